@@ -1,13 +1,19 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
 	"github.com/alex-necsoiu/event-driven/internal/gateway"
+	"github.com/alex-necsoiu/event-driven/pkg/auth"
+	"github.com/alex-necsoiu/event-driven/pkg/lifecycle"
 
 	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
@@ -19,13 +25,74 @@ func main() {
 
 	// Load config (placeholder)
 	cfg := gateway.LoadConfig()
+	lc := lifecycle.New(logger, cfg.ShutdownTimeout)
+
+	// Connect to internal gRPC services
+	userConn, err := grpc.NewClient(cfg.UserGRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Fatal("failed to connect to user service:", err)
+	}
+
+	orderConn, err := grpc.NewClient(cfg.OrderGRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Fatal("failed to connect to order service:", err)
+	}
+
+	paymentConn, err := grpc.NewClient(cfg.PaymentGRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Fatal("failed to connect to payment service:", err)
+	}
+
+	inventoryConn, err := grpc.NewClient(cfg.InventoryGRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Fatal("failed to connect to inventory service:", err)
+	}
+
+	notificationConn, err := grpc.NewClient(cfg.NotificationGRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Fatal("failed to connect to notification service:", err)
+	}
+
+	// Session tokens are signed by the user service with the shared secret
+	tokens, err := auth.NewSigner(cfg.AuthTokenSecret)
+	if err != nil {
+		logger.Fatal("invalid AUTH_TOKEN_SECRET:", err)
+	}
 
 	// Set up HTTP handlers
-	http.HandleFunc("/users", gateway.UserHandler(cfg, logger))
-	// Add more routes as needed
+	handler := gateway.NewHandler(
+		gen.NewUserServiceClient(userConn),
+		gen.NewOrderServiceClient(orderConn),
+		gen.NewPaymentServiceClient(paymentConn),
+		gen.NewInventoryServiceClient(inventoryConn),
+		gen.NewNotificationServiceClient(notificationConn),
+		tokens,
+		cfg.AdminAPIKey,
+		logger,
+	)
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: handler.Routes(),
+	}
+
+	// Shutdown order: drain HTTP requests before dropping upstream connections
+	lc.OnShutdown("http server", lifecycle.HTTPServer(server))
+	lc.OnShutdown("user service connection", lifecycle.Closer(userConn))
+	lc.OnShutdown("order service connection", lifecycle.Closer(orderConn))
+	lc.OnShutdown("payment service connection", lifecycle.Closer(paymentConn))
+	lc.OnShutdown("inventory service connection", lifecycle.Closer(inventoryConn))
+	lc.OnShutdown("notification service connection", lifecycle.Closer(notificationConn))
 
 	logger.Println("Starting REST Gateway on port", cfg.Port)
-	if err := http.ListenAndServe(":"+cfg.Port, nil); err != nil {
-		logger.Fatal("Failed to start server:", err)
+	lc.Go("http server", func() error {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+
+	if err := lc.Wait(); err != nil {
+		logger.Fatal("shutdown with errors:", err)
 	}
+	logger.Println("Gateway stopped")
 }
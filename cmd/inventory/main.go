@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/internal/inventory"
+	"github.com/alex-necsoiu/event-driven/pkg/lifecycle"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/migrate"
+
+	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	_ = godotenv.Load(".env")
+	logger := log.New(os.Stdout, "[inventory] ", log.LstdFlags)
+	cfg := inventory.LoadConfig()
+
+	db, err := sql.Open("postgres", cfg.DBConn)
+	if err != nil {
+		logger.Fatal("failed to open database:", err)
+	}
+
+	migrator, err := migrate.New(db, "inventory", inventory.Migrations(), logger)
+	if err != nil {
+		logger.Fatal("failed to load migrations:", err)
+	}
+
+	// `inventory migrate [up | down [steps] | status]` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.RunCommand(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			logger.Fatal("migration failed:", err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		if err := migrator.Up(context.Background()); err != nil {
+			logger.Fatal("failed to apply migrations:", err)
+		}
+	}
+
+	lc := lifecycle.New(logger, cfg.ShutdownTimeout)
+
+	// Initialize messaging publisher and subscriber
+	publisher, err := messaging.NewPublisher(cfg.EventBusURL)
+	if err != nil {
+		logger.Fatal("failed to create publisher:", err)
+	}
+
+	subscriber, err := messaging.NewSubscriber(cfg.EventBusURL)
+	if err != nil {
+		logger.Fatal("failed to create subscriber:", err)
+	}
+
+	// Initialize repository
+	repo := inventory.NewPostgresRepository(db)
+
+	// Initialize service
+	service := inventory.NewService(repo, publisher, subscriber, cfg.ReservationTTL, logger)
+	if err := service.Start(); err != nil {
+		logger.Fatal("failed to start inventory service:", err)
+	}
+
+	// Release stock held by orders left unpaid past the reservation TTL
+	lc.Go("reservation expiry", func() error {
+		service.RunExpiry(lc.Context(), time.Minute)
+		return nil
+	})
+
+	// Initialize handler
+	handler := inventory.NewInventoryHandler(service, logger)
+
+	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		logger.Fatal("failed to listen:", err)
+	}
+
+	grpcServer := grpc.NewServer()
+	gen.RegisterInventoryServiceServer(grpcServer, handler)
+
+	// Shutdown order: drain requests and events, stop background loops, flush their events, then release connections
+	lc.OnShutdown("grpc server", lifecycle.GRPCServer(grpcServer))
+	lc.OnShutdown("event subscriber drain", subscriber.Drain)
+	lc.OnShutdown("event subscriber", lifecycle.Closer(subscriber))
+	lc.OnShutdown("background tasks", lc.Tasks)
+	lc.OnShutdown("event publisher flush", publisher.Flush)
+	lc.OnShutdown("event publisher", lifecycle.Closer(publisher))
+	lc.OnShutdown("database", lifecycle.Closer(db))
+
+	logger.Println("Inventory gRPC service listening on", cfg.GRPCPort)
+	lc.Go("grpc server", func() error {
+		return grpcServer.Serve(lis)
+	})
+
+	if err := lc.Wait(); err != nil {
+		logger.Fatal("shutdown with errors:", err)
+	}
+	logger.Println("Inventory service stopped")
+}
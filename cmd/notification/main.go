@@ -1,45 +1,142 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
+	"net"
 	"os"
-	"os/signal"
-	"syscall"
+	_ "time/tzdata" // quiet hours may use any IANA time zone, whatever the image ships
 
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
 	"github.com/alex-necsoiu/event-driven/internal/notification"
+	"github.com/alex-necsoiu/event-driven/pkg/lifecycle"
 	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/migrate"
 
 	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
 	_ = godotenv.Load(".env")
 	logger := log.New(os.Stdout, "[notification] ", log.LstdFlags)
+	cfg := notification.LoadConfig()
 
-	// Initialize messaging subscriber
-	subscriber, err := messaging.NewSubscriber(os.Getenv("NATS_URL"))
+	db, err := sql.Open("postgres", cfg.DBConn)
+	if err != nil {
+		logger.Fatal("failed to open database:", err)
+	}
+
+	migrator, err := migrate.New(db, "notification", notification.Migrations(), logger)
+	if err != nil {
+		logger.Fatal("failed to load migrations:", err)
+	}
+
+	// `notification migrate [up | down [steps] | status]` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.RunCommand(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			logger.Fatal("migration failed:", err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		if err := migrator.Up(context.Background()); err != nil {
+			logger.Fatal("failed to apply migrations:", err)
+		}
+	}
+
+	lc := lifecycle.New(logger, cfg.ShutdownTimeout)
+
+	// Initialize messaging publisher and subscriber
+	publisher, err := messaging.NewPublisher(cfg.EventBusURL)
+	if err != nil {
+		logger.Fatal("failed to create publisher:", err)
+	}
+
+	subscriber, err := messaging.NewSubscriber(cfg.EventBusURL)
 	if err != nil {
 		logger.Fatal("failed to create subscriber:", err)
 	}
-	defer subscriber.Close()
+
+	// Connect to the user service for contacts missing from the read model
+	userConn, err := grpc.NewClient(cfg.UserGRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Fatal("failed to connect to user service:", err)
+	}
+
+	// Initialize repository and delivery channels
+	repo := notification.NewPostgresRepository(db)
+	contacts := notification.NewContactDirectory(repo, gen.NewUserServiceClient(userConn), logger)
+
+	channels, err := notification.NewChannels(cfg, repo, logger)
+	if err != nil {
+		logger.Fatal("invalid NOTIFICATION_CHANNELS:", err)
+	}
+	logger.Println("Delivering notifications via", cfg.Channels)
+
+	// Messages are rendered from templates, in each user's language or cfg.Locale
+	renderer := notification.NewRenderer(repo, cfg.Locale, logger)
+
+	// Bursts of these types reach each user as one digest per window
+	digests, err := notification.ParseDigestPolicies(cfg.Digests)
+	if err != nil {
+		logger.Fatal("invalid NOTIFICATION_DIGESTS:", err)
+	}
 
 	// Initialize service
-	service := notification.NewService(subscriber, logger)
+	service := notification.NewService(subscriber, publisher, repo, contacts, renderer, channels, cfg.Retry, digests, cfg.AppURL, logger)
 
 	// Start the service
 	if err := service.Start(); err != nil {
 		logger.Fatal("failed to start service:", err)
 	}
 
-	logger.Println("Notification service started and listening for events")
+	// Retry deliveries that failed on a provider outage until shutdown
+	lc.Go("delivery retries", func() error {
+		service.RunRetries(lc.Context(), cfg.RetryInterval)
+		return nil
+	})
+	logger.Println("Retrying failed deliveries", cfg.Retry)
+
+	// Send the digests of closed windows until shutdown
+	lc.Go("digests", func() error {
+		service.RunDigests(lc.Context(), cfg.DigestInterval)
+		return nil
+	})
+
+	// Initialize handler
+	handler := notification.NewNotificationHandler(service, logger)
+
+	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		logger.Fatal("failed to listen:", err)
+	}
+
+	grpcServer := grpc.NewServer()
+	gen.RegisterNotificationServiceServer(grpcServer, handler)
+
+	// Shutdown order: drain requests and in-flight events, stop background loops, flush their events, then release connections
+	lc.OnShutdown("grpc server", lifecycle.GRPCServer(grpcServer))
+	lc.OnShutdown("event subscriber drain", subscriber.Drain)
+	lc.OnShutdown("notification service", func(context.Context) error {
+		return service.Stop()
+	})
+	lc.OnShutdown("background tasks", lc.Tasks)
+	lc.OnShutdown("event publisher flush", publisher.Flush)
+	lc.OnShutdown("event publisher", lifecycle.Closer(publisher))
+	lc.OnShutdown("user service connection", lifecycle.Closer(userConn))
+	lc.OnShutdown("database", lifecycle.Closer(db))
 
-	// Wait for interrupt signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	logger.Println("Notification gRPC service listening on", cfg.GRPCPort)
+	lc.Go("grpc server", func() error {
+		return grpcServer.Serve(lis)
+	})
 
-	logger.Println("Shutting down notification service...")
-	if err := service.Stop(); err != nil {
-		logger.Printf("Error stopping service: %v", err)
+	if err := lc.Wait(); err != nil {
+		logger.Fatal("shutdown with errors:", err)
 	}
+	logger.Println("Notification service stopped")
 }
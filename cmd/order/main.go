@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
 	"net"
 	"os"
+	"time"
 
 	"github.com/alex-necsoiu/event-driven/api/proto/gen"
 	"github.com/alex-necsoiu/event-driven/internal/order"
+	"github.com/alex-necsoiu/event-driven/internal/saga"
+	"github.com/alex-necsoiu/event-driven/pkg/idempotency"
+	"github.com/alex-necsoiu/event-driven/pkg/lifecycle"
 	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/migrate"
+	"github.com/alex-necsoiu/event-driven/pkg/projection"
 
 	"github.com/joho/godotenv"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
@@ -18,21 +27,144 @@ func main() {
 	logger := log.New(os.Stdout, "[order] ", log.LstdFlags)
 	cfg := order.LoadConfig()
 
+	// Open the connection pool shared by the repository and idempotency store
+	db, err := sql.Open("postgres", cfg.DBConn)
+	if err != nil {
+		logger.Fatal("failed to open database:", err)
+	}
+
+	migrator, err := migrate.New(db, "order", order.Migrations(), logger)
+	if err != nil {
+		logger.Fatal("failed to load migrations:", err)
+	}
+
+	// `order migrate [up | down [steps] | status]` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.RunCommand(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			logger.Fatal("migration failed:", err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		if err := migrator.Up(context.Background()); err != nil {
+			logger.Fatal("failed to apply migrations:", err)
+		}
+	}
+
+	// Read-model projections, fed by the order event log or, without one, the event bus
+	eventStore := order.NewEventStore(db)
+	var projections []*projection.Runner
+	for _, p := range order.Projections() {
+		projections = append(projections, projection.NewRunner(db, p, logger))
+	}
+
+	// `order project [status | rebuild <name | all>]` manages the projections and exits
+	if len(os.Args) > 1 && os.Args[1] == "project" {
+		if len(os.Args) > 2 && os.Args[2] == "rebuild" && cfg.Repository != "eventsourced" {
+			logger.Fatal("rebuilding projections replays the order event log, which needs ORDER_REPOSITORY=eventsourced")
+		}
+		if err := projection.RunCommand(context.Background(), projections, eventStore, os.Args[2:], os.Stdout); err != nil {
+			logger.Fatal("projection command failed:", err)
+		}
+		return
+	}
+
+	lc := lifecycle.New(logger, cfg.ShutdownTimeout)
+
 	// Initialize messaging publisher
-	publisher, err := messaging.NewPublisher(os.Getenv("NATS_URL"))
+	publisher, err := messaging.NewPublisher(cfg.EventBusURL)
 	if err != nil {
 		logger.Fatal("failed to create publisher:", err)
 	}
-	defer publisher.Close()
 
-	// Initialize repository
-	repo, err := order.NewPostgresRepository(os.Getenv("DATABASE_URL"), logger)
+	// Initialize messaging subscriber for the user read model, payment events and fulfillment saga
+	subscriber, err := messaging.NewSubscriber(cfg.EventBusURL)
+	if err != nil {
+		logger.Fatal("failed to create subscriber:", err)
+	}
+
+	// Connect to the user service for users the read model hasn't seen yet
+	userConn, err := grpc.NewClient(cfg.UserGRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		logger.Fatal("failed to create repository:", err)
+		logger.Fatal("failed to connect to user service:", err)
 	}
 
+	// Initialize repository, product catalogue and user read model
+	repo, err := order.NewRepository(cfg.Repository, db, cfg.SnapshotEvery)
+	if err != nil {
+		logger.Fatal("failed to create order repository:", err)
+	}
+	catalogue := order.NewPostgresCatalogue(db)
+	users := order.NewUserDirectory(db, gen.NewUserServiceClient(userConn), subscriber, logger)
+	if err := users.Start(); err != nil {
+		logger.Fatal("failed to start user directory:", err)
+	}
+
+	// Initialize idempotency key store for retry-safe creates
+	idempotencyStore := idempotency.NewPostgresStore(db)
+	lc.Go("idempotency key purge", func() error {
+		idempotencyStore.RunPurging(lc.Context(), time.Hour, logger)
+		return nil
+	})
+
 	// Initialize service
-	service := order.NewService(repo, publisher, logger)
+	service := order.NewService(repo, catalogue, users, publisher, logger)
+
+	// Without the saga, payment outcomes are applied to orders directly
+	payments := order.NewPaymentListener(service, order.NewPostgresAuthorizations(db), subscriber, !cfg.SagaEnabled, logger)
+	if err := payments.Start(); err != nil {
+		logger.Fatal("failed to start payment listener:", err)
+	}
+
+	// Likewise for stock reservation outcomes
+	if !cfg.SagaEnabled {
+		if err := order.NewStockListener(service, payments, subscriber, logger).Start(); err != nil {
+			logger.Fatal("failed to start stock listener:", err)
+		}
+	}
+
+	// Run the fulfillment saga for every new order
+	if cfg.SagaEnabled {
+		sagaEngine := saga.NewEngine(
+			saga.FulfillmentDefinition(service, cfg.SagaStepTimeout),
+			saga.NewPostgresStore(db), publisher, subscriber, logger,
+		)
+		if err := saga.NewFulfillment(sagaEngine, subscriber, logger).Start(); err != nil {
+			logger.Fatal("failed to start fulfillment saga:", err)
+		}
+		lc.Go("saga timeouts", func() error {
+			sagaEngine.RunTimeouts(lc.Context(), 10*time.Second)
+			return nil
+		})
+	}
+
+	if cfg.ProjectionsEnabled {
+		for _, runner := range projections {
+			if cfg.Repository == "eventsourced" {
+				lc.Go("projection tailing", func() error {
+					runner.Tail(lc.Context(), eventStore, 2*time.Second)
+					return nil
+				})
+				continue
+			}
+			if err := runner.Subscribe(subscriber); err != nil {
+				logger.Fatal("failed to start projection:", err)
+			}
+		}
+	}
+
+	// Relay the order event log to the bus for consumers wanting every change
+	if cfg.EventLogRelayEnabled {
+		if cfg.Repository != "eventsourced" {
+			logger.Fatal("relaying the order event log needs ORDER_REPOSITORY=eventsourced")
+		}
+		relay := order.NewEventLogRelay(db, publisher, logger)
+		lc.Go("event log relay", func() error {
+			relay.Run(lc.Context(), 2*time.Second)
+			return nil
+		})
+	}
 
 	// Initialize handler
 	handler := order.NewOrderHandler(service, logger)
@@ -42,11 +174,31 @@ func main() {
 		logger.Fatal("failed to listen:", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(idempotency.UnaryServerInterceptor(
+			idempotencyStore, cfg.IdempotencyTTL, logger,
+			gen.OrderService_CreateOrder_FullMethodName,
+		)),
+	)
 	gen.RegisterOrderServiceServer(grpcServer, handler)
 
+	// Shutdown order: drain requests, stop background loops, flush their events, then release connections
+	lc.OnShutdown("grpc server", lifecycle.GRPCServer(grpcServer))
+	lc.OnShutdown("event subscriber drain", subscriber.Drain)
+	lc.OnShutdown("event subscriber", lifecycle.Closer(subscriber))
+	lc.OnShutdown("background tasks", lc.Tasks)
+	lc.OnShutdown("event publisher flush", publisher.Flush)
+	lc.OnShutdown("event publisher", lifecycle.Closer(publisher))
+	lc.OnShutdown("user service connection", lifecycle.Closer(userConn))
+	lc.OnShutdown("database", lifecycle.Closer(db))
+
 	logger.Println("Order gRPC service listening on", cfg.GRPCPort)
-	if err := grpcServer.Serve(lis); err != nil {
-		logger.Fatal("failed to serve:", err)
+	lc.Go("grpc server", func() error {
+		return grpcServer.Serve(lis)
+	})
+
+	if err := lc.Wait(); err != nil {
+		logger.Fatal("shutdown with errors:", err)
 	}
+	logger.Println("Order service stopped")
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/internal/payment"
+	"github.com/alex-necsoiu/event-driven/pkg/idempotency"
+	"github.com/alex-necsoiu/event-driven/pkg/lifecycle"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/migrate"
+
+	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	_ = godotenv.Load(".env")
+	logger := log.New(os.Stdout, "[payment] ", log.LstdFlags)
+	cfg := payment.LoadConfig()
+
+	// Open the connection pool shared by the repository and idempotency store
+	db, err := sql.Open("postgres", cfg.DBConn)
+	if err != nil {
+		logger.Fatal("failed to open database:", err)
+	}
+
+	migrator, err := migrate.New(db, "payment", payment.Migrations(), logger)
+	if err != nil {
+		logger.Fatal("failed to load migrations:", err)
+	}
+
+	// `payment migrate [up | down [steps] | status]` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.RunCommand(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			logger.Fatal("migration failed:", err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		if err := migrator.Up(context.Background()); err != nil {
+			logger.Fatal("failed to apply migrations:", err)
+		}
+	}
+
+	lc := lifecycle.New(logger, cfg.ShutdownTimeout)
+
+	// Initialize messaging publisher and subscriber
+	publisher, err := messaging.NewPublisher(cfg.EventBusURL)
+	if err != nil {
+		logger.Fatal("failed to create publisher:", err)
+	}
+
+	subscriber, err := messaging.NewSubscriber(cfg.EventBusURL)
+	if err != nil {
+		logger.Fatal("failed to create subscriber:", err)
+	}
+
+	// Initialize payment provider
+	provider, err := payment.NewProvider(cfg.Provider)
+	if err != nil {
+		logger.Fatal("failed to create payment provider:", err)
+	}
+
+	// Initialize repository
+	repo := payment.NewPostgresRepository(db)
+
+	// Initialize idempotency key store for retry-safe refunds
+	idempotencyStore := idempotency.NewPostgresStore(db)
+	lc.Go("idempotency key purge", func() error {
+		idempotencyStore.RunPurging(lc.Context(), time.Hour, logger)
+		return nil
+	})
+
+	// Initialize service
+	service := payment.NewService(repo, provider, publisher, subscriber, logger)
+	if err := service.Start(); err != nil {
+		logger.Fatal("failed to start payment service:", err)
+	}
+
+	// Initialize handler
+	handler := payment.NewPaymentHandler(service, logger)
+
+	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		logger.Fatal("failed to listen:", err)
+	}
+
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(idempotency.UnaryServerInterceptor(
+			idempotencyStore, cfg.IdempotencyTTL, logger,
+			gen.PaymentService_RefundPayment_FullMethodName,
+		)),
+	)
+	gen.RegisterPaymentServiceServer(grpcServer, handler)
+
+	// Shutdown order: drain requests and events, stop background loops, flush their events, then release connections
+	lc.OnShutdown("grpc server", lifecycle.GRPCServer(grpcServer))
+	lc.OnShutdown("event subscriber drain", subscriber.Drain)
+	lc.OnShutdown("event subscriber", lifecycle.Closer(subscriber))
+	lc.OnShutdown("background tasks", lc.Tasks)
+	lc.OnShutdown("event publisher flush", publisher.Flush)
+	lc.OnShutdown("event publisher", lifecycle.Closer(publisher))
+	lc.OnShutdown("database", lifecycle.Closer(db))
+
+	logger.Println("Payment gRPC service listening on", cfg.GRPCPort)
+	lc.Go("grpc server", func() error {
+		return grpcServer.Serve(lis)
+	})
+
+	if err := lc.Wait(); err != nil {
+		logger.Fatal("shutdown with errors:", err)
+	}
+	logger.Println("Payment service stopped")
+}
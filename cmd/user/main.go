@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
 	"net"
 	"os"
+	"time"
 
 	"github.com/alex-necsoiu/event-driven/api/proto/gen"
 	"github.com/alex-necsoiu/event-driven/internal/user"
+	"github.com/alex-necsoiu/event-driven/pkg/auth"
+	"github.com/alex-necsoiu/event-driven/pkg/idempotency"
+	"github.com/alex-necsoiu/event-driven/pkg/lifecycle"
 	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/migrate"
 
 	"github.com/joho/godotenv"
 	"google.golang.org/grpc"
@@ -18,35 +25,94 @@ func main() {
 	logger := log.New(os.Stdout, "[user] ", log.LstdFlags)
 	cfg := user.LoadConfig()
 
+	// Open the connection pool shared by the repository and idempotency store
+	db, err := sql.Open("postgres", cfg.DBConn)
+	if err != nil {
+		logger.Fatal("failed to open database:", err)
+	}
+
+	migrator, err := migrate.New(db, "user", user.Migrations(), logger)
+	if err != nil {
+		logger.Fatal("failed to load migrations:", err)
+	}
+
+	// `user migrate [up | down [steps] | status]` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.RunCommand(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			logger.Fatal("migration failed:", err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		if err := migrator.Up(context.Background()); err != nil {
+			logger.Fatal("failed to apply migrations:", err)
+		}
+	}
+
+	lc := lifecycle.New(logger, cfg.ShutdownTimeout)
+
 	// Initialize messaging publisher
-	publisher, err := messaging.NewPublisher(os.Getenv("NATS_URL"))
+	publisher, err := messaging.NewPublisher(cfg.EventBusURL)
 	if err != nil {
 		logger.Fatal("failed to create publisher:", err)
 	}
-	defer publisher.Close()
 
 	// Initialize repository
-	repo, err := user.NewPostgresRepository(os.Getenv("DATABASE_URL"), logger)
+	repo := user.NewPostgresRepository(db)
+
+	// Initialize idempotency key store for retry-safe creates
+	idempotencyStore := idempotency.NewPostgresStore(db)
+	lc.Go("idempotency key purge", func() error {
+		idempotencyStore.RunPurging(lc.Context(), time.Hour, logger)
+		return nil
+	})
+
+	// Sign session and email verification tokens
+	tokens, err := auth.NewSigner(cfg.AuthTokenSecret)
 	if err != nil {
-		logger.Fatal("failed to create repository:", err)
+		logger.Fatal("invalid AUTH_TOKEN_SECRET:", err)
 	}
 
 	// Initialize service
-	service := user.NewService(repo, publisher, logger)
+	service := user.NewService(repo, publisher, tokens, cfg.EmailVerificationTTL, logger)
+
+	// Initialize authenticator; the repository also stores credentials
+	authenticator, err := user.NewAuthenticator(repo, repo, tokens, cfg.AuthPolicy, publisher, logger)
+	if err != nil {
+		logger.Fatal("failed to create authenticator:", err)
+	}
 
 	// Initialize handler
-	handler := user.NewUserHandler(service, logger)
+	handler := user.NewUserHandler(service, authenticator, logger)
 
 	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
 	if err != nil {
 		logger.Fatal("failed to listen:", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(idempotency.UnaryServerInterceptor(
+			idempotencyStore, cfg.IdempotencyTTL, logger,
+			gen.UserService_CreateUser_FullMethodName,
+		)),
+	)
 	gen.RegisterUserServiceServer(grpcServer, handler)
 
+	// Shutdown order: drain requests, stop background loops, flush their events, then release connections
+	lc.OnShutdown("grpc server", lifecycle.GRPCServer(grpcServer))
+	lc.OnShutdown("background tasks", lc.Tasks)
+	lc.OnShutdown("event publisher flush", publisher.Flush)
+	lc.OnShutdown("event publisher", lifecycle.Closer(publisher))
+	lc.OnShutdown("database", lifecycle.Closer(db))
+
 	logger.Println("User gRPC service listening on", cfg.GRPCPort)
-	if err := grpcServer.Serve(lis); err != nil {
-		logger.Fatal("failed to serve:", err)
+	lc.Go("grpc server", func() error {
+		return grpcServer.Serve(lis)
+	})
+
+	if err := lc.Wait(); err != nil {
+		logger.Fatal("shutdown with errors:", err)
 	}
+	logger.Println("User service stopped")
 }
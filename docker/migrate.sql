@@ -1,12 +1,7 @@
--- Example migration script for local dev
-CREATE TABLE IF NOT EXISTS users (
-    id SERIAL PRIMARY KEY,
-    name TEXT NOT NULL,
-    email TEXT NOT NULL UNIQUE
-);
-
-CREATE TABLE IF NOT EXISTS orders (
-    id SERIAL PRIMARY KEY,
-    user_id INTEGER NOT NULL,
-    amount NUMERIC NOT NULL
-); 
\ No newline at end of file
+-- Bootstraps the databases for local dev. Table schemas are owned by each
+-- service's versioned migrations (internal/<service>/migrations) and applied
+-- on startup or with `<service> migrate up`.
+CREATE DATABASE orders;
+CREATE DATABASE payments;
+CREATE DATABASE inventory;
+CREATE DATABASE notifications;
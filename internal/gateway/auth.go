@@ -0,0 +1,299 @@
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/pkg/auth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AdminKeyHeader carries the admin API key on operator requests
+const AdminKeyHeader = "X-Admin-Key"
+
+// requireUser only lets a request through with a valid session token of the
+// user named by the {id} path value
+func (h *Handler) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := h.session(w, r)
+		if !ok {
+			return
+		}
+
+		if claims.Subject != r.PathValue("id") {
+			writeError(w, http.StatusForbidden, "token does not belong to this user")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireUserOrAdmin lets a request through with the admin API key or a valid
+// session token of the user named by the {id} path value
+func (h *Handler) requireUserOrAdmin(next http.HandlerFunc) http.HandlerFunc {
+	user := h.requireUser(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.isAdmin(r) {
+			next(w, r)
+			return
+		}
+		user(w, r)
+	}
+}
+
+// requireSessionOrAdmin lets a request through with the admin API key or any
+// valid session token, whose claims it stores in the request context
+func (h *Handler) requireSessionOrAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.isAdmin(r) {
+			next(w, r)
+			return
+		}
+
+		claims, ok := h.session(w, r)
+		if !ok {
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, claims)))
+	}
+}
+
+// requireAdmin only lets a request through with the admin API key. Without a
+// configured key every admin endpoint is refused.
+func (h *Handler) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.adminKey == "" {
+			writeError(w, http.StatusForbidden, "admin API is disabled")
+			return
+		}
+		if !h.isAdmin(r) {
+			writeError(w, http.StatusUnauthorized, "missing or invalid admin key")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireOrderOwner lets a request through with the admin API key or a valid
+// session token of the user who placed the order named by the {id} path value
+func (h *Handler) requireOrderOwner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.isAdmin(r) {
+			next(w, r)
+			return
+		}
+
+		claims, ok := h.session(w, r)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		resp, err := h.orders.GetOrder(ctx, &gen.GetOrderRequest{Id: r.PathValue("id")})
+		if err != nil {
+			h.writeGRPCError(w, err)
+			return
+		}
+		if resp.Order.GetUserId() != claims.Subject {
+			writeError(w, http.StatusForbidden, "order does not belong to this user")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, claims)))
+	}
+}
+
+// sessionKey stores the verified session claims in a request context
+type sessionKey struct{}
+
+// sessionFromContext returns the session claims stored by requireOrderOwner
+// and requireSessionOrAdmin. Admin requests have none.
+func sessionFromContext(ctx context.Context) (auth.Claims, bool) {
+	claims, ok := ctx.Value(sessionKey{}).(auth.Claims)
+	return claims, ok
+}
+
+// isAdmin reports whether the request carries the admin API key
+func (h *Handler) isAdmin(r *http.Request) bool {
+	key := r.Header.Get(AdminKeyHeader)
+	return h.adminKey != "" && key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(h.adminKey)) == 1
+}
+
+// session verifies the bearer session token of a request, then asks the user
+// service whether it has been revoked. It writes an error response and
+// returns false unless the session is valid.
+func (h *Handler) session(w http.ResponseWriter, r *http.Request) (auth.Claims, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing bearer token")
+		return auth.Claims{}, false
+	}
+
+	claims, err := h.tokens.Verify(token, auth.PurposeSession)
+	if err != nil {
+		message := "invalid token"
+		if errors.Is(err, auth.ErrExpiredToken) {
+			message = "token has expired"
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, message)
+		return auth.Claims{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	if _, err := h.users.VerifySession(ctx, &gen.VerifySessionRequest{Token: token}); err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "session has been revoked")
+			return auth.Claims{}, false
+		}
+		h.writeGRPCError(w, err)
+		return auth.Claims{}, false
+	}
+	return claims, true
+}
+
+// Login handles POST /auth/login
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.users.Authenticate(ctx, &gen.AuthenticateRequest{Email: body.Email, Password: body.Password})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// ChangePassword handles PUT /users/{id}/password
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	_, err := h.users.ChangePassword(ctx, &gen.ChangePasswordRequest{
+		Id:              r.PathValue("id"),
+		CurrentPassword: body.CurrentPassword,
+		NewPassword:     body.NewPassword,
+	})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequestPasswordReset handles POST /auth/password-reset. It answers 202
+// whether or not the email belongs to an account.
+func (h *Handler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	if _, err := h.users.RequestPasswordReset(ctx, &gen.RequestPasswordResetRequest{Email: body.Email}); err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword handles POST /auth/password-reset/confirm
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	if _, err := h.users.ResetPassword(ctx, &gen.ResetPasswordRequest{Token: body.Token, NewPassword: body.NewPassword}); err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmail handles GET /auth/verify-email?token=, the link sent by email,
+// and POST /auth/verify-email with a JSON token
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		var body struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		token = body.Token
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.users.VerifyEmail(ctx, &gen.VerifyEmailRequest{Token: token})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.User)
+}
+
+// ResendVerificationEmail handles POST /users/{id}/verification-email
+func (h *Handler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	if _, err := h.users.ResendVerificationEmail(ctx, &gen.ResendVerificationEmailRequest{Id: r.PathValue("id")}); err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -2,20 +2,39 @@ package gateway
 
 import (
 	"os"
+	"time"
 )
 
 type Config struct {
 	Port          string
 	UserGRPCAddr  string
 	OrderGRPCAddr string
+	// PaymentGRPCAddr is the payment service address
+	PaymentGRPCAddr string
+	// InventoryGRPCAddr is the inventory service address
+	InventoryGRPCAddr string
+	// NotificationGRPCAddr is the notification service address
+	NotificationGRPCAddr string
+	// ShutdownTimeout bounds how long graceful shutdown may take
+	ShutdownTimeout time.Duration
+	// AuthTokenSecret verifies session tokens issued by the user service
+	AuthTokenSecret string
+	// AdminAPIKey authorizes operator endpoints; they are refused when empty
+	AdminAPIKey string
 }
 
 // LoadConfig loads config from env or defaults
 func LoadConfig() Config {
 	return Config{
-		Port:          getEnv("GATEWAY_PORT", "8080"),
-		UserGRPCAddr:  getEnv("USER_GRPC_ADDR", "localhost:50051"),
-		OrderGRPCAddr: getEnv("ORDER_GRPC_ADDR", "localhost:50052"),
+		Port:                 getEnv("GATEWAY_PORT", "8080"),
+		UserGRPCAddr:         getEnv("USER_GRPC_ADDR", "localhost:50051"),
+		OrderGRPCAddr:        getEnv("ORDER_GRPC_ADDR", "localhost:50052"),
+		PaymentGRPCAddr:      getEnv("PAYMENT_GRPC_ADDR", "localhost:50054"),
+		InventoryGRPCAddr:    getEnv("INVENTORY_GRPC_ADDR", "localhost:50055"),
+		NotificationGRPCAddr: getEnv("NOTIFICATION_GRPC_ADDR", "localhost:50053"),
+		ShutdownTimeout:      getDurationEnv("SHUTDOWN_TIMEOUT", 30*time.Second),
+		AuthTokenSecret:      getEnv("AUTH_TOKEN_SECRET", ""),
+		AdminAPIKey:          getEnv("ADMIN_API_KEY", ""),
 	}
 }
 
@@ -25,3 +44,12 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
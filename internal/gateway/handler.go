@@ -1,16 +1,696 @@
 package gateway
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/pkg/auth"
+	"github.com/alex-necsoiu/event-driven/pkg/idempotency"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+	"github.com/alex-necsoiu/event-driven/pkg/validation"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// requestTimeout bounds each forwarded gRPC call
+	requestTimeout = 10 * time.Second
+	// defaultCurrency applies to prices and refunds that don't specify one
+	defaultCurrency = "USD"
 )
 
-// UserHandler handles /users REST endpoint and forwards to User gRPC service
-func UserHandler(cfg Config, logger *log.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Connect to UserService gRPC and forward request
-		logger.Println("Received request at /users (placeholder)")
-		w.WriteHeader(http.StatusNotImplemented)
-		w.Write([]byte(`{"message": "Not implemented"}`))
+// Handler exposes the REST API and forwards requests to the gRPC services
+type Handler struct {
+	users         gen.UserServiceClient
+	orders        gen.OrderServiceClient
+	payments      gen.PaymentServiceClient
+	inventory     gen.InventoryServiceClient
+	notifications gen.NotificationServiceClient
+	tokens        *auth.Signer
+	adminKey      string
+	logger        *log.Logger
+}
+
+// NewHandler creates a new gateway handler
+func NewHandler(users gen.UserServiceClient, orders gen.OrderServiceClient, payments gen.PaymentServiceClient, inventory gen.InventoryServiceClient, notifications gen.NotificationServiceClient, tokens *auth.Signer, adminKey string, logger *log.Logger) *Handler {
+	return &Handler{users: users, orders: orders, payments: payments, inventory: inventory, notifications: notifications, tokens: tokens, adminKey: adminKey, logger: logger}
+}
+
+// Routes registers all REST endpoints on a new mux
+func (h *Handler) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /users", h.CreateUser)
+	mux.HandleFunc("GET /users", h.requireAdmin(h.ListUsers))
+	mux.HandleFunc("GET /users/{id}", h.requireUserOrAdmin(h.GetUser))
+	mux.HandleFunc("PATCH /users/{id}", h.requireUser(h.UpdateUser))
+	mux.HandleFunc("DELETE /users/{id}", h.requireUser(h.DeleteUser))
+	mux.HandleFunc("PUT /users/{id}/password", h.requireUser(h.ChangePassword))
+	mux.HandleFunc("POST /users/{id}/verification-email", h.requireUser(h.ResendVerificationEmail))
+	mux.HandleFunc("GET /users/{id}/notifications", h.requireUser(h.ListNotifications))
+	mux.HandleFunc("POST /users/{id}/notifications/read", h.requireUser(h.MarkNotificationsRead))
+	mux.HandleFunc("GET /users/{id}/deliveries", h.requireUser(h.ListDeliveries))
+	mux.HandleFunc("GET /users/{id}/deliveries/{deliveryId}", h.requireUser(h.GetDelivery))
+	mux.HandleFunc("GET /users/{id}/notification-preferences", h.requireUser(h.GetNotificationPreferences))
+	mux.HandleFunc("PATCH /users/{id}/notification-preferences", h.requireUser(h.UpdateNotificationPreferences))
+	mux.HandleFunc("GET /notifications/unsubscribe", h.Unsubscribe)
+	mux.HandleFunc("POST /notifications/unsubscribe", h.Unsubscribe)
+	mux.HandleFunc("GET /notification-templates", h.ListNotificationTemplates)
+	mux.HandleFunc("PUT /notification-templates/{type}/{locale}", h.requireAdmin(h.SaveNotificationTemplate))
+	mux.HandleFunc("DELETE /notification-templates/{type}/{locale}", h.requireAdmin(h.DeleteNotificationTemplate))
+	mux.HandleFunc("POST /notification-templates/{type}/{locale}/preview", h.requireAdmin(h.PreviewNotificationTemplate))
+	mux.HandleFunc("GET /auth/verify-email", h.VerifyEmail)
+	mux.HandleFunc("POST /auth/verify-email", h.VerifyEmail)
+	mux.HandleFunc("POST /auth/login", h.Login)
+	mux.HandleFunc("POST /auth/password-reset", h.RequestPasswordReset)
+	mux.HandleFunc("POST /auth/password-reset/confirm", h.ResetPassword)
+	mux.HandleFunc("POST /orders", h.requireSessionOrAdmin(h.CreateOrder))
+	mux.HandleFunc("GET /orders", h.requireSessionOrAdmin(h.ListOrders))
+	mux.HandleFunc("GET /orders/{id}", h.requireOrderOwner(h.GetOrder))
+	mux.HandleFunc("POST /orders/{id}/status", h.requireAdmin(h.UpdateOrderStatus))
+	mux.HandleFunc("POST /orders/{id}/cancel", h.requireOrderOwner(h.CancelOrder))
+	mux.HandleFunc("POST /orders/{id}/complete", h.requireAdmin(h.CompleteOrder))
+	mux.HandleFunc("GET /orders/{id}/payment", h.requireOrderOwner(h.GetPayment))
+	mux.HandleFunc("POST /orders/{id}/refund", h.requireAdmin(h.RefundPayment))
+	mux.HandleFunc("GET /orders/{id}/reservation", h.requireOrderOwner(h.GetReservation))
+	mux.HandleFunc("GET /products", h.ListProducts)
+	mux.HandleFunc("PUT /products/{sku}", h.requireAdmin(h.UpsertProduct))
+	mux.HandleFunc("GET /stock/{sku}", h.GetStock)
+	mux.HandleFunc("PUT /stock/{sku}", h.requireAdmin(h.SetStock))
+	return mux
+}
+
+// CreateUser handles POST /users
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel, ok := h.idempotentContext(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	var header metadata.MD
+	resp, err := h.users.CreateUser(ctx, &gen.CreateUserRequest{Name: body.Name, Email: body.Email, Password: body.Password}, grpc.Header(&header))
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	markReplayed(w, header)
+	writeProto(w, http.StatusCreated, resp.User)
+}
+
+// GetUser handles GET /users/{id}
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.users.GetUser(ctx, &gen.GetUserRequest{Id: r.PathValue("id")})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.User)
+}
+
+// UpdateUser handles PATCH /users/{id}; omitted fields are left unchanged
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name  *string `json:"name"`
+		Email *string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.users.UpdateUser(ctx, &gen.UpdateUserRequest{
+		Id:    r.PathValue("id"),
+		Name:  body.Name,
+		Email: body.Email,
+	})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.User)
+}
+
+// DeleteUser handles DELETE /users/{id}
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.users.DeleteUser(ctx, &gen.DeleteUserRequest{Id: r.PathValue("id")})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.User)
+}
+
+// ListUsers handles GET /users?page_size=&page_token=&include_deleted=
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := &gen.ListUsersRequest{
+		PageToken:      q.Get("page_token"),
+		IncludeDeleted: q.Get("include_deleted") == "true",
+	}
+	if v := q.Get("page_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "page_size must be an integer")
+			return
+		}
+		req.PageSize = int32(size)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.users.ListUsers(ctx, req)
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// CreateOrder handles POST /orders. Customers order for themselves; only
+// operators name the user in the body.
+func (h *Handler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		UserID string `json:"user_id"`
+		Items  []struct {
+			SKU      string `json:"sku"`
+			Quantity int64  `json:"quantity"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if claims, ok := sessionFromContext(r.Context()); ok {
+		if body.UserID != "" && body.UserID != claims.Subject {
+			writeError(w, http.StatusForbidden, "token does not belong to this user")
+			return
+		}
+		body.UserID = claims.Subject
+	}
+
+	// Prices come from the catalogue; clients only choose products and quantities
+	req := &gen.CreateOrderRequest{UserId: body.UserID}
+	for _, item := range body.Items {
+		req.Items = append(req.Items, &gen.OrderItemRequest{Sku: item.SKU, Quantity: item.Quantity})
+	}
+
+	ctx, cancel, ok := h.idempotentContext(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	var header metadata.MD
+	resp, err := h.orders.CreateOrder(ctx, req, grpc.Header(&header))
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	markReplayed(w, header)
+	writeProto(w, http.StatusCreated, resp.Order)
+}
+
+// GetOrder handles GET /orders/{id}
+func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.orders.GetOrder(ctx, &gen.GetOrderRequest{Id: r.PathValue("id")})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Order)
+}
+
+// ListOrders handles GET /orders?user_id=&status=&created_after=&created_before=&page_size=&page_token=.
+// Customers only see their own orders; operators may list anyone's.
+func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	userID := q.Get("user_id")
+	if claims, ok := sessionFromContext(r.Context()); ok {
+		if userID != "" && userID != claims.Subject {
+			writeError(w, http.StatusForbidden, "token does not belong to this user")
+			return
+		}
+		userID = claims.Subject
+	}
+
+	req := &gen.ListOrdersRequest{
+		UserId:        userID,
+		Status:        q.Get("status"),
+		CreatedAfter:  q.Get("created_after"),
+		CreatedBefore: q.Get("created_before"),
+		PageToken:     q.Get("page_token"),
+	}
+	if v := q.Get("page_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "page_size must be an integer")
+			return
+		}
+		req.PageSize = int32(size)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.orders.ListOrders(ctx, req)
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// UpdateOrderStatus handles POST /orders/{id}/status
+func (h *Handler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Status string `json:"status"`
+		Actor  string `json:"actor"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.orders.UpdateOrderStatus(ctx, &gen.UpdateOrderStatusRequest{
+		Id:     r.PathValue("id"),
+		Status: body.Status,
+		Actor:  body.Actor,
+		Reason: body.Reason,
+	})
+	h.writeOrderResponse(w, resp, err)
+}
+
+// CancelOrder handles POST /orders/{id}/cancel
+func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Actor  string `json:"actor"`
+		Reason string `json:"reason"`
+	}
+	if err := decodeOptionalBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	// Customers cancel under their own name; only operators choose the actor
+	if claims, ok := sessionFromContext(r.Context()); ok {
+		body.Actor = "user:" + claims.Subject
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.orders.CancelOrder(ctx, &gen.CancelOrderRequest{
+		Id:     r.PathValue("id"),
+		Actor:  body.Actor,
+		Reason: body.Reason,
+	})
+	h.writeOrderResponse(w, resp, err)
+}
+
+// CompleteOrder handles POST /orders/{id}/complete
+func (h *Handler) CompleteOrder(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Actor string `json:"actor"`
+	}
+	if err := decodeOptionalBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.orders.CompleteOrder(ctx, &gen.CompleteOrderRequest{
+		Id:    r.PathValue("id"),
+		Actor: body.Actor,
+	})
+	h.writeOrderResponse(w, resp, err)
+}
+
+// GetPayment handles GET /orders/{id}/payment
+func (h *Handler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.payments.GetPayment(ctx, &gen.GetPaymentRequest{OrderId: r.PathValue("id")})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+	if resp.Error != "" {
+		writeError(w, http.StatusNotFound, resp.Error)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Payment)
+}
+
+// RefundPayment handles POST /orders/{id}/refund
+func (h *Handler) RefundPayment(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Amount   json.Number `json:"amount"` // decimal; omit to refund everything left
+		Currency string      `json:"currency"`
+		Reason   string      `json:"reason"`
+	}
+	if err := decodeOptionalBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	req := &gen.RefundPaymentRequest{OrderId: r.PathValue("id"), Reason: body.Reason}
+	if body.Amount != "" {
+		if body.Currency == "" {
+			body.Currency = defaultCurrency
+		}
+		amount, err := money.Parse(body.Amount.String(), body.Currency)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Amount = &gen.Money{Amount: amount.Amount, Currency: amount.Currency}
+	}
+
+	ctx, cancel, ok := h.idempotentContext(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	var header metadata.MD
+	resp, err := h.payments.RefundPayment(ctx, req, grpc.Header(&header))
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+	if resp.Error != "" {
+		writeError(w, http.StatusUnprocessableEntity, resp.Error)
+		return
+	}
+
+	markReplayed(w, header)
+	writeProto(w, http.StatusOK, resp.Payment)
+}
+
+// GetReservation handles GET /orders/{id}/reservation
+func (h *Handler) GetReservation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.inventory.GetReservation(ctx, &gen.GetReservationRequest{OrderId: r.PathValue("id")})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+	if resp.Error != "" {
+		writeError(w, http.StatusNotFound, resp.Error)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Reservation)
+}
+
+// ListProducts handles GET /products?include_inactive=
+func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	includeInactive, _ := strconv.ParseBool(r.URL.Query().Get("include_inactive"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.orders.ListProducts(ctx, &gen.ListProductsRequest{IncludeInactive: includeInactive})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// UpsertProduct handles PUT /products/{sku}
+func (h *Handler) UpsertProduct(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name       string      `json:"name"`
+		UnitPrice  json.Number `json:"unit_price"` // decimal, e.g. 49.99 or "49.99"
+		Currency   string      `json:"currency"`
+		TaxRateBps int64       `json:"tax_rate_bps"`
+		Active     *bool       `json:"active"` // defaults to true
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if body.Currency == "" {
+		body.Currency = defaultCurrency
+	}
+
+	// Parse the decimal text directly so the price never passes through float64
+	price, err := money.Parse(body.UnitPrice.String(), body.Currency)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	active := body.Active == nil || *body.Active
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.orders.UpsertProduct(ctx, &gen.UpsertProductRequest{Product: &gen.Product{
+		Sku:        r.PathValue("sku"),
+		Name:       body.Name,
+		UnitPrice:  &gen.Money{Amount: price.Amount, Currency: price.Currency},
+		TaxRateBps: body.TaxRateBps,
+		Active:     active,
+	}})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Product)
+}
+
+// GetStock handles GET /stock/{sku}
+func (h *Handler) GetStock(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.inventory.GetStock(ctx, &gen.GetStockRequest{Sku: r.PathValue("sku")})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+	if resp.Error != "" {
+		writeError(w, http.StatusNotFound, resp.Error)
+		return
 	}
+
+	writeProto(w, http.StatusOK, resp.Stock)
+}
+
+// SetStock handles PUT /stock/{sku}
+func (h *Handler) SetStock(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		OnHand int64 `json:"on_hand"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.inventory.SetStock(ctx, &gen.SetStockRequest{Sku: r.PathValue("sku"), OnHand: body.OnHand})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+	if resp.Error != "" {
+		writeError(w, http.StatusUnprocessableEntity, resp.Error)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Stock)
+}
+
+// writeOrderResponse writes the result of an order status change
+func (h *Handler) writeOrderResponse(w http.ResponseWriter, resp *gen.OrderResponse, err error) {
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Order)
+}
+
+// decodeOptionalBody decodes a JSON body, treating an empty body as valid
+func decodeOptionalBody(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// idempotentContext forwards the Idempotency-Key header, if present, as gRPC
+// metadata scoped to the caller
+func (h *Handler) idempotentContext(w http.ResponseWriter, r *http.Request) (context.Context, context.CancelFunc, bool) {
+	key := r.Header.Get(idempotency.HeaderKey)
+	if len(key) > idempotency.MaxKeyLength {
+		writeError(w, http.StatusBadRequest, idempotency.HeaderKey+" header is too long")
+		return nil, nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	return idempotency.NewOutgoingContext(ctx, key, h.callerScope(r)), cancel, true
+}
+
+// callerScope identifies who sent a request for idempotency keys: the user of
+// a valid session token, or else the client's address
+func (h *Handler) callerScope(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if claims, err := h.tokens.Verify(token, auth.PurposeSession); err == nil {
+			return "user:" + claims.Subject
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "client:" + host
+}
+
+// markReplayed tells the client the response was served from the idempotency cache
+func markReplayed(w http.ResponseWriter, header metadata.MD) {
+	if values := header.Get(idempotency.ReplayedMetadataKey); len(values) > 0 && values[0] == "true" {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+}
+
+// writeGRPCError maps a gRPC status to the closest HTTP status
+func (h *Handler) writeGRPCError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	h.logger.Printf("gRPC call failed: %s: %s", st.Code(), st.Message())
+
+	// Tell clients when a transient failure is worth retrying
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			seconds := int(math.Ceil(info.RetryDelay.AsDuration().Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		}
+	}
+
+	code := http.StatusInternalServerError
+	switch st.Code() {
+	case codes.InvalidArgument:
+		if violations := validation.FieldViolations(err); len(violations) > 0 {
+			writeFieldErrors(w, st.Message(), violations)
+			return
+		}
+		code = http.StatusBadRequest
+	case codes.Unauthenticated:
+		code = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		code = http.StatusForbidden
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		code = http.StatusConflict
+	case codes.FailedPrecondition:
+		code = http.StatusUnprocessableEntity
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	}
+	writeError(w, code, st.Message())
+}
+
+func writeProto(w http.ResponseWriter, code int, msg proto.Message) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// fieldError is one invalid field of a rejected request
+type fieldError struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// writeFieldErrors writes a 400 listing the request's invalid fields
+func writeFieldErrors(w http.ResponseWriter, message string, violations []*errdetails.BadRequest_FieldViolation) {
+	body := struct {
+		Error       string       `json:"error"`
+		FieldErrors []fieldError `json:"field_errors"`
+	}{Error: message}
+	for _, v := range violations {
+		body.FieldErrors = append(body.FieldErrors, fieldError{Field: v.Field, Description: v.Description})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(body)
 }
@@ -0,0 +1,279 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+)
+
+// ListNotifications handles GET /users/{id}/notifications?unread_only=&page_size=&page_token=
+func (h *Handler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := &gen.ListInboxRequest{
+		UserId:     r.PathValue("id"),
+		UnreadOnly: q.Get("unread_only") == "true",
+		PageToken:  q.Get("page_token"),
+	}
+	if v := q.Get("page_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "page_size must be an integer")
+			return
+		}
+		req.PageSize = int32(size)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.ListInbox(ctx, req)
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// MarkNotificationsRead handles POST /users/{id}/notifications/read; without
+// "ids" every notification is marked as read
+func (h *Handler) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if err := decodeOptionalBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.MarkInboxRead(ctx, &gen.MarkInboxReadRequest{UserId: r.PathValue("id"), Ids: body.IDs})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// GetNotificationPreferences handles GET /users/{id}/notification-preferences
+func (h *Handler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.GetPreferences(ctx, &gen.GetPreferencesRequest{UserId: r.PathValue("id")})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Preferences)
+}
+
+// UpdateNotificationPreferences handles PATCH /users/{id}/notification-preferences.
+// "channels" maps notification types to the channels they should go out on.
+func (h *Handler) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Locale     *string             `json:"locale"`
+		Channels   map[string][]string `json:"channels"`
+		QuietHours *struct {
+			Start    string `json:"start"`
+			End      string `json:"end"`
+			TimeZone string `json:"time_zone"`
+		} `json:"quiet_hours"`
+		Unsubscribed *bool `json:"unsubscribed"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	req := &gen.UpdatePreferencesRequest{
+		UserId:       r.PathValue("id"),
+		Locale:       body.Locale,
+		Unsubscribed: body.Unsubscribed,
+	}
+	for notificationType, channels := range body.Channels {
+		req.Channels = append(req.Channels, &gen.ChannelPreference{Type: notificationType, Channels: channels})
+	}
+	if q := body.QuietHours; q != nil {
+		req.QuietHours = &gen.QuietHours{Start: q.Start, End: q.End, TimeZone: q.TimeZone}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.UpdatePreferences(ctx, req)
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Preferences)
+}
+
+// Unsubscribe handles GET and POST /notifications/unsubscribe?token=, the
+// link in non-transactional notifications. Mail clients POST to it for
+// one-click unsubscribe (RFC 8058).
+func (h *Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.Unsubscribe(ctx, &gen.UnsubscribeRequest{Token: r.URL.Query().Get("token")})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// ListNotificationTemplates handles GET /notification-templates?type=&locale=
+func (h *Handler) ListNotificationTemplates(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.ListTemplates(ctx, &gen.ListTemplatesRequest{Type: q.Get("type"), Locale: q.Get("locale")})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// SaveNotificationTemplate handles PUT /notification-templates/{type}/{locale}
+func (h *Handler) SaveNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Subject string `json:"subject"`
+		Text    string `json:"text"`
+		HTML    string `json:"html"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.SaveTemplate(ctx, &gen.SaveTemplateRequest{
+		Type:    r.PathValue("type"),
+		Locale:  r.PathValue("locale"),
+		Subject: body.Subject,
+		Text:    body.Text,
+		Html:    body.HTML,
+	})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Template)
+}
+
+// DeleteNotificationTemplate handles DELETE /notification-templates/{type}/{locale}
+func (h *Handler) DeleteNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	_, err := h.notifications.DeleteTemplate(ctx, &gen.DeleteTemplateRequest{
+		Type:   r.PathValue("type"),
+		Locale: r.PathValue("locale"),
+	})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewNotificationTemplate handles POST /notification-templates/{type}/{locale}/preview.
+// Without a body the stored template is rendered; a body with "subject" and
+// "text" is rendered as a draft. "data" overrides sample values.
+func (h *Handler) PreviewNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Subject string            `json:"subject"`
+		Text    string            `json:"text"`
+		HTML    string            `json:"html"`
+		Data    map[string]string `json:"data"`
+	}
+	if err := decodeOptionalBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.PreviewTemplate(ctx, &gen.PreviewTemplateRequest{
+		Type:    r.PathValue("type"),
+		Locale:  r.PathValue("locale"),
+		Subject: body.Subject,
+		Text:    body.Text,
+		Html:    body.HTML,
+		Data:    body.Data,
+	})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// ListDeliveries handles GET /users/{id}/deliveries?type=&channel=&status=&page_size=&page_token=
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := &gen.ListDeliveriesRequest{
+		UserId:    r.PathValue("id"),
+		Type:      q.Get("type"),
+		Channel:   q.Get("channel"),
+		Status:    q.Get("status"),
+		PageToken: q.Get("page_token"),
+	}
+	if v := q.Get("page_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "page_size must be an integer")
+			return
+		}
+		req.PageSize = int32(size)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.ListDeliveries(ctx, req)
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp)
+}
+
+// GetDelivery handles GET /users/{id}/deliveries/{deliveryId}
+func (h *Handler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	resp, err := h.notifications.GetDelivery(ctx, &gen.GetDeliveryRequest{
+		UserId: r.PathValue("id"),
+		Id:     r.PathValue("deliveryId"),
+	})
+	if err != nil {
+		h.writeGRPCError(w, err)
+		return
+	}
+
+	writeProto(w, http.StatusOK, resp.Delivery)
+}
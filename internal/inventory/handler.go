@@ -0,0 +1,105 @@
+package inventory
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+)
+
+// InventoryHandler implements the gRPC InventoryServiceServer
+type InventoryHandler struct {
+	gen.UnimplementedInventoryServiceServer
+	service *Service
+	logger  *log.Logger
+}
+
+func NewInventoryHandler(service *Service, logger *log.Logger) *InventoryHandler {
+	return &InventoryHandler{service: service, logger: logger}
+}
+
+// SetStock handles setting the on-hand quantity of a SKU
+func (h *InventoryHandler) SetStock(ctx context.Context, req *gen.SetStockRequest) (*gen.StockResponse, error) {
+	h.logger.Printf("SetStock called for SKU: %s", req.Sku)
+
+	stock, err := h.service.SetStock(req.Sku, req.OnHand)
+	return h.stockResponse("set stock", stock, err)
+}
+
+// GetStock handles fetching the stock level of a SKU
+func (h *InventoryHandler) GetStock(ctx context.Context, req *gen.GetStockRequest) (*gen.StockResponse, error) {
+	h.logger.Printf("GetStock called for SKU: %s", req.Sku)
+
+	stock, err := h.service.GetStock(req.Sku)
+	return h.stockResponse("get stock", stock, err)
+}
+
+// GetReservation handles fetching the stock reservation of an order
+func (h *InventoryHandler) GetReservation(ctx context.Context, req *gen.GetReservationRequest) (*gen.ReservationResponse, error) {
+	h.logger.Printf("GetReservation called for order: %s", req.OrderId)
+
+	reservation, err := h.service.GetReservation(req.OrderId)
+	if err != nil {
+		h.logger.Printf("Failed to get reservation: %v", err)
+		return &gen.ReservationResponse{
+			Reservation: nil,
+			Error:       err.Error(),
+		}, nil
+	}
+
+	return &gen.ReservationResponse{
+		Reservation: toProtoReservation(reservation),
+		Error:       "",
+	}, nil
+}
+
+// stockResponse wraps the result of a stock call in a StockResponse
+func (h *InventoryHandler) stockResponse(action string, stock Stock, err error) (*gen.StockResponse, error) {
+	if err != nil {
+		h.logger.Printf("Failed to %s: %v", action, err)
+		return &gen.StockResponse{
+			Stock: nil,
+			Error: err.Error(),
+		}, nil
+	}
+
+	return &gen.StockResponse{
+		Stock: toProtoStock(stock),
+		Error: "",
+	}, nil
+}
+
+func toProtoStock(s Stock) *gen.Stock {
+	return &gen.Stock{
+		Sku:       s.SKU,
+		OnHand:    s.OnHand,
+		Reserved:  s.Reserved,
+		Available: s.Available(),
+		UpdatedAt: formatTime(s.UpdatedAt),
+	}
+}
+
+func toProtoReservation(r Reservation) *gen.Reservation {
+	items := make([]*gen.ReservationItem, len(r.Items))
+	for i, item := range r.Items {
+		items[i] = &gen.ReservationItem{Sku: item.SKU, Quantity: item.Quantity}
+	}
+
+	return &gen.Reservation{
+		Id:            r.ID,
+		OrderId:       r.OrderID,
+		Status:        string(r.Status),
+		Items:         items,
+		FailureReason: r.FailureReason,
+		ExpiresAt:     formatTime(r.ExpiresAt),
+		CreatedAt:     formatTime(r.CreatedAt),
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
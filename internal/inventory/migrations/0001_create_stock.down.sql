@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reservation_items;
+DROP TABLE IF EXISTS reservations;
+DROP TABLE IF EXISTS stock;
@@ -0,0 +1,392 @@
+package inventory
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Status is where a stock reservation is in its lifecycle
+type Status string
+
+const (
+	StatusReserved     Status = "reserved"
+	StatusInsufficient Status = "insufficient"
+	StatusReleased     Status = "released"
+	StatusExpired      Status = "expired"
+	StatusCommitted    Status = "committed"
+)
+
+var (
+	// ErrNotFound is returned for unknown SKUs and orders without a reservation
+	ErrNotFound = errors.New("not found")
+	// ErrBelowReserved is returned when setting on-hand stock below what is reserved
+	ErrBelowReserved = errors.New("on-hand stock cannot be lower than reserved stock")
+)
+
+// Repository abstracts DB operations for stock and reservations
+type Repository interface {
+	SetStock(sku string, onHand int64) (Stock, error)
+	GetStock(sku string) (Stock, error)
+	// Reserve holds stock for every item of an order, or none of them. It returns
+	// false with the existing reservation if the order was already handled.
+	Reserve(orderID, sagaID string, items []Item, expiresAt time.Time) (Reservation, bool, error)
+	GetReservation(orderID string) (Reservation, error)
+	// AttachSaga records the saga awaiting the reservation outcome
+	AttachSaga(orderID, sagaID string) (Reservation, error)
+	// Confirm keeps a reservation until shipment by clearing its expiry
+	Confirm(orderID string) (Reservation, error)
+	// Release returns held stock; it reports false if the reservation was not held
+	Release(orderID string) (Reservation, bool, error)
+	// Expire releases a reservation whose expiry has passed
+	Expire(orderID string) (Reservation, bool, error)
+	// Commit removes held stock from the warehouse once the order shipped
+	Commit(orderID string) (Reservation, bool, error)
+	// Expired returns the orders whose held reservations have expired
+	Expired(now time.Time, limit int) ([]string, error)
+}
+
+// Item is a quantity of one SKU
+type Item struct {
+	SKU      string
+	Quantity int64
+}
+
+// Stock is the stock level of one SKU
+type Stock struct {
+	SKU       string
+	OnHand    int64
+	Reserved  int64
+	UpdatedAt time.Time
+}
+
+// Available is the stock that can still be reserved
+func (s Stock) Available() int64 {
+	return s.OnHand - s.Reserved
+}
+
+// Reservation is the stock held for one order
+type Reservation struct {
+	ID            string
+	OrderID       string
+	Status        Status
+	Items         []Item
+	SagaID        string // fulfillment saga awaiting the outcome, if any
+	FailureReason string
+	ExpiresAt     time.Time // zero once confirmed or no longer held
+	CreatedAt     time.Time
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository.
+// The schema is managed by the versioned migrations in Migrations().
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const reservationColumns = "id::text, order_id, status, saga_id, failure_reason, expires_at, created_at"
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// SetStock sets the on-hand quantity of a SKU, creating it if needed
+func (r *PostgresRepository) SetStock(sku string, onHand int64) (Stock, error) {
+	var s Stock
+	err := r.db.QueryRow(`
+		INSERT INTO stock (sku, on_hand) VALUES ($1, $2)
+		ON CONFLICT (sku) DO UPDATE
+		SET on_hand = EXCLUDED.on_hand, updated_at = now()
+		WHERE stock.reserved <= EXCLUDED.on_hand
+		RETURNING sku, on_hand, reserved, updated_at`,
+		sku, onHand,
+	).Scan(&s.SKU, &s.OnHand, &s.Reserved, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Stock{}, fmt.Errorf("%w: %s", ErrBelowReserved, sku)
+	}
+	return s, err
+}
+
+// GetStock retrieves the stock level of a SKU
+func (r *PostgresRepository) GetStock(sku string) (Stock, error) {
+	var s Stock
+	err := r.db.QueryRow(
+		"SELECT sku, on_hand, reserved, updated_at FROM stock WHERE sku = $1",
+		sku,
+	).Scan(&s.SKU, &s.OnHand, &s.Reserved, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Stock{}, fmt.Errorf("%w: sku %s", ErrNotFound, sku)
+	}
+	return s, err
+}
+
+// Reserve claims the order, then holds each SKU with a conditional UPDATE. The
+// row lock taken by the UPDATE makes the availability check and the increment
+// atomic, so two orders can never both take the last unit. SKUs are locked in
+// sorted order to avoid deadlocks between overlapping orders.
+func (r *PostgresRepository) Reserve(orderID, sagaID string, items []Item, expiresAt time.Time) (Reservation, bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Reservation{}, false, err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(`
+		INSERT INTO reservations (order_id, status, saga_id, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (order_id) DO NOTHING
+		RETURNING id::text`,
+		orderID, StatusReserved, sagaID, expiresAt,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		existing, err := r.GetReservation(orderID)
+		return existing, false, err
+	}
+	if err != nil {
+		return Reservation{}, false, err
+	}
+
+	items = mergeItems(items)
+	for _, item := range items {
+		if _, err := tx.Exec(
+			"INSERT INTO reservation_items (reservation_id, sku, quantity) VALUES ($1, $2, $3)",
+			id, item.SKU, item.Quantity,
+		); err != nil {
+			return Reservation{}, false, err
+		}
+	}
+
+	if _, err := tx.Exec("SAVEPOINT hold"); err != nil {
+		return Reservation{}, false, err
+	}
+
+	var short []string
+	for _, item := range items {
+		res, err := tx.Exec(
+			"UPDATE stock SET reserved = reserved + $2, updated_at = now() WHERE sku = $1 AND on_hand - reserved >= $2",
+			item.SKU, item.Quantity,
+		)
+		if err != nil {
+			return Reservation{}, false, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return Reservation{}, false, err
+		} else if n == 0 {
+			short = append(short, item.SKU)
+		}
+	}
+
+	if len(short) > 0 {
+		// Undo the holds that did succeed; the reservation records the shortage
+		if _, err := tx.Exec("ROLLBACK TO SAVEPOINT hold"); err != nil {
+			return Reservation{}, false, err
+		}
+		if _, err := tx.Exec(
+			"UPDATE reservations SET status = $2, failure_reason = $3, expires_at = NULL, updated_at = now() WHERE id = $1",
+			id, StatusInsufficient, "insufficient stock for "+strings.Join(short, ", "),
+		); err != nil {
+			return Reservation{}, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Reservation{}, false, err
+	}
+
+	reservation, err := r.GetReservation(orderID)
+	return reservation, true, err
+}
+
+// GetReservation retrieves the reservation of an order with its items
+func (r *PostgresRepository) GetReservation(orderID string) (Reservation, error) {
+	return r.queryReservation("SELECT "+reservationColumns+" FROM reservations WHERE order_id = $1", orderID)
+}
+
+// AttachSaga sets the saga waiting on the reservation
+func (r *PostgresRepository) AttachSaga(orderID, sagaID string) (Reservation, error) {
+	return r.queryReservation(
+		"UPDATE reservations SET saga_id = $2, updated_at = now() WHERE order_id = $1 RETURNING "+reservationColumns,
+		orderID, sagaID,
+	)
+}
+
+// Confirm clears the expiry of a held reservation
+func (r *PostgresRepository) Confirm(orderID string) (Reservation, error) {
+	if _, err := r.db.Exec(
+		"UPDATE reservations SET expires_at = NULL, updated_at = now() WHERE order_id = $1 AND status = $2",
+		orderID, StatusReserved,
+	); err != nil {
+		return Reservation{}, err
+	}
+	return r.GetReservation(orderID)
+}
+
+// Release returns the held stock of an order
+func (r *PostgresRepository) Release(orderID string) (Reservation, bool, error) {
+	return r.settle(orderID, StatusReleased, "",
+		"reserved = stock.reserved - i.quantity")
+}
+
+// Expire returns the held stock of an order whose reservation expired
+func (r *PostgresRepository) Expire(orderID string) (Reservation, bool, error) {
+	return r.settle(orderID, StatusExpired, "AND expires_at < now()",
+		"reserved = stock.reserved - i.quantity")
+}
+
+// Commit takes the held stock of a shipped order out of the warehouse
+func (r *PostgresRepository) Commit(orderID string) (Reservation, bool, error) {
+	return r.settle(orderID, StatusCommitted, "",
+		"reserved = stock.reserved - i.quantity, on_hand = stock.on_hand - i.quantity")
+}
+
+// settle ends a held reservation and applies stockUpdate to each of its SKUs in one
+// transaction. It reports false, changing nothing, if the reservation isn't held.
+// The stock rows are locked in SKU order first, like Reserve does, since an
+// UPDATE ... FROM locks them in whatever order the join produces.
+func (r *PostgresRepository) settle(orderID string, to Status, condition, stockUpdate string) (Reservation, bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Reservation{}, false, err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(
+		"UPDATE reservations SET status = $2, expires_at = NULL, updated_at = now() WHERE order_id = $1 AND status = $3 "+condition+" RETURNING id::text",
+		orderID, to, StatusReserved,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		reservation, err := r.GetReservation(orderID)
+		return reservation, false, err
+	}
+	if err != nil {
+		return Reservation{}, false, err
+	}
+
+	if err := lockReservedStock(tx, id); err != nil {
+		return Reservation{}, false, err
+	}
+	if _, err := tx.Exec(
+		"UPDATE stock SET "+stockUpdate+", updated_at = now() FROM reservation_items i WHERE i.reservation_id = $1 AND stock.sku = i.sku",
+		id,
+	); err != nil {
+		return Reservation{}, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Reservation{}, false, err
+	}
+
+	reservation, err := r.GetReservation(orderID)
+	return reservation, true, err
+}
+
+// lockReservedStock locks the stock rows of a reservation's SKUs in sorted order
+func lockReservedStock(tx *sql.Tx, reservationID string) error {
+	rows, err := tx.Query(`
+		SELECT s.sku FROM stock s JOIN reservation_items i ON i.sku = s.sku
+		WHERE i.reservation_id = $1
+		ORDER BY s.sku
+		FOR UPDATE OF s`,
+		reservationID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// Expired returns orders whose held reservations expired, oldest first
+func (r *PostgresRepository) Expired(now time.Time, limit int) ([]string, error) {
+	rows, err := r.db.Query(
+		"SELECT order_id FROM reservations WHERE status = $1 AND expires_at < $2 ORDER BY expires_at LIMIT $3",
+		StatusReserved, now, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orderIDs []string
+	for rows.Next() {
+		var orderID string
+		if err := rows.Scan(&orderID); err != nil {
+			return nil, err
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	return orderIDs, rows.Err()
+}
+
+func (r *PostgresRepository) queryReservation(query string, args ...interface{}) (Reservation, error) {
+	reservation, err := scanReservation(r.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reservation{}, fmt.Errorf("%w: reservation for order %v", ErrNotFound, args[0])
+	}
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	rows, err := r.db.Query(
+		"SELECT sku, quantity FROM reservation_items WHERE reservation_id = $1 ORDER BY sku",
+		reservation.ID,
+	)
+	if err != nil {
+		return Reservation{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.SKU, &item.Quantity); err != nil {
+			return Reservation{}, err
+		}
+		reservation.Items = append(reservation.Items, item)
+	}
+	return reservation, rows.Err()
+}
+
+func scanReservation(row rowScanner) (Reservation, error) {
+	var (
+		reservation Reservation
+		expiresAt   sql.NullTime
+	)
+	if err := row.Scan(&reservation.ID, &reservation.OrderID, &reservation.Status, &reservation.SagaID, &reservation.FailureReason, &expiresAt, &reservation.CreatedAt); err != nil {
+		return Reservation{}, err
+	}
+	if expiresAt.Valid {
+		reservation.ExpiresAt = expiresAt.Time
+	}
+	return reservation, nil
+}
+
+// mergeItems sums quantities per SKU and sorts by SKU, the lock order used by Reserve
+func mergeItems(items []Item) []Item {
+	quantities := make(map[string]int64, len(items))
+	for _, item := range items {
+		quantities[item.SKU] += item.Quantity
+	}
+
+	merged := make([]Item, 0, len(quantities))
+	for sku, quantity := range quantities {
+		merged = append(merged, Item{SKU: sku, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].SKU < merged[j].SKU })
+	return merged
+}
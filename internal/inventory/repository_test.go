@@ -0,0 +1,246 @@
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingDB is a database that records the statements it is sent and
+// answers them from canned rows, picked by statement prefix. It checks which
+// statements the repository sends in which order, not their SQL semantics.
+type recordingDB struct {
+	mu         sync.Mutex
+	statements []string
+	args       [][]driver.Value
+	rows       map[string][][]driver.Value // statement prefix → rows returned
+	affected   map[string][]int64          // statement prefix → rows affected, one per call
+}
+
+func newRecordingDB() *recordingDB {
+	return &recordingDB{rows: make(map[string][][]driver.Value), affected: make(map[string][]int64)}
+}
+
+func (db *recordingDB) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{db: db}, nil
+}
+func (db *recordingDB) Driver() driver.Driver { return nil }
+
+// sent returns the recorded statements starting with prefix, with their arguments
+func (db *recordingDB) sent(prefix string) [][]driver.Value {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var args [][]driver.Value
+	for i, statement := range db.statements {
+		if strings.HasPrefix(statement, prefix) {
+			args = append(args, db.args[i])
+		}
+	}
+	return args
+}
+
+// index returns the position of the first statement starting with prefix, or -1
+func (db *recordingDB) index(prefix string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for i, statement := range db.statements {
+		if strings.HasPrefix(statement, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (db *recordingDB) record(query string, args []driver.NamedValue) string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	query = strings.Join(strings.Fields(query), " ")
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	db.statements = append(db.statements, query)
+	db.args = append(db.args, values)
+	return query
+}
+
+type recordingConn struct {
+	db *recordingDB
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *recordingConn) Close() error                        { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c *recordingConn) Commit() error                       { c.db.record("COMMIT", nil); return nil }
+func (c *recordingConn) Rollback() error                     { return nil }
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query = c.db.record(query, args)
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for prefix, affected := range c.db.affected {
+		if strings.HasPrefix(query, prefix) && len(affected) > 0 {
+			c.db.affected[prefix] = affected[1:]
+			return driver.RowsAffected(affected[0]), nil
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query = c.db.record(query, args)
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for prefix, rows := range c.db.rows {
+		if strings.HasPrefix(query, prefix) {
+			return &cannedRows{values: rows}, nil
+		}
+	}
+	return &cannedRows{}, nil
+}
+
+type cannedRows struct {
+	values [][]driver.Value
+}
+
+// Columns only needs the right count; one is enough for empty results
+func (r *cannedRows) Columns() []string {
+	if len(r.values) == 0 {
+		return []string{"column"}
+	}
+	return make([]string, len(r.values[0]))
+}
+
+func (r *cannedRows) Close() error { return nil }
+
+func (r *cannedRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// withReservation makes db answer reads of order 1's reservation
+func withReservation(db *recordingDB, status Status, items ...Item) {
+	db.rows["SELECT id::text, order_id"] = [][]driver.Value{{"7", "1", string(status), "", "", nil, time.Now()}}
+	for _, item := range items {
+		db.rows["SELECT sku, quantity FROM reservation_items"] = append(db.rows["SELECT sku, quantity FROM reservation_items"], []driver.Value{item.SKU, item.Quantity})
+	}
+}
+
+func TestPostgresRepositoryReserveLocksInSKUOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		affected   []int64 // rows affected by each stock UPDATE, in SKU order
+		wantStatus Status
+		wantHolds  [][]driver.Value
+	}{
+		{
+			name:       "every SKU available",
+			affected:   []int64{1, 1, 1},
+			wantStatus: StatusReserved,
+			wantHolds:  [][]driver.Value{{"BOWL-02", int64(1)}, {"MUG-01", int64(3)}, {"TEA-03", int64(2)}},
+		},
+		{
+			name:       "one SKU short rolls back the holds",
+			affected:   []int64{1, 0, 1},
+			wantStatus: StatusInsufficient,
+			wantHolds:  [][]driver.Value{{"BOWL-02", int64(1)}, {"MUG-01", int64(3)}, {"TEA-03", int64(2)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newRecordingDB()
+			db.rows["INSERT INTO reservations"] = [][]driver.Value{{"7"}}
+			db.affected["UPDATE stock SET reserved"] = tt.affected
+			withReservation(db, tt.wantStatus)
+			repo := NewPostgresRepository(sql.OpenDB(db))
+
+			items := []Item{{SKU: "TEA-03", Quantity: 2}, {SKU: "MUG-01", Quantity: 1}, {SKU: "BOWL-02", Quantity: 1}, {SKU: "MUG-01", Quantity: 2}}
+			reservation, created, err := repo.Reserve("1", "", items, time.Now().Add(time.Hour))
+			if err != nil || !created {
+				t.Fatalf("Reserve() = %v, %v", created, err)
+			}
+			if reservation.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", reservation.Status, tt.wantStatus)
+			}
+
+			if holds := db.sent("UPDATE stock SET reserved"); !reflect.DeepEqual(holds, tt.wantHolds) {
+				t.Errorf("stock held in order %v, want %v", holds, tt.wantHolds)
+			}
+			rolledBack := db.index("ROLLBACK TO SAVEPOINT hold") >= 0
+			if rolledBack != (tt.wantStatus == StatusInsufficient) {
+				t.Errorf("rolled back the holds = %v", rolledBack)
+			}
+		})
+	}
+}
+
+func TestPostgresRepositorySettleLocksInSKUOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		settle func(r *PostgresRepository) (Reservation, bool, error)
+		update string
+	}{
+		{name: "release", settle: func(r *PostgresRepository) (Reservation, bool, error) { return r.Release("1") }, update: "reserved = stock.reserved - i.quantity,"},
+		{name: "expire", settle: func(r *PostgresRepository) (Reservation, bool, error) { return r.Expire("1") }, update: "reserved = stock.reserved - i.quantity,"},
+		{name: "commit", settle: func(r *PostgresRepository) (Reservation, bool, error) { return r.Commit("1") }, update: "on_hand = stock.on_hand - i.quantity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newRecordingDB()
+			db.rows["UPDATE reservations SET status"] = [][]driver.Value{{"7"}}
+			withReservation(db, StatusReleased)
+			repo := NewPostgresRepository(sql.OpenDB(db))
+
+			if _, settled, err := tt.settle(repo); err != nil || !settled {
+				t.Fatalf("settle = %v, %v", settled, err)
+			}
+
+			lock := db.index("SELECT s.sku FROM stock s")
+			update := db.index("UPDATE stock SET")
+			if lock < 0 || update < 0 || lock > update {
+				t.Fatalf("stock locked at statement %d and updated at %d, want the lock first", lock, update)
+			}
+			db.mu.Lock()
+			lockQuery, updateQuery := db.statements[lock], db.statements[update]
+			db.mu.Unlock()
+			if !strings.Contains(lockQuery, "ORDER BY s.sku FOR UPDATE") {
+				t.Errorf("lock statement %q doesn't lock in SKU order", lockQuery)
+			}
+			if !strings.Contains(updateQuery, tt.update) {
+				t.Errorf("update statement %q, want it to set %q", updateQuery, tt.update)
+			}
+			if commit := db.index("COMMIT"); commit < update {
+				t.Errorf("committed before the stock update")
+			}
+		})
+	}
+}
+
+func TestPostgresRepositorySettleNotHeld(t *testing.T) {
+	db := newRecordingDB()
+	withReservation(db, StatusReleased)
+	repo := NewPostgresRepository(sql.OpenDB(db))
+
+	reservation, settled, err := repo.Release("1")
+	if err != nil || settled {
+		t.Fatalf("Release() = %v, %v, want nothing settled", settled, err)
+	}
+	if reservation.Status != StatusReleased {
+		t.Errorf("status = %s, want %s", reservation.Status, StatusReleased)
+	}
+	if db.index("UPDATE stock") >= 0 || db.index("SELECT s.sku") >= 0 {
+		t.Error("touched stock of a reservation that isn't held")
+	}
+}
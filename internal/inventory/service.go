@@ -0,0 +1,369 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// expireBatch bounds how many reservations one expiry sweep releases
+const expireBatch = 100
+
+// Service handles stock business logic, reacting to order events and publishing outcomes
+type Service struct {
+	repo           Repository
+	publisher      messaging.Publisher
+	subscriber     messaging.Subscriber
+	reservationTTL time.Duration
+	logger         *log.Logger
+}
+
+// NewService creates a new inventory service
+func NewService(repo Repository, publisher messaging.Publisher, subscriber messaging.Subscriber, reservationTTL time.Duration, logger *log.Logger) *Service {
+	return &Service{
+		repo:           repo,
+		publisher:      publisher,
+		subscriber:     subscriber,
+		reservationTTL: reservationTTL,
+		logger:         logger,
+	}
+}
+
+// Start subscribes to the order and saga events that drive reservations
+func (s *Service) Start() error {
+	subscriptions := []struct {
+		eventType string
+		handler   func(messaging.Event)
+	}{
+		{messaging.EventTypeOrderCreated, s.handleOrderCreated},
+		{messaging.EventTypeStockReservationRequested, s.handleReservationRequested},
+		{messaging.EventTypeStockReleaseRequested, s.handleReleaseRequested},
+		{messaging.EventTypeOrderCancelled, s.handleOrderCancelled},
+		{messaging.EventTypeOrderPaid, s.handleOrderPaid},
+		{messaging.EventTypeOrderShipped, s.handleOrderShipped},
+		{messaging.EventTypeShipmentRequested, s.handleShipmentRequested},
+	}
+	for _, sub := range subscriptions {
+		if err := s.subscriber.Subscribe(sub.eventType, sub.handler); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", sub.eventType, err)
+		}
+	}
+
+	s.logger.Println("Inventory service subscribed to events")
+	return nil
+}
+
+// SetStock sets the on-hand quantity of a SKU
+func (s *Service) SetStock(sku string, onHand int64) (Stock, error) {
+	sku = strings.TrimSpace(sku)
+	if sku == "" {
+		return Stock{}, fmt.Errorf("sku is required")
+	}
+	if onHand < 0 {
+		return Stock{}, fmt.Errorf("on-hand stock cannot be negative, got %d", onHand)
+	}
+
+	stock, err := s.repo.SetStock(sku, onHand)
+	if err != nil {
+		return Stock{}, fmt.Errorf("failed to set stock: %w", err)
+	}
+
+	s.logger.Printf("Stock of %s set to %d (%d reserved)", stock.SKU, stock.OnHand, stock.Reserved)
+	return stock, nil
+}
+
+// GetStock retrieves the stock level of a SKU
+func (s *Service) GetStock(sku string) (Stock, error) {
+	stock, err := s.repo.GetStock(sku)
+	if err != nil {
+		return Stock{}, fmt.Errorf("failed to get stock: %w", err)
+	}
+	return stock, nil
+}
+
+// GetReservation retrieves the reservation of an order
+func (s *Service) GetReservation(orderID string) (Reservation, error) {
+	reservation, err := s.repo.GetReservation(orderID)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("failed to get reservation: %w", err)
+	}
+	return reservation, nil
+}
+
+// Reserve holds stock for an order and publishes StockReserved or StockInsufficient.
+// Each order is reserved at most once: later calls re-publish the recorded outcome,
+// addressed to sagaID if one is waiting for it.
+func (s *Service) Reserve(orderID, userID string, items []Item, sagaID string) (Reservation, error) {
+	if len(items) == 0 {
+		return Reservation{}, fmt.Errorf("order %s has no items to reserve", orderID)
+	}
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return Reservation{}, fmt.Errorf("quantity of %s must be positive, got %d", item.SKU, item.Quantity)
+		}
+	}
+
+	reservation, created, err := s.repo.Reserve(orderID, sagaID, items, time.Now().Add(s.reservationTTL))
+	if err != nil {
+		return Reservation{}, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+
+	if !created {
+		if sagaID == "" {
+			// Redelivered OrderCreated: the outcome was already published
+			return reservation, nil
+		}
+		if reservation.SagaID != sagaID {
+			if reservation, err = s.repo.AttachSaga(orderID, sagaID); err != nil {
+				return Reservation{}, fmt.Errorf("failed to attach saga to reservation: %w", err)
+			}
+		}
+	}
+
+	if created {
+		s.logger.Printf("Reservation %s for order %s: %s", reservation.ID, orderID, reservation.Status)
+	}
+	s.publishOutcome(reservation, userID)
+	return reservation, nil
+}
+
+// Release returns the stock held for an order. Reservations that are not held,
+// or don't exist, are left alone so repeated releases are harmless.
+func (s *Service) Release(orderID string) (Reservation, error) {
+	reservation, released, err := s.repo.Release(orderID)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("failed to release reservation: %w", err)
+	}
+	if released {
+		s.logger.Printf("Released reservation %s for order %s", reservation.ID, orderID)
+	}
+	return reservation, nil
+}
+
+// Confirm keeps the stock of a paid order held until it ships
+func (s *Service) Confirm(orderID string) (Reservation, error) {
+	reservation, err := s.repo.Confirm(orderID)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("failed to confirm reservation: %w", err)
+	}
+	return reservation, nil
+}
+
+// Commit takes the stock of a shipped order out of the warehouse
+func (s *Service) Commit(orderID string) (Reservation, error) {
+	reservation, committed, err := s.repo.Commit(orderID)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("failed to commit reservation: %w", err)
+	}
+	if committed {
+		s.logger.Printf("Committed reservation %s for order %s", reservation.ID, orderID)
+	}
+	return reservation, nil
+}
+
+// ScheduleShipment answers the fulfillment saga's shipment step. Until a
+// carrier integration exists this stub schedules every order whose stock is
+// still held, keeping the reservation until OrderShipped commits it, and
+// publishes ShipmentScheduled, or ShipmentFailed when there is nothing to ship.
+func (s *Service) ScheduleShipment(orderID, userID, sagaID string) error {
+	reservation, err := s.repo.GetReservation(orderID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to get reservation: %w", err)
+	}
+
+	payload := messaging.FulfillmentPayload{SagaID: sagaID, OrderID: orderID, UserID: userID}
+	eventType := messaging.EventTypeShipmentScheduled
+	switch {
+	case errors.Is(err, ErrNotFound):
+		eventType, payload.Reason = messaging.EventTypeShipmentFailed, "no stock reserved"
+	case reservation.Status == StatusReserved:
+		if _, err := s.repo.Confirm(orderID); err != nil {
+			return fmt.Errorf("failed to confirm reservation: %w", err)
+		}
+		payload.Reference = "shipment-" + reservation.ID
+	case reservation.Status == StatusCommitted:
+		payload.Reference = "shipment-" + reservation.ID // already shipped
+	default:
+		eventType, payload.Reason = messaging.EventTypeShipmentFailed, "reservation "+string(reservation.Status)
+	}
+
+	if payload.Reason != "" {
+		s.logger.Printf("Could not schedule shipment of order %s: %s", orderID, payload.Reason)
+	} else {
+		s.logger.Printf("Scheduled shipment %s for order %s", payload.Reference, orderID)
+	}
+	if err := s.publisher.Publish(eventType, messaging.NewFulfillmentEvent(eventType, payload)); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// RunExpiry periodically releases reservations of orders left unpaid past
+// their expiry, until ctx is cancelled
+func (s *Service) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.expire()
+		}
+	}
+}
+
+func (s *Service) expire() {
+	orderIDs, err := s.repo.Expired(time.Now(), expireBatch)
+	if err != nil {
+		s.logger.Printf("Failed to find expired reservations: %v", err)
+		return
+	}
+
+	for _, orderID := range orderIDs {
+		reservation, expired, err := s.repo.Expire(orderID)
+		if err != nil {
+			s.logger.Printf("Failed to expire reservation for order %s: %v", orderID, err)
+			continue
+		}
+		if expired {
+			s.logger.Printf("Reservation %s for order %s expired", reservation.ID, orderID)
+		}
+	}
+}
+
+// publishOutcome publishes StockReserved or StockInsufficient for a reservation
+func (s *Service) publishOutcome(reservation Reservation, userID string) {
+	eventType, reason := messaging.EventTypeStockReserved, reservation.FailureReason
+	switch reservation.Status {
+	case StatusInsufficient:
+		eventType = messaging.EventTypeStockInsufficient
+	case StatusReleased, StatusExpired:
+		// Stock is no longer held, so a late request must not proceed
+		eventType, reason = messaging.EventTypeStockInsufficient, "reservation "+string(reservation.Status)
+	}
+
+	items := make([]messaging.OrderItemPayload, len(reservation.Items))
+	for i, item := range reservation.Items {
+		items[i] = messaging.OrderItemPayload{SKU: item.SKU, Quantity: item.Quantity}
+	}
+
+	event := messaging.NewFulfillmentEvent(eventType, messaging.FulfillmentPayload{
+		SagaID:    reservation.SagaID,
+		OrderID:   reservation.OrderID,
+		UserID:    userID,
+		Items:     items,
+		Reference: reservation.ID,
+		Reason:    reason,
+	})
+	if err := s.publisher.Publish(eventType, event); err != nil {
+		s.logger.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// handleOrderCreated reserves the stock of a new order
+func (s *Service) handleOrderCreated(event messaging.Event) {
+	var payload messaging.OrderCreatedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal OrderCreated payload: %v", err)
+		return
+	}
+
+	if _, err := s.Reserve(payload.OrderID, payload.UserID, toItems(payload.Items), ""); err != nil {
+		s.logger.Printf("Failed to reserve stock for order %s: %v", payload.OrderID, err)
+	}
+}
+
+// handleReservationRequested answers the fulfillment saga's stock step
+func (s *Service) handleReservationRequested(event messaging.Event) {
+	var payload messaging.FulfillmentPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal StockReservationRequested payload: %v", err)
+		return
+	}
+
+	if _, err := s.Reserve(payload.OrderID, payload.UserID, toItems(payload.Items), payload.SagaID); err != nil {
+		s.logger.Printf("Failed to reserve stock for order %s: %v", payload.OrderID, err)
+	}
+}
+
+// handleReleaseRequested compensates the saga's stock step
+func (s *Service) handleReleaseRequested(event messaging.Event) {
+	var payload messaging.FulfillmentPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal StockReleaseRequested payload: %v", err)
+		return
+	}
+
+	s.releaseReservation(payload.OrderID)
+}
+
+// handleOrderCancelled releases the stock of a cancelled order
+func (s *Service) handleOrderCancelled(event messaging.Event) {
+	var payload messaging.OrderStatusChangedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal OrderCancelled payload: %v", err)
+		return
+	}
+
+	s.releaseReservation(payload.OrderID)
+}
+
+// handleOrderPaid stops the reservation of a paid order from expiring
+func (s *Service) handleOrderPaid(event messaging.Event) {
+	var payload messaging.OrderStatusChangedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal OrderPaid payload: %v", err)
+		return
+	}
+
+	if _, err := s.Confirm(payload.OrderID); err != nil && !errors.Is(err, ErrNotFound) {
+		s.logger.Printf("Failed to confirm reservation for order %s: %v", payload.OrderID, err)
+	}
+}
+
+// handleOrderShipped commits the stock of a shipped order
+func (s *Service) handleOrderShipped(event messaging.Event) {
+	var payload messaging.OrderStatusChangedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal OrderShipped payload: %v", err)
+		return
+	}
+
+	if _, err := s.Commit(payload.OrderID); err != nil && !errors.Is(err, ErrNotFound) {
+		s.logger.Printf("Failed to commit reservation for order %s: %v", payload.OrderID, err)
+	}
+}
+
+// handleShipmentRequested answers the saga's shipment step
+func (s *Service) handleShipmentRequested(event messaging.Event) {
+	var payload messaging.FulfillmentPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal ShipmentRequested payload: %v", err)
+		return
+	}
+
+	if err := s.ScheduleShipment(payload.OrderID, payload.UserID, payload.SagaID); err != nil {
+		s.logger.Printf("Failed to schedule shipment of order %s: %v", payload.OrderID, err)
+	}
+}
+
+func (s *Service) releaseReservation(orderID string) {
+	if _, err := s.Release(orderID); err != nil && !errors.Is(err, ErrNotFound) {
+		s.logger.Printf("Failed to release reservation for order %s: %v", orderID, err)
+	}
+}
+
+func toItems(payloads []messaging.OrderItemPayload) []Item {
+	items := make([]Item, len(payloads))
+	for i, p := range payloads {
+		items[i] = Item{SKU: p.SKU, Quantity: p.Quantity}
+	}
+	return items
+}
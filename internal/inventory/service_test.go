@@ -0,0 +1,430 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/test/mocks"
+)
+
+// memoryRepository keeps stock and reservations in memory
+type memoryRepository struct {
+	mu           sync.Mutex
+	stock        map[string]Stock
+	reservations map[string]Reservation // by order ID
+}
+
+func newMemoryRepository(stock map[string]int64) *memoryRepository {
+	r := &memoryRepository{stock: make(map[string]Stock), reservations: make(map[string]Reservation)}
+	for sku, onHand := range stock {
+		r.stock[sku] = Stock{SKU: sku, OnHand: onHand}
+	}
+	return r
+}
+
+func (r *memoryRepository) SetStock(sku string, onHand int64) (Stock, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.stock[sku]
+	if s.Reserved > onHand {
+		return Stock{}, fmt.Errorf("%w: %s", ErrBelowReserved, sku)
+	}
+	s.SKU, s.OnHand = sku, onHand
+	r.stock[sku] = s
+	return s, nil
+}
+
+func (r *memoryRepository) GetStock(sku string) (Stock, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.stock[sku]
+	if !ok {
+		return Stock{}, fmt.Errorf("%w: sku %s", ErrNotFound, sku)
+	}
+	return s, nil
+}
+
+func (r *memoryRepository) Reserve(orderID, sagaID string, items []Item, expiresAt time.Time) (Reservation, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.reservations[orderID]; ok {
+		return existing, false, nil
+	}
+
+	reservation := Reservation{ID: strconv.Itoa(len(r.reservations) + 1), OrderID: orderID, SagaID: sagaID, Items: mergeItems(items), Status: StatusReserved, ExpiresAt: expiresAt}
+	for _, item := range reservation.Items {
+		if s, ok := r.stock[item.SKU]; !ok || s.Available() < item.Quantity {
+			reservation.Status, reservation.FailureReason, reservation.ExpiresAt = StatusInsufficient, "insufficient stock for "+item.SKU, time.Time{}
+		}
+	}
+	if reservation.Status == StatusReserved {
+		for _, item := range reservation.Items {
+			s := r.stock[item.SKU]
+			s.Reserved += item.Quantity
+			r.stock[item.SKU] = s
+		}
+	}
+	r.reservations[orderID] = reservation
+	return reservation, true, nil
+}
+
+func (r *memoryRepository) GetReservation(orderID string) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reservation, ok := r.reservations[orderID]
+	if !ok {
+		return Reservation{}, fmt.Errorf("%w: reservation for order %s", ErrNotFound, orderID)
+	}
+	return reservation, nil
+}
+
+func (r *memoryRepository) AttachSaga(orderID, sagaID string) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reservation := r.reservations[orderID]
+	reservation.SagaID = sagaID
+	r.reservations[orderID] = reservation
+	return reservation, nil
+}
+
+func (r *memoryRepository) Confirm(orderID string) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reservation, ok := r.reservations[orderID]
+	if !ok {
+		return Reservation{}, fmt.Errorf("%w: reservation for order %s", ErrNotFound, orderID)
+	}
+	if reservation.Status == StatusReserved {
+		reservation.ExpiresAt = time.Time{}
+		r.reservations[orderID] = reservation
+	}
+	return reservation, nil
+}
+
+func (r *memoryRepository) Release(orderID string) (Reservation, bool, error) {
+	return r.settle(orderID, StatusReleased, false)
+}
+
+func (r *memoryRepository) Expire(orderID string) (Reservation, bool, error) {
+	return r.settle(orderID, StatusExpired, false)
+}
+
+func (r *memoryRepository) Commit(orderID string) (Reservation, bool, error) {
+	return r.settle(orderID, StatusCommitted, true)
+}
+
+func (r *memoryRepository) settle(orderID string, to Status, ship bool) (Reservation, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reservation, ok := r.reservations[orderID]
+	if !ok {
+		return Reservation{}, false, fmt.Errorf("%w: reservation for order %s", ErrNotFound, orderID)
+	}
+	if reservation.Status != StatusReserved || (to == StatusExpired && !reservation.ExpiresAt.Before(time.Now())) {
+		return reservation, false, nil
+	}
+
+	for _, item := range reservation.Items {
+		s := r.stock[item.SKU]
+		s.Reserved -= item.Quantity
+		if ship {
+			s.OnHand -= item.Quantity
+		}
+		r.stock[item.SKU] = s
+	}
+	reservation.Status, reservation.ExpiresAt = to, time.Time{}
+	r.reservations[orderID] = reservation
+	return reservation, true, nil
+}
+
+func (r *memoryRepository) Expired(now time.Time, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orderIDs []string
+	for orderID, reservation := range r.reservations {
+		if reservation.Status == StatusReserved && !reservation.ExpiresAt.IsZero() && reservation.ExpiresAt.Before(now) && len(orderIDs) < limit {
+			orderIDs = append(orderIDs, orderID)
+		}
+	}
+	return orderIDs, nil
+}
+
+// levels returns on-hand and reserved stock per SKU
+func (r *memoryRepository) levels() map[string][2]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	levels := make(map[string][2]int64, len(r.stock))
+	for sku, s := range r.stock {
+		levels[sku] = [2]int64{s.OnHand, s.Reserved}
+	}
+	return levels
+}
+
+func newTestService(repo Repository) (*Service, *mocks.Bus) {
+	bus := mocks.NewBus()
+	return NewService(repo, bus, bus, time.Hour, log.New(io.Discard, "", 0)), bus
+}
+
+func TestServiceReserve(t *testing.T) {
+	type request struct {
+		items  []Item
+		sagaID string
+	}
+
+	tests := []struct {
+		name       string
+		requests   []request
+		wantErr    bool
+		wantStatus Status
+		wantSaga   string
+		wantEvents []string
+		wantLevels map[string][2]int64
+	}{
+		{
+			name:       "enough stock",
+			requests:   []request{{items: []Item{{SKU: "MUG-01", Quantity: 2}, {SKU: "TEA-03", Quantity: 1}}}},
+			wantStatus: StatusReserved,
+			wantEvents: []string{messaging.EventTypeStockReserved},
+			wantLevels: map[string][2]int64{"MUG-01": {5, 2}, "TEA-03": {1, 1}},
+		},
+		{
+			name:       "lines of the same SKU are added up",
+			requests:   []request{{items: []Item{{SKU: "MUG-01", Quantity: 3}, {SKU: "MUG-01", Quantity: 3}}}},
+			wantStatus: StatusInsufficient,
+			wantEvents: []string{messaging.EventTypeStockInsufficient},
+			wantLevels: map[string][2]int64{"MUG-01": {5, 0}, "TEA-03": {1, 0}},
+		},
+		{
+			name:       "one SKU short holds nothing",
+			requests:   []request{{items: []Item{{SKU: "MUG-01", Quantity: 2}, {SKU: "TEA-03", Quantity: 2}}}},
+			wantStatus: StatusInsufficient,
+			wantEvents: []string{messaging.EventTypeStockInsufficient},
+			wantLevels: map[string][2]int64{"MUG-01": {5, 0}, "TEA-03": {1, 0}},
+		},
+		{
+			name:       "unknown SKU",
+			requests:   []request{{items: []Item{{SKU: "BOWL-02", Quantity: 1}}}},
+			wantStatus: StatusInsufficient,
+			wantEvents: []string{messaging.EventTypeStockInsufficient},
+			wantLevels: map[string][2]int64{"MUG-01": {5, 0}, "TEA-03": {1, 0}},
+		},
+		{
+			name: "redelivered order is reserved once",
+			requests: []request{
+				{items: []Item{{SKU: "MUG-01", Quantity: 2}}},
+				{items: []Item{{SKU: "MUG-01", Quantity: 2}}},
+			},
+			wantStatus: StatusReserved,
+			wantEvents: []string{messaging.EventTypeStockReserved},
+			wantLevels: map[string][2]int64{"MUG-01": {5, 2}, "TEA-03": {1, 0}},
+		},
+		{
+			name: "saga asking later gets the recorded outcome",
+			requests: []request{
+				{items: []Item{{SKU: "MUG-01", Quantity: 2}}},
+				{items: []Item{{SKU: "MUG-01", Quantity: 2}}, sagaID: "saga-1"},
+			},
+			wantStatus: StatusReserved,
+			wantSaga:   "saga-1",
+			wantEvents: []string{messaging.EventTypeStockReserved, messaging.EventTypeStockReserved},
+			wantLevels: map[string][2]int64{"MUG-01": {5, 2}, "TEA-03": {1, 0}},
+		},
+		{
+			name:       "no items",
+			requests:   []request{{}},
+			wantErr:    true,
+			wantEvents: []string{},
+			wantLevels: map[string][2]int64{"MUG-01": {5, 0}, "TEA-03": {1, 0}},
+		},
+		{
+			name:       "non-positive quantity",
+			requests:   []request{{items: []Item{{SKU: "MUG-01", Quantity: 0}}}},
+			wantErr:    true,
+			wantEvents: []string{},
+			wantLevels: map[string][2]int64{"MUG-01": {5, 0}, "TEA-03": {1, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(map[string]int64{"MUG-01": 5, "TEA-03": 1})
+			s, bus := newTestService(repo)
+
+			var (
+				reservation Reservation
+				err         error
+			)
+			for _, req := range tt.requests {
+				reservation, err = s.Reserve("1", "7", req.items, req.sagaID)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reserve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if reservation.Status != tt.wantStatus || reservation.SagaID != tt.wantSaga {
+				t.Errorf("reservation = %s for saga %q, want %s for %q", reservation.Status, reservation.SagaID, tt.wantStatus, tt.wantSaga)
+			}
+			if got := bus.PublishedTypes(); !reflect.DeepEqual(got, tt.wantEvents) {
+				t.Errorf("published %v, want %v", got, tt.wantEvents)
+			}
+			if got := repo.levels(); !reflect.DeepEqual(got, tt.wantLevels) {
+				t.Errorf("stock levels = %v, want %v", got, tt.wantLevels)
+			}
+		})
+	}
+}
+
+func TestServiceSettle(t *testing.T) {
+	tests := []struct {
+		name       string
+		settle     func(s *Service, repo *memoryRepository)
+		wantStatus Status
+		wantLevels map[string][2]int64
+	}{
+		{
+			name:       "release returns the stock",
+			settle:     func(s *Service, _ *memoryRepository) { s.Release("1") },
+			wantStatus: StatusReleased,
+			wantLevels: map[string][2]int64{"MUG-01": {5, 0}},
+		},
+		{
+			name:       "released twice returns it once",
+			settle:     func(s *Service, _ *memoryRepository) { s.Release("1"); s.Release("1") },
+			wantStatus: StatusReleased,
+			wantLevels: map[string][2]int64{"MUG-01": {5, 0}},
+		},
+		{
+			name:       "commit takes the stock out of the warehouse",
+			settle:     func(s *Service, _ *memoryRepository) { s.Commit("1") },
+			wantStatus: StatusCommitted,
+			wantLevels: map[string][2]int64{"MUG-01": {3, 0}},
+		},
+		{
+			name:       "release after commit changes nothing",
+			settle:     func(s *Service, _ *memoryRepository) { s.Commit("1"); s.Release("1") },
+			wantStatus: StatusCommitted,
+			wantLevels: map[string][2]int64{"MUG-01": {3, 0}},
+		},
+		{
+			name: "expiry returns the stock of an unpaid order",
+			settle: func(s *Service, repo *memoryRepository) {
+				reservation := repo.reservations["1"]
+				reservation.ExpiresAt = time.Now().Add(-time.Minute)
+				repo.reservations["1"] = reservation
+				s.expire()
+			},
+			wantStatus: StatusExpired,
+			wantLevels: map[string][2]int64{"MUG-01": {5, 0}},
+		},
+		{
+			name:       "confirmed reservations don't expire",
+			settle:     func(s *Service, _ *memoryRepository) { s.Confirm("1"); s.expire() },
+			wantStatus: StatusReserved,
+			wantLevels: map[string][2]int64{"MUG-01": {5, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(map[string]int64{"MUG-01": 5})
+			s, _ := newTestService(repo)
+			if _, err := s.Reserve("1", "7", []Item{{SKU: "MUG-01", Quantity: 2}}, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.settle(s, repo)
+
+			if reservation, _ := repo.GetReservation("1"); reservation.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", reservation.Status, tt.wantStatus)
+			}
+			if got := repo.levels(); !reflect.DeepEqual(got, tt.wantLevels) {
+				t.Errorf("stock levels = %v, want %v", got, tt.wantLevels)
+			}
+		})
+	}
+}
+
+func TestServiceScheduleShipment(t *testing.T) {
+	tests := []struct {
+		name          string
+		prepare       func(s *Service)
+		wantEvent     string
+		wantReference string
+		wantReason    string
+	}{
+		{
+			name:          "held stock is scheduled and kept until shipped",
+			prepare:       func(s *Service) { s.Reserve("1", "7", []Item{{SKU: "MUG-01", Quantity: 2}}, "saga-1") },
+			wantEvent:     messaging.EventTypeShipmentScheduled,
+			wantReference: "shipment-1",
+		},
+		{
+			name: "already shipped",
+			prepare: func(s *Service) {
+				s.Reserve("1", "7", []Item{{SKU: "MUG-01", Quantity: 2}}, "saga-1")
+				s.Commit("1")
+			},
+			wantEvent:     messaging.EventTypeShipmentScheduled,
+			wantReference: "shipment-1",
+		},
+		{
+			name:       "no reservation",
+			prepare:    func(s *Service) {},
+			wantEvent:  messaging.EventTypeShipmentFailed,
+			wantReason: "no stock reserved",
+		},
+		{
+			name: "released stock",
+			prepare: func(s *Service) {
+				s.Reserve("1", "7", []Item{{SKU: "MUG-01", Quantity: 2}}, "saga-1")
+				s.Release("1")
+			},
+			wantEvent:  messaging.EventTypeShipmentFailed,
+			wantReason: "reservation released",
+		},
+		{
+			name:       "insufficient stock",
+			prepare:    func(s *Service) { s.Reserve("1", "7", []Item{{SKU: "MUG-01", Quantity: 9}}, "saga-1") },
+			wantEvent:  messaging.EventTypeShipmentFailed,
+			wantReason: "reservation insufficient",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(map[string]int64{"MUG-01": 5})
+			s, bus := newTestService(repo)
+			if err := s.Start(); err != nil {
+				t.Fatal(err)
+			}
+			tt.prepare(s)
+			published := len(bus.Published())
+
+			// The saga asks through the bus, as it does in production
+			bus.Publish(messaging.EventTypeShipmentRequested, messaging.NewFulfillmentEvent(messaging.EventTypeShipmentRequested,
+				messaging.FulfillmentPayload{SagaID: "saga-1", OrderID: "1", UserID: "7"}))
+
+			events := bus.Published()[published:]
+			if len(events) != 2 || events[1].EventType != tt.wantEvent {
+				t.Fatalf("published %v after the request, want %s", bus.PublishedTypes()[published:], tt.wantEvent)
+			}
+			var payload messaging.FulfillmentPayload
+			if err := messaging.DecodePayload(events[1].Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			want := messaging.FulfillmentPayload{SagaID: "saga-1", OrderID: "1", UserID: "7", Reference: tt.wantReference, Reason: tt.wantReason}
+			if !reflect.DeepEqual(payload, want) {
+				t.Errorf("payload = %+v, want %+v", payload, want)
+			}
+			if reservation, err := repo.GetReservation("1"); err == nil && reservation.Status == StatusReserved && !reservation.ExpiresAt.IsZero() {
+				t.Errorf("scheduled reservation still expires at %s", reservation.ExpiresAt)
+			}
+		})
+	}
+}
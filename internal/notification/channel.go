@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Channel names accepted in NOTIFICATION_CHANNELS
+const (
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebhook = "webhook"
+	ChannelInApp   = "inapp"
+)
+
+var (
+	// ErrNoAddress is returned by a channel when the contact can't be reached over it
+	ErrNoAddress = errors.New("contact has no address for this channel")
+	// ErrRejected wraps errors of a provider refusing a message for good, e.g.
+	// an unknown recipient; such messages aren't retried
+	ErrRejected = errors.New("message rejected")
+)
+
+// Message is a notification ready for delivery
+type Message struct {
+	UserID  string
+	Type    string // e.g. "order_confirmation"
+	Subject string
+	Text    string
+	HTML    string // optional alternative to Text, for channels that support it
+	// UnsubscribeURL is the one-click unsubscribe link of non-transactional messages
+	UnsubscribeURL string
+}
+
+// Contact is where a user can be reached
+type Contact struct {
+	UserID string
+	Name   string
+	Email  string
+	Phone  string // E.164; empty unless the user gave one
+}
+
+// Channel delivers messages over one medium. Send returns the provider's
+// reference for the delivered message, if it gives one.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, to Contact, msg Message) (string, error)
+}
+
+// NewChannels builds the channels named in cfg.Channels, in order, each
+// failing over to its secondary provider when one is configured; the inbox
+// channel stores messages in repo
+func NewChannels(cfg Config, repo Repository, logger *log.Logger) ([]Channel, error) {
+	client := &http.Client{Timeout: cfg.SendTimeout}
+
+	channels := make([]Channel, 0, len(cfg.Channels))
+	for _, name := range cfg.Channels {
+		var (
+			channel, secondary Channel
+			err                error
+		)
+		switch name {
+		case ChannelEmail:
+			channel, err = NewSMTPChannel(cfg.SMTP, cfg.SendTimeout)
+			if err == nil && cfg.SMTPSecondary.Host != "" {
+				secondary, err = NewSMTPChannel(cfg.SMTPSecondary, cfg.SendTimeout)
+			}
+		case ChannelSMS:
+			channel, err = NewSMSChannel(cfg.SMS, client)
+			if err == nil && cfg.SMSSecondary.URL != "" {
+				secondary, err = NewSMSChannel(cfg.SMSSecondary, client)
+			}
+		case ChannelWebhook:
+			channel, err = NewWebhookChannel(cfg.Webhook, client)
+		case ChannelInApp:
+			channel = NewInboxChannel(repo)
+		default:
+			err = errors.New("unknown channel")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure %s channel: %w", name, err)
+		}
+		channels = append(channels, NewFailover(channel, secondary, cfg.BreakerThreshold, cfg.BreakerCooldown, logger))
+	}
+	return channels, nil
+}
@@ -0,0 +1,85 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// lookupTimeout bounds the fallback GetUser call to the user service
+const lookupTimeout = 3 * time.Second
+
+// ContactDirectory finds where to reach users, from a local read model fed by
+// user events. Users missing from the read model (events still in flight, or
+// created before this service subscribed) are looked up once over gRPC and
+// cached in the read model.
+type ContactDirectory struct {
+	repo   Repository
+	users  gen.UserServiceClient
+	logger *log.Logger
+}
+
+// NewContactDirectory creates a new ContactDirectory
+func NewContactDirectory(repo Repository, users gen.UserServiceClient, logger *log.Logger) *ContactDirectory {
+	return &ContactDirectory{repo: repo, users: users, logger: logger}
+}
+
+// Lookup returns the contact of a user, or ErrContactDeleted for deleted users
+func (d *ContactDirectory) Lookup(userID string) (Contact, error) {
+	contact, err := d.repo.GetContact(userID)
+	if errors.Is(err, ErrContactNotFound) {
+		return d.fetch(userID)
+	}
+	if err != nil {
+		return Contact{}, fmt.Errorf("failed to look up contact: %w", err)
+	}
+	return contact, nil
+}
+
+// fetch asks the user service about a user the read model hasn't seen yet
+func (d *ContactDirectory) fetch(userID string) (Contact, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	resp, err := d.users.GetUser(ctx, &gen.GetUserRequest{Id: userID})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return Contact{}, fmt.Errorf("%w: %s", ErrContactNotFound, userID)
+	case err != nil:
+		return Contact{}, fmt.Errorf("failed to fetch user %s: %w", userID, err)
+	case resp.User == nil:
+		return Contact{}, fmt.Errorf("%w: %s", ErrContactNotFound, userID)
+	}
+
+	// Events carry whole seconds; truncating keeps a same-second change from looking older
+	now := time.Now().UTC().Truncate(time.Second)
+	if resp.User.DeletedAt != "" {
+		if err := d.Erase(userID, now); err != nil {
+			d.logger.Printf("Failed to cache deletion of user %s: %v", userID, err)
+		}
+		return Contact{}, fmt.Errorf("%w: %s", ErrContactDeleted, userID)
+	}
+
+	contact := Contact{UserID: resp.User.Id, Name: resp.User.Name, Email: resp.User.Email}
+	if err := d.Record(contact, now); err != nil {
+		d.logger.Printf("Failed to cache contact of user %s: %v", userID, err)
+	}
+	return contact, nil
+}
+
+// Record saves a user's name and email as of changedAt
+func (d *ContactDirectory) Record(contact Contact, changedAt time.Time) error {
+	return d.repo.SaveContact(contact, changedAt)
+}
+
+// Erase forgets a deleted user's contact details and inbox
+func (d *ContactDirectory) Erase(userID string, deletedAt time.Time) error {
+	return d.repo.DeleteContact(userID, deletedAt)
+}
@@ -0,0 +1,184 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// ErrDeliveryNotFound is returned for deliveries that don't exist or belong to another user
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// Delivery statuses; attempts are only ever sent or failed
+const (
+	DeliverySent     = "sent"
+	DeliveryFailed   = "failed"
+	DeliveryRetrying = "retrying"
+)
+
+// Delivery is one notification sent to a user over one channel
+type Delivery struct {
+	ID        string
+	UserID    string
+	Type      string
+	Channel   string
+	Recipient string // e.g. the email address; empty for channels without one
+	Subject   string
+	Status    string
+	Attempts  int
+	// ProviderRef is the provider's reference of the delivered message, e.g. the Message-ID
+	ProviderRef string
+	LastError   string
+	SentAt      *time.Time
+	// NextAttemptAt is when a retrying delivery is tried again
+	NextAttemptAt *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	// History lists every attempt, oldest first; only filled by GetDelivery
+	History []DeliveryAttempt
+	// Message is what a retrying delivery sends; only filled by ClaimDeliveries
+	Message *Message
+}
+
+// DeliveryAttempt is one try of a delivery
+type DeliveryAttempt struct {
+	Attempt     int
+	Status      string
+	ProviderRef string
+	// Response is what the provider answered, e.g. the error of a failed attempt
+	Response    string
+	AttemptedAt time.Time
+}
+
+// DeliveryFilter selects and pages a user's deliveries for ListDeliveries, newest first
+type DeliveryFilter struct {
+	UserID    string
+	Type      string // empty for every type
+	Channel   string // empty for every channel
+	Status    string // empty for every status
+	PageSize  int
+	PageToken string
+}
+
+// ListDeliveries returns a page of a user's delivery log and the token of the next page
+func (s *Service) ListDeliveries(filter DeliveryFilter) ([]Delivery, string, error) {
+	switch {
+	case filter.PageSize <= 0:
+		filter.PageSize = defaultPageSize
+	case filter.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
+	}
+
+	deliveries, next, err := s.repo.ListDeliveries(filter)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	return deliveries, next, nil
+}
+
+// GetDelivery returns a delivery of a user with every attempt
+func (s *Service) GetDelivery(userID, id string) (Delivery, error) {
+	delivery, err := s.repo.GetDelivery(userID, id)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("failed to get delivery: %w", err)
+	}
+	return delivery, nil
+}
+
+// record logs the outcome of sending msg to a contact over channel, scheduling
+// a retry if it failed on a provider outage, and publishes NotificationSent
+// or NotificationFailed once the delivery is done
+func (s *Service) record(to Contact, msg Message, channel, ref string, sendErr error) {
+	delivery := Delivery{
+		UserID:    to.UserID,
+		Type:      msg.Type,
+		Channel:   channel,
+		Recipient: recipient(channel, to),
+		Subject:   msg.Subject,
+	}
+	attempt := s.outcome(&delivery, msg, ref, sendErr, time.Now().UTC())
+
+	created, err := s.repo.CreateDelivery(delivery, attempt)
+	if err != nil {
+		s.logger.Printf("Failed to log %s delivery to user %s via %s: %v", msg.Type, to.UserID, channel, err)
+		if delivery.Status == DeliveryRetrying {
+			// Without the log there's nothing to retry from
+			delivery.Status = DeliveryFailed
+		}
+		// The event below still tells the rest of the system what happened
+		created = delivery
+	}
+
+	s.logOutcome(created, sendErr)
+	if created.Status != DeliveryRetrying {
+		s.publishOutcome(created)
+	}
+}
+
+// deferDelivery logs a message held back by quiet hours as a retrying
+// delivery, which the retry scheduler sends once they end at until. Contacts
+// the channel can't reach are skipped, as they would be when sending. Secret
+// links only go by email, which quiet hours don't hold back; one that got
+// here anyway isn't stored, and fails when it comes due.
+func (s *Service) deferDelivery(to Contact, msg Message, channel string, until time.Time) {
+	if recipient(channel, to) == "" {
+		return
+	}
+
+	delivery := Delivery{
+		UserID:        to.UserID,
+		Type:          msg.Type,
+		Channel:       channel,
+		Recipient:     recipient(channel, to),
+		Subject:       msg.Subject,
+		Status:        DeliveryRetrying,
+		NextAttemptAt: &until,
+	}
+	if !emailOnly[msg.Type] {
+		delivery.Message = &msg
+	}
+	if _, err := s.repo.CreateDelivery(delivery, nil); err != nil {
+		s.logger.Printf("Failed to defer %s notification to user %s via %s: %v", msg.Type, to.UserID, channel, err)
+		return
+	}
+	s.logger.Printf("Deferring %s notification to user %s via %s until quiet hours end at %s", msg.Type, to.UserID, channel, until.Format(time.RFC3339))
+}
+
+// logOutcome logs the latest attempt of a delivery
+func (s *Service) logOutcome(d Delivery, sendErr error) {
+	switch d.Status {
+	case DeliverySent:
+		s.logger.Printf("Sent %s notification to user %s via %s (%s)", d.Type, d.UserID, d.Channel, d.ProviderRef)
+	case DeliveryRetrying:
+		s.logger.Printf("Failed to send %s notification to user %s via %s, retrying at %s: %v", d.Type, d.UserID, d.Channel, d.NextAttemptAt.Format(time.RFC3339), sendErr)
+	default:
+		s.logger.Printf("Failed to send %s notification to user %s via %s after %d attempts: %v", d.Type, d.UserID, d.Channel, d.Attempts, sendErr)
+	}
+}
+
+// publishOutcome publishes NotificationSent or NotificationFailed for a
+// delivery that is done
+func (s *Service) publishOutcome(d Delivery) {
+	event := messaging.NewNotificationEvent(d.ID, d.UserID, d.Type, d.Channel, d.Subject, d.Attempts, d.ProviderRef)
+	if d.Status == DeliveryFailed {
+		event = messaging.NewNotificationFailedEvent(d.ID, d.UserID, d.Type, d.Channel, d.Subject, d.Attempts, d.LastError)
+	}
+
+	if err := s.publisher.Publish(event.EventType, event); err != nil {
+		s.logger.Printf("Failed to publish %s for delivery %s: %v", event.EventType, d.ID, err)
+	}
+}
+
+// recipient is the address a channel delivers a contact's messages to
+func recipient(channel string, to Contact) string {
+	switch channel {
+	case ChannelEmail:
+		return to.Email
+	case ChannelSMS:
+		return to.Phone
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,220 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// digestSuffix names the digest of a type, e.g. "order_confirmation_digest"
+	digestSuffix = "_digest"
+	// digestBatch bounds how many closed windows one pass flushes
+	digestBatch = 100
+	// digestLease holds claimed windows back from other instances while
+	// they're flushed; an instance that dies mid-pass leaves them due again
+	digestLease = 5 * time.Minute
+)
+
+// digestible notification types may be batched into digests. The rest carry
+// links or security notices that must go out on their own, at once.
+var digestible = map[string]bool{
+	"order_confirmation": true,
+	"order_completed":    true,
+	"order_cancelled":    true,
+}
+
+// DigestPolicies maps notification types to their aggregation window; types
+// without one are sent immediately
+type DigestPolicies map[string]time.Duration
+
+// ParseDigestPolicies parses NOTIFICATION_DIGESTS entries of the form
+// type=window, e.g. "order_confirmation=10m"; "none" sends everything immediately
+func ParseDigestPolicies(entries []string) (DigestPolicies, error) {
+	policies := make(DigestPolicies)
+	for _, entry := range entries {
+		if entry == "none" {
+			continue
+		}
+		notificationType, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not of the form type=window", entry)
+		}
+		if !digestible[notificationType] {
+			return nil, fmt.Errorf("%q can't be digested, only %s", notificationType, strings.Join(digestibleTypes(), ", "))
+		}
+		window, err := time.ParseDuration(value)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid window %q of %s", value, notificationType)
+		}
+		policies[notificationType] = window
+	}
+	return policies, nil
+}
+
+// digestibleTypes lists the digestible types, sorted
+func digestibleTypes() []string {
+	types := make([]string, 0, len(digestible))
+	for notificationType := range digestible {
+		types = append(types, notificationType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// baseType is the type a digest type batches, or the type itself
+func baseType(notificationType string) string {
+	return strings.TrimSuffix(notificationType, digestSuffix)
+}
+
+// Digest is the notifications held for a user in one window of a type
+type Digest struct {
+	UserID string
+	Type   string
+	Items  []DigestItem
+}
+
+// DigestItem is a held notification
+type DigestItem struct {
+	ID string
+	// Data is what the notification's template is executed with, as JSON
+	Data   []byte
+	HeldAt time.Time
+}
+
+// hold holds a notification for the digest of its type if the user's window
+// is open, and otherwise opens the window; it reports whether it was held
+func (s *Service) hold(userID, notificationType string, data map[string]interface{}, window time.Duration) (bool, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode notification data: %w", err)
+	}
+	held, err := s.repo.HoldForDigest(userID, notificationType, raw, time.Now().UTC().Add(window))
+	if err != nil {
+		return false, fmt.Errorf("failed to hold notification for a digest: %w", err)
+	}
+	return held, nil
+}
+
+// RunDigests periodically sends the digests of windows that closed, until
+// ctx is cancelled
+func (s *Service) RunDigests(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flushDigests(ctx)
+		}
+	}
+}
+
+func (s *Service) flushDigests(ctx context.Context) {
+	digests, err := s.repo.ClaimDigests(time.Now().UTC(), digestLease, digestBatch)
+	if err != nil {
+		s.logger.Printf("Failed to claim due digests: %v", err)
+		return
+	}
+
+	for _, digest := range digests {
+		if ctx.Err() != nil {
+			// The rest come due again once their lease runs out
+			return
+		}
+		s.flushDigest(digest)
+	}
+}
+
+// flushDigest sends what a closed window held and closes it, or keeps it
+// open for another window if it sent anything
+func (s *Service) flushDigest(d Digest) {
+	if len(d.Items) > 0 {
+		contact, err := s.contacts.Lookup(d.UserID)
+		switch {
+		case errors.Is(err, ErrContactDeleted), errors.Is(err, ErrContactNotFound):
+			s.logger.Printf("Dropping %d held %s notifications of user %s: %v", len(d.Items), d.Type, d.UserID, err)
+		case err != nil:
+			// The lease runs out and the window is flushed again
+			s.logger.Printf("Failed to send %s digest to user %s: %v", d.Type, d.UserID, err)
+			return
+		default:
+			s.sendDigest(contact, d)
+		}
+	}
+
+	through := "0"
+	if len(d.Items) > 0 {
+		through = d.Items[len(d.Items)-1].ID
+	}
+	// A type that's no longer digested has no window and comes due at once
+	next := time.Now().UTC().Add(s.digests[d.Type])
+	if err := s.repo.CloseDigest(d.UserID, d.Type, through, next); err != nil {
+		s.logger.Printf("Failed to close %s digest of user %s: %v", d.Type, d.UserID, err)
+	}
+}
+
+// sendDigest sends the held notifications of a window as one digest, or as
+// the notification itself if only one was held
+func (s *Service) sendDigest(contact Contact, d Digest) {
+	notifications := make([]map[string]interface{}, 0, len(d.Items))
+	for _, item := range d.Items {
+		data, err := decodeData(d.Type, item.Data)
+		if err != nil {
+			s.logger.Printf("Skipping held %s notification %s of user %s: %v", d.Type, item.ID, d.UserID, err)
+			continue
+		}
+		notifications = append(notifications, data)
+	}
+
+	switch len(notifications) {
+	case 0:
+		return
+	case 1:
+		s.deliver(contact, d.Type, notifications[0])
+		return
+	}
+
+	s.logger.Printf("Sending digest of %d %s notifications to user %s", len(notifications), d.Type, d.UserID)
+	s.deliver(contact, d.Type+digestSuffix, map[string]interface{}{
+		"Count":         len(notifications),
+		"Notifications": notifications,
+	})
+}
+
+// decodeData restores the data of a held notification from JSON. Fields get
+// the Go type they have in sampleData, so amounts are money again and items
+// can be ranged over like in the notification's own template.
+func decodeData(notificationType string, raw []byte) (map[string]interface{}, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode notification data: %w", err)
+	}
+
+	data := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		sample, ok := sampleData[notificationType][key]
+		if !ok {
+			var v interface{}
+			if err := json.Unmarshal(value, &v); err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+			}
+			data[key] = v
+			continue
+		}
+
+		v := reflect.New(reflect.TypeOf(sample))
+		if err := json.Unmarshal(value, v.Interface()); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+		}
+		data[key] = v.Elem().Interface()
+	}
+	return data, nil
+}
@@ -0,0 +1,95 @@
+package notification
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+)
+
+func TestParseDigestPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    DigestPolicies
+		wantErr bool
+	}{
+		{name: "nothing configured", entries: nil, want: DigestPolicies{}},
+		{name: "none", entries: []string{"none"}, want: DigestPolicies{}},
+		{
+			name:    "one window per type",
+			entries: []string{"order_confirmation=10m", "order_cancelled=1h30m"},
+			want:    DigestPolicies{"order_confirmation": 10 * time.Minute, "order_cancelled": 90 * time.Minute},
+		},
+		{
+			name:    "later entries win",
+			entries: []string{"order_completed=5m", "order_completed=15m"},
+			want:    DigestPolicies{"order_completed": 15 * time.Minute},
+		},
+		{name: "missing window", entries: []string{"order_confirmation"}, wantErr: true},
+		{name: "type that must go out at once", entries: []string{"password_reset=10m"}, wantErr: true},
+		{name: "unknown type", entries: []string{"newsletter=1h"}, wantErr: true},
+		{name: "malformed window", entries: []string{"order_confirmation=soon"}, wantErr: true},
+		{name: "zero window", entries: []string{"order_confirmation=0s"}, wantErr: true},
+		{name: "negative window", entries: []string{"order_confirmation=-5m"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDigestPolicies(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDigestPolicies(%q) error = %v, wantErr %v", tt.entries, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDigestPolicies(%q) = %v, want %v", tt.entries, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeData(t *testing.T) {
+	eur := func(amount int64) money.Money { return money.Money{Amount: amount, Currency: "EUR"} }
+	tests := []struct {
+		name string
+		typ  string
+		data map[string]interface{}
+	}{
+		{
+			name: "amounts and items get their types back",
+			typ:  "order_confirmation",
+			data: map[string]interface{}{
+				"OrderID": "42",
+				"Amount":  eur(3570),
+				"Items":   []messaging.OrderItemPayload{{SKU: "MUG-01", Name: "Mug", Quantity: 2, UnitPrice: eur(1000), Total: eur(2380)}},
+			},
+		},
+		{
+			name: "fields without a sample keep their JSON type",
+			typ:  "order_completed",
+			data: map[string]interface{}{"OrderID": "42", "Note": "left at the door"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodeData(tt.typ, raw)
+			if err != nil {
+				t.Fatalf("decodeData() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.data) {
+				t.Errorf("decodeData() = %#v, want %#v", got, tt.data)
+			}
+		})
+	}
+
+	if _, err := decodeData("order_confirmation", []byte(`{"Amount": "lots"}`)); err == nil {
+		t.Error("decodeData() accepted an amount that isn't money")
+	}
+}
@@ -0,0 +1,19 @@
+package notification
+
+import (
+	"github.com/alex-necsoiu/event-driven/pkg/grpcerr"
+
+	"google.golang.org/grpc/codes"
+)
+
+// statusErrors maps notification errors to the gRPC codes clients act on
+var statusErrors = grpcerr.NewMapper("notification.event-driven",
+	grpcerr.Rule{Err: ErrInvalidPageToken, Code: codes.InvalidArgument, Reason: "INVALID_PAGE_TOKEN"},
+	grpcerr.Rule{Err: ErrContactNotFound, Code: codes.NotFound, Reason: "USER_NOT_FOUND"},
+	grpcerr.Rule{Err: ErrContactDeleted, Code: codes.FailedPrecondition, Reason: "USER_DELETED"},
+	grpcerr.Rule{Err: ErrTemplateNotFound, Code: codes.NotFound, Reason: "TEMPLATE_NOT_FOUND"},
+	grpcerr.Rule{Err: ErrUnknownNotificationType, Code: codes.InvalidArgument, Reason: "UNKNOWN_NOTIFICATION_TYPE"},
+	grpcerr.Rule{Err: ErrReadOnlyTemplate, Code: codes.FailedPrecondition, Reason: "TEMPLATE_READ_ONLY"},
+	grpcerr.Rule{Err: ErrInvalidUnsubscribeToken, Code: codes.InvalidArgument, Reason: "INVALID_UNSUBSCRIBE_TOKEN"},
+	grpcerr.Rule{Err: ErrDeliveryNotFound, Code: codes.NotFound, Reason: "DELIVERY_NOT_FOUND"},
+)
@@ -0,0 +1,175 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CircuitOpenError is returned by Failover when every provider's circuit is
+// open, so the message wasn't tried at all
+type CircuitOpenError struct {
+	Channel string
+	// Until is when a provider lets a message through again
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("every %s provider is unavailable until %s", e.Channel, e.Until.UTC().Format(time.RFC3339))
+}
+
+// Breaker is a circuit breaker for one provider. After threshold failures in
+// a row it opens and turns messages away for cooldown, then lets a single
+// message through to probe whether the provider has recovered.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewBreaker creates a closed Breaker; a threshold below 1 counts as 1
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a message may go to the provider and, if not, when to
+// ask again. A caller that is allowed must report the outcome with Success,
+// Failure or Release.
+func (b *Breaker) Allow(now time.Time) (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true, time.Time{}
+	}
+	if b.probing {
+		return false, now.Add(b.cooldown)
+	}
+	if now.Before(b.openUntil) {
+		return false, b.openUntil
+	}
+	b.probing = true
+	return true, time.Time{}
+}
+
+// Success closes the circuit
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure counts a failed message, opening the circuit at the threshold or
+// reopening it when a probe fails
+func (b *Breaker) Failure(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
+
+// Release gives back an allowed call that never reached the provider
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// provider is one implementation of a channel with its circuit breaker
+type provider struct {
+	name    string
+	channel Channel
+	breaker *Breaker
+}
+
+// Failover is a Channel that sends each message through the first of its
+// providers that takes it, so a secondary provider takes over while the
+// primary is failing. Providers whose circuit is open are skipped.
+type Failover struct {
+	name      string
+	providers []provider
+	logger    *log.Logger
+}
+
+// NewFailover creates a Failover named after its primary channel; each
+// provider gets a Breaker with the given threshold and cooldown
+func NewFailover(primary Channel, secondary Channel, threshold int, cooldown time.Duration, logger *log.Logger) *Failover {
+	f := &Failover{
+		name:      primary.Name(),
+		providers: []provider{{name: "primary", channel: primary, breaker: NewBreaker(threshold, cooldown)}},
+		logger:    logger,
+	}
+	if secondary != nil {
+		f.providers = append(f.providers, provider{name: "secondary", channel: secondary, breaker: NewBreaker(threshold, cooldown)})
+	}
+	return f
+}
+
+// Name returns the channel name
+func (f *Failover) Name() string {
+	return f.name
+}
+
+// Send delivers msg through the first provider that accepts it. Rejections
+// and missing addresses are returned as they are, since another provider
+// would fare no better; a *CircuitOpenError means no provider was tried.
+func (f *Failover) Send(ctx context.Context, to Contact, msg Message) (string, error) {
+	now := time.Now()
+
+	var (
+		failures []string
+		until    time.Time
+	)
+	for i, p := range f.providers {
+		ok, retryAt := p.breaker.Allow(now)
+		if !ok {
+			if until.IsZero() || retryAt.Before(until) {
+				until = retryAt
+			}
+			continue
+		}
+
+		ref, err := p.channel.Send(ctx, to, msg)
+		switch {
+		case err == nil:
+			p.breaker.Success()
+			return ref, nil
+		case errors.Is(err, ErrNoAddress):
+			p.breaker.Release()
+			return "", err
+		case errors.Is(err, ErrRejected):
+			// The provider is up, it just won't take this message
+			p.breaker.Success()
+			return "", err
+		}
+
+		p.breaker.Failure(now)
+		failures = append(failures, fmt.Sprintf("%s provider: %v", p.name, err))
+		if i < len(f.providers)-1 {
+			f.logger.Printf("Failing over from the %s %s provider: %v", p.name, f.name, err)
+		}
+	}
+
+	if len(failures) == 0 {
+		return "", &CircuitOpenError{Channel: f.name, Until: until}
+	}
+	return "", errors.New(strings.Join(failures, "; "))
+}
@@ -0,0 +1,181 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/test/mocks"
+)
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		op          string // allow, success, failure or release
+		at          time.Duration
+		wantAllowed bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stays closed below the threshold",
+			steps: []step{
+				{op: "failure"}, {op: "allow", wantAllowed: true},
+			},
+		},
+		{
+			name: "opens at the threshold until the cooldown ends",
+			steps: []step{
+				{op: "failure"}, {op: "failure"},
+				{op: "allow", wantAllowed: false},
+				{op: "allow", at: 59 * time.Second, wantAllowed: false},
+				{op: "allow", at: time.Minute, wantAllowed: true},
+			},
+		},
+		{
+			name: "success resets the count",
+			steps: []step{
+				{op: "failure"}, {op: "success"}, {op: "failure"},
+				{op: "allow", wantAllowed: true},
+			},
+		},
+		{
+			name: "lets one probe through after the cooldown",
+			steps: []step{
+				{op: "failure"}, {op: "failure"},
+				{op: "allow", at: time.Minute, wantAllowed: true},
+				{op: "allow", at: time.Minute, wantAllowed: false},
+			},
+		},
+		{
+			name: "successful probe closes the circuit",
+			steps: []step{
+				{op: "failure"}, {op: "failure"},
+				{op: "allow", at: time.Minute, wantAllowed: true},
+				{op: "success"},
+				{op: "allow", at: time.Minute, wantAllowed: true},
+				{op: "allow", at: time.Minute, wantAllowed: true},
+			},
+		},
+		{
+			name: "failed probe reopens the circuit",
+			steps: []step{
+				{op: "failure"}, {op: "failure"},
+				{op: "allow", at: time.Minute, wantAllowed: true},
+				{op: "failure", at: time.Minute},
+				{op: "allow", at: 119 * time.Second, wantAllowed: false},
+				{op: "allow", at: 2 * time.Minute, wantAllowed: true},
+			},
+		},
+		{
+			name: "released probe can be retried",
+			steps: []step{
+				{op: "failure"}, {op: "failure"},
+				{op: "allow", at: time.Minute, wantAllowed: true},
+				{op: "release"},
+				{op: "allow", at: time.Minute, wantAllowed: true},
+			},
+		},
+	}
+
+	start := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker(2, time.Minute)
+			for i, s := range tt.steps {
+				now := start.Add(s.at)
+				switch s.op {
+				case "allow":
+					allowed, retryAt := b.Allow(now)
+					if allowed != s.wantAllowed {
+						t.Fatalf("step %d: Allow() = %v, want %v", i, allowed, s.wantAllowed)
+					}
+					if !allowed && !retryAt.After(now) {
+						t.Errorf("step %d: retry at %s, want it after %s", i, retryAt, now)
+					}
+				case "success":
+					b.Success()
+				case "failure":
+					b.Failure(now)
+				case "release":
+					b.Release()
+				}
+			}
+		})
+	}
+}
+
+func TestFailover(t *testing.T) {
+	tests := []struct {
+		name          string
+		primary       int // status the primary provider answers
+		secondary     int
+		phone         string
+		sends         int // how many messages are sent
+		wantErr       error
+		wantOpen      bool // the last send finds every circuit open
+		wantPrimary   int  // requests reaching each provider
+		wantSecondary int
+	}{
+		{
+			name: "primary delivers", primary: http.StatusOK, secondary: http.StatusOK, phone: "+4915112345678",
+			sends: 2, wantPrimary: 2,
+		},
+		{
+			name: "secondary takes over while the primary is down", primary: http.StatusServiceUnavailable, secondary: http.StatusOK, phone: "+4915112345678",
+			sends: 2, wantPrimary: 1, wantSecondary: 2,
+		},
+		{
+			name: "rejections aren't failed over", primary: http.StatusBadRequest, secondary: http.StatusOK, phone: "+4915112345678",
+			sends: 1, wantErr: ErrRejected, wantPrimary: 1,
+		},
+		{
+			name: "contacts without a phone reach no provider", primary: http.StatusOK, secondary: http.StatusOK,
+			sends: 1, wantErr: ErrNoAddress,
+		},
+		{
+			name: "every provider down", primary: http.StatusServiceUnavailable, secondary: http.StatusTooManyRequests, phone: "+4915112345678",
+			sends: 2, wantOpen: true, wantPrimary: 1, wantSecondary: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, secondary := mocks.NewHTTPRecorder(), mocks.NewHTTPRecorder()
+			defer primary.Close()
+			defer secondary.Close()
+			primary.Respond(tt.primary, `{"id":"primary-1"}`)
+			secondary.Respond(tt.secondary, `{"id":"secondary-1"}`)
+
+			primarySMS, _ := NewSMSChannel(SMSConfig{URL: primary.URL(), From: "Shop"}, http.DefaultClient)
+			secondarySMS, _ := NewSMSChannel(SMSConfig{URL: secondary.URL(), From: "Shop"}, http.DefaultClient)
+			failover := NewFailover(primarySMS, secondarySMS, 1, time.Hour, log.New(io.Discard, "", 0))
+
+			var err error
+			for i := 0; i < tt.sends; i++ {
+				_, err = failover.Send(context.Background(), Contact{UserID: "1", Phone: tt.phone}, Message{Text: "Hi"})
+			}
+
+			var open *CircuitOpenError
+			switch {
+			case tt.wantOpen:
+				if !errors.As(err, &open) {
+					t.Errorf("Send() error = %v, want a CircuitOpenError", err)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Errorf("Send() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := len(primary.Requests()); got != tt.wantPrimary {
+				t.Errorf("primary got %d requests, want %d", got, tt.wantPrimary)
+			}
+			if got := len(secondary.Requests()); got != tt.wantSecondary {
+				t.Errorf("secondary got %d requests, want %d", got, tt.wantSecondary)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package notification
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+)
+
+// NotificationHandler implements the gRPC NotificationServiceServer
+type NotificationHandler struct {
+	gen.UnimplementedNotificationServiceServer
+	service *Service
+	logger  *log.Logger
+}
+
+func NewNotificationHandler(service *Service, logger *log.Logger) *NotificationHandler {
+	return &NotificationHandler{service: service, logger: logger}
+}
+
+// ListInbox handles listing a user's in-app notifications
+func (h *NotificationHandler) ListInbox(ctx context.Context, req *gen.ListInboxRequest) (*gen.ListInboxResponse, error) {
+	h.logger.Printf("ListInbox called for user: %s", req.UserId)
+
+	if err := validateListInbox(req); err != nil {
+		return nil, err
+	}
+
+	items, next, unread, err := h.service.ListInbox(InboxFilter{
+		UserID:     req.UserId,
+		UnreadOnly: req.UnreadOnly,
+		PageSize:   int(req.PageSize),
+		PageToken:  req.PageToken,
+	})
+	if err != nil {
+		h.logger.Printf("Failed to list inbox: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	resp := &gen.ListInboxResponse{NextPageToken: next, UnreadCount: unread}
+	for _, item := range items {
+		resp.Items = append(resp.Items, toProtoInboxItem(item))
+	}
+	return resp, nil
+}
+
+// MarkInboxRead handles marking in-app notifications as read
+func (h *NotificationHandler) MarkInboxRead(ctx context.Context, req *gen.MarkInboxReadRequest) (*gen.MarkInboxReadResponse, error) {
+	h.logger.Printf("MarkInboxRead called for user: %s", req.UserId)
+
+	if err := validateMarkInboxRead(req); err != nil {
+		return nil, err
+	}
+
+	marked, err := h.service.MarkInboxRead(req.UserId, req.Ids)
+	if err != nil {
+		h.logger.Printf("Failed to mark inbox read: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.MarkInboxReadResponse{Marked: marked}, nil
+}
+
+// ListTemplates handles listing notification templates
+func (h *NotificationHandler) ListTemplates(ctx context.Context, req *gen.ListTemplatesRequest) (*gen.ListTemplatesResponse, error) {
+	h.logger.Printf("ListTemplates called for type %q, locale %q", req.Type, req.Locale)
+
+	if err := validateListTemplates(req); err != nil {
+		return nil, err
+	}
+
+	templates, err := h.service.Templates(req.Type, req.Locale)
+	if err != nil {
+		h.logger.Printf("Failed to list templates: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	resp := &gen.ListTemplatesResponse{}
+	for _, tmpl := range templates {
+		resp.Templates = append(resp.Templates, toProtoTemplate(tmpl))
+	}
+	return resp, nil
+}
+
+// SaveTemplate handles storing a custom notification template
+func (h *NotificationHandler) SaveTemplate(ctx context.Context, req *gen.SaveTemplateRequest) (*gen.TemplateResponse, error) {
+	h.logger.Printf("SaveTemplate called for %s (%s)", req.Type, req.Locale)
+
+	if err := validateSaveTemplate(req); err != nil {
+		return nil, err
+	}
+
+	tmpl, err := h.service.SaveTemplate(Template{
+		Type:    req.Type,
+		Locale:  req.Locale,
+		Subject: req.Subject,
+		Text:    req.Text,
+		HTML:    req.Html,
+	})
+	if err != nil {
+		h.logger.Printf("Failed to save template: %v", err)
+		return nil, statusErrors.Status(templateViolation(err))
+	}
+
+	return &gen.TemplateResponse{Template: toProtoTemplate(tmpl)}, nil
+}
+
+// DeleteTemplate handles removing a custom notification template
+func (h *NotificationHandler) DeleteTemplate(ctx context.Context, req *gen.DeleteTemplateRequest) (*gen.DeleteTemplateResponse, error) {
+	h.logger.Printf("DeleteTemplate called for %s (%s)", req.Type, req.Locale)
+
+	if err := validateDeleteTemplate(req); err != nil {
+		return nil, err
+	}
+
+	if err := h.service.DeleteTemplate(req.Type, req.Locale); err != nil {
+		h.logger.Printf("Failed to delete template: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.DeleteTemplateResponse{}, nil
+}
+
+// PreviewTemplate handles rendering a stored or draft template with sample data
+func (h *NotificationHandler) PreviewTemplate(ctx context.Context, req *gen.PreviewTemplateRequest) (*gen.PreviewTemplateResponse, error) {
+	h.logger.Printf("PreviewTemplate called for %s (%s)", req.Type, req.Locale)
+
+	if err := validatePreviewTemplate(req); err != nil {
+		return nil, err
+	}
+
+	draft := Template{Subject: req.Subject, Text: req.Text, HTML: req.Html}
+	msg, tmpl, err := h.service.PreviewTemplate(req.Type, req.Locale, draft, req.Data)
+	if err != nil {
+		h.logger.Printf("Failed to preview template: %v", err)
+		return nil, statusErrors.Status(templateViolation(err))
+	}
+
+	return &gen.PreviewTemplateResponse{
+		Subject:  msg.Subject,
+		Text:     msg.Text,
+		Html:     msg.HTML,
+		Template: toProtoTemplate(tmpl),
+	}, nil
+}
+
+// GetPreferences handles getting a user's notification preferences
+func (h *NotificationHandler) GetPreferences(ctx context.Context, req *gen.GetPreferencesRequest) (*gen.PreferencesResponse, error) {
+	h.logger.Printf("GetPreferences called for user: %s", req.UserId)
+
+	if err := validateGetPreferences(req); err != nil {
+		return nil, err
+	}
+
+	prefs, err := h.service.GetPreferences(req.UserId)
+	if err != nil {
+		h.logger.Printf("Failed to get preferences: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.PreferencesResponse{Preferences: toProtoPreferences(prefs, h.service.ChannelNames())}, nil
+}
+
+// UpdatePreferences handles updating a user's notification preferences
+func (h *NotificationHandler) UpdatePreferences(ctx context.Context, req *gen.UpdatePreferencesRequest) (*gen.PreferencesResponse, error) {
+	h.logger.Printf("UpdatePreferences called for user: %s", req.UserId)
+
+	if err := validateUpdatePreferences(req); err != nil {
+		return nil, err
+	}
+
+	update := PreferencesUpdate{Locale: req.Locale, Unsubscribed: req.Unsubscribed}
+	if len(req.Channels) > 0 {
+		update.Channels = make(map[string][]string, len(req.Channels))
+		for _, c := range req.Channels {
+			update.Channels[c.Type] = append([]string{}, c.Channels...)
+		}
+	}
+	if q := req.QuietHours; q != nil {
+		update.QuietHours = &QuietHours{Start: q.Start, End: q.End, TimeZone: q.TimeZone}
+	}
+
+	prefs, err := h.service.UpdatePreferences(req.UserId, update)
+	if err != nil {
+		h.logger.Printf("Failed to update preferences: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.PreferencesResponse{Preferences: toProtoPreferences(prefs, h.service.ChannelNames())}, nil
+}
+
+// Unsubscribe handles the unsubscribe links of non-transactional notifications
+func (h *NotificationHandler) Unsubscribe(ctx context.Context, req *gen.UnsubscribeRequest) (*gen.UnsubscribeResponse, error) {
+	h.logger.Printf("Unsubscribe called")
+
+	if err := validateUnsubscribe(req); err != nil {
+		return nil, err
+	}
+
+	unsubscribedAt, err := h.service.Unsubscribe(req.Token)
+	if err != nil {
+		h.logger.Printf("Failed to unsubscribe: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.UnsubscribeResponse{UnsubscribedAt: unsubscribedAt.UTC().Format(time.RFC3339)}, nil
+}
+
+func toProtoTemplate(tmpl Template) *gen.Template {
+	pb := &gen.Template{
+		Type:    tmpl.Type,
+		Locale:  tmpl.Locale,
+		Subject: tmpl.Subject,
+		Text:    tmpl.Text,
+		Html:    tmpl.HTML,
+		Custom:  tmpl.Custom,
+	}
+	if !tmpl.UpdatedAt.IsZero() {
+		pb.UpdatedAt = tmpl.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	return pb
+}
+
+// ListDeliveries handles listing a user's delivery log
+func (h *NotificationHandler) ListDeliveries(ctx context.Context, req *gen.ListDeliveriesRequest) (*gen.ListDeliveriesResponse, error) {
+	h.logger.Printf("ListDeliveries called for user: %s", req.UserId)
+
+	if err := validateListDeliveries(req); err != nil {
+		return nil, err
+	}
+
+	deliveries, next, err := h.service.ListDeliveries(DeliveryFilter{
+		UserID:    req.UserId,
+		Type:      req.Type,
+		Channel:   req.Channel,
+		Status:    req.Status,
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	})
+	if err != nil {
+		h.logger.Printf("Failed to list deliveries: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	resp := &gen.ListDeliveriesResponse{NextPageToken: next}
+	for _, delivery := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, toProtoDelivery(delivery))
+	}
+	return resp, nil
+}
+
+// GetDelivery handles getting a delivery with every attempt
+func (h *NotificationHandler) GetDelivery(ctx context.Context, req *gen.GetDeliveryRequest) (*gen.DeliveryResponse, error) {
+	h.logger.Printf("GetDelivery called for user %s: %s", req.UserId, req.Id)
+
+	if err := validateGetDelivery(req); err != nil {
+		return nil, err
+	}
+
+	delivery, err := h.service.GetDelivery(req.UserId, req.Id)
+	if err != nil {
+		h.logger.Printf("Failed to get delivery: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.DeliveryResponse{Delivery: toProtoDelivery(delivery)}, nil
+}
+
+func toProtoDelivery(d Delivery) *gen.Delivery {
+	pb := &gen.Delivery{
+		Id:          d.ID,
+		UserId:      d.UserID,
+		Type:        d.Type,
+		Channel:     d.Channel,
+		Recipient:   d.Recipient,
+		Subject:     d.Subject,
+		Status:      d.Status,
+		Attempts:    int32(d.Attempts),
+		ProviderRef: d.ProviderRef,
+		LastError:   d.LastError,
+		CreatedAt:   d.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:   d.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if d.SentAt != nil {
+		pb.SentAt = d.SentAt.UTC().Format(time.RFC3339)
+	}
+	if d.NextAttemptAt != nil {
+		pb.NextAttemptAt = d.NextAttemptAt.UTC().Format(time.RFC3339)
+	}
+	for _, a := range d.History {
+		pb.History = append(pb.History, &gen.DeliveryAttempt{
+			Attempt:     int32(a.Attempt),
+			Status:      a.Status,
+			ProviderRef: a.ProviderRef,
+			Response:    a.Response,
+			AttemptedAt: a.AttemptedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return pb
+}
+
+// toProtoPreferences shows the channels of every type users can configure,
+// out of the configured channels, defaults included
+func toProtoPreferences(prefs Preferences, channels []string) *gen.Preferences {
+	pb := &gen.Preferences{UserId: prefs.UserID, Locale: prefs.Locale}
+	if !prefs.UpdatedAt.IsZero() {
+		pb.UpdatedAt = prefs.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	if q := prefs.QuietHours; q != nil {
+		pb.QuietHours = &gen.QuietHours{Start: q.Start, End: q.End, TimeZone: q.TimeZone}
+	}
+	if prefs.UnsubscribedAt != nil {
+		pb.UnsubscribedAt = prefs.UnsubscribedAt.UTC().Format(time.RFC3339)
+	}
+
+	for _, notificationType := range configurableTypes() {
+		c := &gen.ChannelPreference{Type: notificationType, Channels: []string{}, Transactional: transactional[notificationType]}
+		for _, channel := range channels {
+			if prefs.ChannelEnabled(notificationType, channel) {
+				c.Channels = append(c.Channels, channel)
+			}
+		}
+		pb.Channels = append(pb.Channels, c)
+	}
+	return pb
+}
+
+func toProtoInboxItem(item InboxItem) *gen.InboxItem {
+	pb := &gen.InboxItem{
+		Id:        item.ID,
+		Type:      item.Type,
+		Subject:   item.Subject,
+		Body:      item.Body,
+		CreatedAt: item.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if item.ReadAt != nil {
+		pb.ReadAt = item.ReadAt.UTC().Format(time.RFC3339)
+	}
+	return pb
+}
@@ -0,0 +1,66 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+)
+
+// InboxChannel delivers notifications to the user's in-app inbox, read through
+// the ListInbox RPC
+type InboxChannel struct {
+	repo Repository
+}
+
+// NewInboxChannel creates an InboxChannel
+func NewInboxChannel(repo Repository) *InboxChannel {
+	return &InboxChannel{repo: repo}
+}
+
+// Name returns the channel name
+func (c *InboxChannel) Name() string {
+	return ChannelInApp
+}
+
+// Send stores the message in the user's inbox and returns the inbox item ID
+func (c *InboxChannel) Send(ctx context.Context, to Contact, msg Message) (string, error) {
+	id, err := c.repo.AddInboxItem(InboxItem{
+		UserID:  to.UserID,
+		Type:    msg.Type,
+		Subject: msg.Subject,
+		Body:    msg.Text,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store inbox item: %w", err)
+	}
+	return id, nil
+}
+
+// ListInbox returns a page of a user's inbox, the token for the next page and
+// how many items are unread
+func (s *Service) ListInbox(filter InboxFilter) ([]InboxItem, string, int64, error) {
+	switch {
+	case filter.PageSize <= 0:
+		filter.PageSize = defaultPageSize
+	case filter.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
+	}
+
+	items, next, err := s.repo.ListInbox(filter)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to list inbox: %w", err)
+	}
+	unread, err := s.repo.CountUnread(filter.UserID)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to count unread items: %w", err)
+	}
+	return items, next, unread, nil
+}
+
+// MarkInboxRead marks items of a user's inbox as read, or all of them if ids is empty
+func (s *Service) MarkInboxRead(userID string, ids []string) (int64, error) {
+	marked, err := s.repo.MarkInboxRead(userID, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark inbox items as read: %w", err)
+	}
+	return marked, nil
+}
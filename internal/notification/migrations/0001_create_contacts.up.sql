@@ -0,0 +1,11 @@
+-- Local read model of how to reach each user, fed by UserCreated/UserUpdated/UserDeleted events.
+-- changed_at orders those events; deleted users keep an empty tombstone row.
+CREATE TABLE IF NOT EXISTS contacts (
+    user_id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL DEFAULT '',
+    phone TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMPTZ NOT NULL,
+    deleted_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,12 @@
+-- Notifications delivered over the in-app channel
+CREATE TABLE IF NOT EXISTS inbox_items (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS inbox_items_user_id_idx ON inbox_items (user_id, id DESC);
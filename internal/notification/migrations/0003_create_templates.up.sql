@@ -0,0 +1,10 @@
+-- Notification copy edited at runtime; overrides the built-in defaults for the same type and locale
+CREATE TABLE IF NOT EXISTS templates (
+    type TEXT NOT NULL,
+    locale TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    text_body TEXT NOT NULL,
+    html_body TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (type, locale)
+);
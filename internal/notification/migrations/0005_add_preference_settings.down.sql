@@ -0,0 +1,6 @@
+ALTER TABLE preferences DROP COLUMN IF EXISTS unsubscribe_token;
+ALTER TABLE preferences DROP COLUMN IF EXISTS unsubscribed_at;
+ALTER TABLE preferences DROP COLUMN IF EXISTS quiet_time_zone;
+ALTER TABLE preferences DROP COLUMN IF EXISTS quiet_end;
+ALTER TABLE preferences DROP COLUMN IF EXISTS quiet_start;
+ALTER TABLE preferences DROP COLUMN IF EXISTS channels;
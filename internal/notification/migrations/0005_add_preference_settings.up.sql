@@ -0,0 +1,9 @@
+-- channels maps notification types to the channels the user wants them on; unlisted types use every channel.
+-- Quiet hours are local wall-clock times in quiet_time_zone, empty when unset.
+ALTER TABLE preferences ADD COLUMN IF NOT EXISTS channels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE preferences ADD COLUMN IF NOT EXISTS quiet_start TEXT NOT NULL DEFAULT '';
+ALTER TABLE preferences ADD COLUMN IF NOT EXISTS quiet_end TEXT NOT NULL DEFAULT '';
+ALTER TABLE preferences ADD COLUMN IF NOT EXISTS quiet_time_zone TEXT NOT NULL DEFAULT '';
+-- Unsubscribed users only get transactional notifications; the token is the secret of their unsubscribe links
+ALTER TABLE preferences ADD COLUMN IF NOT EXISTS unsubscribed_at TIMESTAMPTZ;
+ALTER TABLE preferences ADD COLUMN IF NOT EXISTS unsubscribe_token TEXT UNIQUE;
@@ -0,0 +1,29 @@
+-- One row per notification per channel, with its latest outcome; the delivery log support looks at
+CREATE TABLE IF NOT EXISTS deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    channel TEXT NOT NULL,
+    recipient TEXT NOT NULL DEFAULT '',
+    subject TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    provider_ref TEXT NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT '',
+    sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS deliveries_user_id_idx ON deliveries (user_id, id DESC);
+
+-- Every try of a delivery with the provider's answer
+CREATE TABLE IF NOT EXISTS delivery_attempts (
+    delivery_id BIGINT NOT NULL REFERENCES deliveries (id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    status TEXT NOT NULL,
+    provider_ref TEXT NOT NULL DEFAULT '',
+    response TEXT NOT NULL DEFAULT '',
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (delivery_id, attempt)
+);
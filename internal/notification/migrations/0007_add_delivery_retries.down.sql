@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS deliveries_retry_idx;
+ALTER TABLE deliveries DROP COLUMN IF EXISTS message;
+ALTER TABLE deliveries DROP COLUMN IF EXISTS next_attempt_at;
@@ -0,0 +1,6 @@
+-- Deliveries that failed on a provider outage are retried at next_attempt_at from the stored message.
+-- The message may hold secret links, so it's cleared once the delivery is sent or has failed for good.
+ALTER TABLE deliveries ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
+ALTER TABLE deliveries ADD COLUMN IF NOT EXISTS message JSONB;
+
+CREATE INDEX IF NOT EXISTS deliveries_retry_idx ON deliveries (next_attempt_at) WHERE status = 'retrying';
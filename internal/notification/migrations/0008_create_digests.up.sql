@@ -0,0 +1,22 @@
+-- Aggregation windows per user and notification type. While a window is open, notifications of its
+-- type are held and go out together as one digest when it closes.
+CREATE TABLE IF NOT EXISTS digest_windows (
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    closes_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
+
+CREATE INDEX IF NOT EXISTS digest_windows_closes_at_idx ON digest_windows (closes_at);
+
+-- Held notifications with the data their template is executed with
+CREATE TABLE IF NOT EXISTS digest_items (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    data JSONB NOT NULL,
+    held_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    FOREIGN KEY (user_id, type) REFERENCES digest_windows (user_id, type) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS digest_items_window_idx ON digest_items (user_id, type, id);
@@ -0,0 +1 @@
+-- The dropped messages can't be restored; the failed deliveries stay failed
@@ -0,0 +1,10 @@
+-- Verification and password reset emails are no longer retried, so their
+-- secret links aren't stored. Fail the ones waiting for a retry and drop
+-- their messages; the user requests a new link.
+UPDATE deliveries
+SET status = 'failed',
+    message = NULL,
+    next_attempt_at = NULL,
+    last_error = 'secret links are not retried',
+    updated_at = now()
+WHERE type IN ('email_verification', 'password_reset') AND message IS NOT NULL;
@@ -0,0 +1,250 @@
+package notification
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrInvalidUnsubscribeToken is returned for unsubscribe links that don't belong to any user
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// transactional notification types concern the security of the user's account
+// or are receipts of their orders, so they're sent even after the user
+// unsubscribes. Every other type, order status updates included, is
+// non-transactional: it carries an unsubscribe link and is never sent to
+// unsubscribed users, which the law requires.
+var transactional = map[string]bool{
+	"profile_update":     true,
+	"email_verification": true,
+	"sign_in":            true,
+	"password_changed":   true,
+	"password_reset":     true,
+	"order_confirmation": true,
+	// Digests are as transactional as what they batch
+	"order_confirmation_digest": true,
+}
+
+// interruptive channels reach the user's phone; during quiet hours their
+// messages are deferred until the window ends
+var interruptive = map[string]bool{
+	ChannelSMS: true,
+}
+
+// Preferences are a user's notification settings
+type Preferences struct {
+	UserID string
+	// Locale selects the language of notifications; empty for the service default
+	Locale string
+	// Channels lists the channels enabled per notification type; types that
+	// aren't listed go out on every channel
+	Channels   map[string][]string
+	QuietHours *QuietHours // nil when the user has none
+	// UnsubscribedAt is set while the user is unsubscribed from non-transactional notifications
+	UnsubscribedAt *time.Time
+	UpdatedAt      time.Time
+}
+
+// ChannelEnabled reports whether the user wants notifications of a type on channel
+func (p Preferences) ChannelEnabled(notificationType, channel string) bool {
+	channels, ok := p.Channels[notificationType]
+	return !ok || slices.Contains(channels, channel)
+}
+
+// QuietHours is a daily window, on the user's wall clock, during which
+// interruptive channels stay silent
+type QuietHours struct {
+	Start    string // "22:00"
+	End      string // "07:00"; windows may span midnight
+	TimeZone string // IANA name, e.g. "Europe/Berlin"
+}
+
+// Contains reports whether t falls within the quiet hours
+func (q QuietHours) Contains(t time.Time) bool {
+	loc, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		return false
+	}
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return false
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// Until returns when the quiet hours containing t end
+func (q QuietHours) Until(t time.Time) time.Time {
+	loc, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		return t
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return t
+	}
+
+	local := t.In(loc)
+	until := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !until.After(local) {
+		until = time.Date(local.Year(), local.Month(), local.Day()+1, end/60, end%60, 0, 0, loc)
+	}
+	return until.UTC()
+}
+
+// parseClock returns the minute of the day of an "HH:MM" time
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// PreferencesUpdate changes some preferences; nil fields are left unchanged
+type PreferencesUpdate struct {
+	Locale *string
+	// Channels replaces the channels of each listed type
+	Channels map[string][]string
+	// QuietHours replaces the quiet hours; empty start and end remove them
+	QuietHours   *QuietHours
+	Unsubscribed *bool
+}
+
+// GetPreferences returns the notification preferences of a user
+func (s *Service) GetPreferences(userID string) (Preferences, error) {
+	// Only users we can reach have preferences
+	if _, err := s.contacts.Lookup(userID); err != nil {
+		return Preferences{}, err
+	}
+
+	prefs, err := s.repo.GetPreferences(userID)
+	if err != nil {
+		return Preferences{}, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// UpdatePreferences changes the notification preferences of a user
+func (s *Service) UpdatePreferences(userID string, update PreferencesUpdate) (Preferences, error) {
+	prefs, err := s.GetPreferences(userID)
+	if err != nil {
+		return Preferences{}, err
+	}
+
+	if update.Locale != nil {
+		prefs.Locale = NormalizeLocale(*update.Locale)
+	}
+	if len(update.Channels) > 0 && prefs.Channels == nil {
+		prefs.Channels = make(map[string][]string, len(update.Channels))
+	}
+	for notificationType, channels := range update.Channels {
+		prefs.Channels[notificationType] = channels
+	}
+	if update.QuietHours != nil {
+		prefs.QuietHours = update.QuietHours
+		if update.QuietHours.Start == "" && update.QuietHours.End == "" {
+			prefs.QuietHours = nil
+		}
+	}
+	if update.Unsubscribed != nil {
+		switch {
+		case !*update.Unsubscribed:
+			prefs.UnsubscribedAt = nil
+		case prefs.UnsubscribedAt == nil:
+			now := time.Now().UTC()
+			prefs.UnsubscribedAt = &now
+		}
+	}
+
+	saved, err := s.repo.SavePreferences(prefs)
+	if err != nil {
+		return Preferences{}, fmt.Errorf("failed to save preferences: %w", err)
+	}
+	s.logger.Printf("Updated notification preferences of user %s", userID)
+	return saved, nil
+}
+
+// Unsubscribe unsubscribes the owner of an unsubscribe link from
+// non-transactional notifications and returns since when
+func (s *Service) Unsubscribe(token string) (time.Time, error) {
+	userID, unsubscribedAt, err := s.repo.Unsubscribe(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	s.logger.Printf("User %s unsubscribed from non-transactional notifications", userID)
+	return unsubscribedAt, nil
+}
+
+// ChannelNames lists the configured channels, in delivery order
+func (s *Service) ChannelNames() []string {
+	names := make([]string, 0, len(s.channels))
+	for _, channel := range s.channels {
+		names = append(names, channel.Name())
+	}
+	return names
+}
+
+// route picks the channels a notification goes out on at now. Secret links
+// only go by email; otherwise the user's channel choices apply, those of the
+// batched type for digests. During quiet hours interruptive channels are
+// returned as deferred instead.
+func (s *Service) route(prefs Preferences, notificationType string, now time.Time) (channels, deferred []Channel) {
+	quiet := prefs.QuietHours != nil && prefs.QuietHours.Contains(now)
+
+	for _, channel := range s.channels {
+		name := channel.Name()
+		switch {
+		case emailOnly[notificationType]:
+			if name != ChannelEmail {
+				continue
+			}
+		case !prefs.ChannelEnabled(baseType(notificationType), name):
+			continue
+		case quiet && interruptive[name]:
+			deferred = append(deferred, channel)
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	return channels, deferred
+}
+
+// quietUntil reports whether a user's quiet hours hold back a delivery over
+// channel at now, and until when
+func (s *Service) quietUntil(userID, channel string, now time.Time) (time.Time, bool) {
+	if !interruptive[channel] {
+		return time.Time{}, false
+	}
+	prefs, err := s.repo.GetPreferences(userID)
+	if err != nil {
+		// Sending late at night beats not sending
+		s.logger.Printf("Failed to load preferences of user %s: %v", userID, err)
+		return time.Time{}, false
+	}
+	if prefs.QuietHours == nil || !prefs.QuietHours.Contains(now) {
+		return time.Time{}, false
+	}
+	return prefs.QuietHours.Until(now), true
+}
+
+// newUnsubscribeToken generates the secret of a user's unsubscribe links
+func newUnsubscribeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate unsubscribe token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
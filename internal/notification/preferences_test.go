@@ -0,0 +1,126 @@
+package notification
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight := QuietHours{Start: "22:00", End: "07:00", TimeZone: "Europe/Berlin"}
+	daytime := QuietHours{Start: "09:00", End: "17:30", TimeZone: "UTC"}
+
+	tests := []struct {
+		name  string
+		quiet QuietHours
+		at    string // RFC 3339
+		want  bool
+	}{
+		{"before an overnight window", overnight, "2025-01-15T20:59:00Z", false}, // 21:59 in Berlin
+		{"start is inclusive", overnight, "2025-01-15T21:00:00Z", true},
+		{"before midnight", overnight, "2025-01-15T22:30:00Z", true},
+		{"after midnight", overnight, "2025-01-16T03:00:00Z", true},
+		{"end is exclusive", overnight, "2025-01-16T06:00:00Z", false},
+		{"in the user's time zone, not UTC", overnight, "2025-07-15T20:30:00Z", true}, // 22:30 in Berlin summer time
+		{"daytime window", daytime, "2025-01-15T12:00:00Z", true},
+		{"before a daytime window", daytime, "2025-01-15T08:59:00Z", false},
+		{"after a daytime window", daytime, "2025-01-15T17:30:00Z", false},
+		{"unknown time zone", QuietHours{Start: "00:00", End: "23:59", TimeZone: "Mars/Olympus"}, "2025-01-15T12:00:00Z", false},
+		{"malformed start", QuietHours{Start: "late", End: "07:00", TimeZone: "UTC"}, "2025-01-15T23:00:00Z", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.quiet.Contains(at); got != tt.want {
+				t.Errorf("%+v.Contains(%s) = %v, want %v", tt.quiet, tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuietHoursUntil(t *testing.T) {
+	overnight := QuietHours{Start: "22:00", End: "07:00", TimeZone: "Europe/Berlin"}
+
+	tests := []struct {
+		name  string
+		quiet QuietHours
+		at    string
+		want  string
+	}{
+		{"before midnight ends the next morning", overnight, "2025-01-15T22:30:00Z", "2025-01-16T06:00:00Z"},
+		{"after midnight ends the same morning", overnight, "2025-01-16T03:00:00Z", "2025-01-16T06:00:00Z"},
+		{"summer time", overnight, "2025-07-15T21:00:00Z", "2025-07-16T05:00:00Z"},
+		{"across the switch to summer time", overnight, "2025-03-29T22:00:00Z", "2025-03-30T05:00:00Z"},
+		{"daytime window", QuietHours{Start: "09:00", End: "17:30", TimeZone: "UTC"}, "2025-01-15T12:00:00Z", "2025-01-15T17:30:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, _ := time.Parse(time.RFC3339, tt.at)
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if got := tt.quiet.Until(at); !got.Equal(want) {
+				t.Errorf("%+v.Until(%s) = %s, want %s", tt.quiet, tt.at, got.Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliverQuietHours(t *testing.T) {
+	tests := []struct {
+		name         string
+		quiet        bool
+		phone        string
+		wantSMS      bool // the SMS goes out at once
+		wantDeferred bool // the SMS is queued until the quiet hours end
+	}{
+		{name: "outside quiet hours", phone: "+4915112345678", wantSMS: true},
+		{name: "during quiet hours", quiet: true, phone: "+4915112345678", wantDeferred: true},
+		{name: "during quiet hours without a phone", quiet: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &deliveryRepo{prefs: map[string]Preferences{}}
+			if tt.quiet {
+				repo.prefs["1"] = Preferences{QuietHours: quietNow()}
+			}
+			s, email, sms := newDeliveryService(repo, nil)
+
+			s.deliver(Contact{UserID: "1", Email: "ada@example.com", Phone: tt.phone}, "sign_in", map[string]interface{}{"LoggedInAt": "2025-03-14T15:09:26Z"})
+
+			if len(email.sent) != 1 {
+				t.Errorf("sent %d emails, want 1", len(email.sent))
+			}
+			if got := len(sms.sent) == 1; got != tt.wantSMS {
+				t.Errorf("SMS sent = %v, want %v", got, tt.wantSMS)
+			}
+
+			var deferred []Delivery
+			for _, d := range repo.created {
+				if d.Channel == ChannelSMS && d.Status == DeliveryRetrying {
+					deferred = append(deferred, d)
+				}
+			}
+			if !tt.wantDeferred {
+				if len(deferred) != 0 {
+					t.Errorf("deferred %+v, want nothing deferred", deferred)
+				}
+				return
+			}
+			if len(deferred) != 1 {
+				t.Fatalf("deferred %d SMS deliveries, want 1", len(deferred))
+			}
+			d := deferred[0]
+			want := repo.prefs["1"].QuietHours.Until(time.Now())
+			if d.NextAttemptAt == nil || !d.NextAttemptAt.Equal(want) {
+				t.Errorf("deferred until %v, want %s", d.NextAttemptAt, want)
+			}
+			if d.Message == nil || d.Recipient != tt.phone || d.Attempts != 0 {
+				t.Errorf("deferred delivery = %+v, want the message for %s with no attempt used", d, tt.phone)
+			}
+		})
+	}
+}
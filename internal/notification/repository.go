@@ -0,0 +1,823 @@
+package notification
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrContactNotFound is returned for users the contacts read model hasn't seen
+	ErrContactNotFound = errors.New("contact not found")
+	// ErrContactDeleted is returned for users who have been deleted
+	ErrContactDeleted = errors.New("user has been deleted")
+	// ErrInvalidPageToken is returned when a page token can't be decoded
+	ErrInvalidPageToken = errors.New("invalid page token")
+)
+
+// Repository abstracts DB operations for contacts, the in-app inbox, templates and preferences
+type Repository interface {
+	GetContact(userID string) (Contact, error)
+	// SaveContact records a contact as of changedAt, unless a newer change or a deletion is already recorded
+	SaveContact(contact Contact, changedAt time.Time) error
+	// DeleteContact erases a user's contact details and inbox, leaving a tombstone
+	DeleteContact(userID string, deletedAt time.Time) error
+	AddInboxItem(item InboxItem) (string, error)
+	ListInbox(filter InboxFilter) ([]InboxItem, string, error)
+	// MarkInboxRead marks the given items of a user as read, or all of them if ids is empty
+	MarkInboxRead(userID string, ids []string) (int64, error)
+	CountUnread(userID string) (int64, error)
+	// GetTemplate returns the custom template of a type in exactly locale
+	GetTemplate(notificationType, locale string) (Template, error)
+	ListTemplates() ([]Template, error)
+	SaveTemplate(tmpl Template) (Template, error)
+	// DeleteTemplate removes a custom template, restoring the built-in default
+	DeleteTemplate(notificationType, locale string) error
+	// GetPreferences returns a user's preferences, the defaults if they never set any
+	GetPreferences(userID string) (Preferences, error)
+	SavePreferences(prefs Preferences) (Preferences, error)
+	// UnsubscribeToken returns the unsubscribe token of a user, storing candidate if they have none yet
+	UnsubscribeToken(userID, candidate string) (string, error)
+	// Unsubscribe marks the owner of token as unsubscribed and returns who and since when
+	Unsubscribe(token string) (string, time.Time, error)
+	// CreateDelivery logs a delivery with its first attempt, if it was tried at all
+	CreateDelivery(delivery Delivery, attempt *DeliveryAttempt) (Delivery, error)
+	// UpdateDelivery saves the state of a retried delivery and its attempt, if
+	// it was tried, or returns ErrDeliveryNotFound once the delivery is gone
+	UpdateDelivery(delivery Delivery, attempt *DeliveryAttempt) (Delivery, error)
+	// ClaimDeliveries returns up to limit deliveries due for a retry at now,
+	// with their messages, and holds them back from other claims for lease
+	ClaimDeliveries(now time.Time, lease time.Duration, limit int) ([]Delivery, error)
+	ListDeliveries(filter DeliveryFilter) ([]Delivery, string, error)
+	// GetDelivery returns a delivery of a user with its attempts
+	GetDelivery(userID, id string) (Delivery, error)
+	// HoldForDigest holds a notification in the user's open window of its type
+	// and returns true, or opens a window closing at closesAt and returns false
+	HoldForDigest(userID, notificationType string, data []byte, closesAt time.Time) (bool, error)
+	// ClaimDigests returns up to limit digests whose window closed by now, with
+	// their held notifications, and holds them back from other claims for lease
+	ClaimDigests(now time.Time, lease time.Duration, limit int) ([]Digest, error)
+	// CloseDigest removes the held notifications of a window up to throughID
+	// once they're sent, keeping the window open until next if any were
+	CloseDigest(userID, notificationType, throughID string, next time.Time) error
+}
+
+// InboxItem is a notification delivered over the in-app channel
+type InboxItem struct {
+	ID        string
+	UserID    string
+	Type      string
+	Subject   string
+	Body      string
+	ReadAt    *time.Time // nil until the user reads it
+	CreatedAt time.Time
+}
+
+// InboxFilter selects and pages inbox items for ListInbox, newest first
+type InboxFilter struct {
+	UserID     string
+	UnreadOnly bool
+	PageSize   int
+	PageToken  string
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository.
+// The schema is managed by the versioned migrations in Migrations().
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// GetContact returns how to reach a user
+func (r *PostgresRepository) GetContact(userID string) (Contact, error) {
+	var (
+		contact Contact
+		deleted bool
+	)
+	err := r.db.QueryRow(
+		"SELECT user_id, name, email, phone, deleted_at IS NOT NULL FROM contacts WHERE user_id = $1",
+		userID,
+	).Scan(&contact.UserID, &contact.Name, &contact.Email, &contact.Phone, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Contact{}, ErrContactNotFound
+	}
+	if err != nil {
+		return Contact{}, err
+	}
+	if deleted {
+		return Contact{}, ErrContactDeleted
+	}
+	return contact, nil
+}
+
+// SaveContact upserts a contact. Events carry whole seconds, so on a tie the
+// later arrival wins.
+func (r *PostgresRepository) SaveContact(contact Contact, changedAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO contacts (user_id, name, email, phone, changed_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET name = EXCLUDED.name, email = EXCLUDED.email, changed_at = EXCLUDED.changed_at, updated_at = now()
+		WHERE contacts.deleted_at IS NULL AND contacts.changed_at <= EXCLUDED.changed_at`,
+		contact.UserID, contact.Name, contact.Email, contact.Phone, changedAt,
+	)
+	return err
+}
+
+// DeleteContact erases a user's contact details, inbox, preferences, delivery
+// log and held digests
+func (r *PostgresRepository) DeleteContact(userID string, deletedAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO contacts (user_id, changed_at, deleted_at) VALUES ($1, $2, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET name = '', email = '', phone = '', changed_at = EXCLUDED.changed_at,
+			deleted_at = EXCLUDED.deleted_at, updated_at = now()`,
+		userID, deletedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM inbox_items WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM preferences WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM deliveries WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	// Held items go with their windows
+	if _, err := tx.Exec("DELETE FROM digest_windows WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddInboxItem stores an in-app notification and returns its ID
+func (r *PostgresRepository) AddInboxItem(item InboxItem) (string, error) {
+	var id string
+	err := r.db.QueryRow(
+		"INSERT INTO inbox_items (user_id, type, subject, body) VALUES ($1, $2, $3, $4) RETURNING id::text",
+		item.UserID, item.Type, item.Subject, item.Body,
+	).Scan(&id)
+	return id, err
+}
+
+// ListInbox pages through a user's inbox, newest first, and returns the token
+// of the next page, which is empty on the last page
+func (r *PostgresRepository) ListInbox(filter InboxFilter) ([]InboxItem, string, error) {
+	query := "SELECT id::text, user_id, type, subject, body, read_at, created_at FROM inbox_items WHERE user_id = $1"
+	args := []interface{}{filter.UserID}
+	if filter.PageToken != "" {
+		before, err := decodePageToken(filter.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, before)
+		query += " AND id < $" + strconv.Itoa(len(args))
+	}
+	if filter.UnreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	// Fetch one extra row to learn whether another page exists
+	args = append(args, filter.PageSize+1)
+	query += " ORDER BY id DESC LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var items []InboxItem
+	for rows.Next() {
+		var (
+			item   InboxItem
+			readAt sql.NullTime
+		)
+		if err := rows.Scan(&item.ID, &item.UserID, &item.Type, &item.Subject, &item.Body, &readAt, &item.CreatedAt); err != nil {
+			return nil, "", err
+		}
+		if readAt.Valid {
+			item.ReadAt = &readAt.Time
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(items) > filter.PageSize {
+		items = items[:filter.PageSize]
+		next = encodePageToken(items[len(items)-1].ID)
+	}
+	return items, next, nil
+}
+
+// MarkInboxRead marks unread inbox items as read and returns how many changed
+func (r *PostgresRepository) MarkInboxRead(userID string, ids []string) (int64, error) {
+	query := "UPDATE inbox_items SET read_at = now() WHERE user_id = $1 AND read_at IS NULL"
+	args := []interface{}{userID}
+	if len(ids) > 0 {
+		query += " AND id::text = ANY($2)"
+		args = append(args, pq.Array(ids))
+	}
+
+	res, err := r.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountUnread returns how many inbox items a user hasn't read
+func (r *PostgresRepository) CountUnread(userID string) (int64, error) {
+	var n int64
+	err := r.db.QueryRow(
+		"SELECT count(*) FROM inbox_items WHERE user_id = $1 AND read_at IS NULL",
+		userID,
+	).Scan(&n)
+	return n, err
+}
+
+// GetTemplate returns a custom template
+func (r *PostgresRepository) GetTemplate(notificationType, locale string) (Template, error) {
+	tmpl := Template{Custom: true}
+	err := r.db.QueryRow(
+		"SELECT type, locale, subject, text_body, html_body, updated_at FROM templates WHERE type = $1 AND locale = $2",
+		notificationType, locale,
+	).Scan(&tmpl.Type, &tmpl.Locale, &tmpl.Subject, &tmpl.Text, &tmpl.HTML, &tmpl.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Template{}, ErrTemplateNotFound
+	}
+	if err != nil {
+		return Template{}, err
+	}
+	return tmpl, nil
+}
+
+// ListTemplates returns every custom template
+func (r *PostgresRepository) ListTemplates() ([]Template, error) {
+	rows, err := r.db.Query("SELECT type, locale, subject, text_body, html_body, updated_at FROM templates ORDER BY type, locale")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []Template
+	for rows.Next() {
+		tmpl := Template{Custom: true}
+		if err := rows.Scan(&tmpl.Type, &tmpl.Locale, &tmpl.Subject, &tmpl.Text, &tmpl.HTML, &tmpl.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, rows.Err()
+}
+
+// SaveTemplate upserts a custom template
+func (r *PostgresRepository) SaveTemplate(tmpl Template) (Template, error) {
+	tmpl.Custom = true
+	err := r.db.QueryRow(`
+		INSERT INTO templates (type, locale, subject, text_body, html_body) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (type, locale) DO UPDATE
+		SET subject = EXCLUDED.subject, text_body = EXCLUDED.text_body, html_body = EXCLUDED.html_body, updated_at = now()
+		RETURNING updated_at`,
+		tmpl.Type, tmpl.Locale, tmpl.Subject, tmpl.Text, tmpl.HTML,
+	).Scan(&tmpl.UpdatedAt)
+	return tmpl, err
+}
+
+// DeleteTemplate removes a custom template
+func (r *PostgresRepository) DeleteTemplate(notificationType, locale string) error {
+	res, err := r.db.Exec("DELETE FROM templates WHERE type = $1 AND locale = $2", notificationType, locale)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// GetPreferences returns a user's preferences
+func (r *PostgresRepository) GetPreferences(userID string) (Preferences, error) {
+	var (
+		prefs                         = Preferences{UserID: userID}
+		channels                      []byte
+		quietStart, quietEnd, quietTZ string
+		unsubscribedAt                sql.NullTime
+	)
+	err := r.db.QueryRow(`
+		SELECT locale, channels, quiet_start, quiet_end, quiet_time_zone, unsubscribed_at, updated_at
+		FROM preferences WHERE user_id = $1`,
+		userID,
+	).Scan(&prefs.Locale, &channels, &quietStart, &quietEnd, &quietTZ, &unsubscribedAt, &prefs.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return prefs, nil
+	}
+	if err != nil {
+		return Preferences{}, err
+	}
+
+	if err := json.Unmarshal(channels, &prefs.Channels); err != nil {
+		return Preferences{}, fmt.Errorf("failed to decode channel preferences: %w", err)
+	}
+	if quietStart != "" {
+		prefs.QuietHours = &QuietHours{Start: quietStart, End: quietEnd, TimeZone: quietTZ}
+	}
+	if unsubscribedAt.Valid {
+		prefs.UnsubscribedAt = &unsubscribedAt.Time
+	}
+	return prefs, nil
+}
+
+// SavePreferences upserts a user's preferences
+func (r *PostgresRepository) SavePreferences(prefs Preferences) (Preferences, error) {
+	channels, err := json.Marshal(prefs.Channels)
+	if err != nil {
+		return Preferences{}, fmt.Errorf("failed to encode channel preferences: %w", err)
+	}
+	if prefs.Channels == nil {
+		channels = []byte("{}")
+	}
+	var quiet QuietHours
+	if prefs.QuietHours != nil {
+		quiet = *prefs.QuietHours
+	}
+
+	err = r.db.QueryRow(`
+		INSERT INTO preferences (user_id, locale, channels, quiet_start, quiet_end, quiet_time_zone, unsubscribed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE
+		SET locale = EXCLUDED.locale, channels = EXCLUDED.channels, quiet_start = EXCLUDED.quiet_start,
+			quiet_end = EXCLUDED.quiet_end, quiet_time_zone = EXCLUDED.quiet_time_zone,
+			unsubscribed_at = EXCLUDED.unsubscribed_at, updated_at = now()
+		RETURNING updated_at`,
+		prefs.UserID, prefs.Locale, channels, quiet.Start, quiet.End, quiet.TimeZone, prefs.UnsubscribedAt,
+	).Scan(&prefs.UpdatedAt)
+	return prefs, err
+}
+
+// UnsubscribeToken returns a user's unsubscribe token, creating their
+// preferences with candidate as the token if needed
+func (r *PostgresRepository) UnsubscribeToken(userID, candidate string) (string, error) {
+	var token string
+	err := r.db.QueryRow(`
+		INSERT INTO preferences (user_id, unsubscribe_token) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET unsubscribe_token = COALESCE(preferences.unsubscribe_token, EXCLUDED.unsubscribe_token)
+		RETURNING unsubscribe_token`,
+		userID, candidate,
+	).Scan(&token)
+	return token, err
+}
+
+// Unsubscribe records the unsubscription of the owner of token; repeating it
+// keeps the original time
+func (r *PostgresRepository) Unsubscribe(token string) (string, time.Time, error) {
+	var (
+		userID         string
+		unsubscribedAt time.Time
+	)
+	err := r.db.QueryRow(`
+		UPDATE preferences SET unsubscribed_at = COALESCE(unsubscribed_at, now()), updated_at = now()
+		WHERE unsubscribe_token = $1
+		RETURNING user_id, unsubscribed_at`,
+		token,
+	).Scan(&userID, &unsubscribedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, ErrInvalidUnsubscribeToken
+	}
+	return userID, unsubscribedAt, err
+}
+
+// deliveryColumns are the columns scanned by scanDelivery
+const deliveryColumns = "id::text, user_id, type, channel, recipient, subject, status, attempts, provider_ref, last_error, sent_at, next_attempt_at, created_at, updated_at"
+
+// CreateDelivery logs a delivery, storing its message while it's retrying,
+// and its first attempt if there was one
+func (r *PostgresRepository) CreateDelivery(delivery Delivery, attempt *DeliveryAttempt) (Delivery, error) {
+	message, err := encodeMessage(delivery.Message)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Delivery{}, err
+	}
+	defer tx.Rollback()
+
+	created, err := scanDelivery(tx.QueryRow(`
+		INSERT INTO deliveries (user_id, type, channel, recipient, subject, status, attempts, provider_ref, last_error, sent_at, next_attempt_at, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING `+deliveryColumns,
+		delivery.UserID, delivery.Type, delivery.Channel, delivery.Recipient, delivery.Subject, delivery.Status,
+		delivery.Attempts, delivery.ProviderRef, delivery.LastError, delivery.SentAt, delivery.NextAttemptAt, message,
+	))
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	if err := insertAttempt(tx, created.ID, attempt); err != nil {
+		return Delivery{}, err
+	}
+	return created, tx.Commit()
+}
+
+// UpdateDelivery saves the outcome of retrying a delivery; the stored message
+// is replaced by delivery.Message, so it's cleared once the delivery is done
+func (r *PostgresRepository) UpdateDelivery(delivery Delivery, attempt *DeliveryAttempt) (Delivery, error) {
+	message, err := encodeMessage(delivery.Message)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Delivery{}, err
+	}
+	defer tx.Rollback()
+
+	updated, err := scanDelivery(tx.QueryRow(`
+		UPDATE deliveries
+		SET recipient = $2, status = $3, attempts = $4, provider_ref = $5, last_error = $6, sent_at = $7,
+			next_attempt_at = $8, message = $9, updated_at = now()
+		WHERE id::text = $1
+		RETURNING `+deliveryColumns,
+		delivery.ID, delivery.Recipient, delivery.Status, delivery.Attempts, delivery.ProviderRef, delivery.LastError,
+		delivery.SentAt, delivery.NextAttemptAt, message,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		// The user was deleted, and their delivery log with them
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	if err := insertAttempt(tx, updated.ID, attempt); err != nil {
+		return Delivery{}, err
+	}
+	return updated, tx.Commit()
+}
+
+// ClaimDeliveries pushes the next attempt of due retries lease into the
+// future, so a crashed instance's claims come due again and concurrent
+// instances skip them, and returns them oldest due first
+func (r *PostgresRepository) ClaimDeliveries(now time.Time, lease time.Duration, limit int) ([]Delivery, error) {
+	rows, err := r.db.Query(`
+		UPDATE deliveries SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM deliveries
+			WHERE status = $3 AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns+`, message`,
+		now, now.Add(lease), DeliveryRetrying, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var message []byte
+		delivery, err := scanDelivery(rows, &message)
+		if err != nil {
+			return nil, err
+		}
+		if message != nil {
+			delivery.Message = &Message{}
+			if err := json.Unmarshal(message, delivery.Message); err != nil {
+				return nil, fmt.Errorf("failed to decode message of delivery %s: %w", delivery.ID, err)
+			}
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// insertAttempt logs attempt as the latest of a delivery; a nil attempt is skipped
+func insertAttempt(tx *sql.Tx, deliveryID string, attempt *DeliveryAttempt) error {
+	if attempt == nil {
+		return nil
+	}
+	_, err := tx.Exec(
+		"INSERT INTO delivery_attempts (delivery_id, attempt, status, provider_ref, response) VALUES ($1, $2, $3, $4, $5)",
+		deliveryID, attempt.Attempt, attempt.Status, attempt.ProviderRef, attempt.Response,
+	)
+	return err
+}
+
+// encodeMessage stores a message as JSON, or NULL for none
+func encodeMessage(msg *Message) (interface{}, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return string(data), nil
+}
+
+// ListDeliveries pages through a user's deliveries, newest first, and returns
+// the token of the next page, which is empty on the last page
+func (r *PostgresRepository) ListDeliveries(filter DeliveryFilter) ([]Delivery, string, error) {
+	query := "SELECT " + deliveryColumns + " FROM deliveries WHERE user_id = $1"
+	args := []interface{}{filter.UserID}
+	if filter.PageToken != "" {
+		before, err := decodePageToken(filter.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, before)
+		query += " AND id < $" + strconv.Itoa(len(args))
+	}
+	for _, cond := range []struct{ column, value string }{
+		{"type", filter.Type},
+		{"channel", filter.Channel},
+		{"status", filter.Status},
+	} {
+		if cond.value != "" {
+			args = append(args, cond.value)
+			query += " AND " + cond.column + " = $" + strconv.Itoa(len(args))
+		}
+	}
+	// Fetch one extra row to learn whether another page exists
+	args = append(args, filter.PageSize+1)
+	query += " ORDER BY id DESC LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(deliveries) > filter.PageSize {
+		deliveries = deliveries[:filter.PageSize]
+		next = encodePageToken(deliveries[len(deliveries)-1].ID)
+	}
+	return deliveries, next, nil
+}
+
+// GetDelivery returns a delivery of a user with its attempts, oldest first
+func (r *PostgresRepository) GetDelivery(userID, id string) (Delivery, error) {
+	delivery, err := scanDelivery(r.db.QueryRow(
+		"SELECT "+deliveryColumns+" FROM deliveries WHERE id::text = $1 AND user_id = $2",
+		id, userID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	rows, err := r.db.Query(
+		"SELECT attempt, status, provider_ref, response, attempted_at FROM delivery_attempts WHERE delivery_id = $1 ORDER BY attempt",
+		delivery.ID,
+	)
+	if err != nil {
+		return Delivery{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attempt DeliveryAttempt
+		if err := rows.Scan(&attempt.Attempt, &attempt.Status, &attempt.ProviderRef, &attempt.Response, &attempt.AttemptedAt); err != nil {
+			return Delivery{}, err
+		}
+		delivery.History = append(delivery.History, attempt)
+	}
+	return delivery, rows.Err()
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDelivery scans deliveryColumns followed by any extra columns
+func scanDelivery(row rowScanner, extra ...interface{}) (Delivery, error) {
+	var (
+		delivery      Delivery
+		sentAt        sql.NullTime
+		nextAttemptAt sql.NullTime
+	)
+	dest := append([]interface{}{
+		&delivery.ID, &delivery.UserID, &delivery.Type, &delivery.Channel, &delivery.Recipient, &delivery.Subject,
+		&delivery.Status, &delivery.Attempts, &delivery.ProviderRef, &delivery.LastError, &sentAt, &nextAttemptAt,
+		&delivery.CreatedAt, &delivery.UpdatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return Delivery{}, err
+	}
+	if sentAt.Valid {
+		delivery.SentAt = &sentAt.Time
+	}
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	return delivery, nil
+}
+
+// encodePageToken builds an opaque cursor pointing past the given inbox item
+func encodePageToken(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodePageToken(token string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidPageToken
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidPageToken
+	}
+	return id, nil
+}
+
+// HoldForDigest adds a notification to the user's window of its type if one
+// is open; otherwise it opens the window and the caller sends the
+// notification at once. The window's row stays locked until the item is
+// stored, so a concurrent CloseDigest can't drop it.
+func (r *PostgresRepository) HoldForDigest(userID, notificationType string, data []byte, closesAt time.Time) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// xmax is 0 for a freshly inserted row and set for one locked by the no-op update
+	var opened bool
+	if err := tx.QueryRow(`
+		INSERT INTO digest_windows (user_id, type, closes_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, type) DO UPDATE SET closes_at = digest_windows.closes_at
+		RETURNING xmax = 0`,
+		userID, notificationType, closesAt,
+	).Scan(&opened); err != nil {
+		return false, err
+	}
+
+	if !opened {
+		if _, err := tx.Exec(
+			"INSERT INTO digest_items (user_id, type, data) VALUES ($1, $2, $3)",
+			userID, notificationType, string(data),
+		); err != nil {
+			return false, err
+		}
+	}
+	return !opened, tx.Commit()
+}
+
+// ClaimDigests pushes the closing time of closed windows lease into the
+// future, so a crashed instance's claims come due again and concurrent
+// instances skip them, and returns them with their held notifications
+func (r *PostgresRepository) ClaimDigests(now time.Time, lease time.Duration, limit int) ([]Digest, error) {
+	rows, err := r.db.Query(`
+		UPDATE digest_windows SET closes_at = $2
+		WHERE (user_id, type) IN (
+			SELECT user_id, type FROM digest_windows
+			WHERE closes_at <= $1
+			ORDER BY closes_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING user_id, type`,
+		now, now.Add(lease), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var digests []Digest
+	for rows.Next() {
+		var digest Digest
+		if err := rows.Scan(&digest.UserID, &digest.Type); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range digests {
+		if digests[i].Items, err = r.digestItems(digests[i].UserID, digests[i].Type); err != nil {
+			return nil, err
+		}
+	}
+	return digests, nil
+}
+
+// digestItems lists the notifications held in a window, oldest first
+func (r *PostgresRepository) digestItems(userID, notificationType string) ([]DigestItem, error) {
+	rows, err := r.db.Query(
+		"SELECT id::text, data, held_at FROM digest_items WHERE user_id = $1 AND type = $2 ORDER BY id",
+		userID, notificationType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []DigestItem
+	for rows.Next() {
+		var item DigestItem
+		if err := rows.Scan(&item.ID, &item.Data, &item.HeldAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// CloseDigest removes the notifications of a window up to throughID, which
+// were just sent. A window that sent some stays open until next, so a steady
+// stream of notifications keeps being batched. Otherwise it's closed, unless
+// notifications were held since it was claimed, which then come due at once.
+func (r *PostgresRepository) CloseDigest(userID, notificationType, throughID string, next time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"DELETE FROM digest_items WHERE user_id = $1 AND type = $2 AND id <= $3",
+		userID, notificationType, throughID,
+	)
+	if err != nil {
+		return err
+	}
+	sent, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if sent > 0 {
+		_, err = tx.Exec(
+			"UPDATE digest_windows SET closes_at = $3 WHERE user_id = $1 AND type = $2",
+			userID, notificationType, next,
+		)
+	} else {
+		_, err = tx.Exec(`
+			DELETE FROM digest_windows w
+			WHERE w.user_id = $1 AND w.type = $2
+				AND NOT EXISTS (SELECT 1 FROM digest_items i WHERE i.user_id = w.user_id AND i.type = w.type)`,
+			userID, notificationType,
+		)
+		if err == nil {
+			_, err = tx.Exec(
+				"UPDATE digest_windows SET closes_at = now() WHERE user_id = $1 AND type = $2",
+				userID, notificationType,
+			)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,191 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// retryBatch bounds how many due deliveries one pass retries
+	retryBatch = 100
+	// retryLease holds claimed deliveries back from other instances while
+	// they're retried; an instance that dies mid-pass leaves them due again
+	retryLease = 5 * time.Minute
+)
+
+var (
+	errChannelRemoved = errors.New("channel is no longer configured")
+	errMessageMissing = errors.New("message to retry wasn't stored")
+)
+
+// RetryPolicy is how deliveries that failed on a provider outage are retried
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts of a delivery, the first one included
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles with every
+	// further retry, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// backoff is the wait after a delivery's attempts-th failed attempt
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < attempts && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// String describes the policy for the startup log
+func (p RetryPolicy) String() string {
+	return fmt.Sprintf("up to %d attempts, backing off from %s to %s", p.MaxAttempts, p.Backoff, p.MaxBackoff)
+}
+
+// RunRetries periodically retries deliveries that are due, until ctx is
+// cancelled
+func (s *Service) RunRetries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.retryDue(ctx)
+		}
+	}
+}
+
+func (s *Service) retryDue(ctx context.Context) {
+	deliveries, err := s.repo.ClaimDeliveries(time.Now().UTC(), retryLease, retryBatch)
+	if err != nil {
+		s.logger.Printf("Failed to claim deliveries due for a retry: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			// The rest come due again once their lease runs out
+			return
+		}
+		s.retryDelivery(delivery)
+	}
+}
+
+// retryDelivery sends a claimed delivery's message again, to the user's
+// current address, and saves the outcome. A delivery coming due during the
+// user's quiet hours is put off until they end.
+func (s *Service) retryDelivery(d Delivery) {
+	if until, quiet := s.quietUntil(d.UserID, d.Channel, time.Now()); quiet && d.Message != nil {
+		d.NextAttemptAt = &until
+		if _, err := s.repo.UpdateDelivery(d, nil); err != nil {
+			s.logger.Printf("Failed to defer retry of delivery %s: %v", d.ID, err)
+		}
+		return
+	}
+
+	var (
+		ref     string
+		sendErr error
+		msg     Message
+	)
+	channel := s.channel(d.Channel)
+	switch {
+	case d.Message == nil:
+		sendErr = errMessageMissing
+	case channel == nil:
+		sendErr = errChannelRemoved
+	default:
+		msg = *d.Message
+		var contact Contact
+		if contact, sendErr = s.contacts.Lookup(d.UserID); sendErr == nil {
+			d.Recipient = recipient(d.Channel, contact)
+			ref, sendErr = channel.Send(context.Background(), contact, msg)
+		}
+	}
+
+	attempt := s.outcome(&d, msg, ref, sendErr, time.Now().UTC())
+	updated, err := s.repo.UpdateDelivery(d, attempt)
+	if errors.Is(err, ErrDeliveryNotFound) {
+		s.logger.Printf("Dropping retry of delivery %s: %v", d.ID, err)
+		return
+	}
+	if err != nil {
+		// The lease runs out and the delivery is retried again
+		s.logger.Printf("Failed to save retry of delivery %s: %v", d.ID, err)
+		return
+	}
+
+	s.logOutcome(updated, sendErr)
+	if updated.Status != DeliveryRetrying {
+		s.publishOutcome(updated)
+	}
+}
+
+// outcome applies the result of sending msg to a delivery: sent, retrying
+// after a backoff, or failed once retries can't help or are used up. It
+// returns the attempt to log, or nil if every provider's circuit was open,
+// which doesn't use up an attempt. Secret links are never retried, since that
+// would store the link with the delivery; the user requests a new one instead.
+func (s *Service) outcome(d *Delivery, msg Message, ref string, sendErr error, now time.Time) *DeliveryAttempt {
+	var open *CircuitOpenError
+	if errors.As(sendErr, &open) && !emailOnly[d.Type] {
+		d.Status = DeliveryRetrying
+		d.LastError = sendErr.Error()
+		d.NextAttemptAt = &open.Until
+		d.Message = &msg
+		return nil
+	}
+
+	d.Attempts++
+	attempt := &DeliveryAttempt{Attempt: d.Attempts, Status: DeliverySent, ProviderRef: ref, AttemptedAt: now}
+	if sendErr == nil {
+		d.Status = DeliverySent
+		d.ProviderRef = ref
+		d.SentAt = &now
+		d.NextAttemptAt, d.Message = nil, nil
+		return attempt
+	}
+
+	attempt.Status = DeliveryFailed
+	attempt.Response = sendErr.Error()
+	d.LastError = sendErr.Error()
+	if permanent(sendErr) || emailOnly[d.Type] || d.Attempts >= s.retry.MaxAttempts {
+		d.Status = DeliveryFailed
+		d.NextAttemptAt, d.Message = nil, nil
+		return attempt
+	}
+
+	next := now.Add(s.retry.backoff(d.Attempts))
+	d.Status = DeliveryRetrying
+	d.NextAttemptAt = &next
+	d.Message = &msg
+	return attempt
+}
+
+// permanent reports whether retrying a delivery that failed with err can't help
+func permanent(err error) bool {
+	for _, target := range []error{ErrRejected, ErrNoAddress, ErrContactNotFound, ErrContactDeleted, errChannelRemoved, errMessageMissing} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// channel returns the configured channel with the given name, or nil
+func (s *Service) channel(name string) Channel {
+	for _, channel := range s.channels {
+		if channel.Name() == name {
+			return channel
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/test/mocks"
+)
+
+// deliveryRepo keeps contacts, preferences and deliveries in memory
+type deliveryRepo struct {
+	Repository
+	contacts map[string]Contact
+	deleted  map[string]bool
+	prefs    map[string]Preferences
+	created  []Delivery
+	saved    []Delivery
+}
+
+func (r *deliveryRepo) GetPreferences(userID string) (Preferences, error) {
+	prefs := r.prefs[userID]
+	prefs.UserID = userID
+	return prefs, nil
+}
+
+func (r *deliveryRepo) GetTemplate(notificationType, locale string) (Template, error) {
+	return Template{}, ErrTemplateNotFound
+}
+
+func (r *deliveryRepo) CreateDelivery(delivery Delivery, attempt *DeliveryAttempt) (Delivery, error) {
+	r.created = append(r.created, delivery)
+	return delivery, nil
+}
+
+func (r *deliveryRepo) GetContact(userID string) (Contact, error) {
+	if r.deleted[userID] {
+		return Contact{}, ErrContactDeleted
+	}
+	contact, ok := r.contacts[userID]
+	if !ok {
+		return Contact{}, ErrContactNotFound
+	}
+	return contact, nil
+}
+
+func (r *deliveryRepo) UpdateDelivery(delivery Delivery, attempt *DeliveryAttempt) (Delivery, error) {
+	r.saved = append(r.saved, delivery)
+	return delivery, nil
+}
+
+// recordingChannel records who it sent to and fails with err, if set
+type recordingChannel struct {
+	name string
+	err  error
+	sent []Contact
+}
+
+func (c *recordingChannel) Name() string { return c.name }
+
+func (c *recordingChannel) Send(ctx context.Context, to Contact, msg Message) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	if recipient(c.name, to) == "" {
+		return "", ErrNoAddress
+	}
+	c.sent = append(c.sent, to)
+	return "ref-1", nil
+}
+
+// quietNow is a window of quiet hours around the current time
+func quietNow() *QuietHours {
+	now := time.Now().UTC()
+	return &QuietHours{Start: now.Add(-time.Hour).Format("15:04"), End: now.Add(time.Hour).Format("15:04"), TimeZone: "UTC"}
+}
+
+// newDeliveryService returns a Service sending over email and SMS channels
+// that record what they send, failing with sendErr if it's set
+func newDeliveryService(repo *deliveryRepo, sendErr error) (*Service, *recordingChannel, *recordingChannel) {
+	logger := log.New(io.Discard, "", 0)
+	email := &recordingChannel{name: ChannelEmail, err: sendErr}
+	sms := &recordingChannel{name: ChannelSMS, err: sendErr}
+	s := &Service{
+		publisher: mocks.NewBus(),
+		repo:      repo,
+		contacts:  NewContactDirectory(repo, nil, logger),
+		renderer:  NewRenderer(repo, "en", logger),
+		channels:  []Channel{email, sms},
+		retry:     RetryPolicy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour},
+		logger:    logger,
+	}
+	return s, email, sms
+}
+
+func TestRetryDelivery(t *testing.T) {
+	msg := &Message{Subject: "Hi", Text: "Hi"}
+
+	tests := []struct {
+		name          string
+		delivery      Delivery
+		sendErr       error
+		quiet         bool // the user is in their quiet hours
+		wantStatus    string
+		wantSentTo    string // empty if nothing must be sent
+		wantRecipient string
+	}{
+		{
+			name:       "secret links aren't stored to be retried",
+			delivery:   Delivery{UserID: "1", Type: "password_reset", Channel: ChannelEmail, Recipient: "old@example.com"},
+			wantStatus: DeliveryFailed,
+		},
+		{
+			name:          "retries follow the user's current address",
+			delivery:      Delivery{UserID: "1", Type: "welcome", Channel: ChannelEmail, Recipient: "old@example.com", Message: msg},
+			wantStatus:    DeliverySent,
+			wantSentTo:    "current@example.com",
+			wantRecipient: "current@example.com",
+		},
+		{
+			name:       "deleted users get nothing",
+			delivery:   Delivery{UserID: "2", Type: "welcome", Channel: ChannelEmail, Recipient: "gone@example.com", Message: msg},
+			wantStatus: DeliveryFailed,
+		},
+		{
+			name:          "provider still down",
+			delivery:      Delivery{UserID: "1", Type: "welcome", Channel: ChannelEmail, Recipient: "old@example.com", Attempts: 1, Message: msg},
+			sendErr:       errors.New("connection refused"),
+			wantStatus:    DeliveryRetrying,
+			wantRecipient: "current@example.com",
+		},
+		{
+			name:       "message wasn't stored",
+			delivery:   Delivery{UserID: "1", Type: "welcome", Channel: ChannelEmail},
+			wantStatus: DeliveryFailed,
+		},
+		{
+			name:       "channel was removed",
+			delivery:   Delivery{UserID: "1", Type: "welcome", Channel: ChannelWebhook, Message: msg},
+			wantStatus: DeliveryFailed,
+		},
+		{
+			name:          "SMS coming due in quiet hours waits for them to end",
+			delivery:      Delivery{UserID: "1", Type: "sign_in", Channel: ChannelSMS, Recipient: "+4915112345678", Status: DeliveryRetrying, Message: msg},
+			quiet:         true,
+			wantStatus:    DeliveryRetrying,
+			wantRecipient: "+4915112345678",
+		},
+		{
+			name:          "SMS after quiet hours",
+			delivery:      Delivery{UserID: "1", Type: "sign_in", Channel: ChannelSMS, Recipient: "+4915112345678", Message: msg},
+			wantStatus:    DeliverySent,
+			wantSentTo:    "+4915112345678",
+			wantRecipient: "+4915112345678",
+		},
+		{
+			name:          "quiet hours don't hold back email",
+			delivery:      Delivery{UserID: "1", Type: "sign_in", Channel: ChannelEmail, Message: msg},
+			quiet:         true,
+			wantStatus:    DeliverySent,
+			wantSentTo:    "current@example.com",
+			wantRecipient: "current@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &deliveryRepo{
+				contacts: map[string]Contact{"1": {UserID: "1", Email: "current@example.com", Phone: "+4915112345678"}},
+				deleted:  map[string]bool{"2": true},
+				prefs:    map[string]Preferences{},
+			}
+			if tt.quiet {
+				repo.prefs["1"] = Preferences{QuietHours: quietNow()}
+			}
+			s, email, sms := newDeliveryService(repo, tt.sendErr)
+
+			s.retryDelivery(tt.delivery)
+
+			if len(repo.saved) != 1 {
+				t.Fatalf("saved %d deliveries, want 1", len(repo.saved))
+			}
+			saved := repo.saved[0]
+			if saved.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s (%s)", saved.Status, tt.wantStatus, saved.LastError)
+			}
+			if tt.wantRecipient != "" && saved.Recipient != tt.wantRecipient {
+				t.Errorf("recipient = %q, want %q", saved.Recipient, tt.wantRecipient)
+			}
+			sent := append(email.sent, sms.sent...)
+			switch {
+			case tt.wantSentTo == "" && len(sent) != 0:
+				t.Errorf("sent to %+v, want nothing sent", sent)
+			case tt.wantSentTo != "" && (len(sent) != 1 || recipient(tt.delivery.Channel, sent[0]) != tt.wantSentTo):
+				t.Errorf("sent to %+v, want %s", sent, tt.wantSentTo)
+			}
+			if tt.quiet && tt.wantStatus == DeliveryRetrying {
+				want := repo.prefs["1"].QuietHours.Until(time.Now())
+				if saved.NextAttemptAt == nil || !saved.NextAttemptAt.Equal(want) || saved.Attempts != 0 || saved.Message == nil {
+					t.Errorf("deferred delivery = %+v, want it due at %s with its message and no attempt used", saved, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordStoresOnlyRetriedMessages(t *testing.T) {
+	outage := errors.New("connection refused")
+	circuitOpen := &CircuitOpenError{Channel: ChannelEmail, Until: time.Now().Add(time.Minute)}
+
+	tests := []struct {
+		name         string
+		typ          string
+		sendErr      error
+		wantStatus   string
+		wantAttempts int
+	}{
+		{name: "sent", typ: "welcome", wantStatus: DeliverySent, wantAttempts: 1},
+		{name: "outage is retried", typ: "welcome", sendErr: outage, wantStatus: DeliveryRetrying, wantAttempts: 1},
+		{name: "open circuit waits without an attempt", typ: "welcome", sendErr: circuitOpen, wantStatus: DeliveryRetrying},
+		{name: "rejected", typ: "welcome", sendErr: ErrRejected, wantStatus: DeliveryFailed, wantAttempts: 1},
+		{name: "secret link sent", typ: "password_reset", wantStatus: DeliverySent, wantAttempts: 1},
+		{name: "secret link on an outage fails", typ: "password_reset", sendErr: outage, wantStatus: DeliveryFailed, wantAttempts: 1},
+		{name: "secret link on an open circuit fails", typ: "email_verification", sendErr: circuitOpen, wantStatus: DeliveryFailed, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &deliveryRepo{}
+			s, _, _ := newDeliveryService(repo, nil)
+			msg := Message{Type: tt.typ, Subject: "Hi", Text: "https://shop.example.com/reset-password?token=secret"}
+
+			s.record(Contact{UserID: "1", Email: "ada@example.com"}, msg, ChannelEmail, "", tt.sendErr)
+
+			if len(repo.created) != 1 {
+				t.Fatalf("created %d deliveries, want 1", len(repo.created))
+			}
+			d := repo.created[0]
+			if d.Status != tt.wantStatus || d.Attempts != tt.wantAttempts {
+				t.Errorf("status = %s after %d attempts, want %s after %d", d.Status, d.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if stored := d.Message != nil; stored != (tt.wantStatus == DeliveryRetrying) {
+				t.Errorf("message stored = %v with status %s", stored, d.Status)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	capped := RetryPolicy{Backoff: time.Minute, MaxBackoff: 10 * time.Minute}
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempts int
+		want     time.Duration
+	}{
+		{"first retry", capped, 1, time.Minute},
+		{"doubles", capped, 2, 2 * time.Minute},
+		{"doubles again", capped, 4, 8 * time.Minute},
+		{"capped", capped, 5, 10 * time.Minute},
+		{"stays capped", capped, 30, 10 * time.Minute},
+		{"backoff above the cap", RetryPolicy{Backoff: time.Hour, MaxBackoff: time.Minute}, 1, time.Minute},
+		{"without a cap the backoff stays constant", RetryPolicy{Backoff: time.Minute}, 3, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.backoff(tt.attempts); got != tt.want {
+			t.Errorf("%s: backoff(%d) = %s, want %s", tt.name, tt.attempts, got, tt.want)
+		}
+	}
+}
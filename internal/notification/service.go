@@ -1,9 +1,12 @@
 package notification
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"time"
 
 	"github.com/alex-necsoiu/event-driven/pkg/messaging"
@@ -12,17 +15,43 @@ import (
 // Service handles notification business logic and event consumption
 type Service struct {
 	subscriber messaging.Subscriber
+	publisher  messaging.Publisher
+	repo       Repository
+	contacts   *ContactDirectory
+	renderer   *Renderer
+	channels   []Channel
+	retry      RetryPolicy
+	digests    DigestPolicies
+	appURL     string
 	logger     *log.Logger
 }
 
-// NewService creates a new notification service
-func NewService(subscriber messaging.Subscriber, logger *log.Logger) *Service {
+// NewService creates a new notification service rendering messages with
+// renderer and delivering them over channels, retrying failed deliveries per
+// retry and publishing the outcome of each. Types with a digest policy are
+// batched per user; appURL is the base of links in messages.
+func NewService(subscriber messaging.Subscriber, publisher messaging.Publisher, repo Repository, contacts *ContactDirectory, renderer *Renderer, channels []Channel, retry RetryPolicy, digests DigestPolicies, appURL string, logger *log.Logger) *Service {
 	return &Service{
 		subscriber: subscriber,
+		publisher:  publisher,
+		repo:       repo,
+		contacts:   contacts,
+		renderer:   renderer,
+		channels:   channels,
+		retry:      retry,
+		digests:    digests,
+		appURL:     appURL,
 		logger:     logger,
 	}
 }
 
+// emailOnly notification types carry secret links, so they only go to the
+// email address they were requested for
+var emailOnly = map[string]bool{
+	"email_verification": true,
+	"password_reset":     true,
+}
+
 // Start starts the notification service and subscribes to events
 func (s *Service) Start() error {
 	// Subscribe to user events
@@ -34,6 +63,27 @@ func (s *Service) Start() error {
 		return fmt.Errorf("failed to subscribe to UserUpdated: %w", err)
 	}
 
+	if err := s.subscriber.Subscribe(messaging.EventTypeUserDeleted, s.handleUserDeleted); err != nil {
+		return fmt.Errorf("failed to subscribe to UserDeleted: %w", err)
+	}
+
+	if err := s.subscriber.Subscribe(messaging.EventTypeEmailVerificationRequested, s.handleEmailVerificationRequested); err != nil {
+		return fmt.Errorf("failed to subscribe to EmailVerificationRequested: %w", err)
+	}
+
+	// Subscribe to account security events
+	if err := s.subscriber.Subscribe(messaging.EventTypeUserLoggedIn, s.handleUserLoggedIn); err != nil {
+		return fmt.Errorf("failed to subscribe to UserLoggedIn: %w", err)
+	}
+
+	if err := s.subscriber.Subscribe(messaging.EventTypePasswordChanged, s.handlePasswordChanged); err != nil {
+		return fmt.Errorf("failed to subscribe to PasswordChanged: %w", err)
+	}
+
+	if err := s.subscriber.Subscribe(messaging.EventTypePasswordResetRequested, s.handlePasswordResetRequested); err != nil {
+		return fmt.Errorf("failed to subscribe to PasswordResetRequested: %w", err)
+	}
+
 	// Subscribe to order events
 	if err := s.subscriber.Subscribe(messaging.EventTypeOrderCreated, s.handleOrderCreated); err != nil {
 		return fmt.Errorf("failed to subscribe to OrderCreated: %w", err)
@@ -66,9 +116,13 @@ func (s *Service) handleUserCreated(event messaging.Event) {
 		return
 	}
 
-	// Send welcome notification
-	message := fmt.Sprintf("Welcome %s! Your account has been created successfully.", payload.Name)
-	s.sendNotification(payload.UserID, "welcome", message)
+	contact := Contact{UserID: payload.UserID, Name: payload.Name, Email: payload.Email}
+	if err := s.contacts.Record(contact, parseEventTime(payload.CreatedAt)); err != nil {
+		s.logger.Printf("Failed to record contact of user %s: %v", payload.UserID, err)
+	}
+
+	// Send welcome notification; the verification link follows in its own message
+	s.sendNotification(payload.UserID, "welcome", map[string]interface{}{"Name": payload.Name})
 }
 
 // handleUserUpdated handles UserUpdated events
@@ -81,9 +135,105 @@ func (s *Service) handleUserUpdated(event messaging.Event) {
 		return
 	}
 
+	contact := Contact{UserID: payload.UserID, Name: payload.Name, Email: payload.Email}
+	if err := s.contacts.Record(contact, parseEventTime(payload.UpdatedAt)); err != nil {
+		s.logger.Printf("Failed to record contact of user %s: %v", payload.UserID, err)
+	}
+
 	// Send profile update notification
-	message := fmt.Sprintf("Your profile has been updated successfully, %s.", payload.Name)
-	s.sendNotification(payload.UserID, "profile_update", message)
+	s.sendNotification(payload.UserID, "profile_update", map[string]interface{}{"Name": payload.Name})
+}
+
+// handleUserDeleted handles UserDeleted events by erasing the user's contact details and inbox
+func (s *Service) handleUserDeleted(event messaging.Event) {
+	s.logger.Printf("Handling UserDeleted event: %s", event.EventType)
+
+	var payload messaging.UserDeletedPayload
+	if err := s.unmarshalPayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal UserDeleted payload: %v", err)
+		return
+	}
+
+	if err := s.contacts.Erase(payload.UserID, parseEventTime(payload.DeletedAt)); err != nil {
+		s.logger.Printf("Failed to erase contact of user %s: %v", payload.UserID, err)
+	}
+}
+
+// handleEmailVerificationRequested handles EmailVerificationRequested events
+func (s *Service) handleEmailVerificationRequested(event messaging.Event) {
+	s.logger.Printf("Handling EmailVerificationRequested event: %s", event.EventType)
+
+	var payload messaging.EmailVerificationRequestedPayload
+	if err := s.unmarshalPayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal EmailVerificationRequested payload: %v", err)
+		return
+	}
+
+	if payload.UserID == "" || payload.Token == "" {
+		s.logger.Printf("Invalid EmailVerificationRequested payload: missing user_id or token")
+		return
+	}
+
+	// Send verification link
+	data := map[string]interface{}{
+		"Email":     payload.Email,
+		"Link":      s.appURL + "/auth/verify-email?token=" + url.QueryEscape(payload.Token),
+		"ExpiresAt": payload.ExpiresAt,
+	}
+	// The address being verified may be newer than the contacts read model
+	s.deliver(Contact{UserID: payload.UserID, Email: payload.Email}, "email_verification", data)
+}
+
+// handleUserLoggedIn handles UserLoggedIn events
+func (s *Service) handleUserLoggedIn(event messaging.Event) {
+	s.logger.Printf("Handling UserLoggedIn event: %s", event.EventType)
+
+	var payload messaging.UserLoggedInPayload
+	if err := s.unmarshalPayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal UserLoggedIn payload: %v", err)
+		return
+	}
+
+	// Send new sign-in notice
+	s.sendNotification(payload.UserID, "sign_in", map[string]interface{}{"LoggedInAt": payload.LoggedInAt})
+}
+
+// handlePasswordChanged handles PasswordChanged events
+func (s *Service) handlePasswordChanged(event messaging.Event) {
+	s.logger.Printf("Handling PasswordChanged event: %s", event.EventType)
+
+	var payload messaging.PasswordChangedPayload
+	if err := s.unmarshalPayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal PasswordChanged payload: %v", err)
+		return
+	}
+
+	// Send security notice
+	s.sendNotification(payload.UserID, "password_changed", map[string]interface{}{"Method": payload.Method})
+}
+
+// handlePasswordResetRequested handles PasswordResetRequested events
+func (s *Service) handlePasswordResetRequested(event messaging.Event) {
+	s.logger.Printf("Handling PasswordResetRequested event: %s", event.EventType)
+
+	var payload messaging.PasswordResetRequestedPayload
+	if err := s.unmarshalPayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal PasswordResetRequested payload: %v", err)
+		return
+	}
+
+	if payload.UserID == "" || payload.Token == "" {
+		s.logger.Printf("Invalid PasswordResetRequested payload: missing user_id or token")
+		return
+	}
+
+	// Send reset link
+	data := map[string]interface{}{
+		"Email":     payload.Email,
+		"Link":      s.appURL + "/reset-password?token=" + url.QueryEscape(payload.Token),
+		"ExpiresAt": payload.ExpiresAt,
+	}
+	s.deliver(Contact{UserID: payload.UserID, Email: payload.Email}, "password_reset", data)
 }
 
 // handleOrderCreated handles OrderCreated events
@@ -97,78 +247,156 @@ func (s *Service) handleOrderCreated(event messaging.Event) {
 	}
 
 	// Send order confirmation notification
-	message := fmt.Sprintf("Your order #%s for $%.2f has been created and is being processed.", payload.OrderID, payload.Amount)
-	s.sendNotification(payload.UserID, "order_confirmation", message)
+	s.sendNotification(payload.UserID, "order_confirmation", map[string]interface{}{
+		"OrderID":  payload.OrderID,
+		"Subtotal": payload.Subtotal,
+		"Tax":      payload.Tax,
+		"Amount":   payload.Amount,
+		"Items":    payload.Items,
+	})
 }
 
 // handleOrderCompleted handles OrderCompleted events
 func (s *Service) handleOrderCompleted(event messaging.Event) {
 	s.logger.Printf("Handling OrderCompleted event: %s", event.EventType)
 
-	var payload map[string]interface{}
+	var payload messaging.OrderStatusChangedPayload
 	if err := s.unmarshalPayload(event.Payload, &payload); err != nil {
 		s.logger.Printf("Failed to unmarshal OrderCompleted payload: %v", err)
 		return
 	}
 
-	userID, ok := payload["user_id"].(string)
-	if !ok {
-		s.logger.Printf("Invalid user_id in OrderCompleted payload")
-		return
-	}
-
-	orderID, ok := payload["order_id"].(string)
-	if !ok {
-		s.logger.Printf("Invalid order_id in OrderCompleted payload")
+	if payload.UserID == "" || payload.OrderID == "" {
+		s.logger.Printf("Invalid OrderCompleted payload: missing user_id or order_id")
 		return
 	}
 
 	// Send order completion notification
-	message := fmt.Sprintf("Your order #%s has been completed successfully!", orderID)
-	s.sendNotification(userID, "order_completed", message)
+	s.sendNotification(payload.UserID, "order_completed", map[string]interface{}{"OrderID": payload.OrderID})
 }
 
 // handleOrderCancelled handles OrderCancelled events
 func (s *Service) handleOrderCancelled(event messaging.Event) {
 	s.logger.Printf("Handling OrderCancelled event: %s", event.EventType)
 
-	var payload map[string]interface{}
+	var payload messaging.OrderStatusChangedPayload
 	if err := s.unmarshalPayload(event.Payload, &payload); err != nil {
 		s.logger.Printf("Failed to unmarshal OrderCancelled payload: %v", err)
 		return
 	}
 
-	userID, ok := payload["user_id"].(string)
-	if !ok {
-		s.logger.Printf("Invalid user_id in OrderCancelled payload")
+	if payload.UserID == "" || payload.OrderID == "" {
+		s.logger.Printf("Invalid OrderCancelled payload: missing user_id or order_id")
 		return
 	}
 
-	orderID, ok := payload["order_id"].(string)
-	if !ok {
-		s.logger.Printf("Invalid order_id in OrderCancelled payload")
+	// Send order cancellation notification
+	s.sendNotification(payload.UserID, "order_cancelled", map[string]interface{}{"OrderID": payload.OrderID})
+}
+
+// sendNotification sends a notification to a user over every configured
+// channel, or holds it for a digest while the user's window of its type is
+// open; data is what its template is executed with
+func (s *Service) sendNotification(userID, notificationType string, data map[string]interface{}) {
+	contact, err := s.contacts.Lookup(userID)
+	if errors.Is(err, ErrContactDeleted) {
+		s.logger.Printf("Not sending %s notification to deleted user %s", notificationType, userID)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("Failed to send %s notification to user %s: %v", notificationType, userID, err)
 		return
 	}
 
-	// Send order cancellation notification
-	message := fmt.Sprintf("Your order #%s has been cancelled.", orderID)
-	s.sendNotification(userID, "order_cancelled", message)
+	if window, ok := s.digests[notificationType]; ok {
+		held, err := s.hold(userID, notificationType, data, window)
+		if err != nil {
+			// Better a message of its own than none
+			s.logger.Printf("Sending %s notification to user %s right away: %v", notificationType, userID, err)
+		}
+		if held {
+			s.logger.Printf("Holding %s notification for the digest of user %s", notificationType, userID)
+			return
+		}
+	}
+
+	s.deliver(contact, notificationType, data)
 }
 
-// sendNotification sends a notification to a user
-func (s *Service) sendNotification(userID, notificationType, message string) {
-	// In a real implementation, this would integrate with:
-	// - Email service (SendGrid, AWS SES)
-	// - SMS service (Twilio)
-	// - Push notifications (Firebase)
-	// - In-app notifications
+// deliver renders a notification in the contact's language and sends it over
+// every channel their preferences allow that can reach them; a failing
+// channel doesn't stop the others
+func (s *Service) deliver(contact Contact, notificationType string, data map[string]interface{}) {
+	prefs, err := s.repo.GetPreferences(contact.UserID)
+	if err != nil {
+		s.logger.Printf("Failed to load preferences of user %s: %v", contact.UserID, err)
+		if !transactional[notificationType] {
+			// Without preferences we can't tell whether the user unsubscribed
+			return
+		}
+		// Better the default language and channels than no notification
+		prefs = Preferences{UserID: contact.UserID}
+	}
 
-	s.logger.Printf("Sending %s notification to user %s: %s", notificationType, userID, message)
+	var unsubscribeURL string
+	if !transactional[notificationType] {
+		if prefs.UnsubscribedAt != nil {
+			s.logger.Printf("Not sending %s notification to unsubscribed user %s", notificationType, contact.UserID)
+			return
+		}
+		if unsubscribeURL, err = s.unsubscribeURL(contact.UserID); err != nil {
+			s.logger.Printf("Not sending %s notification to user %s without an unsubscribe link: %v", notificationType, contact.UserID, err)
+			return
+		}
+		data["UnsubscribeURL"] = unsubscribeURL
+	}
+
+	if _, ok := data["Name"]; !ok {
+		data["Name"] = contact.Name
+	}
+	msg, err := s.renderer.Render(notificationType, prefs.Locale, data)
+	if err != nil {
+		s.logger.Printf("Failed to render %s notification for user %s: %v", notificationType, contact.UserID, err)
+		return
+	}
+	msg.UserID = contact.UserID
+	msg.UnsubscribeURL = unsubscribeURL
+
+	now := time.Now()
+	channels, deferred := s.route(prefs, notificationType, now)
+	for _, channel := range channels {
+		ref, err := channel.Send(context.Background(), contact, msg)
+		if errors.Is(err, ErrNoAddress) {
+			// The user can't be reached over this channel, e.g. SMS without a phone number
+			continue
+		}
+		s.record(contact, msg, channel.Name(), ref, err)
+	}
+	for _, channel := range deferred {
+		s.deferDelivery(contact, msg, channel.Name(), prefs.QuietHours.Until(now))
+	}
+}
 
-	// Simulate notification sending
-	time.Sleep(100 * time.Millisecond) // Simulate network delay
+// unsubscribeURL builds the link that unsubscribes a user from non-transactional notifications
+func (s *Service) unsubscribeURL(userID string) (string, error) {
+	candidate, err := newUnsubscribeToken()
+	if err != nil {
+		return "", err
+	}
+	token, err := s.repo.UnsubscribeToken(userID, candidate)
+	if err != nil {
+		return "", fmt.Errorf("failed to get unsubscribe token: %w", err)
+	}
+	return s.appURL + "/notifications/unsubscribe?token=" + url.QueryEscape(token), nil
+}
 
-	s.logger.Printf("Notification sent successfully to user %s", userID)
+// parseEventTime parses an RFC 3339 event timestamp, falling back to now
+func parseEventTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return t
 }
 
 // unmarshalPayload unmarshals event payload into the given struct
@@ -0,0 +1,94 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxProviderResponse bounds how much of a provider's response is read
+const maxProviderResponse = 64 << 10
+
+// SMSChannel sends text messages through a generic HTTP provider. It posts
+// {"to", "from", "text"} as JSON with the API key as a bearer token and reads
+// the provider's message ID from an optional {"id"} in the response.
+type SMSChannel struct {
+	url    string
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+// NewSMSChannel creates an SMSChannel
+func NewSMSChannel(cfg SMSConfig, client *http.Client) (*SMSChannel, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("SMS_PROVIDER_URL is required")
+	}
+	return &SMSChannel{url: cfg.URL, apiKey: cfg.APIKey, from: cfg.From, client: client}, nil
+}
+
+// Name returns the channel name
+func (c *SMSChannel) Name() string {
+	return ChannelSMS
+}
+
+// Send texts the message body to the contact's phone
+func (c *SMSChannel) Send(ctx context.Context, to Contact, msg Message) (string, error) {
+	if to.Phone == "" {
+		return "", ErrNoAddress
+	}
+
+	body, err := json.Marshal(map[string]string{"to": to.Phone, "from": c.from, "text": msg.Text})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode SMS: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to build SMS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	respBody, err := doProviderRequest(c.client, req)
+	if err != nil {
+		return "", fmt.Errorf("SMS provider: %w", err)
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	// Providers that don't return JSON still delivered the message
+	_ = json.Unmarshal(respBody, &result)
+	return result.ID, nil
+}
+
+// doProviderRequest sends req and returns the response body, failing on
+// non-2xx statuses. Statuses saying the request itself is bad are ErrRejected;
+// the rest, such as 429 or 503, may succeed on a retry.
+func doProviderRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponse))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusBadRequest, resp.StatusCode == http.StatusRequestEntityTooLarge,
+		resp.StatusCode == http.StatusUnprocessableEntity:
+		return nil, fmt.Errorf("%w: status %s: %s", ErrRejected, resp.Status, bytes.TrimSpace(body))
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
@@ -0,0 +1,209 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPChannel sends email through an SMTP relay, upgrading to TLS with
+// STARTTLS whenever the server offers it
+type SMTPChannel struct {
+	addr    string
+	host    string
+	auth    smtp.Auth
+	from    *mail.Address
+	timeout time.Duration
+}
+
+// NewSMTPChannel creates an SMTPChannel; timeout bounds each delivery
+func NewSMTPChannel(cfg SMTPConfig, timeout time.Duration) (*SMTPChannel, error) {
+	if cfg.Host == "" || cfg.Port == "" {
+		return nil, errors.New("SMTP_HOST and SMTP_PORT are required")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+
+	c := &SMTPChannel{
+		addr:    net.JoinHostPort(cfg.Host, cfg.Port),
+		host:    cfg.Host,
+		from:    from,
+		timeout: timeout,
+	}
+	if cfg.Username != "" {
+		// net/smtp refuses to send PLAIN credentials without TLS, except to localhost
+		c.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return c, nil
+}
+
+// Name returns the channel name
+func (c *SMTPChannel) Name() string {
+	return ChannelEmail
+}
+
+// Send delivers msg to the contact's email and returns its Message-ID
+func (c *SMTPChannel) Send(ctx context.Context, to Contact, msg Message) (string, error) {
+	if to.Email == "" {
+		return "", ErrNoAddress
+	}
+
+	messageID, err := c.messageID()
+	if err != nil {
+		return "", err
+	}
+	body, err := c.compose(to, msg, messageID)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		conn.Close()
+		return "", fmt.Errorf("failed to greet SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.host}); err != nil {
+			return "", fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if c.auth != nil {
+		if err := client.Auth(c.auth); err != nil {
+			return "", fmt.Errorf("failed to authenticate with SMTP server: %w", err)
+		}
+	}
+
+	if err := client.Mail(c.from.Address); err != nil {
+		return "", fmt.Errorf("SMTP server rejected sender: %w", err)
+	}
+	if err := client.Rcpt(to.Email); err != nil {
+		return "", fmt.Errorf("SMTP server rejected recipient: %w", rejection(err))
+	}
+	w, err := client.Data()
+	if err != nil {
+		return "", fmt.Errorf("SMTP server rejected message: %w", rejection(err))
+	}
+	if _, err := w.Write(body); err != nil {
+		return "", fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("SMTP server rejected message: %w", rejection(err))
+	}
+
+	// The message is accepted once DATA completes; a failed QUIT doesn't undo that
+	client.Quit()
+	return messageID, nil
+}
+
+// rejection marks permanent (5xx) SMTP replies as ErrRejected; anything else,
+// such as a 4xx "try again later", may succeed on a retry
+func rejection(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	return err
+}
+
+// messageID generates a unique Message-ID in the sender's domain
+func (c *SMTPChannel) messageID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate message ID: %w", err)
+	}
+	domain := c.from.Address[strings.LastIndex(c.from.Address, "@")+1:]
+	return "<" + hex.EncodeToString(raw) + "@" + domain + ">", nil
+}
+
+// compose builds the MIME message: plain text, or multipart/alternative when
+// the message has an HTML version
+func (c *SMTPChannel) compose(to Contact, msg Message, messageID string) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+
+	recipient := mail.Address{Name: to.Name, Address: to.Email}
+	header("From", c.from.String())
+	header("To", recipient.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	header("MIME-Version", "1.0")
+	if msg.UnsubscribeURL != "" {
+		// One-click unsubscribe (RFC 8058): mail clients POST to the link
+		header("List-Unsubscribe", "<"+msg.UnsubscribeURL+">")
+		header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
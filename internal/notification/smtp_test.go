@@ -0,0 +1,104 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/test/mocks"
+)
+
+func TestSMTPChannelSend(t *testing.T) {
+	tests := []struct {
+		name         string
+		reject       string // reply of the server to MAIL FROM, if it refuses
+		to           Contact
+		msg          Message
+		wantErr      error
+		wantFailed   bool
+		wantContains []string
+	}{
+		{
+			name:         "plain text message",
+			to:           Contact{Name: "Ada Lovelace", Email: "ada@example.com"},
+			msg:          Message{Subject: "Your order is complete", Text: "Thanks, Ada."},
+			wantContains: []string{`To: "Ada Lovelace" <ada@example.com>`, "Subject: Your order is complete", "Content-Type: text/plain", "Thanks, Ada."},
+		},
+		{
+			name:         "HTML alternative and one-click unsubscribe",
+			to:           Contact{Email: "ada@example.com"},
+			msg:          Message{Subject: "Welcome", Text: "Hi", HTML: "<p>Hi</p>", UnsubscribeURL: "https://shop.example.com/unsubscribe?token=t"},
+			wantContains: []string{"multipart/alternative", "text/html", "List-Unsubscribe: <https://shop.example.com/unsubscribe?token=t>", "List-Unsubscribe-Post: List-Unsubscribe=One-Click"},
+		},
+		{
+			name:    "contact without an email",
+			to:      Contact{UserID: "1"},
+			msg:     Message{Subject: "Hi", Text: "Hi"},
+			wantErr: ErrNoAddress,
+		},
+		{
+			name:       "server temporarily unavailable",
+			reject:     "421 Service not available",
+			to:         Contact{Email: "ada@example.com"},
+			msg:        Message{Subject: "Hi", Text: "Hi"},
+			wantFailed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := mocks.NewSMTPServer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+			server.Reject(tt.reject)
+
+			host, port, _ := net.SplitHostPort(server.Addr())
+			channel, err := NewSMTPChannel(SMTPConfig{Host: host, Port: port, From: "Shop <no-reply@shop.example.com>"}, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ref, err := channel.Send(context.Background(), tt.to, tt.msg)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Send() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantFailed:
+				if err == nil || errors.Is(err, ErrRejected) {
+					t.Fatalf("Send() error = %v, want a failure worth retrying", err)
+				}
+			case err != nil:
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			messages := server.Messages()
+			if err != nil {
+				if len(messages) != 0 {
+					t.Errorf("server accepted %d messages after a failure", len(messages))
+				}
+				return
+			}
+			if len(messages) != 1 {
+				t.Fatalf("server accepted %d messages, want 1", len(messages))
+			}
+			got := messages[0]
+			if got.From != "no-reply@shop.example.com" || len(got.To) != 1 || got.To[0] != tt.to.Email {
+				t.Errorf("envelope = %s -> %v", got.From, got.To)
+			}
+			if !strings.Contains(got.Data, "Message-ID: "+ref) || !strings.HasSuffix(ref, "@shop.example.com>") {
+				t.Errorf("Message-ID %q missing from the message", ref)
+			}
+			for _, want := range tt.wantContains {
+				if !strings.Contains(got.Data, want) {
+					t.Errorf("message doesn't contain %q:\n%s", want, got.Data)
+				}
+			}
+		})
+	}
+}
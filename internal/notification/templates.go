@@ -0,0 +1,545 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+)
+
+// templateFiles holds the built-in copy, one directory per locale with a
+// subject, text and optional html file per notification type, e.g.
+// templates/de/welcome.subject.tmpl
+//
+//go:embed templates
+var templateFiles embed.FS
+
+var (
+	// ErrTemplateNotFound is returned when no template exists for a type and locale
+	ErrTemplateNotFound = errors.New("template not found")
+	// ErrUnknownNotificationType is returned for templates of types the service never sends
+	ErrUnknownNotificationType = errors.New("unknown notification type")
+	// ErrReadOnlyTemplate is returned when saving a template of a readOnlyTemplates type
+	ErrReadOnlyTemplate = errors.New("template is read-only")
+)
+
+// readOnlyTemplates are the types whose Link carries a single-use secret
+// token. Only their built-in copy is used, so an edit can't drop the link or
+// send the token anywhere but the recipient.
+var readOnlyTemplates = map[string]bool{
+	"email_verification": true,
+	"password_reset":     true,
+}
+
+// Template parts, as named in TemplateError and field violations
+const (
+	partSubject = "subject"
+	partText    = "text"
+	partHTML    = "html"
+)
+
+// Template is the copy of one notification type in one locale. Subject and
+// Text are text/template sources and HTML an optional html/template source;
+// all are executed with the data of the notification, see sampleData.
+type Template struct {
+	Type    string
+	Locale  string
+	Subject string
+	Text    string
+	HTML    string
+	// Custom templates are stored in the database and override the built-in default
+	Custom    bool
+	UpdatedAt time.Time // zero for built-in defaults
+}
+
+// TemplateError reports the part of a template that failed to parse or execute
+type TemplateError struct {
+	Part string
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return e.Part + ": " + e.Err.Error()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// sampleData is example data for each notification type the service sends,
+// with the same keys the event handlers provide. Templates are checked against
+// it before they're saved, and previews render it.
+var sampleData = map[string]map[string]interface{}{
+	"welcome": {
+		"Name":           "Ada Lovelace",
+		"UnsubscribeURL": sampleUnsubscribeURL,
+	},
+	"profile_update": {
+		"Name": "Ada Lovelace",
+	},
+	"email_verification": {
+		"Name":      "Ada Lovelace",
+		"Email":     "ada@example.com",
+		"Link":      "https://shop.example.com/auth/verify-email?token=sample",
+		"ExpiresAt": "2025-03-14T15:09:26Z",
+	},
+	"sign_in": {
+		"Name":       "Ada Lovelace",
+		"LoggedInAt": "2025-03-14T15:09:26Z",
+	},
+	"password_changed": {
+		"Name":   "Ada Lovelace",
+		"Method": "change", // or "reset"
+	},
+	"password_reset": {
+		"Name":      "Ada Lovelace",
+		"Email":     "ada@example.com",
+		"Link":      "https://shop.example.com/reset-password?token=sample",
+		"ExpiresAt": "2025-03-14T15:09:26Z",
+	},
+	"order_confirmation": {
+		"Name":     "Ada Lovelace",
+		"OrderID":  "42",
+		"Subtotal": money.Money{Amount: 3000, Currency: "EUR"},
+		"Tax":      money.Money{Amount: 570, Currency: "EUR"},
+		"Amount":   money.Money{Amount: 3570, Currency: "EUR"},
+		"Items": []messaging.OrderItemPayload{
+			{SKU: "MUG-01", Name: "Mug", Quantity: 2, UnitPrice: money.Money{Amount: 1000, Currency: "EUR"}, Total: money.Money{Amount: 2380, Currency: "EUR"}},
+			{SKU: "TEA-01", Name: "Tea", Quantity: 1, UnitPrice: money.Money{Amount: 1000, Currency: "EUR"}, Total: money.Money{Amount: 1190, Currency: "EUR"}},
+		},
+	},
+	"order_completed": {
+		"Name":           "Ada Lovelace",
+		"OrderID":        "42",
+		"UnsubscribeURL": sampleUnsubscribeURL,
+	},
+	"order_cancelled": {
+		"Name":           "Ada Lovelace",
+		"OrderID":        "42",
+		"UnsubscribeURL": sampleUnsubscribeURL,
+	},
+	// Digests batch notifications of their type; each entry of Notifications
+	// has the data of one of them
+	"order_confirmation_digest": {
+		"Name":  "Ada Lovelace",
+		"Count": 2,
+		"Notifications": []map[string]interface{}{
+			{"OrderID": "42", "Subtotal": money.Money{Amount: 3000, Currency: "EUR"}, "Tax": money.Money{Amount: 570, Currency: "EUR"}, "Amount": money.Money{Amount: 3570, Currency: "EUR"}, "Items": []messaging.OrderItemPayload{
+				{SKU: "MUG-01", Name: "Mug", Quantity: 3, UnitPrice: money.Money{Amount: 1000, Currency: "EUR"}, Total: money.Money{Amount: 3570, Currency: "EUR"}},
+			}},
+			{"OrderID": "43", "Subtotal": money.Money{Amount: 1000, Currency: "EUR"}, "Tax": money.Money{Amount: 190, Currency: "EUR"}, "Amount": money.Money{Amount: 1190, Currency: "EUR"}, "Items": []messaging.OrderItemPayload{
+				{SKU: "TEA-01", Name: "Tea", Quantity: 1, UnitPrice: money.Money{Amount: 1000, Currency: "EUR"}, Total: money.Money{Amount: 1190, Currency: "EUR"}},
+			}},
+		},
+	},
+	"order_completed_digest": {
+		"Name":           "Ada Lovelace",
+		"Count":          2,
+		"Notifications":  []map[string]interface{}{{"OrderID": "42"}, {"OrderID": "43"}},
+		"UnsubscribeURL": sampleUnsubscribeURL,
+	},
+	"order_cancelled_digest": {
+		"Name":           "Ada Lovelace",
+		"Count":          2,
+		"Notifications":  []map[string]interface{}{{"OrderID": "42"}, {"OrderID": "43"}},
+		"UnsubscribeURL": sampleUnsubscribeURL,
+	},
+}
+
+// dateLayouts are how languages write timestamps; others use defaultDateLayout
+var dateLayouts = map[string]string{
+	"en": "Jan 2, 2006 15:04 MST",
+	"de": "02.01.2006 15:04 MST",
+	"es": "02/01/2006 15:04 MST",
+	"fr": "02/01/2006 15:04 MST",
+	"it": "02/01/2006 15:04 MST",
+	"nl": "02-01-2006 15:04 MST",
+	"pt": "02/01/2006 15:04 MST",
+	"ro": "02.01.2006 15:04 MST",
+}
+
+const defaultDateLayout = "2006-01-02 15:04 MST"
+
+// sampleUnsubscribeURL stands in for the unsubscribe link of non-transactional notifications
+const sampleUnsubscribeURL = "https://shop.example.com/notifications/unsubscribe?token=sample"
+
+// Renderer turns notification data into messages with the template for the
+// recipient's locale: a custom template from the database if there is one,
+// otherwise the built-in default. Locales fall back to their language, then
+// to the default locale, e.g. "de-AT" → "de" → "en-US" → "en".
+type Renderer struct {
+	repo          Repository
+	defaults      fs.FS
+	defaultLocale string
+	logger        *log.Logger
+}
+
+// NewRenderer creates a new Renderer for recipients without a locale of their own
+func NewRenderer(repo Repository, defaultLocale string, logger *log.Logger) *Renderer {
+	defaults, err := fs.Sub(templateFiles, "templates")
+	if err != nil {
+		panic(err) // the embedded directory is fixed at compile time
+	}
+	return &Renderer{
+		repo:          repo,
+		defaults:      defaults,
+		defaultLocale: NormalizeLocale(defaultLocale),
+		logger:        logger,
+	}
+}
+
+// Render renders a notification for a recipient in locale, which may be empty.
+// When a custom template can't be loaded or fails to execute the built-in
+// default is used, so neither an outage nor a bad edit stops notifications.
+// So is the default when a custom template leaves out the unsubscribe link in
+// data, e.g. one saved while its type was still transactional.
+func (r *Renderer) Render(notificationType, locale string, data map[string]interface{}) (Message, error) {
+	locale = r.formatLocale(locale)
+
+	tmpl, err := r.Resolve(notificationType, locale)
+	if err != nil && !errors.Is(err, ErrTemplateNotFound) {
+		r.logger.Printf("Failed to load custom %s template, using the default: %v", notificationType, err)
+		tmpl, err = r.resolveDefault(notificationType, locale)
+	}
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg, err := executeTemplate(tmpl, locale, data)
+	if unsubscribeURL, _ := data["UnsubscribeURL"].(string); err == nil && tmpl.Custom && unsubscribeURL != "" && !strings.Contains(msg.Text, unsubscribeURL) {
+		err = errors.New("text doesn't include the unsubscribe link")
+	}
+	if err != nil && tmpl.Custom {
+		r.logger.Printf("Failed to render custom %s template (%s), using the default: %v", notificationType, tmpl.Locale, err)
+		if def, defErr := r.resolveDefault(notificationType, locale); defErr == nil {
+			return executeTemplate(def, locale, data)
+		}
+	}
+	return msg, err
+}
+
+// Preview renders tmpl with the sample data of its type, optionally overriding
+// some of the sample values, and returns the message recipients in locale
+// would get
+func (r *Renderer) Preview(tmpl Template, locale string, overrides map[string]string) (Message, error) {
+	sample, ok := sampleData[tmpl.Type]
+	if !ok {
+		return Message{}, fmt.Errorf("%w: %s", ErrUnknownNotificationType, tmpl.Type)
+	}
+
+	data := make(map[string]interface{}, len(sample))
+	for key, value := range sample {
+		data[key] = value
+	}
+	for key, value := range overrides {
+		data[key] = value
+	}
+	return executeTemplate(tmpl, r.formatLocale(locale), data)
+}
+
+// Resolve returns the template used for a notification type in locale
+func (r *Renderer) Resolve(notificationType, locale string) (Template, error) {
+	if readOnlyTemplates[notificationType] {
+		return r.resolveDefault(notificationType, locale)
+	}
+	for _, candidate := range r.candidates(locale) {
+		tmpl, err := r.repo.GetTemplate(notificationType, candidate)
+		if err == nil {
+			return tmpl, nil
+		}
+		if !errors.Is(err, ErrTemplateNotFound) {
+			return Template{}, fmt.Errorf("failed to load %s template: %w", notificationType, err)
+		}
+
+		if tmpl, err := r.defaultTemplate(notificationType, candidate); err == nil {
+			return tmpl, nil
+		}
+	}
+	return Template{}, fmt.Errorf("%w: %s (%s)", ErrTemplateNotFound, notificationType, locale)
+}
+
+// resolveDefault is Resolve ignoring custom templates
+func (r *Renderer) resolveDefault(notificationType, locale string) (Template, error) {
+	for _, candidate := range r.candidates(locale) {
+		if tmpl, err := r.defaultTemplate(notificationType, candidate); err == nil {
+			return tmpl, nil
+		}
+	}
+	return Template{}, fmt.Errorf("%w: %s (%s)", ErrTemplateNotFound, notificationType, locale)
+}
+
+// Templates lists the template of every type and locale, custom templates in
+// place of the defaults they override, sorted by type and locale. Empty
+// arguments match everything.
+func (r *Renderer) Templates(notificationType, locale string) ([]Template, error) {
+	locale = NormalizeLocale(locale)
+
+	custom, err := r.repo.ListTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	byKey := make(map[string]Template)
+	for _, tmpl := range r.defaultTemplates() {
+		byKey[tmpl.Type+"/"+tmpl.Locale] = tmpl
+	}
+	for _, tmpl := range custom {
+		if !readOnlyTemplates[tmpl.Type] {
+			byKey[tmpl.Type+"/"+tmpl.Locale] = tmpl
+		}
+	}
+
+	templates := make([]Template, 0, len(byKey))
+	for _, tmpl := range byKey {
+		if (notificationType == "" || tmpl.Type == notificationType) && (locale == "" || tmpl.Locale == locale) {
+			templates = append(templates, tmpl)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Type != templates[j].Type {
+			return templates[i].Type < templates[j].Type
+		}
+		return templates[i].Locale < templates[j].Locale
+	})
+	return templates, nil
+}
+
+// Check reports the first part of tmpl that doesn't parse or doesn't execute
+// with the sample data of its type, as a *TemplateError. Non-transactional
+// templates must also show the unsubscribe link in their text.
+func (r *Renderer) Check(tmpl Template) error {
+	msg, err := r.Preview(tmpl, tmpl.Locale, nil)
+	if err != nil {
+		return err
+	}
+	if !transactional[tmpl.Type] && !strings.Contains(msg.Text, sampleUnsubscribeURL) {
+		return &TemplateError{Part: partText, Err: errors.New("must include the unsubscribe link {{.UnsubscribeURL}}")}
+	}
+	return nil
+}
+
+// candidates lists the locales tried for a recipient in locale, most specific first
+func (r *Renderer) candidates(locale string) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, l := range []string{locale, r.defaultLocale} {
+		for _, c := range []string{l, language(l)} {
+			if c != "" && !seen[c] {
+				seen[c] = true
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	return candidates
+}
+
+// formatLocale is the locale amounts and dates are formatted in for a recipient
+func (r *Renderer) formatLocale(locale string) string {
+	if locale = NormalizeLocale(locale); locale != "" {
+		return locale
+	}
+	return r.defaultLocale
+}
+
+// defaultTemplate loads the built-in template of a type in exactly locale
+func (r *Renderer) defaultTemplate(notificationType, locale string) (Template, error) {
+	tmpl := Template{Type: notificationType, Locale: locale}
+	for _, part := range []struct {
+		name     string
+		dst      *string
+		optional bool
+	}{
+		{partSubject, &tmpl.Subject, false},
+		{partText, &tmpl.Text, false},
+		{partHTML, &tmpl.HTML, true},
+	} {
+		data, err := fs.ReadFile(r.defaults, path.Join(locale, notificationType+"."+part.name+".tmpl"))
+		if errors.Is(err, fs.ErrNotExist) && part.optional {
+			continue
+		}
+		if err != nil {
+			return Template{}, ErrTemplateNotFound
+		}
+		*part.dst = string(data)
+	}
+	return tmpl, nil
+}
+
+// defaultTemplates loads every built-in template
+func (r *Renderer) defaultTemplates() []Template {
+	var templates []Template
+	locales, _ := fs.ReadDir(r.defaults, ".")
+	for _, dir := range locales {
+		if !dir.IsDir() {
+			continue
+		}
+		for notificationType := range sampleData {
+			if tmpl, err := r.defaultTemplate(notificationType, dir.Name()); err == nil {
+				templates = append(templates, tmpl)
+			}
+		}
+	}
+	return templates
+}
+
+// executeTemplate renders every part of tmpl, formatting amounts and dates for locale
+func executeTemplate(tmpl Template, locale string, data map[string]interface{}) (Message, error) {
+	funcs := templateFuncs(locale)
+	msg := Message{Type: tmpl.Type}
+
+	subject, err := executeText(partSubject, tmpl.Subject, funcs, data)
+	if err != nil {
+		return Message{}, err
+	}
+	// A subject is a single header line
+	msg.Subject = strings.Join(strings.Fields(subject), " ")
+
+	text, err := executeText(partText, tmpl.Text, funcs, data)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.Text = strings.TrimSpace(text)
+
+	if strings.TrimSpace(tmpl.HTML) != "" {
+		t, err := htmltemplate.New(partHTML).Option("missingkey=error").Funcs(htmltemplate.FuncMap(funcs)).Parse(tmpl.HTML)
+		if err != nil {
+			return Message{}, &TemplateError{Part: partHTML, Err: err}
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return Message{}, &TemplateError{Part: partHTML, Err: err}
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
+
+func executeText(part, source string, funcs template.FuncMap, data map[string]interface{}) (string, error) {
+	t, err := template.New(part).Option("missingkey=error").Funcs(funcs).Parse(source)
+	if err != nil {
+		return "", &TemplateError{Part: part, Err: err}
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", &TemplateError{Part: part, Err: err}
+	}
+	return buf.String(), nil
+}
+
+// templateFuncs are the functions available to templates:
+//
+//	{{money .Amount}}        "35,70 €" in de
+//	{{datetime .ExpiresAt}}  an RFC 3339 timestamp in the locale's format
+func templateFuncs(locale string) template.FuncMap {
+	return template.FuncMap{
+		"money": func(m money.Money) string {
+			return m.Format(locale)
+		},
+		"datetime": func(value string) string {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return value
+			}
+			layout, ok := dateLayouts[language(locale)]
+			if !ok {
+				layout = defaultDateLayout
+			}
+			return t.Format(layout)
+		},
+	}
+}
+
+// NormalizeLocale canonicalizes a BCP 47 style locale such as "de_at" to "de-AT"
+func NormalizeLocale(locale string) string {
+	locale = strings.TrimSpace(strings.ReplaceAll(locale, "_", "-"))
+	if locale == "" {
+		return ""
+	}
+	lang, region, ok := strings.Cut(locale, "-")
+	if !ok {
+		return strings.ToLower(lang)
+	}
+	return strings.ToLower(lang) + "-" + strings.ToUpper(region)
+}
+
+// language returns the language of a locale, e.g. "de" for "de-AT"
+func language(locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	return lang
+}
+
+// Templates lists the templates of a type and locale; empty arguments match everything
+func (s *Service) Templates(notificationType, locale string) ([]Template, error) {
+	return s.renderer.Templates(notificationType, locale)
+}
+
+// SaveTemplate stores a custom template after checking that it renders
+func (s *Service) SaveTemplate(tmpl Template) (Template, error) {
+	if _, ok := sampleData[tmpl.Type]; !ok {
+		return Template{}, fmt.Errorf("%w: %s", ErrUnknownNotificationType, tmpl.Type)
+	}
+	if readOnlyTemplates[tmpl.Type] {
+		return Template{}, fmt.Errorf("%w: %s templates carry secret links", ErrReadOnlyTemplate, tmpl.Type)
+	}
+	tmpl.Locale = NormalizeLocale(tmpl.Locale)
+	if err := s.renderer.Check(tmpl); err != nil {
+		return Template{}, err
+	}
+
+	saved, err := s.repo.SaveTemplate(tmpl)
+	if err != nil {
+		return Template{}, fmt.Errorf("failed to save template: %w", err)
+	}
+	s.logger.Printf("Saved %s template for locale %s", saved.Type, saved.Locale)
+	return saved, nil
+}
+
+// DeleteTemplate removes a custom template, restoring the built-in default
+func (s *Service) DeleteTemplate(notificationType, locale string) error {
+	err := s.repo.DeleteTemplate(notificationType, NormalizeLocale(locale))
+	if errors.Is(err, ErrTemplateNotFound) {
+		return fmt.Errorf("%w: no custom %s template for %s", ErrTemplateNotFound, notificationType, locale)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	s.logger.Printf("Deleted %s template for locale %s", notificationType, locale)
+	return nil
+}
+
+// PreviewTemplate renders a notification type as recipients in locale would
+// get it, with sample data. A draft with a subject or text is rendered instead
+// of the stored template, so copy can be tried out before it's saved.
+func (s *Service) PreviewTemplate(notificationType, locale string, draft Template, data map[string]string) (Message, Template, error) {
+	if _, ok := sampleData[notificationType]; !ok {
+		return Message{}, Template{}, fmt.Errorf("%w: %s", ErrUnknownNotificationType, notificationType)
+	}
+
+	tmpl := draft
+	if draft.Subject == "" && draft.Text == "" {
+		var err error
+		if tmpl, err = s.renderer.Resolve(notificationType, s.renderer.formatLocale(locale)); err != nil {
+			return Message{}, Template{}, err
+		}
+	} else {
+		tmpl.Type = notificationType
+		tmpl.Locale = NormalizeLocale(locale)
+	}
+
+	msg, err := s.renderer.Preview(tmpl, locale, data)
+	if err != nil {
+		return Message{}, Template{}, err
+	}
+	return msg, tmpl, nil
+}
@@ -0,0 +1,241 @@
+package notification
+
+import (
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+// templateRepo keeps custom templates in memory; other Repository methods
+// aren't used by the renderer
+type templateRepo struct {
+	Repository
+	templates map[string]Template
+}
+
+func newTemplateRepo(custom ...Template) *templateRepo {
+	r := &templateRepo{templates: make(map[string]Template)}
+	for _, tmpl := range custom {
+		tmpl.Custom = true
+		r.templates[tmpl.Type+"/"+tmpl.Locale] = tmpl
+	}
+	return r
+}
+
+func (r *templateRepo) GetTemplate(notificationType, locale string) (Template, error) {
+	tmpl, ok := r.templates[notificationType+"/"+locale]
+	if !ok {
+		return Template{}, ErrTemplateNotFound
+	}
+	return tmpl, nil
+}
+
+func (r *templateRepo) ListTemplates() ([]Template, error) {
+	var templates []Template
+	for _, tmpl := range r.templates {
+		templates = append(templates, tmpl)
+	}
+	return templates, nil
+}
+
+func (r *templateRepo) SaveTemplate(tmpl Template) (Template, error) {
+	tmpl.Custom = true
+	r.templates[tmpl.Type+"/"+tmpl.Locale] = tmpl
+	return tmpl, nil
+}
+
+func TestRendererRender(t *testing.T) {
+	custom := []Template{
+		{Type: "welcome", Locale: "de", Subject: "Hallo {{.Name}}", Text: "Servus {{.Name}} {{.UnsubscribeURL}}"},
+		{Type: "profile_update", Locale: "en", Subject: "Broken", Text: "{{.Missing}}"},
+		{Type: "password_reset", Locale: "en", Subject: "Reset", Text: "https://attacker.example/?t={{.Link}}"},
+		{Type: "order_completed", Locale: "en", Subject: "Done", Text: "Order {{.OrderID}} is done"},
+	}
+
+	tests := []struct {
+		name        string
+		typ         string
+		locale      string
+		data        map[string]interface{}
+		wantSubject string
+		wantText    string
+	}{
+		{
+			name:        "built-in template in the default locale",
+			typ:         "order_completed",
+			locale:      "",
+			data:        sampleData["order_completed"],
+			wantSubject: "Your order is complete",
+		},
+		{
+			name:        "custom template overrides the built-in one",
+			typ:         "welcome",
+			locale:      "de",
+			data:        sampleData["welcome"],
+			wantSubject: "Hallo Ada Lovelace",
+			wantText:    "Servus Ada Lovelace",
+		},
+		{
+			name:        "regional locale falls back to its language",
+			typ:         "welcome",
+			locale:      "de_at",
+			data:        sampleData["welcome"],
+			wantSubject: "Hallo Ada Lovelace",
+		},
+		{
+			name:     "amounts are formatted for the locale",
+			typ:      "order_confirmation",
+			locale:   "de-DE",
+			data:     sampleData["order_confirmation"],
+			wantText: "35,70\u00a0€",
+		},
+		{
+			name:        "custom template failing at send time falls back to the built-in one",
+			typ:         "profile_update",
+			locale:      "en",
+			data:        sampleData["profile_update"],
+			wantSubject: "Your profile was updated",
+		},
+		{
+			name:     "custom templates of read-only types are ignored",
+			typ:      "password_reset",
+			locale:   "en",
+			data:     map[string]interface{}{"Name": "Ada", "Email": "ada@example.com", "Link": "https://shop.example.com/reset-password?token=secret", "ExpiresAt": "2025-03-14T15:09:26Z"},
+			wantText: "https://shop.example.com/reset-password?token=secret",
+		},
+		{
+			name:        "custom template without the unsubscribe link falls back to the built-in one",
+			typ:         "order_completed",
+			locale:      "en",
+			data:        sampleData["order_completed"],
+			wantSubject: "Your order is complete",
+			wantText:    sampleUnsubscribeURL,
+		},
+	}
+
+	renderer := NewRenderer(newTemplateRepo(custom...), "en", log.New(io.Discard, "", 0))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := renderer.Render(tt.typ, tt.locale, tt.data)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if !strings.Contains(msg.Subject, tt.wantSubject) {
+				t.Errorf("subject = %q, want it to contain %q", msg.Subject, tt.wantSubject)
+			}
+			if !strings.Contains(msg.Text, tt.wantText) {
+				t.Errorf("text = %q, want it to contain %q", msg.Text, tt.wantText)
+			}
+			if strings.Contains(msg.Text, "attacker") {
+				t.Errorf("text = %q renders a read-only type's custom template", msg.Text)
+			}
+		})
+	}
+}
+
+func TestServiceSaveTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		tmpl     Template
+		wantErr  error
+		wantPart string
+	}{
+		{
+			name: "valid template is saved",
+			tmpl: Template{Type: "order_confirmation", Locale: "de_AT", Subject: "Bestellung {{.OrderID}}", Text: "Danke, {{.Name}}."},
+		},
+		{
+			name:    "unknown type",
+			tmpl:    Template{Type: "newsletter", Locale: "en", Subject: "Hi", Text: "Hi"},
+			wantErr: ErrUnknownNotificationType,
+		},
+		{
+			name:    "secret-link type is read-only",
+			tmpl:    Template{Type: "email_verification", Locale: "en", Subject: "Verify", Text: "{{.Link}}"},
+			wantErr: ErrReadOnlyTemplate,
+		},
+		{
+			name:     "syntax error",
+			tmpl:     Template{Type: "order_completed", Locale: "en", Subject: "{{.OrderID", Text: "Done"},
+			wantPart: partSubject,
+		},
+		{
+			name:     "unknown field",
+			tmpl:     Template{Type: "order_completed", Locale: "en", Subject: "Done", Text: "{{.Link}}"},
+			wantPart: partText,
+		},
+		{
+			name:     "non-transactional template without the unsubscribe link",
+			tmpl:     Template{Type: "welcome", Locale: "en", Subject: "Welcome", Text: "Hi {{.Name}}"},
+			wantPart: partText,
+		},
+		{
+			name:     "order status updates carry the unsubscribe link too",
+			tmpl:     Template{Type: "order_cancelled", Locale: "en", Subject: "Cancelled", Text: "Order {{.OrderID}} was cancelled"},
+			wantPart: partText,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(io.Discard, "", 0)
+			repo := newTemplateRepo()
+			s := &Service{repo: repo, renderer: NewRenderer(repo, "en", logger), logger: logger}
+
+			saved, err := s.SaveTemplate(tt.tmpl)
+
+			var templateErr *TemplateError
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SaveTemplate() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantPart != "":
+				if !errors.As(err, &templateErr) || templateErr.Part != tt.wantPart {
+					t.Fatalf("SaveTemplate() error = %v, want a %s TemplateError", err, tt.wantPart)
+				}
+			case err != nil:
+				t.Fatalf("SaveTemplate() error = %v", err)
+			default:
+				if saved.Locale != NormalizeLocale(tt.tmpl.Locale) {
+					t.Errorf("saved locale = %q, want %q", saved.Locale, NormalizeLocale(tt.tmpl.Locale))
+				}
+				return
+			}
+			if len(repo.templates) != 0 {
+				t.Errorf("rejected template was stored")
+			}
+		})
+	}
+}
+
+func TestDefaultTemplatesCheck(t *testing.T) {
+	renderer := NewRenderer(newTemplateRepo(), "en", log.New(io.Discard, "", 0))
+	templates, err := renderer.Templates("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tmpl := range templates {
+		if err := renderer.Check(tmpl); err != nil {
+			t.Errorf("built-in %s template (%s) fails its check: %v", tmpl.Type, tmpl.Locale, err)
+		}
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"DE", "de"},
+		{"de_at", "de-AT"},
+		{" en-us ", "en-US"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeLocale(tt.in); got != tt.want {
+			t.Errorf("NormalizeLocale(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
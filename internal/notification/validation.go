@@ -0,0 +1,264 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/pkg/validation"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+	// maxMarkIDs bounds how many inbox items one MarkInboxRead call names
+	maxMarkIDs = 500
+	// maxSubjectLength and maxBodyLength bound template sources
+	maxSubjectLength = 500
+	maxBodyLength    = 100000
+	// maxTokenLength bounds unsubscribe tokens, which are 43 characters
+	maxTokenLength = 128
+)
+
+// localePattern matches a language code with an optional region, e.g. "de", "de-AT" or "pt_BR"
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_]([a-zA-Z]{2}|[0-9]{3}))?$`)
+
+func validateListInbox(req *gen.ListInboxRequest) error {
+	var v validation.Violations
+	v.ID("user_id", req.UserId)
+	v.Range("page_size", int64(req.PageSize), 0, maxPageSize)
+	return v.Err()
+}
+
+func validateMarkInboxRead(req *gen.MarkInboxReadRequest) error {
+	var v validation.Violations
+	v.ID("user_id", req.UserId)
+	if len(req.Ids) > maxMarkIDs {
+		v.Add("ids", "must have at most %d items", maxMarkIDs)
+	}
+	for i, id := range req.Ids {
+		v.ID(fmt.Sprintf("ids[%d]", i), id)
+	}
+	return v.Err()
+}
+
+func validateListTemplates(req *gen.ListTemplatesRequest) error {
+	var v validation.Violations
+	if req.Type != "" {
+		notificationType(&v, "type", req.Type)
+	}
+	if req.Locale != "" {
+		locale(&v, "locale", req.Locale)
+	}
+	return v.Err()
+}
+
+func validateSaveTemplate(req *gen.SaveTemplateRequest) error {
+	var v validation.Violations
+	notificationType(&v, "type", req.Type)
+	locale(&v, "locale", req.Locale)
+	if v.Required("subject", req.Subject) {
+		v.Length("subject", req.Subject, maxSubjectLength)
+	}
+	if v.Required("text", req.Text) {
+		body(&v, "text", req.Text)
+	}
+	body(&v, "html", req.Html)
+	return v.Err()
+}
+
+func validateDeleteTemplate(req *gen.DeleteTemplateRequest) error {
+	var v validation.Violations
+	notificationType(&v, "type", req.Type)
+	locale(&v, "locale", req.Locale)
+	return v.Err()
+}
+
+func validatePreviewTemplate(req *gen.PreviewTemplateRequest) error {
+	var v validation.Violations
+	notificationType(&v, "type", req.Type)
+	if req.Locale != "" {
+		locale(&v, "locale", req.Locale)
+	}
+	// A draft needs what a saved template needs
+	if req.Subject != "" || req.Text != "" || req.Html != "" {
+		if v.Required("subject", req.Subject) {
+			v.Length("subject", req.Subject, maxSubjectLength)
+		}
+		if v.Required("text", req.Text) {
+			body(&v, "text", req.Text)
+		}
+		body(&v, "html", req.Html)
+	}
+	if sample, ok := sampleData[req.Type]; ok {
+		for key := range req.Data {
+			// Only text values can be given as strings; amounts and items keep their samples
+			if _, ok := sample[key].(string); !ok {
+				v.Add("data."+key, "is not a text value of %s notifications", req.Type)
+			}
+		}
+	}
+	return v.Err()
+}
+
+func validateGetPreferences(req *gen.GetPreferencesRequest) error {
+	var v validation.Violations
+	v.ID("user_id", req.UserId)
+	return v.Err()
+}
+
+func validateUpdatePreferences(req *gen.UpdatePreferencesRequest) error {
+	var v validation.Violations
+	v.ID("user_id", req.UserId)
+	if req.Locale != nil && *req.Locale != "" {
+		locale(&v, "locale", *req.Locale)
+	}
+
+	seenTypes := make(map[string]bool)
+	for i, c := range req.Channels {
+		field := fmt.Sprintf("channels[%d]", i)
+		if !slices.Contains(configurableTypes(), c.Type) {
+			v.Add(field+".type", "must be one of %s", strings.Join(configurableTypes(), ", "))
+		} else if seenTypes[c.Type] {
+			v.Add(field+".type", "is listed twice")
+		}
+		seenTypes[c.Type] = true
+
+		seenChannels := make(map[string]bool)
+		for j, channel := range c.Channels {
+			switch {
+			case !knownChannels[channel]:
+				v.Add(fmt.Sprintf("%s.channels[%d]", field, j), "must be one of email, sms, webhook, inapp")
+			case seenChannels[channel]:
+				v.Add(fmt.Sprintf("%s.channels[%d]", field, j), "is listed twice")
+			}
+			seenChannels[channel] = true
+		}
+	}
+
+	if q := req.QuietHours; q != nil && (q.Start != "" || q.End != "") {
+		start, startErr := parseClock(q.Start)
+		if startErr != nil {
+			v.Add("quiet_hours.start", "must be a time of day as HH:MM")
+		}
+		end, endErr := parseClock(q.End)
+		if endErr != nil {
+			v.Add("quiet_hours.end", "must be a time of day as HH:MM")
+		}
+		if startErr == nil && endErr == nil && start == end {
+			v.Add("quiet_hours.end", "must differ from start")
+		}
+		if v.Required("quiet_hours.time_zone", q.TimeZone) {
+			if _, err := time.LoadLocation(q.TimeZone); err != nil || q.TimeZone == "Local" {
+				v.Add("quiet_hours.time_zone", "must be an IANA time zone, e.g. Europe/Berlin")
+			}
+		}
+	}
+	return v.Err()
+}
+
+func validateListDeliveries(req *gen.ListDeliveriesRequest) error {
+	var v validation.Violations
+	v.ID("user_id", req.UserId)
+	v.Range("page_size", int64(req.PageSize), 0, maxPageSize)
+	if req.Type != "" {
+		notificationType(&v, "type", req.Type)
+	}
+	if req.Channel != "" && !knownChannels[req.Channel] {
+		v.Add("channel", "must be one of email, sms, webhook, inapp")
+	}
+	if req.Status != "" && !deliveryStatuses[req.Status] {
+		v.Add("status", "must be one of %s, %s, %s", DeliverySent, DeliveryFailed, DeliveryRetrying)
+	}
+	return v.Err()
+}
+
+func validateGetDelivery(req *gen.GetDeliveryRequest) error {
+	var v validation.Violations
+	v.ID("user_id", req.UserId)
+	v.ID("id", req.Id)
+	return v.Err()
+}
+
+// deliveryStatuses are the statuses deliveries can be listed by
+var deliveryStatuses = map[string]bool{
+	DeliverySent:     true,
+	DeliveryFailed:   true,
+	DeliveryRetrying: true,
+}
+
+func validateUnsubscribe(req *gen.UnsubscribeRequest) error {
+	var v validation.Violations
+	if v.Required("token", req.Token) {
+		v.Length("token", req.Token, maxTokenLength)
+	}
+	return v.Err()
+}
+
+// knownChannels are the channel names preferences may refer to, configured or not
+var knownChannels = map[string]bool{
+	ChannelEmail:   true,
+	ChannelSMS:     true,
+	ChannelWebhook: true,
+	ChannelInApp:   true,
+}
+
+// configurableTypes lists, sorted, the notification types whose channels users
+// choose; secret links always go by email and digests follow their type
+func configurableTypes() []string {
+	var types []string
+	for notificationType := range sampleData {
+		if !emailOnly[notificationType] && baseType(notificationType) == notificationType {
+			types = append(types, notificationType)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// templateViolation reports a template that doesn't render as a violation of
+// the offending field, like any other invalid request
+func templateViolation(err error) error {
+	var tmplErr *TemplateError
+	if !errors.As(err, &tmplErr) {
+		return err
+	}
+	var v validation.Violations
+	v.Add(tmplErr.Part, "%v", tmplErr.Err)
+	return v.Err()
+}
+
+// notificationType records a violation if value isn't a type the service sends
+func notificationType(v *validation.Violations, field, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+	if _, ok := sampleData[value]; !ok {
+		types := make([]string, 0, len(sampleData))
+		for t := range sampleData {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		v.Add(field, "must be one of %s", strings.Join(types, ", "))
+	}
+}
+
+// locale records a violation if value isn't a locale such as "de" or "de-AT"
+func locale(v *validation.Violations, field, value string) {
+	if v.Required(field, value) && !localePattern.MatchString(value) {
+		v.Add(field, "must be a language code with an optional region, e.g. de or de-AT")
+	}
+}
+
+// body records a violation if a template body is too long
+func body(v *validation.Violations, field, value string) {
+	if utf8.RuneCountInString(value) > maxBodyLength {
+		v.Add(field, "must be at most %d characters", maxBodyLength)
+	}
+}
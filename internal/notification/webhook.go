@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WebhookChannel posts every notification as JSON to one outbound URL, for
+// integrations such as CRMs or chat tools. Requests are signed so receivers can
+// reject forgeries and replays: X-Webhook-Signature is "sha256=" followed by the
+// hex HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" under the shared secret.
+type WebhookChannel struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// webhookPayload is the JSON body of a webhook request
+type webhookPayload struct {
+	ID      string `json:"id"`
+	UserID  string `json:"user_id"`
+	Type    string `json:"type"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	SentAt  string `json:"sent_at"`
+}
+
+// NewWebhookChannel creates a WebhookChannel
+func NewWebhookChannel(cfg WebhookConfig, client *http.Client) (*WebhookChannel, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("WEBHOOK_URL is required")
+	}
+	if cfg.Secret == "" {
+		return nil, errors.New("WEBHOOK_SECRET is required")
+	}
+	return &WebhookChannel{url: cfg.URL, secret: []byte(cfg.Secret), client: client}, nil
+}
+
+// Name returns the channel name
+func (c *WebhookChannel) Name() string {
+	return ChannelWebhook
+}
+
+// Send posts the message and returns the delivery ID sent as X-Webhook-Id
+func (c *WebhookChannel) Send(ctx context.Context, to Contact, msg Message) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate webhook ID: %w", err)
+	}
+	id := hex.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	body, err := json.Marshal(webhookPayload{
+		ID:      id,
+		UserID:  to.UserID,
+		Type:    msg.Type,
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		SentAt:  now.Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode webhook: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", id)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+c.sign(timestamp, body))
+
+	if _, err := doProviderRequest(c.client, req); err != nil {
+		return "", fmt.Errorf("webhook: %w", err)
+	}
+	return id, nil
+}
+
+func (c *WebhookChannel) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
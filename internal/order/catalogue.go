@@ -0,0 +1,122 @@
+package order
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+
+	"github.com/lib/pq"
+)
+
+// Product is a sellable catalogue entry. Order prices always come from the
+// catalogue so clients can't choose what they pay.
+type Product struct {
+	SKU        string
+	Name       string
+	UnitPrice  money.Money
+	TaxRateBps int64 // basis points, e.g. 1900 = 19%
+	Active     bool
+}
+
+// Catalogue abstracts product lookups and maintenance
+type Catalogue interface {
+	// GetProducts returns the products for skus, keyed by SKU; unknown SKUs are omitted
+	GetProducts(skus []string) (map[string]Product, error)
+	UpsertProduct(p Product) error
+	ListProducts(includeInactive bool) ([]Product, error)
+}
+
+// PostgresCatalogue implements Catalogue using PostgreSQL
+type PostgresCatalogue struct {
+	db *sql.DB
+}
+
+// NewPostgresCatalogue creates a new PostgresCatalogue
+func NewPostgresCatalogue(db *sql.DB) *PostgresCatalogue {
+	return &PostgresCatalogue{db: db}
+}
+
+const productColumns = "sku, name, unit_price::text, currency, tax_rate_bps, active"
+
+// GetProducts retrieves products by SKU
+func (c *PostgresCatalogue) GetProducts(skus []string) (map[string]Product, error) {
+	rows, err := c.db.Query(
+		"SELECT "+productColumns+" FROM products WHERE sku = ANY($1)",
+		pq.Array(skus),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make(map[string]Product, len(skus))
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products[p.SKU] = p
+	}
+	return products, rows.Err()
+}
+
+// UpsertProduct creates a product or replaces its details
+func (c *PostgresCatalogue) UpsertProduct(p Product) error {
+	_, err := c.db.Exec(`
+		INSERT INTO products (sku, name, unit_price, currency, tax_rate_bps, active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (sku) DO UPDATE
+		SET name = EXCLUDED.name,
+			unit_price = EXCLUDED.unit_price,
+			currency = EXCLUDED.currency,
+			tax_rate_bps = EXCLUDED.tax_rate_bps,
+			active = EXCLUDED.active,
+			updated_at = now()`,
+		p.SKU, p.Name, p.UnitPrice.Decimal(), p.UnitPrice.Currency, p.TaxRateBps, p.Active,
+	)
+	return err
+}
+
+// ListProducts returns catalogue products ordered by SKU
+func (c *PostgresCatalogue) ListProducts(includeInactive bool) ([]Product, error) {
+	query := "SELECT " + productColumns + " FROM products"
+	if !includeInactive {
+		query += " WHERE active"
+	}
+	query += " ORDER BY sku"
+
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []Product
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+func scanProduct(row rowScanner) (Product, error) {
+	var (
+		p        Product
+		price    string
+		currency string
+	)
+	if err := row.Scan(&p.SKU, &p.Name, &price, &currency, &p.TaxRateBps, &p.Active); err != nil {
+		return Product{}, err
+	}
+
+	unitPrice, err := money.Parse(price, currency)
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid price stored for product %s: %w", p.SKU, err)
+	}
+	p.UnitPrice = unitPrice
+	return p, nil
+}
@@ -0,0 +1,29 @@
+package order
+
+import (
+	"github.com/alex-necsoiu/event-driven/pkg/grpcerr"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+
+	"google.golang.org/grpc/codes"
+)
+
+// statusErrors maps order errors to the gRPC codes clients act on. Errors that
+// depend on the state of the order, catalogue or user are FailedPrecondition;
+// a lost race is Aborted, which clients may retry.
+var statusErrors = grpcerr.NewMapper("order.event-driven",
+	grpcerr.Rule{Err: ErrNotFound, Code: codes.NotFound, Reason: "ORDER_NOT_FOUND"},
+	grpcerr.Rule{Err: ErrEmptyOrder, Code: codes.InvalidArgument, Reason: "EMPTY_ORDER"},
+	grpcerr.Rule{Err: ErrInvalidQuantity, Code: codes.InvalidArgument, Reason: "INVALID_QUANTITY"},
+	grpcerr.Rule{Err: ErrInvalidStatus, Code: codes.InvalidArgument, Reason: "INVALID_STATUS"},
+	grpcerr.Rule{Err: ErrInvalidProduct, Code: codes.InvalidArgument, Reason: "INVALID_PRODUCT"},
+	grpcerr.Rule{Err: ErrInvalidPageToken, Code: codes.InvalidArgument, Reason: "INVALID_PAGE_TOKEN"},
+	grpcerr.Rule{Err: money.ErrUnknownCurrency, Code: codes.InvalidArgument, Reason: "UNKNOWN_CURRENCY"},
+	grpcerr.Rule{Err: ErrInvalidAmount, Code: codes.FailedPrecondition, Reason: "INVALID_AMOUNT"},
+	grpcerr.Rule{Err: money.ErrCurrencyMismatch, Code: codes.FailedPrecondition, Reason: "MIXED_CURRENCIES"},
+	grpcerr.Rule{Err: ErrUnknownProduct, Code: codes.FailedPrecondition, Reason: "UNKNOWN_PRODUCT"},
+	grpcerr.Rule{Err: ErrUnknownUser, Code: codes.FailedPrecondition, Reason: "UNKNOWN_USER"},
+	grpcerr.Rule{Err: ErrUserDeleted, Code: codes.FailedPrecondition, Reason: "USER_DELETED"},
+	grpcerr.Rule{Err: ErrEmailNotVerified, Code: codes.FailedPrecondition, Reason: "EMAIL_NOT_VERIFIED"},
+	grpcerr.Rule{Err: ErrInvalidTransition, Code: codes.FailedPrecondition, Reason: "INVALID_TRANSITION"},
+	grpcerr.Rule{Err: ErrConcurrentUpdate, Code: codes.Aborted, Reason: "CONCURRENT_UPDATE"},
+)
@@ -0,0 +1,301 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/alex-necsoiu/event-driven/pkg/eventstore"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// orderImportedEvent starts the stream of an order written before event
+// sourcing was enabled, carrying its state and history at that point
+const orderImportedEvent = "OrderImported"
+
+// NewRepository returns the Repository implementation selected by kind
+func NewRepository(kind string, db *sql.DB, snapshotEvery int) (Repository, error) {
+	switch kind {
+	case "postgres":
+		return NewPostgresRepository(db), nil
+	case "eventsourced":
+		return NewEventSourcedRepository(db, snapshotEvery), nil
+	default:
+		return nil, fmt.Errorf("unknown order repository %q", kind)
+	}
+}
+
+// orderImported is the payload of orderImportedEvent
+type orderImported struct {
+	Order   Order        `json:"order"`
+	History []Transition `json:"history"`
+}
+
+// aggregate is an order rebuilt from its events
+type aggregate struct {
+	order   Order
+	version int64
+	// imported is set for an order found only in the orders table; it is
+	// appended as the first event before anything else is recorded
+	imported *orderImported
+}
+
+// apply folds one event into the aggregate
+func (a *aggregate) apply(e eventstore.RecordedEvent) error {
+	switch {
+	case e.Type == messaging.EventTypeOrderCreated:
+		if err := json.Unmarshal(e.Data, &a.order); err != nil {
+			return fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+		}
+	case e.Type == orderImportedEvent:
+		var imported orderImported
+		if err := json.Unmarshal(e.Data, &imported); err != nil {
+			return fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+		}
+		a.order = imported.Order
+	case isTransitionEvent(e.Type):
+		var t Transition
+		if err := json.Unmarshal(e.Data, &t); err != nil {
+			return fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+		}
+		if a.order.Status != t.From {
+			return fmt.Errorf("event %d of order %s moves it from %s, but it is %s", e.Version, a.order.ID, t.From, a.order.Status)
+		}
+		a.order.Status = t.To
+		a.order.UpdatedAt = t.At
+	default:
+		return fmt.Errorf("unknown order event type %q", e.Type)
+	}
+
+	a.version = e.Version
+	return nil
+}
+
+func isTransitionEvent(eventType string) bool {
+	for _, t := range transitionEvents {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// EventSourcedRepository implements Repository on an append-only log of order
+// events. An order's state is rebuilt by folding its events onto its latest
+// snapshot, and writes append with optimistic concurrency on the stream version.
+// The orders tables are updated in the same transaction as the read model behind
+// ListOrders; orders written by PostgresRepository are imported on first write.
+type EventSourcedRepository struct {
+	db            *sql.DB
+	events        *eventstore.PostgresStore
+	projection    *PostgresRepository
+	snapshotEvery int64
+}
+
+// NewEventSourcedRepository creates a new EventSourcedRepository that snapshots
+// each order every snapshotEvery events.
+// The schema is managed by the versioned migrations in Migrations().
+func NewEventSourcedRepository(db *sql.DB, snapshotEvery int) *EventSourcedRepository {
+	if snapshotEvery <= 0 {
+		snapshotEvery = 1
+	}
+	return &EventSourcedRepository{
+		db:            db,
+		events:        NewEventStore(db),
+		projection:    NewPostgresRepository(db),
+		snapshotEvery: int64(snapshotEvery),
+	}
+}
+
+// CreateOrder records OrderCreated as the first event of a new order
+func (r *EventSourcedRepository) CreateOrder(order Order) (Order, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Order{}, err
+	}
+	defer tx.Rollback()
+
+	// The orders row allocates the ID that names the stream
+	if order, err = insertOrder(tx, order); err != nil {
+		return Order{}, err
+	}
+
+	if err := r.append(tx, &aggregate{}, order.ID, messaging.EventTypeOrderCreated, order); err != nil {
+		return Order{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Order{}, err
+	}
+	return order, nil
+}
+
+// GetOrder rebuilds an order from its snapshot and later events
+func (r *EventSourcedRepository) GetOrder(id string) (Order, error) {
+	agg, err := r.load(id)
+	if err != nil {
+		return Order{}, err
+	}
+	return agg.order, nil
+}
+
+// UpdateOrderStatus appends t as the next event of the order. A concurrent
+// writer that appended first makes it fail with ErrConcurrentUpdate.
+func (r *EventSourcedRepository) UpdateOrderStatus(id string, t Transition) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	agg, err := r.load(id)
+	if err != nil {
+		return err
+	}
+	if agg.order.Status != t.From {
+		return fmt.Errorf("%w: order %s is no longer %s", ErrConcurrentUpdate, id, t.From)
+	}
+
+	if agg.imported != nil {
+		if err := r.append(tx, agg, id, orderImportedEvent, agg.imported); err != nil {
+			return err
+		}
+	}
+
+	if err := r.append(tx, agg, id, transitionEvents[t.To], t); err != nil {
+		return err
+	}
+
+	if err := updateOrderStatus(tx, id, t); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetOrderHistory returns the status transitions recorded in the order's events
+func (r *EventSourcedRepository) GetOrderHistory(id string) ([]Transition, error) {
+	events, err := r.events.ReadStream(context.Background(), id, 1, eventstore.Forward, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return r.projection.GetOrderHistory(id)
+	}
+
+	var history []Transition
+	for _, e := range events {
+		switch {
+		case e.Type == orderImportedEvent:
+			var imported orderImported
+			if err := json.Unmarshal(e.Data, &imported); err != nil {
+				return nil, fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+			}
+			history = append(history, imported.History...)
+		case isTransitionEvent(e.Type):
+			var t Transition
+			if err := json.Unmarshal(e.Data, &t); err != nil {
+				return nil, fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+			}
+			history = append(history, t)
+		}
+	}
+	return history, nil
+}
+
+// ListOrders pages through the orders read model
+func (r *EventSourcedRepository) ListOrders(filter ListFilter) ([]Order, string, error) {
+	return r.projection.ListOrders(filter)
+}
+
+// load rebuilds an order by folding the events after its latest snapshot. It
+// reads outside any transaction: a stale read fails later, when appending.
+func (r *EventSourcedRepository) load(id string) (*aggregate, error) {
+	agg := &aggregate{}
+
+	var state []byte
+	err := r.db.QueryRow("SELECT version, state FROM order_snapshots WHERE stream_id = $1", id).Scan(&agg.version, &state)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(state, &agg.order); err != nil {
+			return nil, fmt.Errorf("failed to decode snapshot of order %s: %w", id, err)
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	events, err := r.events.ReadStream(context.Background(), id, agg.version+1, eventstore.Forward, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		if err := agg.apply(e); err != nil {
+			return nil, err
+		}
+	}
+
+	if agg.version == 0 {
+		return r.adopt(id)
+	}
+	return agg, nil
+}
+
+// adopt rebuilds an order that has no events yet from the orders tables
+func (r *EventSourcedRepository) adopt(id string) (*aggregate, error) {
+	order, err := r.projection.GetOrder(id)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := r.projection.GetOrderHistory(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aggregate{
+		order:    order,
+		imported: &orderImported{Order: order, History: history},
+	}, nil
+}
+
+// append records the next event of an order's stream and folds it into agg,
+// snapshotting every snapshotEvery versions
+func (r *EventSourcedRepository) append(tx *sql.Tx, agg *aggregate, id, eventType string, payload interface{}) error {
+	data, err := eventstore.NewEvent(eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	version, err := r.events.AppendTx(context.Background(), tx, id, agg.version, data)
+	if errors.Is(err, eventstore.ErrVersionConflict) {
+		return fmt.Errorf("%w: %v", ErrConcurrentUpdate, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	e := eventstore.RecordedEvent{StreamID: id, Version: version, Type: data.Type, Data: data.Data}
+	if err := agg.apply(e); err != nil {
+		return err
+	}
+	agg.imported = nil
+
+	if agg.version%r.snapshotEvery != 0 {
+		return nil
+	}
+
+	state, err := json.Marshal(agg.order)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot of order %s: %w", id, err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO order_snapshots (stream_id, version, state) VALUES ($1, $2, $3)
+		ON CONFLICT (stream_id) DO UPDATE
+		SET version = EXCLUDED.version, state = EXCLUDED.state, taken_at = now()
+		WHERE order_snapshots.version < EXCLUDED.version`,
+		id, agg.version, state,
+	)
+	return err
+}
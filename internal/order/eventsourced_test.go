@@ -0,0 +1,450 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/alex-necsoiu/event-driven/pkg/eventstore"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// eventDB is a database answering queries from canned rows and failing
+// statements with canned errors, both picked by statement prefix. It records
+// the statements it is sent so tests can check what was written.
+type eventDB struct {
+	mu         sync.Mutex
+	statements []string
+	args       [][]driver.Value
+	rows       map[string][][]driver.Value // statement prefix → rows returned
+	errs       map[string]error            // statement prefix → error returned
+}
+
+func newEventDB() *eventDB {
+	return &eventDB{rows: make(map[string][][]driver.Value), errs: make(map[string]error)}
+}
+
+func (db *eventDB) Connect(context.Context) (driver.Conn, error) { return &eventConn{db: db}, nil }
+func (db *eventDB) Driver() driver.Driver                        { return nil }
+
+// sent returns the arguments of the recorded statements starting with prefix
+func (db *eventDB) sent(prefix string) [][]driver.Value {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var args [][]driver.Value
+	for i, statement := range db.statements {
+		if strings.HasPrefix(statement, prefix) {
+			args = append(args, db.args[i])
+		}
+	}
+	return args
+}
+
+// answer records query and returns the canned rows and error for it
+func (db *eventDB) answer(query string, args []driver.NamedValue) ([][]driver.Value, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	query = strings.Join(strings.Fields(query), " ")
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	db.statements = append(db.statements, query)
+	db.args = append(db.args, values)
+
+	for prefix, err := range db.errs {
+		if strings.HasPrefix(query, prefix) {
+			return nil, err
+		}
+	}
+	for prefix, rows := range db.rows {
+		if strings.HasPrefix(query, prefix) {
+			return rows, nil
+		}
+	}
+	return nil, nil
+}
+
+type eventConn struct {
+	db *eventDB
+}
+
+func (c *eventConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *eventConn) Close() error                        { return nil }
+func (c *eventConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c *eventConn) Rollback() error                     { return nil }
+
+func (c *eventConn) Commit() error {
+	_, err := c.db.answer("COMMIT", nil)
+	return err
+}
+
+func (c *eventConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.db.answer(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *eventConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.db.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &eventRows{values: rows}, nil
+}
+
+type eventRows struct {
+	values [][]driver.Value
+}
+
+// Columns only needs the right count; one is enough for empty results
+func (r *eventRows) Columns() []string {
+	if len(r.values) == 0 {
+		return []string{"column"}
+	}
+	return make([]string, len(r.values[0]))
+}
+
+func (r *eventRows) Close() error { return nil }
+
+func (r *eventRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+const (
+	snapshotQuery = "SELECT version, state FROM order_snapshots"
+	streamQuery   = "SELECT stream_id, version, position"
+	versionQuery  = "SELECT COALESCE(MAX(version), 0)"
+	appendInsert  = `INSERT INTO "order_events"`
+)
+
+var changedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func move(from, to Status) Transition {
+	return Transition{From: from, To: to, Actor: SystemActor, At: changedAt}
+}
+
+// recorded builds an order event as read back from the store
+func recorded(t *testing.T, version int64, eventType string, payload interface{}) eventstore.RecordedEvent {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return eventstore.RecordedEvent{StreamID: "1", Version: version, Position: version, Type: eventType, Data: data}
+}
+
+// row is e as a row of the stream query
+func row(e eventstore.RecordedEvent) []driver.Value {
+	return []driver.Value{e.StreamID, e.Version, e.Position, e.Type, []byte(e.Data), []byte("{}"), changedAt}
+}
+
+// withSnapshot makes db answer the snapshot read of order 1
+func withSnapshot(t *testing.T, db *eventDB, version int64, status Status) {
+	t.Helper()
+	state, err := json.Marshal(Order{ID: "1", UserID: "7", Status: status})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.rows[snapshotQuery] = [][]driver.Value{{version, state}}
+}
+
+// withEvents makes db answer the stream read of order 1 with events
+func withEvents(db *eventDB, events ...eventstore.RecordedEvent) {
+	for _, e := range events {
+		db.rows[streamQuery] = append(db.rows[streamQuery], row(e))
+	}
+}
+
+func TestAggregateApply(t *testing.T) {
+	created := Order{ID: "1", UserID: "7", Status: StatusPending, CreatedAt: changedAt}
+
+	tests := []struct {
+		name        string
+		from        Order
+		event       func(t *testing.T) eventstore.RecordedEvent
+		wantStatus  Status
+		wantVersion int64
+		wantErr     bool
+	}{
+		{
+			name: "created",
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 1, messaging.EventTypeOrderCreated, created)
+			},
+			wantStatus:  StatusPending,
+			wantVersion: 1,
+		},
+		{
+			name: "imported",
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				paid := created
+				paid.Status = StatusPaid
+				return recorded(t, 1, orderImportedEvent, orderImported{Order: paid, History: []Transition{move(StatusPending, StatusPaid)}})
+			},
+			wantStatus:  StatusPaid,
+			wantVersion: 1,
+		},
+		{
+			name: "confirmed",
+			from: Order{ID: "1", Status: StatusPending},
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 2, messaging.EventTypeOrderConfirmed, move(StatusPending, StatusConfirmed))
+			},
+			wantStatus:  StatusConfirmed,
+			wantVersion: 2,
+		},
+		{
+			name: "paid",
+			from: Order{ID: "1", Status: StatusConfirmed},
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 3, messaging.EventTypeOrderPaid, move(StatusConfirmed, StatusPaid))
+			},
+			wantStatus:  StatusPaid,
+			wantVersion: 3,
+		},
+		{
+			name: "shipped",
+			from: Order{ID: "1", Status: StatusPaid},
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 4, messaging.EventTypeOrderShipped, move(StatusPaid, StatusShipped))
+			},
+			wantStatus:  StatusShipped,
+			wantVersion: 4,
+		},
+		{
+			name: "completed",
+			from: Order{ID: "1", Status: StatusShipped},
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 5, messaging.EventTypeOrderCompleted, move(StatusShipped, StatusCompleted))
+			},
+			wantStatus:  StatusCompleted,
+			wantVersion: 5,
+		},
+		{
+			name: "cancelled",
+			from: Order{ID: "1", Status: StatusConfirmed},
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 3, messaging.EventTypeOrderCancelled, move(StatusConfirmed, StatusCancelled))
+			},
+			wantStatus:  StatusCancelled,
+			wantVersion: 3,
+		},
+		{
+			name: "refunded",
+			from: Order{ID: "1", Status: StatusCompleted},
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 6, messaging.EventTypeOrderRefunded, move(StatusCompleted, StatusRefunded))
+			},
+			wantStatus:  StatusRefunded,
+			wantVersion: 6,
+		},
+		{
+			name: "transition from another status",
+			from: Order{ID: "1", Status: StatusPending},
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 2, messaging.EventTypeOrderPaid, move(StatusConfirmed, StatusPaid))
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown event type",
+			from: Order{ID: "1", Status: StatusPending},
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 2, "OrderTeleported", move(StatusPending, StatusShipped))
+			},
+			wantErr: true,
+		},
+		{
+			name: "undecodable payload",
+			from: Order{ID: "1", Status: StatusPending},
+			event: func(t *testing.T) eventstore.RecordedEvent {
+				return recorded(t, 2, messaging.EventTypeOrderConfirmed, "not a transition")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg := &aggregate{order: tt.from}
+			err := agg.apply(tt.event(t))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if agg.order.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", agg.order.Status, tt.wantStatus)
+			}
+			if agg.version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", agg.version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestEventSourcedRepositoryGetOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, db *eventDB)
+		wantStatus Status
+		wantFrom   int64 // first version read from the stream
+		wantErr    bool
+	}{
+		{
+			name: "snapshot plus the event tail",
+			setup: func(t *testing.T, db *eventDB) {
+				withSnapshot(t, db, 2, StatusConfirmed)
+				withEvents(db,
+					recorded(t, 3, messaging.EventTypeOrderPaid, move(StatusConfirmed, StatusPaid)),
+					recorded(t, 4, messaging.EventTypeOrderShipped, move(StatusPaid, StatusShipped)),
+				)
+			},
+			wantStatus: StatusShipped,
+			wantFrom:   3,
+		},
+		{
+			name: "snapshot with no later events",
+			setup: func(t *testing.T, db *eventDB) {
+				withSnapshot(t, db, 4, StatusShipped)
+			},
+			wantStatus: StatusShipped,
+			wantFrom:   5,
+		},
+		{
+			name: "no snapshot folds the whole stream",
+			setup: func(t *testing.T, db *eventDB) {
+				withEvents(db,
+					recorded(t, 1, messaging.EventTypeOrderCreated, Order{ID: "1", UserID: "7", Status: StatusPending}),
+					recorded(t, 2, messaging.EventTypeOrderConfirmed, move(StatusPending, StatusConfirmed)),
+				)
+			},
+			wantStatus: StatusConfirmed,
+			wantFrom:   1,
+		},
+		{
+			name: "tail not following the snapshot",
+			setup: func(t *testing.T, db *eventDB) {
+				withSnapshot(t, db, 2, StatusPending)
+				withEvents(db, recorded(t, 3, messaging.EventTypeOrderPaid, move(StatusConfirmed, StatusPaid)))
+			},
+			wantFrom: 3,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newEventDB()
+			tt.setup(t, db)
+			repo := NewEventSourcedRepository(sql.OpenDB(db), 10)
+
+			order, err := repo.GetOrder("1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && order.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", order.Status, tt.wantStatus)
+			}
+
+			reads := db.sent(streamQuery)
+			if len(reads) != 1 || reads[0][1] != tt.wantFrom {
+				t.Errorf("stream read with %v, want it read from version %d", reads, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestEventSourcedRepositoryUpdateOrderStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     int64 // version of the stream when appending
+		appendErr   error
+		snapshot    Status
+		transition  Transition
+		wantErr     error
+		wantVersion int64 // version appended, 0 for none
+	}{
+		{
+			name:        "appends the next version",
+			current:     3,
+			snapshot:    StatusPaid,
+			transition:  move(StatusPaid, StatusShipped),
+			wantVersion: 4,
+		},
+		{
+			name:       "stale expected version",
+			current:    4,
+			snapshot:   StatusPaid,
+			transition: move(StatusPaid, StatusShipped),
+			wantErr:    ErrConcurrentUpdate,
+		},
+		{
+			name:        "same version appended concurrently",
+			current:     3,
+			appendErr:   &pq.Error{Code: "23505"},
+			snapshot:    StatusPaid,
+			transition:  move(StatusPaid, StatusShipped),
+			wantErr:     ErrConcurrentUpdate,
+			wantVersion: 4,
+		},
+		{
+			name:       "status moved on since the transition was built",
+			current:    3,
+			snapshot:   StatusShipped,
+			transition: move(StatusPaid, StatusShipped),
+			wantErr:    ErrConcurrentUpdate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newEventDB()
+			withSnapshot(t, db, 3, tt.snapshot)
+			db.rows[versionQuery] = [][]driver.Value{{tt.current}}
+			if tt.appendErr != nil {
+				db.errs[appendInsert] = tt.appendErr
+			}
+			repo := NewEventSourcedRepository(sql.OpenDB(db), 10)
+
+			err := repo.UpdateOrderStatus("1", tt.transition)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("UpdateOrderStatus() error = %v, want %v", err, tt.wantErr)
+			}
+
+			appended := db.sent(appendInsert)
+			switch {
+			case tt.wantVersion == 0 && len(appended) != 0:
+				t.Errorf("appended %v, want nothing", appended)
+			case tt.wantVersion != 0 && (len(appended) != 1 || appended[0][1] != tt.wantVersion):
+				t.Errorf("appended %v, want version %d", appended, tt.wantVersion)
+			}
+
+			committed := len(db.sent("COMMIT")) > 0
+			if committed != (tt.wantErr == nil) {
+				t.Errorf("committed = %v", committed)
+			}
+			updated := len(db.sent("UPDATE orders SET status")) > 0
+			if updated != (tt.wantErr == nil) {
+				t.Errorf("updated the orders table = %v", updated)
+			}
+		})
+	}
+}
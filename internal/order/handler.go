@@ -2,9 +2,16 @@ package order
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // OrderHandler implements the gRPC OrderServiceServer
@@ -20,24 +27,25 @@ func NewOrderHandler(service *Service, logger *log.Logger) *OrderHandler {
 
 // CreateOrder handles order creation and publishes an event
 func (h *OrderHandler) CreateOrder(ctx context.Context, req *gen.CreateOrderRequest) (*gen.OrderResponse, error) {
-	h.logger.Printf("CreateOrder called for user: %s, amount: %.2f", req.UserId, req.Amount)
+	h.logger.Printf("CreateOrder called for user: %s, items: %d", req.UserId, len(req.Items))
+
+	if err := validateCreateOrder(req); err != nil {
+		return nil, err
+	}
 
-	orderID, err := h.service.CreateOrder(req.UserId, req.Amount)
+	items := make([]ItemRequest, 0, len(req.Items))
+	for _, item := range req.Items {
+		items = append(items, ItemRequest{SKU: item.Sku, Quantity: item.Quantity})
+	}
+
+	order, err := h.service.CreateOrder(req.UserId, items)
 	if err != nil {
 		h.logger.Printf("Failed to create order: %v", err)
-		return &gen.OrderResponse{
-			Order: nil,
-			Error: err.Error(),
-		}, nil
+		return nil, statusErrors.Status(err)
 	}
 
 	return &gen.OrderResponse{
-		Order: &gen.Order{
-			Id:     orderID,
-			UserId: req.UserId,
-			Amount: req.Amount,
-		},
-		Error: "",
+		Order: toProtoOrder(order),
 	}, nil
 }
 
@@ -45,21 +53,233 @@ func (h *OrderHandler) CreateOrder(ctx context.Context, req *gen.CreateOrderRequ
 func (h *OrderHandler) GetOrder(ctx context.Context, req *gen.GetOrderRequest) (*gen.OrderResponse, error) {
 	h.logger.Printf("GetOrder called for ID: %s", req.Id)
 
+	if err := validateOrderID(req.Id); err != nil {
+		return nil, err
+	}
+
 	order, err := h.service.GetOrder(req.Id)
 	if err != nil {
 		h.logger.Printf("Failed to get order: %v", err)
-		return &gen.OrderResponse{
-			Order: nil,
-			Error: err.Error(),
-		}, nil
+		return nil, statusErrors.Status(err)
 	}
 
 	return &gen.OrderResponse{
-		Order: &gen.Order{
-			Id:     order.ID,
-			UserId: order.UserID,
-			Amount: order.Amount,
-		},
-		Error: "",
+		Order: toProtoOrder(order),
 	}, nil
 }
+
+// UpdateOrderStatus handles moving an order to another lifecycle status
+func (h *OrderHandler) UpdateOrderStatus(ctx context.Context, req *gen.UpdateOrderStatusRequest) (*gen.OrderResponse, error) {
+	h.logger.Printf("UpdateOrderStatus called for ID: %s, status: %s", req.Id, req.Status)
+
+	if err := validateUpdateOrderStatus(req); err != nil {
+		return nil, err
+	}
+
+	status, err := ParseStatus(req.Status)
+	if err != nil {
+		return nil, statusErrors.Status(err)
+	}
+
+	order, err := h.service.UpdateOrderStatus(req.Id, status, req.Actor, req.Reason)
+	return h.orderResponse("update order status", order, err)
+}
+
+// CancelOrder handles order cancellation
+func (h *OrderHandler) CancelOrder(ctx context.Context, req *gen.CancelOrderRequest) (*gen.OrderResponse, error) {
+	h.logger.Printf("CancelOrder called for ID: %s", req.Id)
+
+	if err := validateCancelOrder(req); err != nil {
+		return nil, err
+	}
+
+	order, err := h.service.CancelOrder(req.Id, req.Actor, req.Reason)
+	return h.orderResponse("cancel order", order, err)
+}
+
+// CompleteOrder handles order completion
+func (h *OrderHandler) CompleteOrder(ctx context.Context, req *gen.CompleteOrderRequest) (*gen.OrderResponse, error) {
+	h.logger.Printf("CompleteOrder called for ID: %s", req.Id)
+
+	if err := validateCompleteOrder(req); err != nil {
+		return nil, err
+	}
+
+	order, err := h.service.CompleteOrder(req.Id, req.Actor)
+	return h.orderResponse("complete order", order, err)
+}
+
+// ListOrders handles filtered, paginated order listing
+func (h *OrderHandler) ListOrders(ctx context.Context, req *gen.ListOrdersRequest) (*gen.ListOrdersResponse, error) {
+	h.logger.Printf("ListOrders called for user: %q, status: %q", req.UserId, req.Status)
+
+	if err := validateListOrders(req); err != nil {
+		return nil, err
+	}
+
+	filter, err := listFilterFromProto(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	orders, next, err := h.service.ListOrders(filter)
+	if err != nil {
+		h.logger.Printf("Failed to list orders: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	resp := &gen.ListOrdersResponse{
+		Orders:        make([]*gen.Order, 0, len(orders)),
+		NextPageToken: next,
+	}
+	for _, order := range orders {
+		resp.Orders = append(resp.Orders, toProtoOrder(order))
+	}
+	return resp, nil
+}
+
+// UpsertProduct handles creating or updating a catalogue product
+func (h *OrderHandler) UpsertProduct(ctx context.Context, req *gen.UpsertProductRequest) (*gen.ProductResponse, error) {
+	h.logger.Printf("UpsertProduct called for SKU: %s", req.GetProduct().GetSku())
+
+	if err := validateUpsertProduct(req); err != nil {
+		return nil, err
+	}
+
+	price, err := fromProtoMoney(req.Product.UnitPrice)
+	if err != nil {
+		return nil, statusErrors.Status(err)
+	}
+
+	product, err := h.service.UpsertProduct(Product{
+		SKU:        req.Product.Sku,
+		Name:       req.Product.Name,
+		UnitPrice:  price,
+		TaxRateBps: req.Product.TaxRateBps,
+		Active:     req.Product.Active,
+	})
+	if err != nil {
+		h.logger.Printf("Failed to upsert product: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.ProductResponse{Product: toProtoProduct(product)}, nil
+}
+
+// ListProducts handles listing the product catalogue
+func (h *OrderHandler) ListProducts(ctx context.Context, req *gen.ListProductsRequest) (*gen.ListProductsResponse, error) {
+	h.logger.Printf("ListProducts called, include inactive: %t", req.IncludeInactive)
+
+	products, err := h.service.ListProducts(req.IncludeInactive)
+	if err != nil {
+		h.logger.Printf("Failed to list products: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	resp := &gen.ListProductsResponse{Products: make([]*gen.Product, 0, len(products))}
+	for _, p := range products {
+		resp.Products = append(resp.Products, toProtoProduct(p))
+	}
+	return resp, nil
+}
+
+// orderResponse wraps the result of a status change in an OrderResponse
+func (h *OrderHandler) orderResponse(action string, order Order, err error) (*gen.OrderResponse, error) {
+	if err != nil {
+		h.logger.Printf("Failed to %s: %v", action, err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.OrderResponse{
+		Order: toProtoOrder(order),
+	}, nil
+}
+
+func listFilterFromProto(req *gen.ListOrdersRequest) (ListFilter, error) {
+	filter := ListFilter{
+		UserID:    req.UserId,
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	}
+
+	if req.Status != "" {
+		status, err := ParseStatus(req.Status)
+		if err != nil {
+			return ListFilter{}, err
+		}
+		filter.Status = status
+	}
+
+	if req.CreatedAfter != "" {
+		t, err := time.Parse(time.RFC3339, req.CreatedAfter)
+		if err != nil {
+			return ListFilter{}, fmt.Errorf("invalid created_after: %w", err)
+		}
+		filter.CreatedAfter = t
+	}
+
+	if req.CreatedBefore != "" {
+		t, err := time.Parse(time.RFC3339, req.CreatedBefore)
+		if err != nil {
+			return ListFilter{}, fmt.Errorf("invalid created_before: %w", err)
+		}
+		filter.CreatedBefore = t
+	}
+
+	return filter, nil
+}
+
+func toProtoOrder(order Order) *gen.Order {
+	items := make([]*gen.LineItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, &gen.LineItem{
+			Sku:        item.SKU,
+			Name:       item.Name,
+			Quantity:   item.Quantity,
+			UnitPrice:  toProtoMoney(item.UnitPrice),
+			TaxRateBps: item.TaxRateBps,
+			Tax:        toProtoMoney(item.Tax),
+			Total:      toProtoMoney(item.Total),
+		})
+	}
+
+	return &gen.Order{
+		Id:        order.ID,
+		UserId:    order.UserID,
+		Items:     items,
+		Subtotal:  toProtoMoney(order.Subtotal),
+		Tax:       toProtoMoney(order.Tax),
+		Amount:    toProtoMoney(order.Amount),
+		Status:    string(order.Status),
+		CreatedAt: formatTime(order.CreatedAt),
+		UpdatedAt: formatTime(order.UpdatedAt),
+	}
+}
+
+func toProtoProduct(p Product) *gen.Product {
+	return &gen.Product{
+		Sku:        p.SKU,
+		Name:       p.Name,
+		UnitPrice:  toProtoMoney(p.UnitPrice),
+		TaxRateBps: p.TaxRateBps,
+		Active:     p.Active,
+	}
+}
+
+func toProtoMoney(m money.Money) *gen.Money {
+	return &gen.Money{Amount: m.Amount, Currency: m.Currency}
+}
+
+func fromProtoMoney(m *gen.Money) (money.Money, error) {
+	if m == nil {
+		return money.Money{}, errors.New("price is required")
+	}
+	return money.New(m.Amount, m.Currency)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,113 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+)
+
+var (
+	// ErrEmptyOrder is returned when an order has no line items
+	ErrEmptyOrder = errors.New("order must contain at least one item")
+	// ErrInvalidQuantity is returned for non-positive quantities
+	ErrInvalidQuantity = errors.New("item quantity must be positive")
+	// ErrUnknownProduct is returned for SKUs missing from the catalogue or inactive
+	ErrUnknownProduct = errors.New("unknown or inactive product")
+	// ErrInvalidAmount is returned when an order would not cost a positive amount
+	ErrInvalidAmount = errors.New("order amount must be positive")
+	// ErrInvalidProduct is returned for catalogue entries that can't be sold
+	ErrInvalidProduct = errors.New("invalid product")
+)
+
+// ItemRequest is a product and quantity requested by the client
+type ItemRequest struct {
+	SKU      string
+	Quantity int64
+}
+
+// LineItem is one priced product line of an order
+type LineItem struct {
+	SKU        string      `json:"sku"`
+	Name       string      `json:"name"`
+	Quantity   int64       `json:"quantity"`
+	UnitPrice  money.Money `json:"unit_price"`
+	TaxRateBps int64       `json:"tax_rate_bps"`
+	Tax        money.Money `json:"tax"`   // tax for the whole line
+	Total      money.Money `json:"total"` // UnitPrice * Quantity + Tax
+}
+
+// Totals are the amounts of an order computed from its line items
+type Totals struct {
+	Subtotal money.Money
+	Tax      money.Money
+	Total    money.Money
+}
+
+// priceItems builds line items from catalogue prices and sums the order totals.
+// Repeated SKUs are merged so each product appears once.
+func priceItems(requests []ItemRequest, products map[string]Product) ([]LineItem, Totals, error) {
+	if len(requests) == 0 {
+		return nil, Totals{}, ErrEmptyOrder
+	}
+
+	quantities := make(map[string]int64, len(requests))
+	var skus []string
+	for _, req := range requests {
+		if req.Quantity <= 0 {
+			return nil, Totals{}, fmt.Errorf("%w: %s has quantity %d", ErrInvalidQuantity, req.SKU, req.Quantity)
+		}
+		if _, seen := quantities[req.SKU]; !seen {
+			skus = append(skus, req.SKU)
+		}
+		quantities[req.SKU] += req.Quantity
+	}
+
+	var (
+		items  []LineItem
+		totals Totals
+	)
+	for i, sku := range skus {
+		product, ok := products[sku]
+		if !ok || !product.Active {
+			return nil, Totals{}, fmt.Errorf("%w: %s", ErrUnknownProduct, sku)
+		}
+
+		if i == 0 {
+			currency := product.UnitPrice.Currency
+			totals = Totals{Subtotal: money.Zero(currency), Tax: money.Zero(currency), Total: money.Zero(currency)}
+		}
+
+		net := product.UnitPrice.Mul(quantities[sku])
+		tax := net.Rate(product.TaxRateBps)
+		lineTotal, err := net.Add(tax)
+		if err != nil {
+			return nil, Totals{}, err
+		}
+
+		item := LineItem{
+			SKU:        sku,
+			Name:       product.Name,
+			Quantity:   quantities[sku],
+			UnitPrice:  product.UnitPrice,
+			TaxRateBps: product.TaxRateBps,
+			Tax:        tax,
+			Total:      lineTotal,
+		}
+
+		// Add fails on mixed currencies, which a single order can't settle
+		if totals.Subtotal, err = totals.Subtotal.Add(net); err != nil {
+			return nil, Totals{}, fmt.Errorf("order items must share a currency: %w", err)
+		}
+		if totals.Tax, err = totals.Tax.Add(tax); err != nil {
+			return nil, Totals{}, err
+		}
+		if totals.Total, err = totals.Total.Add(lineTotal); err != nil {
+			return nil, Totals{}, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, totals, nil
+}
@@ -0,0 +1,79 @@
+package order
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+)
+
+func TestPriceItems(t *testing.T) {
+	eur := func(amount int64) money.Money { return money.Money{Amount: amount, Currency: "EUR"} }
+	products := map[string]Product{
+		"MUG-01":  {SKU: "MUG-01", Name: "Mug", UnitPrice: eur(1000), TaxRateBps: 1900, Active: true},
+		"BOOK-01": {SKU: "BOOK-01", Name: "Book", UnitPrice: eur(1999), TaxRateBps: 700, Active: true},
+		"GIFT-01": {SKU: "GIFT-01", Name: "Voucher", UnitPrice: eur(2500), Active: true},
+		"OLD-01":  {SKU: "OLD-01", Name: "Retired", UnitPrice: eur(500), TaxRateBps: 1900},
+		"USD-01":  {SKU: "USD-01", Name: "Import", UnitPrice: money.Money{Amount: 1000, Currency: "USD"}, Active: true},
+	}
+
+	tests := []struct {
+		name       string
+		requests   []ItemRequest
+		wantItems  []LineItem
+		wantTotals Totals
+		wantErr    error
+	}{
+		{
+			name:     "single line",
+			requests: []ItemRequest{{SKU: "MUG-01", Quantity: 2}},
+			wantItems: []LineItem{
+				{SKU: "MUG-01", Name: "Mug", Quantity: 2, UnitPrice: eur(1000), TaxRateBps: 1900, Tax: eur(380), Total: eur(2380)},
+			},
+			wantTotals: Totals{Subtotal: eur(2000), Tax: eur(380), Total: eur(2380)},
+		},
+		{
+			name:     "tax rounds per line",
+			requests: []ItemRequest{{SKU: "BOOK-01", Quantity: 1}, {SKU: "GIFT-01", Quantity: 1}},
+			wantItems: []LineItem{
+				{SKU: "BOOK-01", Name: "Book", Quantity: 1, UnitPrice: eur(1999), TaxRateBps: 700, Tax: eur(140), Total: eur(2139)},
+				{SKU: "GIFT-01", Name: "Voucher", Quantity: 1, UnitPrice: eur(2500), Tax: eur(0), Total: eur(2500)},
+			},
+			wantTotals: Totals{Subtotal: eur(4499), Tax: eur(140), Total: eur(4639)},
+		},
+		{
+			name:     "repeated SKUs are merged in first-seen order",
+			requests: []ItemRequest{{SKU: "GIFT-01", Quantity: 1}, {SKU: "MUG-01", Quantity: 1}, {SKU: "GIFT-01", Quantity: 2}},
+			wantItems: []LineItem{
+				{SKU: "GIFT-01", Name: "Voucher", Quantity: 3, UnitPrice: eur(2500), Tax: eur(0), Total: eur(7500)},
+				{SKU: "MUG-01", Name: "Mug", Quantity: 1, UnitPrice: eur(1000), TaxRateBps: 1900, Tax: eur(190), Total: eur(1190)},
+			},
+			wantTotals: Totals{Subtotal: eur(8500), Tax: eur(190), Total: eur(8690)},
+		},
+		{name: "no items", wantErr: ErrEmptyOrder},
+		{name: "zero quantity", requests: []ItemRequest{{SKU: "MUG-01", Quantity: 0}}, wantErr: ErrInvalidQuantity},
+		{name: "negative quantity", requests: []ItemRequest{{SKU: "MUG-01", Quantity: 3}, {SKU: "MUG-01", Quantity: -1}}, wantErr: ErrInvalidQuantity},
+		{name: "unknown product", requests: []ItemRequest{{SKU: "NOPE", Quantity: 1}}, wantErr: ErrUnknownProduct},
+		{name: "inactive product", requests: []ItemRequest{{SKU: "OLD-01", Quantity: 1}}, wantErr: ErrUnknownProduct},
+		{name: "mixed currencies", requests: []ItemRequest{{SKU: "MUG-01", Quantity: 1}, {SKU: "USD-01", Quantity: 1}}, wantErr: money.ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, totals, err := priceItems(tt.requests, products)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("priceItems() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !reflect.DeepEqual(items, tt.wantItems) {
+				t.Errorf("items = %+v, want %+v", items, tt.wantItems)
+			}
+			if totals != tt.wantTotals {
+				t.Errorf("totals = %+v, want %+v", totals, tt.wantTotals)
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+-- ISO 4217 code; existing orders were all taken in USD
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
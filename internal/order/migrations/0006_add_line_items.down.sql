@@ -0,0 +1,4 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS tax;
+ALTER TABLE orders DROP COLUMN IF EXISTS subtotal;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS products;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS products (
+    sku TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    unit_price NUMERIC NOT NULL CHECK (unit_price >= 0),
+    currency CHAR(3) NOT NULL,
+    tax_rate_bps INTEGER NOT NULL DEFAULT 0 CHECK (tax_rate_bps >= 0),
+    active BOOLEAN NOT NULL DEFAULT true,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders (id),
+    sku TEXT NOT NULL,
+    name TEXT NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price NUMERIC NOT NULL,
+    tax_rate_bps INTEGER NOT NULL,
+    tax NUMERIC NOT NULL,
+    total NUMERIC NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS order_items_order_id_idx ON order_items (order_id);
+
+-- Orders placed before line items carried no tax, so their amount is the subtotal
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS subtotal NUMERIC;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax NUMERIC NOT NULL DEFAULT 0;
+UPDATE orders SET subtotal = amount WHERE subtotal IS NULL;
+ALTER TABLE orders ALTER COLUMN subtotal SET NOT NULL;
@@ -0,0 +1,6 @@
+-- Local read model of the user service, fed by UserCreated/UserDeleted events
+CREATE TABLE IF NOT EXISTS known_users (
+    user_id TEXT PRIMARY KEY,
+    deleted_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
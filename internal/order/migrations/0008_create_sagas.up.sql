@@ -0,0 +1,18 @@
+-- Persisted state of the sagas run by internal/saga (e.g. order fulfillment)
+CREATE TABLE IF NOT EXISTS sagas (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    correlation_id TEXT NOT NULL,
+    step INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    data JSONB NOT NULL,
+    refs JSONB NOT NULL DEFAULT '{}',
+    inbox JSONB NOT NULL DEFAULT '[]',
+    failure_reason TEXT NOT NULL DEFAULT '',
+    deadline TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (type, correlation_id)
+);
+
+CREATE INDEX IF NOT EXISTS sagas_deadline_idx ON sagas (deadline) WHERE status IN ('running', 'compensating');
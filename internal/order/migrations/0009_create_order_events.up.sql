@@ -0,0 +1,32 @@
+-- Append-only log of order events, the source of truth of the event-sourced
+-- repository (ORDER_REPOSITORY=eventsourced). Position orders events globally.
+CREATE TABLE IF NOT EXISTS order_events (
+    position BIGSERIAL PRIMARY KEY,
+    stream_id TEXT NOT NULL,
+    version INTEGER NOT NULL CHECK (version > 0),
+    event_type TEXT NOT NULL,
+    data JSONB NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- Two writers appending the same version is how optimistic concurrency fails
+    UNIQUE (stream_id, version)
+);
+
+CREATE OR REPLACE FUNCTION order_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'order_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS order_events_append_only ON order_events;
+CREATE TRIGGER order_events_append_only
+    BEFORE UPDATE OR DELETE ON order_events
+    FOR EACH ROW EXECUTE FUNCTION order_events_append_only();
+
+-- Latest folded state per order, so loading doesn't replay the whole stream
+CREATE TABLE IF NOT EXISTS order_snapshots (
+    stream_id TEXT PRIMARY KEY,
+    version INTEGER NOT NULL,
+    state JSONB NOT NULL,
+    taken_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS daily_revenue_orders;
+DROP TABLE IF EXISTS daily_revenue;
+DROP TABLE IF EXISTS user_orders;
+DROP TABLE IF EXISTS projection_checkpoints;
@@ -0,0 +1,40 @@
+-- How far each projection has applied the order event log
+CREATE TABLE IF NOT EXISTS projection_checkpoints (
+    name TEXT PRIMARY KEY,
+    position BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Read model of the user_orders projection; amounts are in minor units
+CREATE TABLE IF NOT EXISTS user_orders (
+    order_id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    item_count INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_orders_user_id_idx ON user_orders (user_id, created_at DESC);
+
+-- Read model of the daily_revenue projection; amounts are in minor units
+CREATE TABLE IF NOT EXISTS daily_revenue (
+    day DATE NOT NULL,
+    currency CHAR(3) NOT NULL,
+    orders INTEGER NOT NULL DEFAULT 0,
+    gross BIGINT NOT NULL DEFAULT 0,
+    cancelled BIGINT NOT NULL DEFAULT 0,
+    refunded BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, currency)
+);
+
+-- Orders counted in daily_revenue, so each is added and deducted at most once
+CREATE TABLE IF NOT EXISTS daily_revenue_orders (
+    order_id TEXT PRIMARY KEY,
+    day DATE NOT NULL,
+    currency CHAR(3) NOT NULL,
+    amount BIGINT NOT NULL,
+    outcome TEXT NOT NULL DEFAULT 'open'
+);
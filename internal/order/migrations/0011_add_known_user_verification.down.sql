@@ -0,0 +1,2 @@
+ALTER TABLE known_users DROP COLUMN IF EXISTS verification_changed_at;
+ALTER TABLE known_users DROP COLUMN IF EXISTS email_verified;
@@ -0,0 +1,4 @@
+-- Whether the user has verified their email, from UserEmailVerified/UserUpdated events.
+-- verification_changed_at orders those events so a stale one can't overwrite a newer state.
+ALTER TABLE known_users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE known_users ADD COLUMN IF NOT EXISTS verification_changed_at TIMESTAMPTZ;
@@ -0,0 +1,7 @@
+-- Payment authorizations received while the order still waited for its stock;
+-- the order is marked paid once it is confirmed
+CREATE TABLE IF NOT EXISTS payment_authorizations (
+    order_id TEXT PRIMARY KEY,
+    reference TEXT NOT NULL,
+    authorized_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
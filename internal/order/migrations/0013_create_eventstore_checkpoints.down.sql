@@ -0,0 +1 @@
+DROP TABLE IF EXISTS eventstore_checkpoints;
@@ -0,0 +1,7 @@
+-- How far each event store subscription, e.g. the order event log relay, has
+-- forwarded the order_events log
+CREATE TABLE IF NOT EXISTS eventstore_checkpoints (
+    name TEXT PRIMARY KEY,
+    position BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
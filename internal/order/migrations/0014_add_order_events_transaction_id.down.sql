@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_order_events_transaction;
+ALTER TABLE order_events DROP COLUMN IF EXISTS transaction_id;
@@ -0,0 +1,7 @@
+-- The transaction that appended each event. Readers tailing the log only
+-- take events of finished transactions, in transaction order, so an append
+-- that commits late is never skipped.
+ALTER TABLE order_events
+    ADD COLUMN IF NOT EXISTS transaction_id xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+CREATE INDEX IF NOT EXISTS idx_order_events_transaction ON order_events (transaction_id, position);
@@ -0,0 +1,180 @@
+package order
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// PaymentActor is recorded on order status changes caused by payment events
+const PaymentActor = "payment-service"
+
+// AuthorizationStore remembers payment authorizations until their order is
+// confirmed, since payment and stock outcomes may arrive in either order
+type AuthorizationStore interface {
+	// RecordAuthorization stores the provider reference of an order's
+	// authorization; recording it again is a no-op
+	RecordAuthorization(orderID, reference string) error
+	// Authorization returns the reference of an order's authorization and
+	// whether there is one
+	Authorization(orderID string) (string, bool, error)
+}
+
+// PostgresAuthorizations is an AuthorizationStore in the payment_authorizations table
+type PostgresAuthorizations struct {
+	db *sql.DB
+}
+
+// NewPostgresAuthorizations creates a new PostgresAuthorizations
+func NewPostgresAuthorizations(db *sql.DB) *PostgresAuthorizations {
+	return &PostgresAuthorizations{db: db}
+}
+
+// RecordAuthorization stores an order's payment authorization
+func (a *PostgresAuthorizations) RecordAuthorization(orderID, reference string) error {
+	_, err := a.db.Exec(
+		"INSERT INTO payment_authorizations (order_id, reference) VALUES ($1, $2) ON CONFLICT (order_id) DO NOTHING",
+		orderID, reference,
+	)
+	return err
+}
+
+// Authorization returns the reference of an order's payment authorization
+func (a *PostgresAuthorizations) Authorization(orderID string) (string, bool, error) {
+	var reference string
+	err := a.db.QueryRow("SELECT reference FROM payment_authorizations WHERE order_id = $1", orderID).Scan(&reference)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return reference, true, nil
+}
+
+// PaymentListener applies payment service outcomes to orders. Authorization
+// results are only followed when the fulfillment saga is not handling them;
+// an order is then marked paid once its payment is authorized and its stock
+// reserved, whichever happens last.
+type PaymentListener struct {
+	service              *Service
+	authorizations       AuthorizationStore
+	subscriber           messaging.Subscriber
+	followAuthorizations bool
+	logger               *log.Logger
+}
+
+// NewPaymentListener creates a new PaymentListener
+func NewPaymentListener(service *Service, authorizations AuthorizationStore, subscriber messaging.Subscriber, followAuthorizations bool, logger *log.Logger) *PaymentListener {
+	return &PaymentListener{
+		service:              service,
+		authorizations:       authorizations,
+		subscriber:           subscriber,
+		followAuthorizations: followAuthorizations,
+		logger:               logger,
+	}
+}
+
+// Start subscribes to payment events
+func (l *PaymentListener) Start() error {
+	if err := l.subscriber.Subscribe(messaging.EventTypeRefundIssued, l.handleRefundIssued); err != nil {
+		return fmt.Errorf("failed to subscribe to RefundIssued: %w", err)
+	}
+
+	if !l.followAuthorizations {
+		return nil
+	}
+
+	if err := l.subscriber.Subscribe(messaging.EventTypePaymentAuthorized, l.handlePaymentAuthorized); err != nil {
+		return fmt.Errorf("failed to subscribe to PaymentAuthorized: %w", err)
+	}
+
+	if err := l.subscriber.Subscribe(messaging.EventTypePaymentFailed, l.handlePaymentFailed); err != nil {
+		return fmt.Errorf("failed to subscribe to PaymentFailed: %w", err)
+	}
+
+	return nil
+}
+
+// handlePaymentAuthorized records the authorization and marks the order paid
+// if its stock is already reserved
+func (l *PaymentListener) handlePaymentAuthorized(event messaging.Event) {
+	var payload messaging.FulfillmentPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		l.logger.Printf("Failed to unmarshal PaymentAuthorized payload: %v", err)
+		return
+	}
+
+	if err := l.authorizations.RecordAuthorization(payload.OrderID, payload.Reference); err != nil {
+		l.logger.Printf("Failed to record payment authorization of order %s: %v", payload.OrderID, err)
+		return
+	}
+	l.PayIfConfirmed(payload.OrderID)
+}
+
+// PayIfConfirmed marks an order paid once it is confirmed, i.e. its stock is
+// reserved, and its payment authorized. Both outcomes record their part before
+// calling it, so whichever arrives last moves the order on.
+func (l *PaymentListener) PayIfConfirmed(orderID string) {
+	order, err := l.service.GetOrder(orderID)
+	if err != nil {
+		l.logger.Printf("Failed to get order %s for payment: %v", orderID, err)
+		return
+	}
+	if order.Status != StatusConfirmed {
+		return // waiting for stock, or already past it
+	}
+
+	reference, ok, err := l.authorizations.Authorization(orderID)
+	if err != nil {
+		l.logger.Printf("Failed to look up payment authorization of order %s: %v", orderID, err)
+		return
+	}
+	if !ok {
+		return // waiting for the payment
+	}
+
+	l.apply(orderID, StatusPaid, "payment "+reference+" authorized")
+}
+
+// handlePaymentFailed cancels the order
+func (l *PaymentListener) handlePaymentFailed(event messaging.Event) {
+	var payload messaging.FulfillmentPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		l.logger.Printf("Failed to unmarshal PaymentFailed payload: %v", err)
+		return
+	}
+
+	l.apply(payload.OrderID, StatusCancelled, payload.Reason)
+}
+
+// handleRefundIssued marks fully refunded orders as refunded
+func (l *PaymentListener) handleRefundIssued(event messaging.Event) {
+	var payload messaging.RefundIssuedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		l.logger.Printf("Failed to unmarshal RefundIssued payload: %v", err)
+		return
+	}
+
+	if !payload.FullyRefunded {
+		l.logger.Printf("Order %s partially refunded: %s", payload.OrderID, payload.Amount)
+		return
+	}
+
+	l.apply(payload.OrderID, StatusRefunded, payload.Reason)
+}
+
+// apply moves an order to status, treating an order already past it as handled
+func (l *PaymentListener) apply(orderID string, status Status, reason string) {
+	_, err := l.service.UpdateOrderStatus(orderID, status, PaymentActor, reason)
+	if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrConcurrentUpdate) {
+		l.logger.Printf("Ignoring payment outcome for order %s: %v", orderID, err)
+		return
+	}
+	if err != nil {
+		l.logger.Printf("Failed to move order %s to %s: %v", orderID, status, err)
+	}
+}
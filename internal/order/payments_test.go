@@ -0,0 +1,141 @@
+package order
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/test/mocks"
+)
+
+// memoryRepository keeps orders in memory; only what the listeners use is implemented
+type memoryRepository struct {
+	Repository
+	mu      sync.Mutex
+	orders  map[string]Order
+	history map[string][]Transition
+}
+
+func newMemoryRepository(orders ...Order) *memoryRepository {
+	r := &memoryRepository{orders: make(map[string]Order), history: make(map[string][]Transition)}
+	for _, o := range orders {
+		r.orders[o.ID] = o
+	}
+	return r
+}
+
+func (r *memoryRepository) GetOrder(id string) (Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[id]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	return o, nil
+}
+
+func (r *memoryRepository) UpdateOrderStatus(id string, t Transition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o := r.orders[id]
+	if o.Status != t.From {
+		return fmt.Errorf("%w: order %s is no longer %s", ErrConcurrentUpdate, id, t.From)
+	}
+	o.Status = t.To
+	r.orders[id] = o
+	r.history[id] = append(r.history[id], t)
+	return nil
+}
+
+// memoryAuthorizations is an in-memory AuthorizationStore
+type memoryAuthorizations map[string]string
+
+func (a memoryAuthorizations) RecordAuthorization(orderID, reference string) error {
+	if _, ok := a[orderID]; !ok {
+		a[orderID] = reference
+	}
+	return nil
+}
+
+func (a memoryAuthorizations) Authorization(orderID string) (string, bool, error) {
+	reference, ok := a[orderID]
+	return reference, ok, nil
+}
+
+func TestListenersPayOnlyConfirmedOrders(t *testing.T) {
+	tests := []struct {
+		name       string
+		events     []string
+		wantStatus Status
+	}{
+		{
+			name:       "stock then payment",
+			events:     []string{messaging.EventTypeStockReserved, messaging.EventTypePaymentAuthorized},
+			wantStatus: StatusPaid,
+		},
+		{
+			name:       "payment then stock",
+			events:     []string{messaging.EventTypePaymentAuthorized, messaging.EventTypeStockReserved},
+			wantStatus: StatusPaid,
+		},
+		{
+			name:       "payment alone doesn't confirm the order",
+			events:     []string{messaging.EventTypePaymentAuthorized},
+			wantStatus: StatusPending,
+		},
+		{
+			name:       "stock alone confirms the order",
+			events:     []string{messaging.EventTypeStockReserved},
+			wantStatus: StatusConfirmed,
+		},
+		{
+			name:       "redelivered outcomes are ignored",
+			events:     []string{messaging.EventTypePaymentAuthorized, messaging.EventTypeStockReserved, messaging.EventTypePaymentAuthorized, messaging.EventTypeStockReserved},
+			wantStatus: StatusPaid,
+		},
+		{
+			name:       "authorized payment of an order without stock",
+			events:     []string{messaging.EventTypePaymentAuthorized, messaging.EventTypeStockInsufficient},
+			wantStatus: StatusCancelled,
+		},
+		{
+			name:       "late stock for a cancelled order",
+			events:     []string{messaging.EventTypePaymentFailed, messaging.EventTypeStockReserved},
+			wantStatus: StatusCancelled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(io.Discard, "", 0)
+			bus := mocks.NewBus()
+			repo := newMemoryRepository(Order{ID: "1", UserID: "7", Status: StatusPending})
+			service := NewService(repo, nil, nil, bus, logger)
+
+			payments := NewPaymentListener(service, memoryAuthorizations{}, bus, true, logger)
+			if err := payments.Start(); err != nil {
+				t.Fatal(err)
+			}
+			if err := NewStockListener(service, payments, bus, logger).Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, eventType := range tt.events {
+				bus.Publish(eventType, messaging.NewFulfillmentEvent(eventType, messaging.FulfillmentPayload{OrderID: "1", Reference: "auth-1"}))
+			}
+
+			o, _ := repo.GetOrder("1")
+			if o.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s (history %+v)", o.Status, tt.wantStatus, repo.history["1"])
+			}
+			for _, tr := range repo.history["1"] {
+				if tr.To == StatusConfirmed && tr.Actor != InventoryActor {
+					t.Errorf("order confirmed by %s, want %s", tr.Actor, InventoryActor)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/eventstore"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+	"github.com/alex-necsoiu/event-driven/pkg/projection"
+)
+
+// NewEventStore returns the store holding the order event log
+func NewEventStore(db *sql.DB) *eventstore.PostgresStore {
+	return eventstore.NewPostgresStore(db, "order_events")
+}
+
+// EventLogSubjectPrefix prefixes the subjects the order event log is relayed
+// under, keeping the raw log apart from the events the service publishes itself
+const EventLogSubjectPrefix = "order_events."
+
+// NewEventLogRelay returns the subscription forwarding the order event log to
+// the bus, e.g. order_events.OrderCreated
+func NewEventLogRelay(db *sql.DB, publisher messaging.Publisher, logger *log.Logger) *eventstore.Subscription {
+	return eventstore.NewSubscription("order_events", NewEventStore(db), eventstore.NewPostgresCheckpoints(db), publisher, EventLogSubjectPrefix, logger)
+}
+
+// Projections returns the order read models
+func Projections() []projection.Projection {
+	return []projection.Projection{UserOrdersProjection{}, DailyRevenueProjection{}}
+}
+
+// projectedEventTypes are the events both order projections consume
+func projectedEventTypes() []string {
+	types := []string{messaging.EventTypeOrderCreated, orderImportedEvent}
+	for _, status := range []Status{StatusConfirmed, StatusPaid, StatusShipped, StatusCompleted, StatusCancelled, StatusRefunded} {
+		types = append(types, transitionEvents[status])
+	}
+	return types
+}
+
+// orderFacts is what projections read from an order event. The keys are shared
+// by the bus payloads and the events of the order event log.
+type orderFacts struct {
+	OrderID   string            `json:"order_id"`
+	UserID    string            `json:"user_id"`
+	Items     []json.RawMessage `json:"items"`
+	Amount    money.Money       `json:"amount"`
+	Status    Status            `json:"status"`
+	CreatedAt time.Time         `json:"created_at"`
+	To        Status            `json:"to_status"`
+	ChangedAt time.Time         `json:"changed_at"`
+}
+
+func decodeFacts(e projection.Event) (orderFacts, error) {
+	var facts orderFacts
+	if e.Type == orderImportedEvent {
+		var imported struct {
+			Order orderFacts `json:"order"`
+		}
+		if err := json.Unmarshal(e.Data, &imported); err != nil {
+			return orderFacts{}, fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+		}
+		facts = imported.Order
+	} else if err := json.Unmarshal(e.Data, &facts); err != nil {
+		return orderFacts{}, fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+	}
+
+	// Transitions in the event log identify their order by stream only
+	if facts.OrderID == "" {
+		facts.OrderID = e.StreamID
+	}
+	if facts.OrderID == "" {
+		return orderFacts{}, fmt.Errorf("%s event has no order_id", e.Type)
+	}
+	return facts, nil
+}
+
+// UserOrdersProjection maintains user_orders, one row per order keyed for
+// listing a user's orders
+type UserOrdersProjection struct{}
+
+func (UserOrdersProjection) Name() string         { return "user_orders" }
+func (UserOrdersProjection) EventTypes() []string { return projectedEventTypes() }
+
+// Handle inserts placed orders and moves them through their statuses
+func (UserOrdersProjection) Handle(ctx context.Context, tx *sql.Tx, e projection.Event) error {
+	facts, err := decodeFacts(e)
+	if err != nil {
+		return err
+	}
+
+	switch e.Type {
+	case messaging.EventTypeOrderCreated, orderImportedEvent:
+		updatedAt := facts.CreatedAt
+		if facts.Status != StatusPending {
+			updatedAt = e.RecordedAt
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_orders (order_id, user_id, status, amount, currency, item_count, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (order_id) DO NOTHING`,
+			facts.OrderID, facts.UserID, facts.Status, facts.Amount.Amount, facts.Amount.Currency, len(facts.Items), facts.CreatedAt, updatedAt,
+		)
+	default:
+		// Bus events may arrive out of order; never move an order back in time
+		_, err = tx.ExecContext(ctx,
+			"UPDATE user_orders SET status = $2, updated_at = $3 WHERE order_id = $1 AND updated_at <= $3",
+			facts.OrderID, facts.To, facts.ChangedAt,
+		)
+	}
+	return err
+}
+
+// Reset empties user_orders
+func (UserOrdersProjection) Reset(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "TRUNCATE user_orders")
+	return err
+}
+
+// DailyRevenueProjection maintains daily_revenue, the orders placed per UTC
+// day and currency with their gross, cancelled and refunded amounts. Each
+// order is counted once, tracked in daily_revenue_orders.
+type DailyRevenueProjection struct{}
+
+func (DailyRevenueProjection) Name() string         { return "daily_revenue" }
+func (DailyRevenueProjection) EventTypes() []string { return projectedEventTypes() }
+
+// revenueColumns maps the statuses that take revenue back to their column
+var revenueColumns = map[Status]string{
+	StatusCancelled: "cancelled",
+	StatusRefunded:  "refunded",
+}
+
+// Handle counts placed orders on their day and deducts cancellations and refunds from it
+func (p DailyRevenueProjection) Handle(ctx context.Context, tx *sql.Tx, e projection.Event) error {
+	facts, err := decodeFacts(e)
+	if err != nil {
+		return err
+	}
+
+	switch e.Type {
+	case messaging.EventTypeOrderCreated, orderImportedEvent:
+		if err := p.place(ctx, tx, facts); err != nil {
+			return err
+		}
+		// An imported order may already be past its revenue
+		return p.settle(ctx, tx, facts.OrderID, facts.Status)
+	default:
+		return p.settle(ctx, tx, facts.OrderID, facts.To)
+	}
+}
+
+// place counts an order on the day it was created, unless it was counted before
+func (DailyRevenueProjection) place(ctx context.Context, tx *sql.Tx, facts orderFacts) error {
+	day := facts.CreatedAt.UTC().Format(time.DateOnly)
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO daily_revenue_orders (order_id, day, currency, amount)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (order_id) DO NOTHING`,
+		facts.OrderID, day, facts.Amount.Currency, facts.Amount.Amount,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO daily_revenue (day, currency, orders, gross) VALUES ($1, $2, 1, $3)
+		ON CONFLICT (day, currency) DO UPDATE
+		SET orders = daily_revenue.orders + 1, gross = daily_revenue.gross + EXCLUDED.gross`,
+		day, facts.Amount.Currency, facts.Amount.Amount,
+	)
+	return err
+}
+
+// settle deducts an order's amount once it is cancelled or refunded
+func (DailyRevenueProjection) settle(ctx context.Context, tx *sql.Tx, orderID string, status Status) error {
+	column, ok := revenueColumns[status]
+	if !ok {
+		return nil
+	}
+
+	var (
+		day      time.Time
+		currency string
+		amount   int64
+	)
+	err := tx.QueryRowContext(ctx, `
+		UPDATE daily_revenue_orders SET outcome = $2
+		WHERE order_id = $1 AND outcome = 'open'
+		RETURNING day, currency, amount`,
+		orderID, status,
+	).Scan(&day, &currency, &amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Already settled, or placed before the projection started
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE daily_revenue SET "+column+" = "+column+" + $3 WHERE day = $1 AND currency = $2",
+		day, currency, amount,
+	)
+	return err
+}
+
+// Reset empties daily_revenue and its order ledger
+func (DailyRevenueProjection) Reset(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "TRUNCATE daily_revenue, daily_revenue_orders")
+	return err
+}
@@ -2,93 +2,368 @@ package order
 
 import (
 	"database/sql"
-	"log"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+
+	"github.com/lib/pq"
 )
 
 // Repository abstracts DB operations for orders
-// Implements basic PostgreSQL connection and migration placeholder
-
 type Repository interface {
-	CreateOrder(userID string, amount float64) (string, error)
+	// CreateOrder stores a new pending order with its line items and returns it with ID and timestamps
+	CreateOrder(order Order) (Order, error)
 	GetOrder(id string) (Order, error)
-	UpdateOrderStatus(id string, status string) error
+	// UpdateOrderStatus applies t only if the order is still in t.From, recording it in the history
+	UpdateOrderStatus(id string, t Transition) error
+	GetOrderHistory(id string) ([]Transition, error)
+	// ListOrders returns one page of orders, newest first, and the token for the next page
+	ListOrders(filter ListFilter) ([]Order, string, error)
 }
 
+// Order is stored as JSON in order events under the same keys as OrderCreatedPayload
 type Order struct {
-	ID     string
-	UserID string
-	Amount float64
+	ID        string      `json:"order_id"`
+	UserID    string      `json:"user_id"`
+	Items     []LineItem  `json:"items"`
+	Subtotal  money.Money `json:"subtotal"`
+	Tax       money.Money `json:"tax"`
+	Amount    money.Money `json:"amount"` // grand total including tax
+	Status    Status      `json:"status"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// ListFilter narrows ListOrders; zero values match everything
+type ListFilter struct {
+	UserID        string
+	Status        Status
+	CreatedAfter  time.Time // inclusive
+	CreatedBefore time.Time // exclusive
+	PageSize      int
+	PageToken     string
 }
 
+var (
+	// ErrNotFound is returned when an order does not exist
+	ErrNotFound = errors.New("order not found")
+	// ErrInvalidPageToken is returned when a page token can't be decoded
+	ErrInvalidPageToken = errors.New("invalid page token")
+)
+
 // PostgresRepository implements Repository using PostgreSQL
 type PostgresRepository struct {
 	db *sql.DB
 }
 
-// NewPostgresRepository creates a new PostgresRepository
-func NewPostgresRepository(connStr string, logger *log.Logger) (*PostgresRepository, error) {
-	db, err := sql.Open("postgres", connStr)
+// NewPostgresRepository creates a new PostgresRepository.
+// The schema is managed by the versioned migrations in Migrations().
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// CreateOrder creates a new pending order and its line items in one transaction
+func (r *PostgresRepository) CreateOrder(order Order) (Order, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return nil, err
+		return Order{}, err
 	}
-	// Run migrations (placeholder)
-	if err := migrateOrders(db, logger); err != nil {
-		return nil, err
+	defer tx.Rollback()
+
+	if order, err = insertOrder(tx, order); err != nil {
+		return Order{}, err
 	}
-	return &PostgresRepository{db: db}, nil
+
+	if err := tx.Commit(); err != nil {
+		return Order{}, err
+	}
+	return order, nil
 }
 
-// migrateOrders runs DB migrations for the orders table (placeholder)
-func migrateOrders(db *sql.DB, logger *log.Logger) error {
-	logger.Println("Running order table migrations (placeholder)")
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS orders (
-		id SERIAL PRIMARY KEY,
-		user_id INTEGER NOT NULL,
-		amount NUMERIC NOT NULL
-	)`)
-	return err
+// insertOrder writes a new pending order and its line items within tx
+func insertOrder(tx *sql.Tx, order Order) (Order, error) {
+	order.Status = StatusPending
+	// Amounts are written as exact decimal strings so NUMERIC never sees a float
+	err := tx.QueryRow(
+		"INSERT INTO orders (user_id, subtotal, tax, amount, currency, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id::text, created_at, updated_at",
+		order.UserID, order.Subtotal.Decimal(), order.Tax.Decimal(), order.Amount.Decimal(), order.Amount.Currency, order.Status,
+	).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
+	if err != nil {
+		return Order{}, err
+	}
+
+	for _, item := range order.Items {
+		if _, err := tx.Exec(
+			"INSERT INTO order_items (order_id, sku, name, quantity, unit_price, tax_rate_bps, tax, total) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			order.ID, item.SKU, item.Name, item.Quantity, item.UnitPrice.Decimal(), item.TaxRateBps, item.Tax.Decimal(), item.Total.Decimal(),
+		); err != nil {
+			return Order{}, err
+		}
+	}
+	return order, nil
 }
 
-// CreateOrder creates a new order and returns the order ID
-func (r *PostgresRepository) CreateOrder(userID string, amount float64) (string, error) {
-	var id string
-	err := r.db.QueryRow(
-		"INSERT INTO orders (user_id, amount) VALUES ($1, $2) RETURNING id::text",
-		userID, amount,
-	).Scan(&id)
+// orderColumns is the column list scanned into an Order
+const orderColumns = "id::text, user_id::text, subtotal::text, tax::text, amount::text, currency, status, created_at, updated_at"
 
-	if err != nil {
-		return "", err
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrder reads orderColumns, converting NUMERIC amounts without going through float64
+func scanOrder(row rowScanner) (Order, error) {
+	var (
+		order                 Order
+		subtotal, tax, amount string
+		currency              string
+	)
+	if err := row.Scan(&order.ID, &order.UserID, &subtotal, &tax, &amount, &currency, &order.Status, &order.CreatedAt, &order.UpdatedAt); err != nil {
+		return Order{}, err
 	}
 
-	return id, nil
+	var err error
+	if order.Subtotal, err = money.Parse(subtotal, currency); err != nil {
+		return Order{}, fmt.Errorf("invalid subtotal stored for order %s: %w", order.ID, err)
+	}
+	if order.Tax, err = money.Parse(tax, currency); err != nil {
+		return Order{}, fmt.Errorf("invalid tax stored for order %s: %w", order.ID, err)
+	}
+	if order.Amount, err = money.Parse(amount, currency); err != nil {
+		return Order{}, fmt.Errorf("invalid amount stored for order %s: %w", order.ID, err)
+	}
+	return order, nil
 }
 
-// GetOrder retrieves an order by ID
+// GetOrder retrieves an order and its line items by ID
 func (r *PostgresRepository) GetOrder(id string) (Order, error) {
-	var order Order
-	err := r.db.QueryRow(
-		"SELECT id::text, user_id::text, amount FROM orders WHERE id = $1",
+	order, err := scanOrder(r.db.QueryRow(
+		"SELECT "+orderColumns+" FROM orders WHERE id = $1",
 		id,
-	).Scan(&order.ID, &order.UserID, &order.Amount)
-
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Order{}, ErrNotFound
+	}
 	if err != nil {
 		return Order{}, err
 	}
 
-	return order, nil
+	orders := []Order{order}
+	if err := r.loadItems(orders); err != nil {
+		return Order{}, err
+	}
+	return orders[0], nil
+}
+
+// loadItems fills in the line items of orders with a single query
+func (r *PostgresRepository) loadItems(orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(orders))
+	index := make(map[string]int, len(orders))
+	for i, o := range orders {
+		ids[i] = o.ID
+		index[o.ID] = i
+	}
+
+	rows, err := r.db.Query(
+		"SELECT order_id::text, sku, name, quantity, unit_price::text, tax_rate_bps, tax::text, total::text FROM order_items WHERE order_id = ANY($1::int[]) ORDER BY id",
+		pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			orderID               string
+			item                  LineItem
+			unitPrice, tax, total string
+		)
+		if err := rows.Scan(&orderID, &item.SKU, &item.Name, &item.Quantity, &unitPrice, &item.TaxRateBps, &tax, &total); err != nil {
+			return err
+		}
+
+		o := &orders[index[orderID]]
+		currency := o.Amount.Currency
+		if item.UnitPrice, err = money.Parse(unitPrice, currency); err != nil {
+			return fmt.Errorf("invalid unit price stored for order %s: %w", orderID, err)
+		}
+		if item.Tax, err = money.Parse(tax, currency); err != nil {
+			return fmt.Errorf("invalid tax stored for order %s: %w", orderID, err)
+		}
+		if item.Total, err = money.Parse(total, currency); err != nil {
+			return fmt.Errorf("invalid total stored for order %s: %w", orderID, err)
+		}
+		o.Items = append(o.Items, item)
+	}
+	return rows.Err()
+}
+
+// UpdateOrderStatus moves an order from t.From to t.To and appends the transition to its history
+func (r *PostgresRepository) UpdateOrderStatus(id string, t Transition) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateOrderStatus(tx, id, t); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateOrderStatus applies t to the orders row and appends it to the history within tx
+func updateOrderStatus(tx *sql.Tx, id string, t Transition) error {
+	// Guarding on the current status makes concurrent transitions fail instead of overwriting each other
+	res, err := tx.Exec(
+		"UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4",
+		t.To, t.At, id, t.From,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%w: order %s is no longer %s", ErrConcurrentUpdate, id, t.From)
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason, changed_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		id, t.From, t.To, t.Actor, t.Reason, t.At,
+	); err != nil {
+		return err
+	}
+	return nil
 }
 
-// UpdateOrderStatus updates the status of an order
-func (r *PostgresRepository) UpdateOrderStatus(id string, status string) error {
-	// First, we need to add a status column to the orders table
-	// For now, we'll just log the status update
-	_, err := r.db.Exec(
-		"UPDATE orders SET status = $1 WHERE id = $2",
-		status, id,
+// GetOrderHistory returns the status transitions of an order, oldest first
+func (r *PostgresRepository) GetOrderHistory(id string) ([]Transition, error) {
+	rows, err := r.db.Query(
+		"SELECT from_status, to_status, actor, reason, changed_at FROM order_status_history WHERE order_id = $1 ORDER BY changed_at, id",
+		id,
 	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []Transition
+	for rows.Next() {
+		var t Transition
+		if err := rows.Scan(&t.From, &t.To, &t.Actor, &t.Reason, &t.At); err != nil {
+			return nil, err
+		}
+		history = append(history, t)
+	}
+	return history, rows.Err()
+}
 
-	return err
+// ListOrders pages through orders with keyset pagination on (created_at, id)
+func (r *PostgresRepository) ListOrders(filter ListFilter) ([]Order, string, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	addCond := func(cond string, values ...interface{}) {
+		for _, v := range values {
+			args = append(args, v)
+			cond = strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1)
+		}
+		conds = append(conds, cond)
+	}
+
+	if filter.UserID != "" {
+		addCond("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		addCond("status = ?", filter.Status)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		addCond("created_at >= ?", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		addCond("created_at < ?", filter.CreatedBefore)
+	}
+	if filter.PageToken != "" {
+		createdAt, id, err := decodePageToken(filter.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		addCond("(created_at, id) < (?, ?)", createdAt, id)
+	}
+
+	query := "SELECT " + orderColumns + " FROM orders"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	// Fetch one extra row to learn whether another page exists
+	args = append(args, filter.PageSize+1)
+	query += " ORDER BY created_at DESC, id DESC LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(orders) > filter.PageSize {
+		orders = orders[:filter.PageSize]
+		last := orders[len(orders)-1]
+		next = encodePageToken(last.CreatedAt, last.ID)
+	}
+
+	if err := r.loadItems(orders); err != nil {
+		return nil, "", err
+	}
+	return orders, next, nil
+}
+
+// encodePageToken builds an opaque cursor pointing after the given row
+func encodePageToken(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodePageToken(token string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidPageToken
+	}
+	ts, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidPageToken
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidPageToken
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidPageToken
+	}
+	return createdAt, id, nil
 }
@@ -11,37 +11,70 @@ import (
 // Service handles order business logic and event publishing
 type Service struct {
 	repo      Repository
+	catalogue Catalogue
+	users     UserValidator
 	publisher messaging.Publisher
 	logger    *log.Logger
 }
 
 // NewService creates a new order service
-func NewService(repo Repository, publisher messaging.Publisher, logger *log.Logger) *Service {
+func NewService(repo Repository, catalogue Catalogue, users UserValidator, publisher messaging.Publisher, logger *log.Logger) *Service {
 	return &Service{
 		repo:      repo,
+		catalogue: catalogue,
+		users:     users,
 		publisher: publisher,
 		logger:    logger,
 	}
 }
 
-// CreateOrder creates a new order and publishes OrderCreated event
-func (s *Service) CreateOrder(userID string, amount float64) (string, error) {
+// CreateOrder checks the user exists, prices the requested items from the
+// catalogue, stores the order and publishes OrderCreated event
+func (s *Service) CreateOrder(userID string, requests []ItemRequest) (Order, error) {
+	if err := s.users.ValidateUser(userID); err != nil {
+		return Order{}, err
+	}
+
+	skus := make([]string, 0, len(requests))
+	for _, req := range requests {
+		skus = append(skus, req.SKU)
+	}
+
+	products, err := s.catalogue.GetProducts(skus)
+	if err != nil {
+		return Order{}, fmt.Errorf("failed to get products: %w", err)
+	}
+
+	items, totals, err := priceItems(requests, products)
+	if err != nil {
+		return Order{}, err
+	}
+	if !totals.Total.IsPositive() {
+		return Order{}, fmt.Errorf("%w, got %s", ErrInvalidAmount, totals.Total)
+	}
+
 	// Create order in database
-	orderID, err := s.repo.CreateOrder(userID, amount)
+	order, err := s.repo.CreateOrder(Order{
+		UserID:   userID,
+		Items:    items,
+		Subtotal: totals.Subtotal,
+		Tax:      totals.Tax,
+		Amount:   totals.Total,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to create order: %w", err)
+		return Order{}, fmt.Errorf("failed to create order: %w", err)
 	}
 
-	s.logger.Printf("Created order: %s for user: %s, amount: %.2f", orderID, userID, amount)
+	s.logger.Printf("Created order: %s for user: %s, items: %d, amount: %s", order.ID, userID, len(items), order.Amount)
 
 	// Publish OrderCreated event
-	event := messaging.NewOrderCreatedEvent(orderID, userID, amount)
+	event := messaging.NewOrderCreatedEvent(order.ID, userID, toItemPayloads(items), order.Subtotal, order.Tax, order.Amount)
 	if err := s.publisher.Publish(messaging.EventTypeOrderCreated, event); err != nil {
 		s.logger.Printf("Failed to publish OrderCreated event: %v", err)
 		// Don't fail the operation if event publishing fails
 	}
 
-	return orderID, nil
+	return order, nil
 }
 
 // GetOrder retrieves an order by ID
@@ -53,19 +86,27 @@ func (s *Service) GetOrder(id string) (Order, error) {
 	return order, nil
 }
 
-// UpdateOrderStatus updates order status and publishes OrderUpdated event
-func (s *Service) UpdateOrderStatus(orderID, status string) error {
+// UpdateOrderStatus moves an order through its lifecycle, recording who changed it and why,
+// and publishes OrderUpdated plus the event matching the new status
+func (s *Service) UpdateOrderStatus(orderID string, status Status, actor, reason string) (Order, error) {
 	order, err := s.repo.GetOrder(orderID)
 	if err != nil {
-		return fmt.Errorf("failed to get order for status update: %w", err)
+		return Order{}, fmt.Errorf("failed to get order for status update: %w", err)
+	}
+
+	transition, err := newTransition(order.Status, status, actor, reason)
+	if err != nil {
+		return Order{}, err
 	}
 
 	// Update order status
-	if err := s.repo.UpdateOrderStatus(orderID, status); err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
+	if err := s.repo.UpdateOrderStatus(orderID, transition); err != nil {
+		return Order{}, fmt.Errorf("failed to update order status: %w", err)
 	}
+	order.Status = status
+	order.UpdatedAt = transition.At
 
-	s.logger.Printf("Updated order %s status to: %s", orderID, status)
+	s.logger.Printf("Updated order %s status: %s → %s (actor: %s)", orderID, transition.From, transition.To, transition.Actor)
 
 	// Publish OrderUpdated event
 	event := messaging.Event{
@@ -74,8 +115,8 @@ func (s *Service) UpdateOrderStatus(orderID, status string) error {
 			OrderID:   orderID,
 			UserID:    order.UserID,
 			Amount:    order.Amount,
-			Status:    status,
-			UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+			Status:    string(status),
+			UpdatedAt: transition.At.Format(time.RFC3339),
 		},
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
@@ -84,47 +125,108 @@ func (s *Service) UpdateOrderStatus(orderID, status string) error {
 		s.logger.Printf("Failed to publish OrderUpdated event: %v", err)
 	}
 
-	// Publish specific status events
-	switch status {
-	case "cancelled":
-		s.publishOrderCancelledEvent(orderID, order.UserID)
-	case "completed":
-		s.publishOrderCompletedEvent(orderID, order.UserID)
+	s.publishTransitionEvent(order, transition)
+
+	return order, nil
+}
+
+// CancelOrder cancels an order that has not shipped yet
+func (s *Service) CancelOrder(orderID, actor, reason string) (Order, error) {
+	return s.UpdateOrderStatus(orderID, StatusCancelled, actor, reason)
+}
+
+// CompleteOrder marks a shipped order as completed
+func (s *Service) CompleteOrder(orderID, actor string) (Order, error) {
+	return s.UpdateOrderStatus(orderID, StatusCompleted, actor, "")
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// ListOrders returns a page of orders matching filter and the token for the next page
+func (s *Service) ListOrders(filter ListFilter) ([]Order, string, error) {
+	switch {
+	case filter.PageSize <= 0:
+		filter.PageSize = defaultPageSize
+	case filter.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
 	}
 
-	return nil
+	orders, next, err := s.repo.ListOrders(filter)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list orders: %w", err)
+	}
+	return orders, next, nil
 }
 
-// publishOrderCancelledEvent publishes OrderCancelled event
-func (s *Service) publishOrderCancelledEvent(orderID, userID string) {
-	event := messaging.Event{
-		EventType: messaging.EventTypeOrderCancelled,
-		Payload: map[string]interface{}{
-			"order_id":     orderID,
-			"user_id":      userID,
-			"cancelled_at": time.Now().UTC().Format(time.RFC3339),
-		},
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+// GetOrderHistory returns the recorded status transitions of an order
+func (s *Service) GetOrderHistory(orderID string) ([]Transition, error) {
+	history, err := s.repo.GetOrderHistory(orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+	return history, nil
+}
+
+// UpsertProduct creates or replaces a catalogue product
+func (s *Service) UpsertProduct(p Product) (Product, error) {
+	if p.SKU == "" || p.Name == "" {
+		return Product{}, fmt.Errorf("%w: sku and name are required", ErrInvalidProduct)
+	}
+	if !p.UnitPrice.IsPositive() {
+		return Product{}, fmt.Errorf("%w: price must be positive, got %s", ErrInvalidProduct, p.UnitPrice)
+	}
+	if p.TaxRateBps < 0 || p.TaxRateBps > 10000 {
+		return Product{}, fmt.Errorf("%w: tax rate must be between 0 and 10000 basis points, got %d", ErrInvalidProduct, p.TaxRateBps)
 	}
 
-	if err := s.publisher.Publish(messaging.EventTypeOrderCancelled, event); err != nil {
-		s.logger.Printf("Failed to publish OrderCancelled event: %v", err)
+	if err := s.catalogue.UpsertProduct(p); err != nil {
+		return Product{}, fmt.Errorf("failed to upsert product: %w", err)
 	}
+
+	s.logger.Printf("Upserted product %s: %s at %s", p.SKU, p.Name, p.UnitPrice)
+	return p, nil
 }
 
-// publishOrderCompletedEvent publishes OrderCompleted event
-func (s *Service) publishOrderCompletedEvent(orderID, userID string) {
-	event := messaging.Event{
-		EventType: messaging.EventTypeOrderCompleted,
-		Payload: map[string]interface{}{
-			"order_id":     orderID,
-			"user_id":      userID,
-			"completed_at": time.Now().UTC().Format(time.RFC3339),
-		},
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+// ListProducts returns the catalogue, optionally including inactive products
+func (s *Service) ListProducts(includeInactive bool) ([]Product, error) {
+	products, err := s.catalogue.ListProducts(includeInactive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	return products, nil
+}
+
+func toItemPayloads(items []LineItem) []messaging.OrderItemPayload {
+	payloads := make([]messaging.OrderItemPayload, 0, len(items))
+	for _, item := range items {
+		payloads = append(payloads, messaging.OrderItemPayload{
+			SKU:        item.SKU,
+			Name:       item.Name,
+			Quantity:   item.Quantity,
+			UnitPrice:  item.UnitPrice,
+			TaxRateBps: item.TaxRateBps,
+			Tax:        item.Tax,
+			Total:      item.Total,
+		})
+	}
+	return payloads
+}
+
+// publishTransitionEvent publishes the typed event for the state the order entered
+func (s *Service) publishTransitionEvent(order Order, t Transition) {
+	eventType, ok := transitionEvents[t.To]
+	if !ok {
+		return
 	}
 
-	if err := s.publisher.Publish(messaging.EventTypeOrderCompleted, event); err != nil {
-		s.logger.Printf("Failed to publish OrderCompleted event: %v", err)
+	event := messaging.NewOrderStatusChangedEvent(
+		eventType, order.ID, order.UserID,
+		string(t.From), string(t.To), t.Actor, t.Reason, t.At,
+	)
+	if err := s.publisher.Publish(eventType, event); err != nil {
+		s.logger.Printf("Failed to publish %s event: %v", eventType, err)
 	}
 }
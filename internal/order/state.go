@@ -0,0 +1,110 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// Status is a state in the order lifecycle
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusConfirmed Status = "confirmed"
+	StatusPaid      Status = "paid"
+	StatusShipped   Status = "shipped"
+	StatusCompleted Status = "completed"
+	StatusCancelled Status = "cancelled"
+	StatusRefunded  Status = "refunded"
+)
+
+// SystemActor is recorded for transitions not triggered by a person
+const SystemActor = "system"
+
+var (
+	// ErrInvalidStatus is returned for a status outside the lifecycle
+	ErrInvalidStatus = errors.New("invalid order status")
+	// ErrInvalidTransition is returned when the lifecycle forbids moving between two states
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	// ErrConcurrentUpdate is returned when the order changed state while a transition was applied
+	ErrConcurrentUpdate = errors.New("order status was changed concurrently")
+)
+
+// transitions is the order state machine:
+//
+//	pending → confirmed → paid → shipped → completed
+//	pending | confirmed | paid → cancelled
+//	paid | shipped | completed → refunded
+var transitions = map[Status][]Status{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusShipped, StatusCancelled, StatusRefunded},
+	StatusShipped:   {StatusCompleted, StatusRefunded},
+	StatusCompleted: {StatusRefunded},
+	StatusCancelled: {},
+	StatusRefunded:  {},
+}
+
+// transitionEvents maps the target state of a transition to the event it emits
+var transitionEvents = map[Status]string{
+	StatusConfirmed: messaging.EventTypeOrderConfirmed,
+	StatusPaid:      messaging.EventTypeOrderPaid,
+	StatusShipped:   messaging.EventTypeOrderShipped,
+	StatusCompleted: messaging.EventTypeOrderCompleted,
+	StatusCancelled: messaging.EventTypeOrderCancelled,
+	StatusRefunded:  messaging.EventTypeOrderRefunded,
+}
+
+// ParseStatus validates a status string
+func ParseStatus(s string) (Status, error) {
+	status := Status(s)
+	if _, ok := transitions[status]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidStatus, s)
+	}
+	return status, nil
+}
+
+// CanTransitionTo reports whether the lifecycle allows moving from s to next
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether no further transitions are possible
+func (s Status) IsTerminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// Transition records a single status change: who made it, when and why.
+// Its JSON keys match OrderStatusChangedPayload.
+type Transition struct {
+	From   Status    `json:"from_status"`
+	To     Status    `json:"to_status"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"changed_at"`
+}
+
+// newTransition validates and builds a transition from the current status
+func newTransition(from, to Status, actor, reason string) (Transition, error) {
+	if !from.CanTransitionTo(to) {
+		return Transition{}, fmt.Errorf("%w: %s → %s", ErrInvalidTransition, from, to)
+	}
+	if actor == "" {
+		actor = SystemActor
+	}
+	return Transition{
+		From:   from,
+		To:     to,
+		Actor:  actor,
+		Reason: reason,
+		At:     time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,131 @@
+package order
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatusCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		want     bool
+	}{
+		{StatusPending, StatusConfirmed, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusPending, StatusPaid, false},
+		{StatusPending, StatusRefunded, false},
+		{StatusConfirmed, StatusPaid, true},
+		{StatusConfirmed, StatusCancelled, true},
+		{StatusConfirmed, StatusShipped, false},
+		{StatusConfirmed, StatusPending, false},
+		{StatusPaid, StatusShipped, true},
+		{StatusPaid, StatusCancelled, true},
+		{StatusPaid, StatusRefunded, true},
+		{StatusPaid, StatusCompleted, false},
+		{StatusShipped, StatusCompleted, true},
+		{StatusShipped, StatusRefunded, true},
+		{StatusShipped, StatusCancelled, false},
+		{StatusCompleted, StatusRefunded, true},
+		{StatusCompleted, StatusCancelled, false},
+		{StatusCancelled, StatusPending, false},
+		{StatusCancelled, StatusConfirmed, false},
+		{StatusRefunded, StatusCompleted, false},
+		{StatusPending, StatusPending, false},
+		{Status("archived"), StatusCancelled, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("%s → %s allowed = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestStatusIsTerminal(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   bool
+	}{
+		{StatusPending, false},
+		{StatusConfirmed, false},
+		{StatusPaid, false},
+		{StatusShipped, false},
+		{StatusCompleted, false},
+		{StatusCancelled, true},
+		{StatusRefunded, true},
+	}
+	for _, tt := range tests {
+		if got := tt.status.IsTerminal(); got != tt.want {
+			t.Errorf("%s.IsTerminal() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Status
+		wantErr bool
+	}{
+		{in: "pending", want: StatusPending},
+		{in: "refunded", want: StatusRefunded},
+		{in: "Pending", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "archived", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseStatus(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidStatus) {
+				t.Errorf("ParseStatus(%q) error = %v, want %v", tt.in, err, ErrInvalidStatus)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseStatus(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewTransition(t *testing.T) {
+	tests := []struct {
+		name      string
+		from, to  Status
+		actor     string
+		wantActor string
+		wantErr   error
+	}{
+		{name: "allowed transition", from: StatusPending, to: StatusCancelled, actor: "user:7", wantActor: "user:7"},
+		{name: "without an actor the system made it", from: StatusPaid, to: StatusShipped, wantActor: SystemActor},
+		{name: "forbidden transition", from: StatusCancelled, to: StatusConfirmed, actor: "admin", wantErr: ErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := newTransition(tt.from, tt.to, tt.actor, "because")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("newTransition() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if tr.From != tt.from || tr.To != tt.to || tr.Actor != tt.wantActor || tr.Reason != "because" {
+				t.Errorf("newTransition() = %+v", tr)
+			}
+			if tr.At.IsZero() || tr.At.Location().String() != "UTC" {
+				t.Errorf("transition time = %v, want the current UTC time", tr.At)
+			}
+		})
+	}
+}
+
+func TestTransitionEvents(t *testing.T) {
+	// Every state reachable by a transition publishes an event
+	for from, targets := range transitions {
+		for _, to := range targets {
+			if transitionEvents[to] == "" {
+				t.Errorf("%s → %s has no event", from, to)
+			}
+		}
+	}
+}
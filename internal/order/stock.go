@@ -0,0 +1,81 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// InventoryActor is recorded on order status changes caused by stock events
+const InventoryActor = "inventory-service"
+
+// StockListener applies stock reservation outcomes to orders when the
+// fulfillment saga is not handling them
+type StockListener struct {
+	service    *Service
+	payments   *PaymentListener
+	subscriber messaging.Subscriber
+	logger     *log.Logger
+}
+
+// NewStockListener creates a new StockListener; confirmed orders whose payment
+// is already authorized are handed to payments
+func NewStockListener(service *Service, payments *PaymentListener, subscriber messaging.Subscriber, logger *log.Logger) *StockListener {
+	return &StockListener{
+		service:    service,
+		payments:   payments,
+		subscriber: subscriber,
+		logger:     logger,
+	}
+}
+
+// Start subscribes to stock events
+func (l *StockListener) Start() error {
+	if err := l.subscriber.Subscribe(messaging.EventTypeStockReserved, l.handleStockReserved); err != nil {
+		return fmt.Errorf("failed to subscribe to StockReserved: %w", err)
+	}
+
+	if err := l.subscriber.Subscribe(messaging.EventTypeStockInsufficient, l.handleStockInsufficient); err != nil {
+		return fmt.Errorf("failed to subscribe to StockInsufficient: %w", err)
+	}
+
+	return nil
+}
+
+// handleStockReserved confirms the order and marks it paid if its payment was
+// authorized first
+func (l *StockListener) handleStockReserved(event messaging.Event) {
+	var payload messaging.FulfillmentPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		l.logger.Printf("Failed to unmarshal StockReserved payload: %v", err)
+		return
+	}
+
+	l.apply(payload.OrderID, StatusConfirmed, "stock reserved")
+	l.payments.PayIfConfirmed(payload.OrderID)
+}
+
+// handleStockInsufficient cancels the order, which releases any payment hold
+func (l *StockListener) handleStockInsufficient(event messaging.Event) {
+	var payload messaging.FulfillmentPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		l.logger.Printf("Failed to unmarshal StockInsufficient payload: %v", err)
+		return
+	}
+
+	l.apply(payload.OrderID, StatusCancelled, payload.Reason)
+}
+
+// apply moves an order to status, treating an order already past it as handled
+func (l *StockListener) apply(orderID string, status Status, reason string) {
+	_, err := l.service.UpdateOrderStatus(orderID, status, InventoryActor, reason)
+	if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrConcurrentUpdate) {
+		l.logger.Printf("Ignoring stock outcome for order %s: %v", orderID, err)
+		return
+	}
+	if err != nil {
+		l.logger.Printf("Failed to move order %s to %s: %v", orderID, status, err)
+	}
+}
@@ -0,0 +1,252 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrUnknownUser is returned when an order's user does not exist in the user service
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrUserDeleted is returned when an order's user has been deleted
+	ErrUserDeleted = errors.New("user has been deleted")
+	// ErrEmailNotVerified is returned when an order's user has not verified their email
+	ErrEmailNotVerified = errors.New("user has not verified their email")
+)
+
+// lookupTimeout bounds the fallback GetUser call to the user service
+const lookupTimeout = 3 * time.Second
+
+// UserValidator checks that orders are placed by existing, verified users
+type UserValidator interface {
+	ValidateUser(userID string) error
+}
+
+// UserDirectory validates users against a local read model of the user service,
+// fed by UserCreated, UserDeleted, UserUpdated and UserEmailVerified events.
+// Users missing from the read model (events still in flight, or created before
+// this service subscribed) are looked up once over gRPC and cached in the read
+// model. Users not yet verified are looked up again on every order, so a
+// verification is honoured before its event arrives.
+type UserDirectory struct {
+	db         *sql.DB
+	users      gen.UserServiceClient
+	subscriber messaging.Subscriber
+	logger     *log.Logger
+}
+
+// NewUserDirectory creates a new UserDirectory; call Start to follow user events
+func NewUserDirectory(db *sql.DB, users gen.UserServiceClient, subscriber messaging.Subscriber, logger *log.Logger) *UserDirectory {
+	return &UserDirectory{
+		db:         db,
+		users:      users,
+		subscriber: subscriber,
+		logger:     logger,
+	}
+}
+
+// Start subscribes to the user events that maintain the read model
+func (d *UserDirectory) Start() error {
+	if err := d.subscriber.Subscribe(messaging.EventTypeUserCreated, d.handleUserCreated); err != nil {
+		return fmt.Errorf("failed to subscribe to UserCreated: %w", err)
+	}
+
+	if err := d.subscriber.Subscribe(messaging.EventTypeUserDeleted, d.handleUserDeleted); err != nil {
+		return fmt.Errorf("failed to subscribe to UserDeleted: %w", err)
+	}
+
+	if err := d.subscriber.Subscribe(messaging.EventTypeUserUpdated, d.handleUserUpdated); err != nil {
+		return fmt.Errorf("failed to subscribe to UserUpdated: %w", err)
+	}
+
+	if err := d.subscriber.Subscribe(messaging.EventTypeUserEmailVerified, d.handleUserEmailVerified); err != nil {
+		return fmt.Errorf("failed to subscribe to UserEmailVerified: %w", err)
+	}
+
+	return nil
+}
+
+// ValidateUser returns nil if userID belongs to an existing, non-deleted user
+// with a verified email
+func (d *UserDirectory) ValidateUser(userID string) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user_id is required", ErrUnknownUser)
+	}
+
+	var deleted, verified bool
+	err := d.db.QueryRow(
+		"SELECT deleted_at IS NOT NULL, email_verified FROM known_users WHERE user_id = $1",
+		userID,
+	).Scan(&deleted, &verified)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return d.lookupUser(userID)
+	case err != nil:
+		return fmt.Errorf("failed to look up user: %w", err)
+	case deleted:
+		return fmt.Errorf("%w: %s", ErrUserDeleted, userID)
+	case !verified:
+		return d.lookupUser(userID)
+	}
+	return nil
+}
+
+// lookupUser asks the user service about a user the read model hasn't seen yet
+func (d *UserDirectory) lookupUser(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	resp, err := d.users.GetUser(ctx, &gen.GetUserRequest{Id: userID})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return fmt.Errorf("%w: %s", ErrUnknownUser, userID)
+	case err != nil:
+		// Fail closed: an unverified user would create another orphaned order
+		return fmt.Errorf("failed to verify user %s: %w", userID, err)
+	case resp.User == nil:
+		return fmt.Errorf("%w: %s", ErrUnknownUser, userID)
+	}
+	if resp.User.DeletedAt != "" {
+		deletedAt, err := time.Parse(time.RFC3339, resp.User.DeletedAt)
+		if err != nil {
+			deletedAt = time.Now().UTC()
+		}
+		if err := d.recordDeletion(resp.User.Id, deletedAt); err != nil {
+			d.logger.Printf("Failed to cache deletion of user %s: %v", userID, err)
+		}
+		return fmt.Errorf("%w: %s", ErrUserDeleted, userID)
+	}
+
+	if err := d.recordUser(resp.User.Id); err != nil {
+		d.logger.Printf("Failed to cache user %s: %v", userID, err)
+	}
+
+	verified := resp.User.EmailVerifiedAt != ""
+	// Events carry whole seconds; truncating keeps a same-second email change from looking older
+	if err := d.recordVerification(resp.User.Id, verified, time.Now().UTC().Truncate(time.Second)); err != nil {
+		d.logger.Printf("Failed to cache verification of user %s: %v", userID, err)
+	}
+	if !verified {
+		return fmt.Errorf("%w: %s", ErrEmailNotVerified, userID)
+	}
+	return nil
+}
+
+// recordUser adds a user to the read model. A tombstone from an earlier
+// UserDeleted is kept, so out-of-order events can't resurrect a user.
+func (d *UserDirectory) recordUser(userID string) error {
+	_, err := d.db.Exec(
+		"INSERT INTO known_users (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING",
+		userID,
+	)
+	return err
+}
+
+// recordDeletion marks a user as deleted in the read model
+func (d *UserDirectory) recordDeletion(userID string, deletedAt time.Time) error {
+	_, err := d.db.Exec(`
+		INSERT INTO known_users (user_id, deleted_at) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET deleted_at = EXCLUDED.deleted_at, updated_at = now()`,
+		userID, deletedAt,
+	)
+	return err
+}
+
+// recordVerification sets whether a user's email is verified, as of changedAt.
+// Older changes are ignored; on a tie the unverified state wins, so a missed
+// verification costs a lookup rather than letting an unverified email through.
+func (d *UserDirectory) recordVerification(userID string, verified bool, changedAt time.Time) error {
+	_, err := d.db.Exec(`
+		INSERT INTO known_users (user_id, email_verified, verification_changed_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET email_verified = EXCLUDED.email_verified, verification_changed_at = EXCLUDED.verification_changed_at, updated_at = now()
+		WHERE known_users.verification_changed_at IS NULL
+			OR known_users.verification_changed_at < EXCLUDED.verification_changed_at
+			OR (known_users.verification_changed_at = EXCLUDED.verification_changed_at AND NOT EXCLUDED.email_verified)`,
+		userID, verified, changedAt,
+	)
+	return err
+}
+
+// handleUserCreated handles UserCreated events
+func (d *UserDirectory) handleUserCreated(event messaging.Event) {
+	var payload messaging.UserCreatedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		d.logger.Printf("Failed to unmarshal UserCreated payload: %v", err)
+		return
+	}
+
+	if err := d.recordUser(payload.UserID); err != nil {
+		d.logger.Printf("Failed to record user %s: %v", payload.UserID, err)
+	}
+}
+
+// handleUserDeleted handles UserDeleted events
+func (d *UserDirectory) handleUserDeleted(event messaging.Event) {
+	var payload messaging.UserDeletedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		d.logger.Printf("Failed to unmarshal UserDeleted payload: %v", err)
+		return
+	}
+
+	deletedAt, err := time.Parse(time.RFC3339, payload.DeletedAt)
+	if err != nil {
+		deletedAt = time.Now().UTC()
+	}
+
+	if err := d.recordDeletion(payload.UserID, deletedAt); err != nil {
+		d.logger.Printf("Failed to record deletion of user %s: %v", payload.UserID, err)
+		return
+	}
+	d.logger.Printf("User %s deleted; new orders will be rejected", payload.UserID)
+}
+
+// handleUserUpdated handles UserUpdated events, which revoke verification
+// when the email changed
+func (d *UserDirectory) handleUserUpdated(event messaging.Event) {
+	var payload messaging.UserUpdatedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		d.logger.Printf("Failed to unmarshal UserUpdated payload: %v", err)
+		return
+	}
+
+	updatedAt, err := time.Parse(time.RFC3339, payload.UpdatedAt)
+	if err != nil {
+		updatedAt = time.Now().UTC()
+	}
+
+	if err := d.recordVerification(payload.UserID, payload.EmailVerified, updatedAt); err != nil {
+		d.logger.Printf("Failed to record verification of user %s: %v", payload.UserID, err)
+	}
+}
+
+// handleUserEmailVerified handles UserEmailVerified events
+func (d *UserDirectory) handleUserEmailVerified(event messaging.Event) {
+	var payload messaging.UserEmailVerifiedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		d.logger.Printf("Failed to unmarshal UserEmailVerified payload: %v", err)
+		return
+	}
+
+	verifiedAt, err := time.Parse(time.RFC3339, payload.VerifiedAt)
+	if err != nil {
+		verifiedAt = time.Now().UTC()
+	}
+
+	if err := d.recordVerification(payload.UserID, true, verifiedAt); err != nil {
+		d.logger.Printf("Failed to record verification of user %s: %v", payload.UserID, err)
+		return
+	}
+	d.logger.Printf("User %s verified their email; orders are accepted", payload.UserID)
+}
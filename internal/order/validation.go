@@ -0,0 +1,138 @@
+package order
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+	"github.com/alex-necsoiu/event-driven/pkg/validation"
+)
+
+// Limits on order requests; amounts are in minor units
+const (
+	maxItems        = 100
+	maxQuantity     = 10000
+	maxSKULength    = 64
+	maxNameLength   = 200
+	maxActorLength  = 100
+	maxReasonLength = 500
+	maxUnitPrice    = 100_000_000 // 1,000,000.00 in a two-decimal currency
+	maxTaxRateBps   = 10000
+)
+
+func validateCreateOrder(req *gen.CreateOrderRequest) error {
+	var v validation.Violations
+	v.ID("user_id", req.UserId)
+
+	switch {
+	case len(req.Items) == 0:
+		v.Add("items", "must contain at least one item")
+	case len(req.Items) > maxItems:
+		v.Add("items", "must contain at most %d items", maxItems)
+	}
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		item.Sku = strings.TrimSpace(item.Sku)
+		if v.Required(field+".sku", item.Sku) {
+			v.Length(field+".sku", item.Sku, maxSKULength)
+		}
+		v.Range(field+".quantity", item.Quantity, 1, maxQuantity)
+	}
+	return v.Err()
+}
+
+// validateOrderID checks the ID of a single-order request
+func validateOrderID(id string) error {
+	var v validation.Violations
+	v.ID("id", id)
+	return v.Err()
+}
+
+// validateStatusChange checks the common fields of a status change request
+func validateStatusChange(v *validation.Violations, id, actor, reason string) {
+	v.ID("id", id)
+	v.Length("actor", actor, maxActorLength)
+	v.Length("reason", reason, maxReasonLength)
+}
+
+func validateUpdateOrderStatus(req *gen.UpdateOrderStatusRequest) error {
+	var v validation.Violations
+	validateStatusChange(&v, req.Id, req.Actor, req.Reason)
+	if v.Required("status", req.Status) {
+		if _, err := ParseStatus(req.Status); err != nil {
+			v.Add("status", "must be a valid order status")
+		}
+	}
+	return v.Err()
+}
+
+func validateCancelOrder(req *gen.CancelOrderRequest) error {
+	var v validation.Violations
+	validateStatusChange(&v, req.Id, req.Actor, req.Reason)
+	return v.Err()
+}
+
+func validateCompleteOrder(req *gen.CompleteOrderRequest) error {
+	var v validation.Violations
+	validateStatusChange(&v, req.Id, req.Actor, "")
+	return v.Err()
+}
+
+func validateListOrders(req *gen.ListOrdersRequest) error {
+	var v validation.Violations
+	if req.UserId != "" {
+		v.ID("user_id", req.UserId)
+	}
+	if req.Status != "" {
+		if _, err := ParseStatus(req.Status); err != nil {
+			v.Add("status", "must be a valid order status")
+		}
+	}
+	validateTimestamp(&v, "created_after", req.CreatedAfter)
+	validateTimestamp(&v, "created_before", req.CreatedBefore)
+	v.Range("page_size", int64(req.PageSize), 0, maxPageSize)
+	return v.Err()
+}
+
+// validateTimestamp checks an optional RFC 3339 timestamp
+func validateTimestamp(v *validation.Violations, field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := time.Parse(time.RFC3339, value); err != nil {
+		v.Add(field, "must be an RFC 3339 timestamp")
+	}
+}
+
+// validateUpsertProduct checks an UpsertProductRequest, trimming the product's
+// SKU and name in place
+func validateUpsertProduct(req *gen.UpsertProductRequest) error {
+	var v validation.Violations
+	p := req.Product
+	if p == nil {
+		v.Add("product", "is required")
+		return v.Err()
+	}
+
+	p.Sku = strings.TrimSpace(p.Sku)
+	if v.Required("product.sku", p.Sku) {
+		v.Length("product.sku", p.Sku, maxSKULength)
+	}
+	p.Name = strings.TrimSpace(p.Name)
+	if v.Required("product.name", p.Name) {
+		v.Length("product.name", p.Name, maxNameLength)
+	}
+
+	if p.UnitPrice == nil {
+		v.Add("product.unit_price", "is required")
+	} else {
+		v.Range("product.unit_price.amount", p.UnitPrice.Amount, 1, maxUnitPrice)
+		if _, err := money.Exponent(p.UnitPrice.Currency); err != nil {
+			v.Add("product.unit_price.currency", "must be a supported ISO 4217 code")
+		}
+	}
+	v.Range("product.tax_rate_bps", p.TaxRateBps, 0, maxTaxRateBps)
+	return v.Err()
+}
@@ -0,0 +1,69 @@
+package payment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+)
+
+// FakeDeclineLimit is the largest amount, in minor units, the fake provider authorizes
+const FakeDeclineLimit = 1_000_000
+
+// FakeProvider is a deterministic in-process Provider for local development and
+// demos. Outcomes depend only on the input, like a processor's test cards:
+//   - amounts ending in .13 (minor units % 100 == 13) are declined as "card declined"
+//   - amounts above FakeDeclineLimit are declined as "insufficient funds"
+//   - everything else is authorized, captured, voided and refunded successfully
+type FakeProvider struct{}
+
+// NewFakeProvider creates a new FakeProvider
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+// Authorize declines the magic amounts above and approves the rest
+func (p *FakeProvider) Authorize(ctx context.Context, orderID string, amount money.Money) (string, error) {
+	switch {
+	case amount.Amount%100 == 13:
+		return "", fmt.Errorf("%w: card declined", ErrDeclined)
+	case amount.Amount > FakeDeclineLimit:
+		return "", fmt.Errorf("%w: insufficient funds", ErrDeclined)
+	}
+	return fakeReference("auth", orderID, amount.String()), nil
+}
+
+// Capture always succeeds for fake authorizations
+func (p *FakeProvider) Capture(ctx context.Context, reference string, amount money.Money) error {
+	return checkFakeReference(reference)
+}
+
+// Void always succeeds for fake authorizations
+func (p *FakeProvider) Void(ctx context.Context, reference string) error {
+	return checkFakeReference(reference)
+}
+
+// Refund always succeeds for fake authorizations
+func (p *FakeProvider) Refund(ctx context.Context, reference string, amount money.Money) (string, error) {
+	if err := checkFakeReference(reference); err != nil {
+		return "", err
+	}
+	return fakeReference("refund", reference, amount.String()), nil
+}
+
+// fakeReference derives a stable reference from its inputs, so retries of the
+// same call return the same reference
+func fakeReference(kind string, parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return "fake_" + kind + "_" + hex.EncodeToString(sum[:8])
+}
+
+func checkFakeReference(reference string) error {
+	if !strings.HasPrefix(reference, "fake_auth_") {
+		return fmt.Errorf("unknown authorization %q", reference)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package payment
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+)
+
+// PaymentHandler implements the gRPC PaymentServiceServer
+type PaymentHandler struct {
+	gen.UnimplementedPaymentServiceServer
+	service *Service
+	logger  *log.Logger
+}
+
+func NewPaymentHandler(service *Service, logger *log.Logger) *PaymentHandler {
+	return &PaymentHandler{service: service, logger: logger}
+}
+
+// GetPayment handles fetching the payment of an order
+func (h *PaymentHandler) GetPayment(ctx context.Context, req *gen.GetPaymentRequest) (*gen.PaymentResponse, error) {
+	h.logger.Printf("GetPayment called for order: %s", req.OrderId)
+
+	p, err := h.service.GetPayment(req.OrderId)
+	return h.paymentResponse("get payment", p, err)
+}
+
+// RefundPayment handles full and partial refunds
+func (h *PaymentHandler) RefundPayment(ctx context.Context, req *gen.RefundPaymentRequest) (*gen.PaymentResponse, error) {
+	h.logger.Printf("RefundPayment called for order: %s", req.OrderId)
+
+	var amount *money.Money
+	if req.Amount != nil {
+		m, err := money.New(req.Amount.Amount, req.Amount.Currency)
+		if err != nil {
+			return &gen.PaymentResponse{Payment: nil, Error: err.Error()}, nil
+		}
+		amount = &m
+	}
+
+	p, err := h.service.Refund(req.OrderId, amount, req.Reason)
+	return h.paymentResponse("refund payment", p, err)
+}
+
+// paymentResponse wraps the result of a payment call in a PaymentResponse
+func (h *PaymentHandler) paymentResponse(action string, p Payment, err error) (*gen.PaymentResponse, error) {
+	if err != nil {
+		h.logger.Printf("Failed to %s: %v", action, err)
+		return &gen.PaymentResponse{
+			Payment: nil,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	return &gen.PaymentResponse{
+		Payment: toProtoPayment(p),
+		Error:   "",
+	}, nil
+}
+
+func toProtoPayment(p Payment) *gen.Payment {
+	return &gen.Payment{
+		Id:                p.ID,
+		OrderId:           p.OrderID,
+		UserId:            p.UserID,
+		Amount:            toProtoMoney(p.Amount),
+		Status:            string(p.Status),
+		ProviderReference: p.ProviderReference,
+		FailureReason:     p.FailureReason,
+		Refunded:          toProtoMoney(p.Refunded),
+		CreatedAt:         formatTime(p.CreatedAt),
+		UpdatedAt:         formatTime(p.UpdatedAt),
+	}
+}
+
+func toProtoMoney(m money.Money) *gen.Money {
+	return &gen.Money{Amount: m.Amount, Currency: m.Currency}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
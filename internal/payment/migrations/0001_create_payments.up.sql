@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS payments (
+    id BIGSERIAL PRIMARY KEY,
+    order_id TEXT NOT NULL UNIQUE,
+    user_id TEXT NOT NULL,
+    amount NUMERIC NOT NULL,
+    currency CHAR(3) NOT NULL,
+    status TEXT NOT NULL,
+    provider_reference TEXT NOT NULL DEFAULT '',
+    failure_reason TEXT NOT NULL DEFAULT '',
+    refunded_amount NUMERIC NOT NULL DEFAULT 0,
+    saga_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
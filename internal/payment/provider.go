@@ -0,0 +1,36 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+)
+
+// ErrDeclined is returned by a Provider that refused the charge; other errors
+// mean the provider could not be reached and the call may be retried
+var ErrDeclined = errors.New("payment declined")
+
+// Provider abstracts the payment processor. To support a real processor,
+// implement Provider and add it to NewProvider.
+type Provider interface {
+	// Authorize places a hold for amount and returns the authorization reference
+	Authorize(ctx context.Context, orderID string, amount money.Money) (string, error)
+	// Capture collects a previously authorized amount
+	Capture(ctx context.Context, reference string, amount money.Money) error
+	// Void releases an authorization that was not captured
+	Void(ctx context.Context, reference string) error
+	// Refund returns part or all of a captured amount and returns the refund reference
+	Refund(ctx context.Context, reference string, amount money.Money) (string, error)
+}
+
+// NewProvider returns the Provider selected by name
+func NewProvider(name string) (Provider, error) {
+	switch name {
+	case "fake":
+		return NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
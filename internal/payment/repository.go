@@ -0,0 +1,186 @@
+package payment
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+
+	_ "github.com/lib/pq"
+)
+
+// Status is where a payment is in its lifecycle
+type Status string
+
+const (
+	StatusPending           Status = "pending" // authorization in flight
+	StatusAuthorized        Status = "authorized"
+	StatusFailed            Status = "failed"
+	StatusCaptured          Status = "captured"
+	StatusVoided            Status = "voided"
+	StatusPartiallyRefunded Status = "partially_refunded"
+	StatusRefunded          Status = "refunded"
+)
+
+var (
+	// ErrNotFound is returned when an order has no payment
+	ErrNotFound = errors.New("payment not found")
+	// ErrInvalidState is returned when a payment is not in a state allowing the operation
+	ErrInvalidState = errors.New("payment is not in a valid state for this operation")
+)
+
+// Repository abstracts DB operations for payments
+type Repository interface {
+	// ClaimPayment stores a pending payment for its order; it returns false with
+	// the existing payment if the order already has one
+	ClaimPayment(p Payment) (Payment, bool, error)
+	GetPaymentByOrder(orderID string) (Payment, error)
+	// AttachSaga records the saga awaiting the authorization outcome
+	AttachSaga(orderID, sagaID string) (Payment, error)
+	// CompleteAuthorization moves a pending payment to authorized or failed
+	CompleteAuthorization(id string, status Status, reference, reason string) (Payment, error)
+	// Transition moves a payment from one status to another, failing with ErrInvalidState otherwise
+	Transition(id string, from, to Status) (Payment, error)
+	// RecordRefund adds amount to the refunded total of a captured payment
+	RecordRefund(id string, amount money.Money) (Payment, error)
+}
+
+// Payment is the money collected for one order
+type Payment struct {
+	ID                string
+	OrderID           string
+	UserID            string
+	Amount            money.Money
+	Status            Status
+	ProviderReference string
+	FailureReason     string
+	Refunded          money.Money
+	SagaID            string // fulfillment saga awaiting the authorization, if any
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository.
+// The schema is managed by the versioned migrations in Migrations().
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const paymentColumns = "id::text, order_id, user_id, amount::text, currency, status, provider_reference, failure_reason, refunded_amount::text, saga_id, created_at, updated_at"
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ClaimPayment inserts a pending payment unless the order already has one
+func (r *PostgresRepository) ClaimPayment(p Payment) (Payment, bool, error) {
+	claimed, err := scanPayment(r.db.QueryRow(`
+		INSERT INTO payments (order_id, user_id, amount, currency, status, saga_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (order_id) DO NOTHING
+		RETURNING `+paymentColumns,
+		p.OrderID, p.UserID, p.Amount.Decimal(), p.Amount.Currency, StatusPending, p.SagaID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err := r.GetPaymentByOrder(p.OrderID)
+		return existing, false, err
+	}
+	if err != nil {
+		return Payment{}, false, err
+	}
+	return claimed, true, nil
+}
+
+// GetPaymentByOrder retrieves the payment of an order
+func (r *PostgresRepository) GetPaymentByOrder(orderID string) (Payment, error) {
+	return r.queryPayment("SELECT "+paymentColumns+" FROM payments WHERE order_id = $1", orderID)
+}
+
+// AttachSaga sets the saga waiting on the payment's authorization
+func (r *PostgresRepository) AttachSaga(orderID, sagaID string) (Payment, error) {
+	return r.queryPayment(
+		"UPDATE payments SET saga_id = $2, updated_at = now() WHERE order_id = $1 RETURNING "+paymentColumns,
+		orderID, sagaID,
+	)
+}
+
+// CompleteAuthorization records the provider's answer for a pending payment
+func (r *PostgresRepository) CompleteAuthorization(id string, status Status, reference, reason string) (Payment, error) {
+	p, err := r.queryPayment(`
+		UPDATE payments SET status = $2, provider_reference = $3, failure_reason = $4, updated_at = now()
+		WHERE id = $1 AND status = $5
+		RETURNING `+paymentColumns,
+		id, status, reference, reason, StatusPending,
+	)
+	if errors.Is(err, ErrNotFound) {
+		return Payment{}, fmt.Errorf("%w: payment %s is no longer pending", ErrInvalidState, id)
+	}
+	return p, err
+}
+
+// Transition moves a payment between statuses, guarded by its current status
+func (r *PostgresRepository) Transition(id string, from, to Status) (Payment, error) {
+	p, err := r.queryPayment(`
+		UPDATE payments SET status = $3, updated_at = now()
+		WHERE id = $1 AND status = $2
+		RETURNING `+paymentColumns,
+		id, from, to,
+	)
+	if errors.Is(err, ErrNotFound) {
+		return Payment{}, fmt.Errorf("%w: payment %s is not %s", ErrInvalidState, id, from)
+	}
+	return p, err
+}
+
+// RecordRefund adds to the refunded total, never exceeding the captured amount
+func (r *PostgresRepository) RecordRefund(id string, amount money.Money) (Payment, error) {
+	p, err := r.queryPayment(`
+		UPDATE payments
+		SET refunded_amount = refunded_amount + $2,
+			status = CASE WHEN refunded_amount + $2 = amount THEN $3 ELSE $4 END,
+			updated_at = now()
+		WHERE id = $1 AND currency = $5 AND status IN ($6, $4) AND refunded_amount + $2 <= amount
+		RETURNING `+paymentColumns,
+		id, amount.Decimal(), StatusRefunded, StatusPartiallyRefunded, amount.Currency, StatusCaptured,
+	)
+	if errors.Is(err, ErrNotFound) {
+		return Payment{}, fmt.Errorf("%w: payment %s cannot be refunded %s", ErrInvalidState, id, amount)
+	}
+	return p, err
+}
+
+func (r *PostgresRepository) queryPayment(query string, args ...interface{}) (Payment, error) {
+	p, err := scanPayment(r.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Payment{}, ErrNotFound
+	}
+	return p, err
+}
+
+func scanPayment(row rowScanner) (Payment, error) {
+	var (
+		p                Payment
+		amount, refunded string
+		currency         string
+	)
+	if err := row.Scan(&p.ID, &p.OrderID, &p.UserID, &amount, &currency, &p.Status, &p.ProviderReference, &p.FailureReason, &refunded, &p.SagaID, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return Payment{}, err
+	}
+
+	var err error
+	if p.Amount, err = money.Parse(amount, currency); err != nil {
+		return Payment{}, fmt.Errorf("invalid amount stored for payment %s: %w", p.ID, err)
+	}
+	if p.Refunded, err = money.Parse(refunded, currency); err != nil {
+		return Payment{}, fmt.Errorf("invalid refunded amount stored for payment %s: %w", p.ID, err)
+	}
+	return p, nil
+}
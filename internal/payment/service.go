@@ -0,0 +1,311 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+)
+
+// providerTimeout bounds each call to the payment provider
+const providerTimeout = 10 * time.Second
+
+// Service handles payment business logic, reacting to order events and publishing outcomes
+type Service struct {
+	repo       Repository
+	provider   Provider
+	publisher  messaging.Publisher
+	subscriber messaging.Subscriber
+	logger     *log.Logger
+}
+
+// NewService creates a new payment service
+func NewService(repo Repository, provider Provider, publisher messaging.Publisher, subscriber messaging.Subscriber, logger *log.Logger) *Service {
+	return &Service{
+		repo:       repo,
+		provider:   provider,
+		publisher:  publisher,
+		subscriber: subscriber,
+		logger:     logger,
+	}
+}
+
+// Start subscribes to the order and saga events that drive payments
+func (s *Service) Start() error {
+	subscriptions := []struct {
+		eventType string
+		handler   func(messaging.Event)
+	}{
+		{messaging.EventTypeOrderCreated, s.handleOrderCreated},
+		{messaging.EventTypePaymentAuthorizationRequested, s.handleAuthorizationRequested},
+		{messaging.EventTypePaymentVoidRequested, s.handleVoidRequested},
+		{messaging.EventTypeOrderCancelled, s.handleOrderCancelled},
+		{messaging.EventTypeOrderShipped, s.handleOrderShipped},
+	}
+	for _, sub := range subscriptions {
+		if err := s.subscriber.Subscribe(sub.eventType, sub.handler); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", sub.eventType, err)
+		}
+	}
+
+	s.logger.Println("Payment service subscribed to events")
+	return nil
+}
+
+// Authorize places a hold for an order's amount and publishes PaymentAuthorized
+// or PaymentFailed. Each order is authorized at most once: later calls re-publish
+// the recorded outcome, addressed to sagaID if one is waiting for it.
+func (s *Service) Authorize(orderID, userID string, amount money.Money, sagaID string) (Payment, error) {
+	p, claimed, err := s.repo.ClaimPayment(Payment{
+		OrderID: orderID,
+		UserID:  userID,
+		Amount:  amount,
+		SagaID:  sagaID,
+	})
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to claim payment: %w", err)
+	}
+
+	if !claimed {
+		if sagaID != "" && p.SagaID != sagaID {
+			if p, err = s.repo.AttachSaga(orderID, sagaID); err != nil {
+				return Payment{}, fmt.Errorf("failed to attach saga to payment: %w", err)
+			}
+		}
+		// A pending payment publishes its outcome, to the attached saga, once the provider answers
+		if p.Status != StatusPending {
+			s.publishOutcome(p)
+		}
+		return p, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+
+	status, reason := StatusAuthorized, ""
+	reference, err := s.provider.Authorize(ctx, orderID, amount)
+	if err != nil {
+		if !errors.Is(err, ErrDeclined) {
+			// Leave it pending: the provider may still have placed the hold
+			return Payment{}, fmt.Errorf("failed to authorize payment: %w", err)
+		}
+		status, reason = StatusFailed, err.Error()
+	}
+
+	if p, err = s.repo.CompleteAuthorization(p.ID, status, reference, reason); err != nil {
+		return Payment{}, fmt.Errorf("failed to record authorization: %w", err)
+	}
+
+	s.logger.Printf("Payment %s for order %s: %s %s", p.ID, orderID, p.Status, amount)
+	s.publishOutcome(p)
+	return p, nil
+}
+
+// Capture collects an authorized payment, e.g. once the order shipped
+func (s *Service) Capture(orderID string) (Payment, error) {
+	p, err := s.repo.GetPaymentByOrder(orderID)
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if p.Status != StatusAuthorized {
+		return Payment{}, fmt.Errorf("%w: cannot capture %s payment", ErrInvalidState, p.Status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+
+	if err := s.provider.Capture(ctx, p.ProviderReference, p.Amount); err != nil {
+		return Payment{}, fmt.Errorf("failed to capture payment: %w", err)
+	}
+
+	if p, err = s.repo.Transition(p.ID, StatusAuthorized, StatusCaptured); err != nil {
+		return Payment{}, fmt.Errorf("failed to record capture: %w", err)
+	}
+
+	s.logger.Printf("Captured payment %s for order %s: %s", p.ID, orderID, p.Amount)
+	return p, nil
+}
+
+// Void releases an authorized payment. Payments that were never authorized or
+// are already voided are left alone, so repeated voids are harmless.
+func (s *Service) Void(orderID string) (Payment, error) {
+	p, err := s.repo.GetPaymentByOrder(orderID)
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to get payment: %w", err)
+	}
+
+	switch p.Status {
+	case StatusFailed, StatusVoided:
+		return p, nil
+	case StatusAuthorized:
+	default:
+		return Payment{}, fmt.Errorf("%w: cannot void %s payment", ErrInvalidState, p.Status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+
+	if err := s.provider.Void(ctx, p.ProviderReference); err != nil {
+		return Payment{}, fmt.Errorf("failed to void payment: %w", err)
+	}
+
+	if p, err = s.repo.Transition(p.ID, StatusAuthorized, StatusVoided); err != nil {
+		return Payment{}, fmt.Errorf("failed to record void: %w", err)
+	}
+
+	s.logger.Printf("Voided payment %s for order %s", p.ID, orderID)
+	return p, nil
+}
+
+// Refund returns amount (or, if nil, everything not yet refunded) of a captured
+// payment and publishes RefundIssued
+func (s *Service) Refund(orderID string, amount *money.Money, reason string) (Payment, error) {
+	p, err := s.repo.GetPaymentByOrder(orderID)
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if p.Status != StatusCaptured && p.Status != StatusPartiallyRefunded {
+		return Payment{}, fmt.Errorf("%w: cannot refund %s payment", ErrInvalidState, p.Status)
+	}
+
+	refund := money.Money{Amount: p.Amount.Amount - p.Refunded.Amount, Currency: p.Amount.Currency}
+	if amount != nil {
+		refund = *amount
+	}
+	if !refund.IsPositive() {
+		return Payment{}, fmt.Errorf("refund amount must be positive, got %s", refund)
+	}
+	if refund.Currency != p.Amount.Currency || refund.Amount > p.Amount.Amount-p.Refunded.Amount {
+		return Payment{}, fmt.Errorf("%w: refund of %s exceeds the %s left on payment %s",
+			ErrInvalidState, refund, p.Amount.Currency, p.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+
+	reference, err := s.provider.Refund(ctx, p.ProviderReference, refund)
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to refund payment: %w", err)
+	}
+
+	if p, err = s.repo.RecordRefund(p.ID, refund); err != nil {
+		return Payment{}, fmt.Errorf("failed to record refund: %w", err)
+	}
+
+	s.logger.Printf("Refunded %s of payment %s for order %s", refund, p.ID, orderID)
+
+	event := messaging.NewRefundIssuedEvent(messaging.RefundIssuedPayload{
+		PaymentID:     p.ID,
+		OrderID:       p.OrderID,
+		UserID:        p.UserID,
+		Amount:        refund,
+		Reference:     reference,
+		Reason:        reason,
+		FullyRefunded: p.Status == StatusRefunded,
+	})
+	if err := s.publisher.Publish(messaging.EventTypeRefundIssued, event); err != nil {
+		s.logger.Printf("Failed to publish RefundIssued event: %v", err)
+	}
+
+	return p, nil
+}
+
+// GetPayment retrieves the payment of an order
+func (s *Service) GetPayment(orderID string) (Payment, error) {
+	p, err := s.repo.GetPaymentByOrder(orderID)
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to get payment: %w", err)
+	}
+	return p, nil
+}
+
+// publishOutcome publishes PaymentAuthorized or PaymentFailed for a settled authorization
+func (s *Service) publishOutcome(p Payment) {
+	eventType := messaging.EventTypePaymentAuthorized
+	if p.Status == StatusFailed {
+		eventType = messaging.EventTypePaymentFailed
+	}
+
+	event := messaging.NewFulfillmentEvent(eventType, messaging.FulfillmentPayload{
+		SagaID:    p.SagaID,
+		OrderID:   p.OrderID,
+		UserID:    p.UserID,
+		Amount:    p.Amount,
+		Reference: p.ProviderReference,
+		Reason:    p.FailureReason,
+	})
+	if err := s.publisher.Publish(eventType, event); err != nil {
+		s.logger.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// handleOrderCreated authorizes the payment of a new order
+func (s *Service) handleOrderCreated(event messaging.Event) {
+	var payload messaging.OrderCreatedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal OrderCreated payload: %v", err)
+		return
+	}
+
+	if _, err := s.Authorize(payload.OrderID, payload.UserID, payload.Amount, ""); err != nil {
+		s.logger.Printf("Failed to authorize payment for order %s: %v", payload.OrderID, err)
+	}
+}
+
+// handleAuthorizationRequested answers the fulfillment saga's payment step
+func (s *Service) handleAuthorizationRequested(event messaging.Event) {
+	var payload messaging.FulfillmentPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal PaymentAuthorizationRequested payload: %v", err)
+		return
+	}
+
+	if _, err := s.Authorize(payload.OrderID, payload.UserID, payload.Amount, payload.SagaID); err != nil {
+		s.logger.Printf("Failed to authorize payment for order %s: %v", payload.OrderID, err)
+	}
+}
+
+// handleVoidRequested compensates the saga's payment step
+func (s *Service) handleVoidRequested(event messaging.Event) {
+	var payload messaging.FulfillmentPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal PaymentVoidRequested payload: %v", err)
+		return
+	}
+
+	s.voidPayment(payload.OrderID)
+}
+
+// handleOrderCancelled releases the hold of a cancelled order
+func (s *Service) handleOrderCancelled(event messaging.Event) {
+	var payload messaging.OrderStatusChangedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal OrderCancelled payload: %v", err)
+		return
+	}
+
+	s.voidPayment(payload.OrderID)
+}
+
+// handleOrderShipped captures the payment of a shipped order
+func (s *Service) handleOrderShipped(event messaging.Event) {
+	var payload messaging.OrderStatusChangedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		s.logger.Printf("Failed to unmarshal OrderShipped payload: %v", err)
+		return
+	}
+
+	if _, err := s.Capture(payload.OrderID); err != nil {
+		s.logger.Printf("Failed to capture payment for order %s: %v", payload.OrderID, err)
+	}
+}
+
+func (s *Service) voidPayment(orderID string) {
+	if _, err := s.Void(orderID); err != nil && !errors.Is(err, ErrNotFound) {
+		s.logger.Printf("Failed to void payment for order %s: %v", orderID, err)
+	}
+}
@@ -0,0 +1,375 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/pkg/money"
+	"github.com/alex-necsoiu/event-driven/test/mocks"
+)
+
+// memoryRepository keeps payments in memory, keyed by order ID
+type memoryRepository struct {
+	mu       sync.Mutex
+	payments map[string]Payment
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{payments: make(map[string]Payment)}
+}
+
+func (r *memoryRepository) ClaimPayment(p Payment) (Payment, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.payments[p.OrderID]; ok {
+		return existing, false, nil
+	}
+	p.ID = strconv.Itoa(len(r.payments) + 1)
+	p.Status = StatusPending
+	p.Refunded = money.Money{Currency: p.Amount.Currency}
+	r.payments[p.OrderID] = p
+	return p, true, nil
+}
+
+func (r *memoryRepository) GetPaymentByOrder(orderID string) (Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.payments[orderID]
+	if !ok {
+		return Payment{}, ErrNotFound
+	}
+	return p, nil
+}
+
+func (r *memoryRepository) AttachSaga(orderID, sagaID string) (Payment, error) {
+	return r.update(orderID, func(p *Payment) error { p.SagaID = sagaID; return nil })
+}
+
+func (r *memoryRepository) CompleteAuthorization(id string, status Status, reference, reason string) (Payment, error) {
+	return r.update(id, func(p *Payment) error {
+		if p.Status != StatusPending {
+			return fmt.Errorf("%w: payment %s is not pending", ErrInvalidState, id)
+		}
+		p.Status, p.ProviderReference, p.FailureReason = status, reference, reason
+		return nil
+	})
+}
+
+func (r *memoryRepository) Transition(id string, from, to Status) (Payment, error) {
+	return r.update(id, func(p *Payment) error {
+		if p.Status != from {
+			return fmt.Errorf("%w: payment %s is not %s", ErrInvalidState, id, from)
+		}
+		p.Status = to
+		return nil
+	})
+}
+
+func (r *memoryRepository) RecordRefund(id string, amount money.Money) (Payment, error) {
+	return r.update(id, func(p *Payment) error {
+		if (p.Status != StatusCaptured && p.Status != StatusPartiallyRefunded) || p.Refunded.Amount+amount.Amount > p.Amount.Amount {
+			return fmt.Errorf("%w: payment %s cannot be refunded %s", ErrInvalidState, id, amount)
+		}
+		p.Refunded.Amount += amount.Amount
+		p.Status = StatusPartiallyRefunded
+		if p.Refunded.Amount == p.Amount.Amount {
+			p.Status = StatusRefunded
+		}
+		return nil
+	})
+}
+
+// update applies fn to the payment with the given ID or order ID
+func (r *memoryRepository) update(key string, fn func(p *Payment) error) (Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for orderID, p := range r.payments {
+		if p.ID != key && orderID != key {
+			continue
+		}
+		if err := fn(&p); err != nil {
+			return Payment{}, err
+		}
+		r.payments[orderID] = p
+		return p, nil
+	}
+	return Payment{}, ErrNotFound
+}
+
+// countingProvider is the FakeProvider counting its calls, failing them with
+// err while it's set
+type countingProvider struct {
+	FakeProvider
+	calls map[string]int
+	err   error
+}
+
+func newCountingProvider() *countingProvider {
+	return &countingProvider{calls: make(map[string]int)}
+}
+
+func (p *countingProvider) Authorize(ctx context.Context, orderID string, amount money.Money) (string, error) {
+	p.calls["authorize"]++
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.FakeProvider.Authorize(ctx, orderID, amount)
+}
+
+func (p *countingProvider) Capture(ctx context.Context, reference string, amount money.Money) error {
+	p.calls["capture"]++
+	if p.err != nil {
+		return p.err
+	}
+	return p.FakeProvider.Capture(ctx, reference, amount)
+}
+
+func (p *countingProvider) Void(ctx context.Context, reference string) error {
+	p.calls["void"]++
+	if p.err != nil {
+		return p.err
+	}
+	return p.FakeProvider.Void(ctx, reference)
+}
+
+func (p *countingProvider) Refund(ctx context.Context, reference string, amount money.Money) (string, error) {
+	p.calls["refund"]++
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.FakeProvider.Refund(ctx, reference, amount)
+}
+
+func eur(minor int64) money.Money {
+	return money.Money{Amount: minor, Currency: "EUR"}
+}
+
+func newTestService() (*Service, *memoryRepository, *countingProvider, *mocks.Bus) {
+	repo := newMemoryRepository()
+	provider := newCountingProvider()
+	bus := mocks.NewBus()
+	return NewService(repo, provider, bus, bus, log.New(io.Discard, "", 0)), repo, provider, bus
+}
+
+func TestServiceAuthorize(t *testing.T) {
+	outage := errors.New("connection reset")
+
+	tests := []struct {
+		name          string
+		amount        money.Money
+		providerErr   error
+		wantErr       bool
+		wantStatus    Status
+		wantEvents    []string
+		wantAuthorize int
+	}{
+		{name: "authorized", amount: eur(3570), wantStatus: StatusAuthorized, wantEvents: []string{messaging.EventTypePaymentAuthorized}, wantAuthorize: 1},
+		{name: "declined", amount: eur(3513), wantStatus: StatusFailed, wantEvents: []string{messaging.EventTypePaymentFailed}, wantAuthorize: 1},
+		{name: "provider unreachable stays pending", amount: eur(3570), providerErr: outage, wantErr: true, wantStatus: StatusPending, wantEvents: []string{}, wantAuthorize: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo, provider, bus := newTestService()
+			provider.err = tt.providerErr
+
+			_, err := s.Authorize("1", "7", tt.amount, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			p, _ := repo.GetPaymentByOrder("1")
+			if p.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", p.Status, tt.wantStatus)
+			}
+			if got := bus.PublishedTypes(); !reflect.DeepEqual(got, tt.wantEvents) {
+				t.Errorf("published %v, want %v", got, tt.wantEvents)
+			}
+			if provider.calls["authorize"] != tt.wantAuthorize {
+				t.Errorf("provider authorized %d times, want %d", provider.calls["authorize"], tt.wantAuthorize)
+			}
+		})
+	}
+}
+
+func TestServiceDuplicateEvents(t *testing.T) {
+	created := func() messaging.Event {
+		return messaging.Event{EventType: messaging.EventTypeOrderCreated, Payload: messaging.OrderCreatedPayload{OrderID: "1", UserID: "7", Amount: eur(3570)}}
+	}
+	requested := func(sagaID string) messaging.Event {
+		return messaging.NewFulfillmentEvent(messaging.EventTypePaymentAuthorizationRequested, messaging.FulfillmentPayload{SagaID: sagaID, OrderID: "1", UserID: "7", Amount: eur(3570)})
+	}
+	orderEvent := func(eventType string) messaging.Event {
+		return messaging.Event{EventType: eventType, Payload: messaging.OrderStatusChangedPayload{OrderID: "1"}}
+	}
+
+	tests := []struct {
+		name       string
+		events     []messaging.Event
+		wantStatus Status
+		wantSaga   string
+		wantCalls  map[string]int
+		// wantOutcomes counts PaymentAuthorized events
+		wantOutcomes int
+	}{
+		{
+			name:         "redelivered OrderCreated authorizes once",
+			events:       []messaging.Event{created(), created()},
+			wantStatus:   StatusAuthorized,
+			wantCalls:    map[string]int{"authorize": 1},
+			wantOutcomes: 2,
+		},
+		{
+			name:         "saga asking after OrderCreated gets the recorded outcome",
+			events:       []messaging.Event{created(), requested("saga-1"), requested("saga-1")},
+			wantStatus:   StatusAuthorized,
+			wantSaga:     "saga-1",
+			wantCalls:    map[string]int{"authorize": 1},
+			wantOutcomes: 3,
+		},
+		{
+			name:         "repeated voids release the hold once",
+			events:       []messaging.Event{created(), orderEvent(messaging.EventTypeOrderCancelled), orderEvent(messaging.EventTypeOrderCancelled)},
+			wantStatus:   StatusVoided,
+			wantCalls:    map[string]int{"authorize": 1, "void": 1},
+			wantOutcomes: 1,
+		},
+		{
+			name:         "redelivered OrderShipped captures once",
+			events:       []messaging.Event{created(), orderEvent(messaging.EventTypeOrderShipped), orderEvent(messaging.EventTypeOrderShipped)},
+			wantStatus:   StatusCaptured,
+			wantCalls:    map[string]int{"authorize": 1, "capture": 1},
+			wantOutcomes: 1,
+		},
+		{
+			name:         "late cancellation of a shipped order doesn't void",
+			events:       []messaging.Event{created(), orderEvent(messaging.EventTypeOrderShipped), orderEvent(messaging.EventTypeOrderCancelled)},
+			wantStatus:   StatusCaptured,
+			wantCalls:    map[string]int{"authorize": 1, "capture": 1},
+			wantOutcomes: 1,
+		},
+		{
+			name:      "cancellation before any payment is ignored",
+			events:    []messaging.Event{orderEvent(messaging.EventTypeOrderCancelled)},
+			wantCalls: map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo, provider, bus := newTestService()
+			if err := s.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, event := range tt.events {
+				bus.Publish(event.EventType, event)
+			}
+
+			p, _ := repo.GetPaymentByOrder("1")
+			if p.Status != tt.wantStatus || p.SagaID != tt.wantSaga {
+				t.Errorf("payment = %s for saga %q, want %s for %q", p.Status, p.SagaID, tt.wantStatus, tt.wantSaga)
+			}
+			if !reflect.DeepEqual(provider.calls, tt.wantCalls) {
+				t.Errorf("provider calls = %v, want %v", provider.calls, tt.wantCalls)
+			}
+			outcomes := 0
+			for _, eventType := range bus.PublishedTypes() {
+				if eventType == messaging.EventTypePaymentAuthorized {
+					outcomes++
+				}
+			}
+			if outcomes != tt.wantOutcomes {
+				t.Errorf("published PaymentAuthorized %d times, want %d", outcomes, tt.wantOutcomes)
+			}
+		})
+	}
+}
+
+func TestServiceRefund(t *testing.T) {
+	part := func(minor int64) *money.Money { m := eur(minor); return &m }
+
+	tests := []struct {
+		name string
+		// capture captures the payment before refunding
+		capture      bool
+		refunds      []*money.Money
+		providerErr  error
+		wantErr      error // of the last refund
+		wantStatus   Status
+		wantRefunded int64
+		wantIssued   int
+	}{
+		{name: "everything left", capture: true, refunds: []*money.Money{nil}, wantStatus: StatusRefunded, wantRefunded: 3570, wantIssued: 1},
+		{name: "part", capture: true, refunds: []*money.Money{part(1000)}, wantStatus: StatusPartiallyRefunded, wantRefunded: 1000, wantIssued: 1},
+		{name: "parts adding up to everything", capture: true, refunds: []*money.Money{part(1000), part(2570)}, wantStatus: StatusRefunded, wantRefunded: 3570, wantIssued: 2},
+		{name: "the rest after a part", capture: true, refunds: []*money.Money{part(1000), nil}, wantStatus: StatusRefunded, wantRefunded: 3570, wantIssued: 2},
+		{
+			name: "more than is left", capture: true, refunds: []*money.Money{part(3000), part(1000)},
+			wantErr: ErrInvalidState, wantStatus: StatusPartiallyRefunded, wantRefunded: 3000, wantIssued: 1,
+		},
+		{
+			name: "another currency", capture: true, refunds: []*money.Money{{Amount: 100, Currency: "USD"}},
+			wantErr: ErrInvalidState, wantStatus: StatusCaptured, wantIssued: 0,
+		},
+		{name: "fully refunded payment", capture: true, refunds: []*money.Money{nil, nil}, wantErr: ErrInvalidState, wantStatus: StatusRefunded, wantRefunded: 3570, wantIssued: 1},
+		{name: "not captured yet", refunds: []*money.Money{nil}, wantErr: ErrInvalidState, wantStatus: StatusAuthorized},
+		{name: "provider unreachable", capture: true, refunds: []*money.Money{nil}, providerErr: errors.New("timeout"), wantStatus: StatusCaptured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo, provider, bus := newTestService()
+			if _, err := s.Authorize("1", "7", eur(3570), ""); err != nil {
+				t.Fatal(err)
+			}
+			if tt.capture {
+				if _, err := s.Capture("1"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			provider.err = tt.providerErr
+
+			var err error
+			for _, amount := range tt.refunds {
+				_, err = s.Refund("1", amount, "damaged")
+			}
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("Refund() error = %v, want %v", err, tt.wantErr)
+			case tt.wantErr == nil && (err != nil) != (tt.providerErr != nil):
+				t.Fatalf("Refund() error = %v", err)
+			}
+
+			p, _ := repo.GetPaymentByOrder("1")
+			if p.Status != tt.wantStatus || p.Refunded.Amount != tt.wantRefunded {
+				t.Errorf("payment = %s with %d refunded, want %s with %d", p.Status, p.Refunded.Amount, tt.wantStatus, tt.wantRefunded)
+			}
+			var issued []messaging.Event
+			for _, event := range bus.Published() {
+				if event.EventType == messaging.EventTypeRefundIssued {
+					issued = append(issued, event)
+				}
+			}
+			if len(issued) != tt.wantIssued {
+				t.Fatalf("published RefundIssued %d times, want %d", len(issued), tt.wantIssued)
+			}
+			if len(issued) > 0 {
+				var payload messaging.RefundIssuedPayload
+				if err := messaging.DecodePayload(issued[len(issued)-1].Payload, &payload); err != nil {
+					t.Fatal(err)
+				}
+				if payload.FullyRefunded != (tt.wantStatus == StatusRefunded) || payload.Reason != "damaged" || payload.Reference == "" {
+					t.Errorf("RefundIssued payload = %+v", payload)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+const (
+	// compensationRetry is how long to wait before re-issuing compensations that failed to publish
+	compensationRetry = 30 * time.Second
+	// sweepBatch caps how many expired sagas are handled per sweep
+	sweepBatch = 100
+)
+
+// Engine runs instances of one saga Definition. Replies are routed by their
+// saga_id; a reply for a later step than the current one is kept in the saga's
+// inbox until that step starts, and duplicate or late replies are ignored.
+type Engine struct {
+	def        Definition
+	store      Store
+	publisher  messaging.Publisher
+	subscriber messaging.Subscriber
+	logger     *log.Logger
+}
+
+// NewEngine creates a new saga engine; call Start to receive step replies
+func NewEngine(def Definition, store Store, publisher messaging.Publisher, subscriber messaging.Subscriber, logger *log.Logger) *Engine {
+	return &Engine{
+		def:        def,
+		store:      store,
+		publisher:  publisher,
+		subscriber: subscriber,
+		logger:     logger,
+	}
+}
+
+// Start subscribes to the reply events of every step
+func (e *Engine) Start() error {
+	for _, step := range e.def.Steps {
+		for _, eventType := range []string{step.SuccessEvent, step.FailureEvent} {
+			if err := e.subscriber.Subscribe(eventType, e.handleReply); err != nil {
+				return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RunTimeouts periodically fails sagas whose step timed out and retries pending
+// compensations until ctx is cancelled
+func (e *Engine) RunTimeouts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ids, err := e.store.Expired(time.Now(), sweepBatch)
+			if err != nil {
+				e.logger.Printf("Failed to find expired %s sagas: %v", e.def.Name, err)
+				continue
+			}
+			for _, id := range ids {
+				e.expire(id)
+			}
+		}
+	}
+}
+
+// Begin starts a saga for correlationID with data as its input. Starting the
+// same correlation ID again is a no-op, so redelivered triggers are harmless.
+func (e *Engine) Begin(correlationID string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga data: %w", err)
+	}
+
+	s, created, err := e.store.Create(Saga{
+		Type:          e.def.Name,
+		CorrelationID: correlationID,
+		Status:        StatusRunning,
+		Data:          raw,
+		References:    map[string]string{},
+		Deadline:      time.Now().Add(e.def.Steps[0].Timeout),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create saga: %w", err)
+	}
+	if !created {
+		e.logger.Printf("Saga %s for %s already started (%s)", e.def.Name, correlationID, s.Status)
+		return nil
+	}
+
+	e.logger.Printf("Started saga %s %s for %s", e.def.Name, s.ID, correlationID)
+	e.request(s)
+	return nil
+}
+
+// Abort fails the running saga for correlationID, compensating every step that
+// succeeded or may have. It does nothing if the saga already finished.
+func (e *Engine) Abort(correlationID, reason string) error {
+	s, err := e.store.FindByCorrelation(e.def.Name, correlationID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find saga: %w", err)
+	}
+
+	var effects []func()
+	err = e.store.Update(s.ID, func(s *Saga) error {
+		effects = nil
+		if s.Status == StatusRunning {
+			effects = e.fail(s, s.Step, reason)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort saga: %w", err)
+	}
+
+	runEffects(effects)
+	return nil
+}
+
+// handleReply advances the saga a reply event belongs to
+func (e *Engine) handleReply(event messaging.Event) {
+	reply, err := decodeReply(event)
+	if err != nil {
+		e.logger.Printf("Failed to decode %s reply: %v", event.EventType, err)
+		return
+	}
+
+	var effects []func()
+	err = e.store.Update(reply.SagaID, func(s *Saga) error {
+		effects = e.apply(s, reply)
+		return nil
+	})
+	if err != nil {
+		e.logger.Printf("Failed to apply %s to saga %s: %v", reply.EventType, reply.SagaID, err)
+		return
+	}
+
+	runEffects(effects)
+}
+
+// apply updates the locked saga for reply and returns the side effects to run
+// once the new state is saved
+func (e *Engine) apply(s *Saga, reply Reply) []func() {
+	if s.Status != StatusRunning {
+		e.logger.Printf("Ignoring %s for %s saga %s", reply.EventType, s.Status, s.ID)
+		return nil
+	}
+
+	index := e.stepIndex(reply.EventType)
+	switch {
+	case index > s.Step:
+		// The first answer wins, as it would for the current step
+		if s.hasBuffered(e.def.Steps[index]) {
+			e.logger.Printf("Ignoring duplicate %s for saga %s", reply.EventType, s.ID)
+			return nil
+		}
+		e.logger.Printf("Buffering early %s for saga %s (waiting on step %s)", reply.EventType, s.ID, e.def.Steps[s.Step].Name)
+		s.Inbox = append(s.Inbox, reply)
+		return nil
+	case index < s.Step:
+		e.logger.Printf("Ignoring duplicate %s for saga %s", reply.EventType, s.ID)
+		return nil
+	}
+
+	var effects []func()
+	for {
+		step := e.def.Steps[s.Step]
+		if reply.EventType == step.FailureEvent {
+			// The failed step did nothing, so only earlier steps are undone
+			return append(effects, e.fail(s, s.Step-1, fmt.Sprintf("%s failed: %s", step.Name, reply.Reason))...)
+		}
+
+		s.References[step.Name] = reply.Reference
+		if step.OnSuccess != nil {
+			if err := step.OnSuccess(*s); err != nil {
+				return append(effects, e.fail(s, s.Step, fmt.Sprintf("%s could not be applied: %v", step.Name, err))...)
+			}
+		}
+		e.logger.Printf("Saga %s step %s succeeded", s.ID, step.Name)
+
+		s.Step++
+		if s.Step == len(e.def.Steps) {
+			s.Status = StatusCompleted
+			s.Deadline = time.Time{}
+			e.logger.Printf("Saga %s %s completed", e.def.Name, s.ID)
+			return effects
+		}
+		s.Deadline = time.Now().Add(e.def.Steps[s.Step].Timeout)
+
+		// The next step may already have answered; otherwise ask it
+		buffered, ok := s.takeBuffered(e.def.Steps[s.Step])
+		if !ok {
+			next := *s
+			return append(effects, func() { e.request(next) })
+		}
+		reply = buffered
+	}
+}
+
+// fail moves the saga to compensating, undoing steps last..0 in reverse order
+func (e *Engine) fail(s *Saga, last int, reason string) []func() {
+	e.logger.Printf("Saga %s %s failed: %s", e.def.Name, s.ID, reason)
+
+	s.Status = StatusCompensating
+	s.Step = last
+	s.FailureReason = reason
+	s.Deadline = time.Now().Add(compensationRetry)
+
+	failed := *s
+	return []func(){func() { e.compensate(failed) }}
+}
+
+// compensate publishes the compensations of a failed saga and marks it
+// compensated. On error the saga stays compensating and is retried by the sweep.
+func (e *Engine) compensate(s Saga) {
+	for i := s.Step; i >= 0; i-- {
+		step := e.def.Steps[i]
+		if step.Compensate == nil {
+			continue
+		}
+
+		event, err := step.Compensate(s)
+		if err == nil {
+			err = e.publisher.Publish(event.EventType, event)
+		}
+		if err != nil {
+			e.logger.Printf("Failed to compensate step %s of saga %s: %v", step.Name, s.ID, err)
+			return
+		}
+	}
+
+	if e.def.OnFailure != nil {
+		if err := e.def.OnFailure(s); err != nil {
+			e.logger.Printf("Failed to finish compensating saga %s: %v", s.ID, err)
+			return
+		}
+	}
+
+	err := e.store.Update(s.ID, func(s *Saga) error {
+		if s.Status == StatusCompensating {
+			s.Status = StatusCompensated
+			s.Deadline = time.Time{}
+		}
+		return nil
+	})
+	if err != nil {
+		e.logger.Printf("Failed to mark saga %s compensated: %v", s.ID, err)
+		return
+	}
+	e.logger.Printf("Saga %s %s compensated", e.def.Name, s.ID)
+}
+
+// request publishes the command of the saga's current step. A lost command is
+// recovered by the step timeout.
+func (e *Engine) request(s Saga) {
+	step := e.def.Steps[s.Step]
+	event, err := step.Request(s)
+	if err == nil {
+		err = e.publisher.Publish(event.EventType, event)
+	}
+	if err != nil {
+		e.logger.Printf("Failed to request step %s of saga %s: %v", step.Name, s.ID, err)
+	}
+}
+
+// expire times out the current step of a saga or retries its compensation
+func (e *Engine) expire(id string) {
+	var effects []func()
+	err := e.store.Update(id, func(s *Saga) error {
+		effects = nil
+		if s.Deadline.IsZero() || time.Now().Before(s.Deadline) {
+			return nil // progressed since it was listed
+		}
+
+		switch s.Status {
+		case StatusRunning:
+			// The step may have succeeded without us hearing back, so it is undone too
+			effects = e.fail(s, s.Step, fmt.Sprintf("%s timed out", e.def.Steps[s.Step].Name))
+		case StatusCompensating:
+			s.Deadline = time.Now().Add(compensationRetry)
+			retry := *s
+			effects = []func(){func() { e.compensate(retry) }}
+		}
+		return nil
+	})
+	if err != nil {
+		e.logger.Printf("Failed to expire saga %s: %v", id, err)
+		return
+	}
+
+	runEffects(effects)
+}
+
+// stepIndex returns the index of the step replying with eventType
+func (e *Engine) stepIndex(eventType string) int {
+	for i, step := range e.def.Steps {
+		if eventType == step.SuccessEvent || eventType == step.FailureEvent {
+			return i
+		}
+	}
+	return -1
+}
+
+func runEffects(effects []func()) {
+	for _, effect := range effects {
+		effect()
+	}
+}
+
+// decodeReply extracts the saga reply fields from an event payload
+func decodeReply(event messaging.Event) (Reply, error) {
+	var reply Reply
+	if err := messaging.DecodePayload(event.Payload, &reply); err != nil {
+		return Reply{}, err
+	}
+	if reply.SagaID == "" {
+		return Reply{}, errors.New("reply has no saga_id")
+	}
+	reply.EventType = event.EventType
+	return reply, nil
+}
@@ -0,0 +1,301 @@
+package saga
+
+import (
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/test/mocks"
+)
+
+// memoryStore keeps sagas in memory
+type memoryStore struct {
+	mu    sync.Mutex
+	sagas map[string]Saga
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{sagas: make(map[string]Saga)}
+}
+
+func (m *memoryStore) Create(s Saga) (Saga, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.sagas {
+		if existing.Type == s.Type && existing.CorrelationID == s.CorrelationID {
+			return existing, false, nil
+		}
+	}
+	s.ID = strconv.Itoa(len(m.sagas) + 1)
+	m.sagas[s.ID] = s
+	return s, true, nil
+}
+
+func (m *memoryStore) FindByCorrelation(sagaType, correlationID string) (Saga, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sagas {
+		if s.Type == sagaType && s.CorrelationID == correlationID {
+			return s, nil
+		}
+	}
+	return Saga{}, ErrNotFound
+}
+
+func (m *memoryStore) Update(id string, fn func(s *Saga) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sagas[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := fn(&s); err != nil {
+		return err
+	}
+	m.sagas[id] = s
+	return nil
+}
+
+func (m *memoryStore) Expired(now time.Time, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for id, s := range m.sagas {
+		if !s.Deadline.IsZero() && s.Deadline.Before(now) && len(ids) < limit {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *memoryStore) get(id string) Saga {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sagas[id]
+}
+
+// testDefinition has steps a, b and c. Each is requested with "<step>.request",
+// answers "<step>.ok" or "<step>.failed" and is undone with "<step>.undo",
+// except c, which has no compensation.
+func testDefinition(failOnSuccess string, failures *[]string) Definition {
+	cmd := func(eventType string) func(Saga) (messaging.Event, error) {
+		return func(s Saga) (messaging.Event, error) {
+			return messaging.Event{EventType: eventType, Payload: map[string]string{"saga_id": s.ID}}, nil
+		}
+	}
+
+	def := Definition{
+		Name: "test",
+		OnFailure: func(s Saga) error {
+			*failures = append(*failures, s.FailureReason)
+			return nil
+		},
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		step := Step{
+			Name:         name,
+			Request:      cmd(name + ".request"),
+			SuccessEvent: name + ".ok",
+			FailureEvent: name + ".failed",
+			Timeout:      time.Minute,
+			OnSuccess: func(Saga) error {
+				if name == failOnSuccess {
+					return errors.New("order is gone")
+				}
+				return nil
+			},
+		}
+		if name != "c" {
+			step.Compensate = cmd(name + ".undo")
+		}
+		def.Steps = append(def.Steps, step)
+	}
+	return def
+}
+
+func TestEngine(t *testing.T) {
+	tests := []struct {
+		name string
+		// replies lists the events each step's service answers its request with
+		replies       map[string][]string
+		failOnSuccess string
+		// expire times out the waiting step; abort cancels the saga from outside
+		expire      bool
+		abort       bool
+		failUndo    bool // the first compensation attempt fails to publish
+		wantStatus  Status
+		wantEvents  []string
+		wantFailure string
+	}{
+		{
+			name:       "every step succeeds",
+			replies:    map[string][]string{"a": {"a.ok"}, "b": {"b.ok"}, "c": {"c.ok"}},
+			wantStatus: StatusCompleted,
+			wantEvents: []string{"a.request", "a.ok", "b.request", "b.ok", "c.request", "c.ok"},
+		},
+		{
+			name:        "failed step compensates only earlier steps",
+			replies:     map[string][]string{"a": {"a.ok"}, "b": {"b.failed"}},
+			wantStatus:  StatusCompensated,
+			wantEvents:  []string{"a.request", "a.ok", "b.request", "b.failed", "a.undo"},
+			wantFailure: "b failed",
+		},
+		{
+			name:        "compensations run in reverse order",
+			replies:     map[string][]string{"a": {"a.ok"}, "b": {"b.ok"}, "c": {"c.failed"}},
+			wantStatus:  StatusCompensated,
+			wantEvents:  []string{"a.request", "a.ok", "b.request", "b.ok", "c.request", "c.failed", "b.undo", "a.undo"},
+			wantFailure: "c failed",
+		},
+		{
+			name:          "step that can't be applied is compensated too",
+			replies:       map[string][]string{"a": {"a.ok"}, "b": {"b.ok"}},
+			failOnSuccess: "b",
+			wantStatus:    StatusCompensated,
+			wantEvents:    []string{"a.request", "a.ok", "b.request", "b.ok", "b.undo", "a.undo"},
+			wantFailure:   "b could not be applied",
+		},
+		{
+			name:        "timed out step is compensated too",
+			replies:     map[string][]string{"a": {"a.ok"}},
+			expire:      true,
+			wantStatus:  StatusCompensated,
+			wantEvents:  []string{"a.request", "a.ok", "b.request", "b.undo", "a.undo"},
+			wantFailure: "b timed out",
+		},
+		{
+			name:       "waiting step is left alone before its deadline",
+			replies:    map[string][]string{"a": {"a.ok"}},
+			wantStatus: StatusRunning,
+			wantEvents: []string{"a.request", "a.ok", "b.request"},
+		},
+		{
+			name:        "abort compensates the waiting step",
+			replies:     map[string][]string{"a": {"a.ok"}},
+			abort:       true,
+			wantStatus:  StatusCompensated,
+			wantEvents:  []string{"a.request", "a.ok", "b.request", "b.undo", "a.undo"},
+			wantFailure: "cancelled",
+		},
+		{
+			name:       "early reply is buffered until its step starts",
+			replies:    map[string][]string{"a": {"b.ok", "a.ok"}, "c": {"c.ok"}},
+			wantStatus: StatusCompleted,
+			wantEvents: []string{"a.request", "b.ok", "a.ok", "c.request", "c.ok"},
+		},
+		{
+			name:       "duplicate replies are ignored",
+			replies:    map[string][]string{"a": {"a.ok", "a.ok"}, "b": {"b.ok", "b.failed"}, "c": {"c.ok"}},
+			wantStatus: StatusCompleted,
+			wantEvents: []string{"a.request", "a.ok", "b.request", "b.ok", "c.request", "c.ok", "b.failed", "a.ok"},
+		},
+		{
+			name:        "failed compensation is retried by the sweep",
+			replies:     map[string][]string{"a": {"a.ok"}, "b": {"b.failed"}},
+			failUndo:    true,
+			wantStatus:  StatusCompensated,
+			wantEvents:  []string{"a.request", "a.ok", "b.request", "b.failed", "a.undo"},
+			wantFailure: "b failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := mocks.NewBus()
+			store := newMemoryStore()
+			var failures []string
+			engine := NewEngine(testDefinition(tt.failOnSuccess, &failures), store, bus, bus, log.New(io.Discard, "", 0))
+			if err := engine.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Each step's service answers its request with the scripted replies
+			for step, replies := range tt.replies {
+				replies := replies
+				bus.Subscribe(step+".request", func(event messaging.Event) {
+					sagaID := event.Payload.(map[string]string)["saga_id"]
+					for _, reply := range replies {
+						bus.Publish(reply, messaging.Event{EventType: reply, Payload: map[string]string{"saga_id": sagaID, "reason": "no"}})
+					}
+				})
+			}
+			if tt.failUndo {
+				bus.Fail("a.undo", errors.New("broker unavailable"))
+			}
+
+			if err := engine.Begin("order-1", map[string]string{"order_id": "order-1"}); err != nil {
+				t.Fatalf("Begin() error = %v", err)
+			}
+			// Beginning again is a no-op
+			if err := engine.Begin("order-1", nil); err != nil {
+				t.Fatalf("second Begin() error = %v", err)
+			}
+
+			if tt.abort {
+				if err := engine.Abort("order-1", "cancelled by customer"); err != nil {
+					t.Fatalf("Abort() error = %v", err)
+				}
+			}
+			engine.expire("1") // before the deadline this does nothing
+			if tt.expire {
+				store.Update("1", func(s *Saga) error { s.Deadline = time.Now().Add(-time.Second); return nil })
+				engine.expire("1")
+			}
+			if tt.failUndo {
+				if got := store.get("1").Status; got != StatusCompensating {
+					t.Fatalf("status after failed compensation = %s, want %s", got, StatusCompensating)
+				}
+				bus.Fail("a.undo", nil)
+				store.Update("1", func(s *Saga) error { s.Deadline = time.Now().Add(-time.Second); return nil })
+				engine.expire("1")
+			}
+
+			s := store.get("1")
+			if s.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", s.Status, tt.wantStatus)
+			}
+			if got := bus.PublishedTypes(); !reflect.DeepEqual(got, tt.wantEvents) {
+				t.Errorf("published %v, want %v", got, tt.wantEvents)
+			}
+			if tt.wantFailure == "" {
+				if len(failures) != 0 {
+					t.Errorf("OnFailure ran for a saga that didn't fail: %v", failures)
+				}
+				return
+			}
+			if len(failures) != 1 || !strings.Contains(failures[0], tt.wantFailure) {
+				t.Errorf("OnFailure got %v, want one failure containing %q", failures, tt.wantFailure)
+			}
+		})
+	}
+}
+
+func TestEngineAbortFinished(t *testing.T) {
+	bus := mocks.NewBus()
+	store := newMemoryStore()
+	var failures []string
+	engine := NewEngine(testDefinition("", &failures), store, bus, bus, log.New(io.Discard, "", 0))
+
+	// Unknown sagas and finished ones are left alone
+	if err := engine.Abort("order-404", "cancelled"); err != nil {
+		t.Fatalf("Abort() of an unknown saga error = %v", err)
+	}
+	store.Create(Saga{Type: "test", CorrelationID: "order-1", Status: StatusCompleted, References: map[string]string{}})
+	if err := engine.Abort("order-1", "cancelled"); err != nil {
+		t.Fatalf("Abort() error = %v", err)
+	}
+	if got := store.get("1").Status; got != StatusCompleted {
+		t.Errorf("status = %s, want %s", got, StatusCompleted)
+	}
+	if len(bus.Published()) != 0 || len(failures) != 0 {
+		t.Errorf("aborting a finished saga published %v", bus.PublishedTypes())
+	}
+}
@@ -0,0 +1,169 @@
+package saga
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/internal/order"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+const (
+	// FulfillmentSaga is the saga type that takes a new order through to shipment
+	FulfillmentSaga = "order_fulfillment"
+	// FulfillmentActor is recorded on order status changes made by the saga
+	FulfillmentActor = "fulfillment-saga"
+
+	stepReserveStock     = "reserve_stock"
+	stepAuthorizePayment = "authorize_payment"
+	stepScheduleShipment = "schedule_shipment"
+)
+
+// OrderUpdater is the part of the order service the fulfillment saga drives
+type OrderUpdater interface {
+	UpdateOrderStatus(orderID string, status order.Status, actor, reason string) (order.Order, error)
+}
+
+// FulfillmentDefinition describes order fulfillment: reserve stock (order
+// confirmed), authorize payment (paid), then schedule shipment (shipped).
+// A failure releases the stock, voids the payment and cancels the order.
+func FulfillmentDefinition(orders OrderUpdater, stepTimeout time.Duration) Definition {
+	advance := func(status order.Status) func(Saga) error {
+		return func(s Saga) error {
+			_, err := orders.UpdateOrderStatus(s.CorrelationID, status, FulfillmentActor, "")
+			return err
+		}
+	}
+
+	return Definition{
+		Name: FulfillmentSaga,
+		Steps: []Step{
+			{
+				Name:         stepReserveStock,
+				Request:      command(messaging.EventTypeStockReservationRequested, ""),
+				SuccessEvent: messaging.EventTypeStockReserved,
+				FailureEvent: messaging.EventTypeStockInsufficient,
+				OnSuccess:    advance(order.StatusConfirmed),
+				Compensate:   command(messaging.EventTypeStockReleaseRequested, stepReserveStock),
+				Timeout:      stepTimeout,
+			},
+			{
+				Name:         stepAuthorizePayment,
+				Request:      command(messaging.EventTypePaymentAuthorizationRequested, ""),
+				SuccessEvent: messaging.EventTypePaymentAuthorized,
+				FailureEvent: messaging.EventTypePaymentFailed,
+				OnSuccess:    advance(order.StatusPaid),
+				Compensate:   command(messaging.EventTypePaymentVoidRequested, stepAuthorizePayment),
+				Timeout:      stepTimeout,
+			},
+			{
+				Name:         stepScheduleShipment,
+				Request:      command(messaging.EventTypeShipmentRequested, ""),
+				SuccessEvent: messaging.EventTypeShipmentScheduled,
+				FailureEvent: messaging.EventTypeShipmentFailed,
+				OnSuccess:    advance(order.StatusShipped),
+				Timeout:      stepTimeout,
+			},
+		},
+		OnFailure: func(s Saga) error {
+			_, err := orders.UpdateOrderStatus(s.CorrelationID, order.StatusCancelled, FulfillmentActor, s.FailureReason)
+			if errors.Is(err, order.ErrInvalidTransition) {
+				return nil // already cancelled, e.g. by the customer
+			}
+			return err
+		},
+	}
+}
+
+// command builds a step request or compensation carrying the saga's order data.
+// referenceStep, if set, names the step whose reference the command acts on.
+func command(eventType, referenceStep string) func(Saga) (messaging.Event, error) {
+	return func(s Saga) (messaging.Event, error) {
+		var payload messaging.FulfillmentPayload
+		if err := json.Unmarshal(s.Data, &payload); err != nil {
+			return messaging.Event{}, fmt.Errorf("invalid data stored for saga %s: %w", s.ID, err)
+		}
+
+		payload.SagaID = s.ID
+		if referenceStep != "" {
+			payload.Reference = s.References[referenceStep]
+			payload.Reason = s.FailureReason
+		}
+		return messaging.NewFulfillmentEvent(eventType, payload), nil
+	}
+}
+
+// Fulfillment starts a fulfillment saga for every new order and aborts it when
+// the order is cancelled from outside the saga
+type Fulfillment struct {
+	engine     *Engine
+	subscriber messaging.Subscriber
+	logger     *log.Logger
+}
+
+// NewFulfillment creates a new Fulfillment driving engine
+func NewFulfillment(engine *Engine, subscriber messaging.Subscriber, logger *log.Logger) *Fulfillment {
+	return &Fulfillment{
+		engine:     engine,
+		subscriber: subscriber,
+		logger:     logger,
+	}
+}
+
+// Start subscribes to step replies and to the order events that begin and abort sagas
+func (f *Fulfillment) Start() error {
+	if err := f.engine.Start(); err != nil {
+		return err
+	}
+
+	if err := f.subscriber.Subscribe(messaging.EventTypeOrderCreated, f.handleOrderCreated); err != nil {
+		return fmt.Errorf("failed to subscribe to OrderCreated: %w", err)
+	}
+
+	if err := f.subscriber.Subscribe(messaging.EventTypeOrderCancelled, f.handleOrderCancelled); err != nil {
+		return fmt.Errorf("failed to subscribe to OrderCancelled: %w", err)
+	}
+
+	return nil
+}
+
+// handleOrderCreated handles OrderCreated events
+func (f *Fulfillment) handleOrderCreated(event messaging.Event) {
+	var payload messaging.OrderCreatedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		f.logger.Printf("Failed to unmarshal OrderCreated payload: %v", err)
+		return
+	}
+
+	data := messaging.FulfillmentPayload{
+		OrderID: payload.OrderID,
+		UserID:  payload.UserID,
+		Items:   payload.Items,
+		Amount:  payload.Amount,
+	}
+	if err := f.engine.Begin(payload.OrderID, data); err != nil {
+		f.logger.Printf("Failed to start fulfillment of order %s: %v", payload.OrderID, err)
+	}
+}
+
+// handleOrderCancelled handles OrderCancelled events
+func (f *Fulfillment) handleOrderCancelled(event messaging.Event) {
+	var payload messaging.OrderStatusChangedPayload
+	if err := messaging.DecodePayload(event.Payload, &payload); err != nil {
+		f.logger.Printf("Failed to unmarshal OrderCancelled payload: %v", err)
+		return
+	}
+
+	// Cancellations issued by the saga itself are already being compensated
+	if payload.Actor == FulfillmentActor {
+		return
+	}
+
+	reason := fmt.Sprintf("order cancelled by %s", payload.Actor)
+	if err := f.engine.Abort(payload.OrderID, reason); err != nil {
+		f.logger.Printf("Failed to abort fulfillment of order %s: %v", payload.OrderID, err)
+	}
+}
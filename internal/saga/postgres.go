@@ -0,0 +1,172 @@
+package saga
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresStore implements Store using PostgreSQL
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a new PostgresStore.
+// The sagas table is created by the owning service's migrations.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+const sagaColumns = "id::text, type, correlation_id, step, status, data, refs, inbox, failure_reason, deadline, created_at, updated_at"
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Create inserts a saga unless one exists for its type and correlation ID
+func (st *PostgresStore) Create(s Saga) (Saga, bool, error) {
+	refs, inbox, err := encodeState(s)
+	if err != nil {
+		return Saga{}, false, err
+	}
+
+	created, err := scanSaga(st.db.QueryRow(`
+		INSERT INTO sagas (type, correlation_id, step, status, data, refs, inbox, deadline)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (type, correlation_id) DO NOTHING
+		RETURNING `+sagaColumns,
+		s.Type, s.CorrelationID, s.Step, s.Status, []byte(s.Data), refs, inbox, nullTime(s.Deadline),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err := st.FindByCorrelation(s.Type, s.CorrelationID)
+		return existing, false, err
+	}
+	if err != nil {
+		return Saga{}, false, err
+	}
+	return created, true, nil
+}
+
+// FindByCorrelation retrieves a saga by type and correlation ID
+func (st *PostgresStore) FindByCorrelation(sagaType, correlationID string) (Saga, error) {
+	s, err := scanSaga(st.db.QueryRow(
+		"SELECT "+sagaColumns+" FROM sagas WHERE type = $1 AND correlation_id = $2",
+		sagaType, correlationID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Saga{}, ErrNotFound
+	}
+	return s, err
+}
+
+// Update applies fn to the saga while holding its row lock, so concurrent
+// replies for the same saga are handled one at a time
+func (st *PostgresStore) Update(id string, fn func(s *Saga) error) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	s, err := scanSaga(tx.QueryRow("SELECT "+sagaColumns+" FROM sagas WHERE id = $1 FOR UPDATE", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&s); err != nil {
+		return err
+	}
+
+	refs, inbox, err := encodeState(s)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE sagas
+		SET step = $2, status = $3, refs = $4, inbox = $5, failure_reason = $6, deadline = $7, updated_at = now()
+		WHERE id = $1`,
+		id, s.Step, s.Status, refs, inbox, s.FailureReason, nullTime(s.Deadline),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Expired returns unfinished sagas whose deadline has passed, oldest first
+func (st *PostgresStore) Expired(now time.Time, limit int) ([]string, error) {
+	rows, err := st.db.Query(`
+		SELECT id::text FROM sagas
+		WHERE status IN ($1, $2) AND deadline < $3
+		ORDER BY deadline
+		LIMIT $4`,
+		StatusRunning, StatusCompensating, now, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func scanSaga(row rowScanner) (Saga, error) {
+	var (
+		s           Saga
+		data        []byte
+		refs, inbox []byte
+		deadline    sql.NullTime
+	)
+	if err := row.Scan(&s.ID, &s.Type, &s.CorrelationID, &s.Step, &s.Status, &data, &refs, &inbox, &s.FailureReason, &deadline, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return Saga{}, err
+	}
+
+	s.Data = json.RawMessage(data)
+	if err := json.Unmarshal(refs, &s.References); err != nil {
+		return Saga{}, fmt.Errorf("invalid references stored for saga %s: %w", s.ID, err)
+	}
+	if s.References == nil {
+		s.References = map[string]string{}
+	}
+	if err := json.Unmarshal(inbox, &s.Inbox); err != nil {
+		return Saga{}, fmt.Errorf("invalid inbox stored for saga %s: %w", s.ID, err)
+	}
+	if deadline.Valid {
+		s.Deadline = deadline.Time
+	}
+	return s, nil
+}
+
+func encodeState(s Saga) (refs, inbox []byte, err error) {
+	if refs, err = json.Marshal(s.References); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode saga references: %w", err)
+	}
+	if s.Inbox == nil {
+		s.Inbox = []Reply{}
+	}
+	if inbox, err = json.Marshal(s.Inbox); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode saga inbox: %w", err)
+	}
+	return refs, inbox, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,113 @@
+package saga
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// ErrNotFound is returned when no saga matches the given ID or correlation ID
+var ErrNotFound = errors.New("saga not found")
+
+// Status is where a saga instance is in its run
+type Status string
+
+const (
+	// StatusRunning means a step is waiting for its reply
+	StatusRunning Status = "running"
+	// StatusCompleted means every step succeeded
+	StatusCompleted Status = "completed"
+	// StatusCompensating means a step failed and compensations are still being issued
+	StatusCompensating Status = "compensating"
+	// StatusCompensated means a step failed and every compensation was issued
+	StatusCompensated Status = "compensated"
+)
+
+// Saga is the persisted state of one saga instance
+type Saga struct {
+	ID            string
+	Type          string
+	CorrelationID string // e.g. the order ID; one saga per type and correlation ID
+	// Step is the index of the step awaiting its reply while running, and the
+	// last step still to compensate while compensating
+	Step          int
+	Status        Status
+	Data          json.RawMessage   // definition-specific input, set when the saga begins
+	References    map[string]string // reference returned by each succeeded step, keyed by step name
+	Inbox         []Reply           // replies that arrived before their step started
+	FailureReason string
+	Deadline      time.Time // when the current step times out or compensation is retried
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Reply is a step's answer, decoded from the payload of its reply event
+type Reply struct {
+	EventType string `json:"event_type"`
+	SagaID    string `json:"saga_id"`
+	Reference string `json:"reference,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Step is one stage of a saga: a command published to another service and the
+// events it answers with
+type Step struct {
+	Name string
+	// Request builds the command that starts the step
+	Request func(s Saga) (messaging.Event, error)
+	// SuccessEvent and FailureEvent are the event types replying to the command
+	SuccessEvent string
+	FailureEvent string
+	// OnSuccess runs once the step succeeded, before the next step starts;
+	// an error fails the saga and compensates this step too
+	OnSuccess func(s Saga) error
+	// Compensate builds the command undoing the step. Compensations may be
+	// published more than once, so receivers must handle them idempotently.
+	Compensate func(s Saga) (messaging.Event, error)
+	// Timeout bounds how long the step may wait for its reply
+	Timeout time.Duration
+}
+
+// Definition describes a saga type
+type Definition struct {
+	Name  string
+	Steps []Step
+	// OnFailure runs after all compensations were issued
+	OnFailure func(s Saga) error
+}
+
+// Store persists saga instances
+type Store interface {
+	// Create stores a new saga; it returns false with the existing saga if one
+	// already exists for the type and correlation ID
+	Create(s Saga) (Saga, bool, error)
+	// FindByCorrelation returns the saga of sagaType for correlationID
+	FindByCorrelation(sagaType, correlationID string) (Saga, error)
+	// Update locks the saga, applies fn and saves the result atomically
+	Update(id string, fn func(s *Saga) error) error
+	// Expired returns the IDs of unfinished sagas whose deadline has passed
+	Expired(now time.Time, limit int) ([]string, error)
+}
+
+// hasBuffered reports whether the inbox holds a reply answering step
+func (s *Saga) hasBuffered(step Step) bool {
+	for _, reply := range s.Inbox {
+		if reply.EventType == step.SuccessEvent || reply.EventType == step.FailureEvent {
+			return true
+		}
+	}
+	return false
+}
+
+// takeBuffered removes and returns an inbox reply answering step
+func (s *Saga) takeBuffered(step Step) (Reply, bool) {
+	for i, reply := range s.Inbox {
+		if reply.EventType == step.SuccessEvent || reply.EventType == step.FailureEvent {
+			s.Inbox = append(s.Inbox[:i], s.Inbox[i+1:]...)
+			return reply, true
+		}
+	}
+	return Reply{}, false
+}
@@ -0,0 +1,249 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/auth"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+var (
+	// ErrInvalidCredentials is returned for an unknown email or a wrong password
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrAccountLocked is returned while an account is locked after failed logins
+	ErrAccountLocked = errors.New("account is temporarily locked after too many failed logins")
+	// ErrInvalidResetToken is returned for unknown, used or expired reset tokens
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	// ErrInvalidSession is returned for session tokens that are forged, expired
+	// or revoked by a password change or account deletion
+	ErrInvalidSession = errors.New("invalid or revoked session")
+)
+
+// AuthPolicy controls sessions, password resets and lockout
+type AuthPolicy struct {
+	SessionTTL    time.Duration
+	ResetTokenTTL time.Duration
+	// MaxFailedLogins consecutive failures lock the account for LockoutDuration
+	MaxFailedLogins int
+	LockoutDuration time.Duration
+}
+
+// Session is the result of a successful login
+type Session struct {
+	Token     string
+	ExpiresAt time.Time
+	User      User
+}
+
+// Authenticator handles passwords, logins and password resets and publishes
+// the corresponding events
+type Authenticator struct {
+	users       Repository
+	credentials CredentialStore
+	tokens      *auth.Signer
+	policy      AuthPolicy
+	publisher   messaging.Publisher
+	logger      *log.Logger
+	// dummyHash is verified against for unknown emails, so that a login takes
+	// as long whether or not the account exists
+	dummyHash string
+}
+
+// NewAuthenticator creates a new Authenticator
+func NewAuthenticator(users Repository, credentials CredentialStore, tokens *auth.Signer, policy AuthPolicy, publisher messaging.Publisher, logger *log.Logger) (*Authenticator, error) {
+	dummyHash, err := hashPassword("dummy password for unknown users")
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{
+		users:       users,
+		credentials: credentials,
+		tokens:      tokens,
+		policy:      policy,
+		publisher:   publisher,
+		logger:      logger,
+		dummyHash:   dummyHash,
+	}, nil
+}
+
+// SetPassword sets the initial password of a new user
+func (a *Authenticator) SetPassword(userID, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := a.credentials.SetPassword(userID, hash); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	return nil
+}
+
+// Authenticate checks an email and password and issues a session token
+func (a *Authenticator) Authenticate(email, password string) (Session, error) {
+	user, err := a.users.GetUserByEmail(email)
+	if errors.Is(err, ErrNotFound) {
+		verifyPassword(password, a.dummyHash)
+		return Session{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	creds, err := a.credentials.GetCredentials(user.ID)
+	if errors.Is(err, ErrNoPassword) {
+		verifyPassword(password, a.dummyHash)
+		return Session{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to authenticate: %w", err)
+	}
+	if err := a.checkPassword(creds, password); err != nil {
+		return Session{}, err
+	}
+
+	if err := a.credentials.RecordLoginSuccess(user.ID); err != nil {
+		a.logger.Printf("Failed to record login of user %s: %v", user.ID, err)
+	}
+
+	token, expiresAt, err := a.tokens.Issue(auth.Claims{Subject: user.ID, Purpose: auth.PurposeSession, Version: creds.Version}, a.policy.SessionTTL)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to issue session token: %w", err)
+	}
+
+	a.publish(messaging.EventTypeUserLoggedIn, messaging.NewUserLoggedInEvent(user.ID))
+	return Session{Token: token, ExpiresAt: expiresAt, User: user}, nil
+}
+
+// VerifySession checks a session token and that it hasn't been revoked since
+// it was issued: the user must still exist and have the same password.
+func (a *Authenticator) VerifySession(token string) (auth.Claims, error) {
+	claims, err := a.tokens.Verify(token, auth.PurposeSession)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("%w: %v", ErrInvalidSession, err)
+	}
+
+	creds, err := a.credentials.GetCredentials(claims.Subject)
+	if errors.Is(err, ErrNoPassword) {
+		return auth.Claims{}, fmt.Errorf("%w: user %s no longer exists", ErrInvalidSession, claims.Subject)
+	}
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("failed to verify session: %w", err)
+	}
+	if claims.Version != creds.Version {
+		return auth.Claims{}, fmt.Errorf("%w: password of user %s has changed", ErrInvalidSession, claims.Subject)
+	}
+	return claims, nil
+}
+
+// ChangePassword replaces a user's password after checking the current one
+func (a *Authenticator) ChangePassword(userID, current, next string) error {
+	creds, err := a.credentials.GetCredentials(userID)
+	if errors.Is(err, ErrNoPassword) {
+		return ErrInvalidCredentials
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+
+	if err := a.checkPassword(creds, current); err != nil {
+		return err
+	}
+
+	if err := a.SetPassword(userID, next); err != nil {
+		return err
+	}
+
+	a.logger.Printf("Changed password of user %s", userID)
+	a.publish(messaging.EventTypePasswordChanged, messaging.NewPasswordChangedEvent(userID, "change"))
+	return nil
+}
+
+// checkPassword verifies password against a user's credentials. Wrong
+// passwords count towards the lockout wherever they're tried, so a stolen
+// session can't be used to guess the password either.
+func (a *Authenticator) checkPassword(creds Credentials, password string) error {
+	if creds.LockedUntil != nil && time.Now().Before(*creds.LockedUntil) {
+		return ErrAccountLocked
+	}
+
+	ok, err := verifyPassword(password, creds.PasswordHash)
+	if err != nil {
+		return fmt.Errorf("failed to verify password of user %s: %w", creds.UserID, err)
+	}
+	if ok {
+		return nil
+	}
+
+	locked, err := a.credentials.RecordLoginFailure(creds.UserID, a.policy.MaxFailedLogins, a.policy.LockoutDuration)
+	if err != nil {
+		a.logger.Printf("Failed to record login failure of user %s: %v", creds.UserID, err)
+	}
+	if locked {
+		a.logger.Printf("Locked user %s for %s after %d failed logins", creds.UserID, a.policy.LockoutDuration, a.policy.MaxFailedLogins)
+		return ErrAccountLocked
+	}
+	return ErrInvalidCredentials
+}
+
+// RequestPasswordReset issues a reset token for the user with email and
+// publishes it for delivery. Unknown emails are ignored without an error so
+// callers can't probe which accounts exist.
+func (a *Authenticator) RequestPasswordReset(email string) error {
+	user, err := a.users.GetUserByEmail(email)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to request password reset: %w", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().Add(a.policy.ResetTokenTTL)
+
+	if err := a.credentials.CreateResetToken(user.ID, hashResetToken(token), expiresAt); err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	a.logger.Printf("Issued password reset token for user %s", user.ID)
+	a.publish(messaging.EventTypePasswordResetRequested, messaging.NewPasswordResetRequestedEvent(user.ID, user.Email, token, expiresAt))
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token
+func (a *Authenticator) ResetPassword(token, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	userID, err := a.credentials.ResetPassword(hashResetToken(token), hash)
+	if err != nil {
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	a.logger.Printf("Reset password of user %s", userID)
+	a.publish(messaging.EventTypePasswordChanged, messaging.NewPasswordChangedEvent(userID, "reset"))
+	return nil
+}
+
+func (a *Authenticator) publish(eventType string, event messaging.Event) {
+	if err := a.publisher.Publish(eventType, event); err != nil {
+		a.logger.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// hashResetToken is how reset tokens are stored, so a leaked table can't be used
+func hashResetToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,193 @@
+package user
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/auth"
+	"github.com/alex-necsoiu/event-driven/test/mocks"
+)
+
+// credentialStore keeps credentials in memory
+type credentialStore struct {
+	CredentialStore
+	credentials map[string]Credentials
+	failures    map[string]int
+}
+
+func (s *credentialStore) SetPassword(userID, passwordHash string) error {
+	creds := s.credentials[userID]
+	creds.PasswordHash, creds.LockedUntil = passwordHash, nil
+	creds.Version++
+	s.credentials[userID] = creds
+	return nil
+}
+
+func (s *credentialStore) RecordLoginFailure(userID string, maxAttempts int, lockout time.Duration) (bool, error) {
+	s.failures[userID]++
+	if s.failures[userID] < maxAttempts {
+		return false, nil
+	}
+	s.failures[userID] = 0
+	lockedUntil := time.Now().Add(lockout)
+	creds := s.credentials[userID]
+	creds.LockedUntil = &lockedUntil
+	s.credentials[userID] = creds
+	return true, nil
+}
+
+func (s *credentialStore) GetCredentials(userID string) (Credentials, error) {
+	creds, ok := s.credentials[userID]
+	if !ok {
+		return Credentials{}, ErrNoPassword
+	}
+	return creds, nil
+}
+
+func TestAuthenticatorVerifySession(t *testing.T) {
+	signer, err := auth.NewSigner("test-secret-0123456789abcdef0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := auth.NewSigner("other-secret-0123456789abcdef012345678")
+
+	issue := func(signer *auth.Signer, claims auth.Claims, ttl time.Duration) string {
+		token, _, err := signer.Issue(claims, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{
+			name:  "current session",
+			token: issue(signer, auth.Claims{Subject: "1", Purpose: auth.PurposeSession, Version: 2}, time.Hour),
+		},
+		{
+			name:    "issued before the password changed",
+			token:   issue(signer, auth.Claims{Subject: "1", Purpose: auth.PurposeSession, Version: 1}, time.Hour),
+			wantErr: ErrInvalidSession,
+		},
+		{
+			name:    "issued before versions existed",
+			token:   issue(signer, auth.Claims{Subject: "1", Purpose: auth.PurposeSession}, time.Hour),
+			wantErr: ErrInvalidSession,
+		},
+		{
+			name:    "deleted user",
+			token:   issue(signer, auth.Claims{Subject: "2", Purpose: auth.PurposeSession, Version: 1}, time.Hour),
+			wantErr: ErrInvalidSession,
+		},
+		{
+			name:    "expired",
+			token:   issue(signer, auth.Claims{Subject: "1", Purpose: auth.PurposeSession, Version: 2}, -time.Minute),
+			wantErr: ErrInvalidSession,
+		},
+		{
+			name:    "other purpose",
+			token:   issue(signer, auth.Claims{Subject: "1", Purpose: auth.PurposeVerifyEmail, Version: 2}, time.Hour),
+			wantErr: ErrInvalidSession,
+		},
+		{
+			name:    "forged",
+			token:   issue(other, auth.Claims{Subject: "1", Purpose: auth.PurposeSession, Version: 2}, time.Hour),
+			wantErr: ErrInvalidSession,
+		},
+	}
+
+	a := &Authenticator{
+		credentials: &credentialStore{credentials: map[string]Credentials{
+			"1": {UserID: "1", Version: 2},
+		}},
+		tokens: signer,
+		logger: log.New(io.Discard, "", 0),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := a.VerifySession(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifySession() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Subject != "1" {
+				t.Errorf("subject = %q, want 1", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorChangePassword(t *testing.T) {
+	hash, err := hashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockedUntil := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		// attempts are the current passwords tried in turn
+		attempts []string
+		locked   bool // the account starts out locked
+		wantErrs []error
+	}{
+		{
+			name:     "right password",
+			attempts: []string{"correct horse battery"},
+			wantErrs: []error{nil},
+		},
+		{
+			name:     "wrong password",
+			attempts: []string{"guess"},
+			wantErrs: []error{ErrInvalidCredentials},
+		},
+		{
+			name:     "wrong passwords lock the account",
+			attempts: []string{"guess 1", "guess 2", "guess 3", "correct horse battery"},
+			wantErrs: []error{ErrInvalidCredentials, ErrInvalidCredentials, ErrAccountLocked, ErrAccountLocked},
+		},
+		{
+			name:     "locked by failed logins",
+			attempts: []string{"correct horse battery"},
+			locked:   true,
+			wantErrs: []error{ErrAccountLocked},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds := Credentials{UserID: "1", PasswordHash: hash, Version: 1}
+			if tt.locked {
+				creds.LockedUntil = &lockedUntil
+			}
+			store := &credentialStore{credentials: map[string]Credentials{"1": creds}, failures: map[string]int{}}
+			bus := mocks.NewBus()
+			a := &Authenticator{
+				credentials: store,
+				policy:      AuthPolicy{MaxFailedLogins: 3, LockoutDuration: time.Hour},
+				publisher:   bus,
+				logger:      log.New(io.Discard, "", 0),
+			}
+
+			for i, current := range tt.attempts {
+				if err := a.ChangePassword("1", current, "new password 123"); !errors.Is(err, tt.wantErrs[i]) {
+					t.Fatalf("attempt %d: ChangePassword() error = %v, want %v", i+1, err, tt.wantErrs[i])
+				}
+			}
+
+			changed := store.credentials["1"].Version != 1
+			if want := tt.wantErrs[len(tt.wantErrs)-1] == nil; changed != want {
+				t.Errorf("password changed = %v, want %v", changed, want)
+			}
+			if changed != (len(bus.Published()) == 1) {
+				t.Errorf("published %v", bus.PublishedTypes())
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrNoPassword is returned for users who have not set a password
+var ErrNoPassword = errors.New("user has no password")
+
+// Credentials are a user's password hash and lockout state
+type Credentials struct {
+	UserID       string
+	PasswordHash string
+	LockedUntil  *time.Time
+	// Version increases with every password change, revoking older sessions
+	Version int64
+}
+
+// CredentialStore abstracts DB operations for passwords and reset tokens
+type CredentialStore interface {
+	GetCredentials(userID string) (Credentials, error)
+	SetPassword(userID, passwordHash string) error
+	RecordLoginFailure(userID string, maxAttempts int, lockout time.Duration) (bool, error)
+	RecordLoginSuccess(userID string) error
+	CreateResetToken(userID string, tokenHash []byte, expiresAt time.Time) error
+	ResetPassword(tokenHash []byte, passwordHash string) (string, error)
+}
+
+// GetCredentials returns the password of an active user
+func (r *PostgresRepository) GetCredentials(userID string) (Credentials, error) {
+	var (
+		creds       Credentials
+		lockedUntil sql.NullTime
+	)
+	err := r.db.QueryRow(`
+		SELECT c.user_id::text, c.password_hash, c.locked_until, c.version
+		FROM credentials c JOIN users u ON u.id = c.user_id
+		WHERE c.user_id = $1 AND u.deleted_at IS NULL`,
+		userID,
+	).Scan(&creds.UserID, &creds.PasswordHash, &lockedUntil, &creds.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Credentials{}, ErrNoPassword
+	}
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if lockedUntil.Valid {
+		creds.LockedUntil = &lockedUntil.Time
+	}
+	return creds, nil
+}
+
+// SetPassword stores a new password hash, lifting any lockout and revoking
+// outstanding reset tokens and sessions
+func (r *PostgresRepository) SetPassword(userID, passwordHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setPassword(tx, userID, passwordHash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setPassword(tx *sql.Tx, userID, passwordHash string) error {
+	if _, err := tx.Exec(`
+		INSERT INTO credentials (user_id, password_hash) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET password_hash = EXCLUDED.password_hash, failed_attempts = 0, locked_until = NULL,
+			changed_at = now(), version = credentials.version + 1`,
+		userID, passwordHash,
+	); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(
+		"UPDATE password_reset_tokens SET used_at = now() WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	)
+	return err
+}
+
+// RecordLoginFailure counts a failed login and locks the account for lockout
+// once maxAttempts consecutive failures are reached. It reports whether the
+// account is now locked.
+func (r *PostgresRepository) RecordLoginFailure(userID string, maxAttempts int, lockout time.Duration) (bool, error) {
+	var locked bool
+	err := r.db.QueryRow(`
+		UPDATE credentials SET
+			failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+			locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN now() + make_interval(secs => $3) ELSE locked_until END
+		WHERE user_id = $1
+		RETURNING COALESCE(locked_until > now(), false)`,
+		userID, maxAttempts, lockout.Seconds(),
+	).Scan(&locked)
+	return locked, err
+}
+
+// RecordLoginSuccess resets the failure count after a successful login
+func (r *PostgresRepository) RecordLoginSuccess(userID string) error {
+	_, err := r.db.Exec(
+		"UPDATE credentials SET failed_attempts = 0, locked_until = NULL, last_login_at = now() WHERE user_id = $1",
+		userID,
+	)
+	return err
+}
+
+// CreateResetToken stores the hash of a password reset token
+func (r *PostgresRepository) CreateResetToken(userID string, tokenHash []byte, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		"INSERT INTO password_reset_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		tokenHash, userID, expiresAt,
+	)
+	return err
+}
+
+// ResetPassword consumes an unexpired reset token of an active user and sets
+// their password in one transaction, returning the user ID
+func (r *PostgresRepository) ResetPassword(tokenHash []byte, passwordHash string) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(`
+		UPDATE password_reset_tokens t SET used_at = now()
+		FROM users u
+		WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > now()
+			AND u.id = t.user_id AND u.deleted_at IS NULL
+		RETURNING t.user_id::text`,
+		tokenHash,
+	).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidResetToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := setPassword(tx, userID, passwordHash); err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
+}
@@ -0,0 +1,23 @@
+package user
+
+import (
+	"github.com/alex-necsoiu/event-driven/pkg/grpcerr"
+
+	"google.golang.org/grpc/codes"
+)
+
+// statusErrors maps user errors to the gRPC codes clients act on
+var statusErrors = grpcerr.NewMapper("user.event-driven",
+	grpcerr.Rule{Err: ErrNotFound, Code: codes.NotFound, Reason: "USER_NOT_FOUND"},
+	grpcerr.Rule{Err: ErrEmailTaken, Code: codes.AlreadyExists, Reason: "EMAIL_TAKEN"},
+	grpcerr.Rule{Err: ErrDeleted, Code: codes.FailedPrecondition, Reason: "USER_DELETED"},
+	grpcerr.Rule{Err: ErrNothingToUpdate, Code: codes.InvalidArgument, Reason: "NOTHING_TO_UPDATE"},
+	grpcerr.Rule{Err: ErrInvalidPageToken, Code: codes.InvalidArgument, Reason: "INVALID_PAGE_TOKEN"},
+	grpcerr.Rule{Err: ErrInvalidResetToken, Code: codes.InvalidArgument, Reason: "INVALID_RESET_TOKEN"},
+	grpcerr.Rule{Err: ErrInvalidVerificationToken, Code: codes.InvalidArgument, Reason: "INVALID_VERIFICATION_TOKEN"},
+	grpcerr.Rule{Err: ErrStaleVerification, Code: codes.FailedPrecondition, Reason: "STALE_VERIFICATION_TOKEN"},
+	grpcerr.Rule{Err: ErrAlreadyVerified, Code: codes.FailedPrecondition, Reason: "EMAIL_ALREADY_VERIFIED"},
+	grpcerr.Rule{Err: ErrInvalidCredentials, Code: codes.Unauthenticated, Reason: "INVALID_CREDENTIALS"},
+	grpcerr.Rule{Err: ErrInvalidSession, Code: codes.Unauthenticated, Reason: "INVALID_SESSION"},
+	grpcerr.Rule{Err: ErrAccountLocked, Code: codes.PermissionDenied, Reason: "ACCOUNT_LOCKED"},
+)
@@ -3,6 +3,7 @@ package user
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/alex-necsoiu/event-driven/api/proto/gen"
 )
@@ -11,24 +12,33 @@ import (
 type UserHandler struct {
 	gen.UnimplementedUserServiceServer
 	service *Service
+	auth    *Authenticator
 	logger  *log.Logger
 }
 
-func NewUserHandler(service *Service, logger *log.Logger) *UserHandler {
-	return &UserHandler{service: service, logger: logger}
+func NewUserHandler(service *Service, auth *Authenticator, logger *log.Logger) *UserHandler {
+	return &UserHandler{service: service, auth: auth, logger: logger}
 }
 
 // CreateUser handles user creation and publishes an event
 func (h *UserHandler) CreateUser(ctx context.Context, req *gen.CreateUserRequest) (*gen.UserResponse, error) {
 	h.logger.Printf("CreateUser called for: %s (%s)", req.Name, req.Email)
 
+	if err := validateCreateUser(req); err != nil {
+		return nil, err
+	}
+
 	userID, err := h.service.CreateUser(req.Name, req.Email)
 	if err != nil {
 		h.logger.Printf("Failed to create user: %v", err)
-		return &gen.UserResponse{
-			User:  nil,
-			Error: err.Error(),
-		}, nil
+		return nil, statusErrors.Status(err)
+	}
+
+	if req.Password != "" {
+		// The user exists either way; without a password they can still set one by resetting it
+		if err := h.auth.SetPassword(userID, req.Password); err != nil {
+			h.logger.Printf("Failed to set password of user %s: %v", userID, err)
+		}
 	}
 
 	return &gen.UserResponse{
@@ -37,7 +47,6 @@ func (h *UserHandler) CreateUser(ctx context.Context, req *gen.CreateUserRequest
 			Name:  req.Name,
 			Email: req.Email,
 		},
-		Error: "",
 	}, nil
 }
 
@@ -45,21 +54,206 @@ func (h *UserHandler) CreateUser(ctx context.Context, req *gen.CreateUserRequest
 func (h *UserHandler) GetUser(ctx context.Context, req *gen.GetUserRequest) (*gen.UserResponse, error) {
 	h.logger.Printf("GetUser called for ID: %s", req.Id)
 
+	if err := validateUserID(req.Id); err != nil {
+		return nil, err
+	}
+
 	user, err := h.service.GetUser(req.Id)
 	if err != nil {
 		h.logger.Printf("Failed to get user: %v", err)
-		return &gen.UserResponse{
-			User:  nil,
-			Error: err.Error(),
-		}, nil
+		return nil, statusErrors.Status(err)
 	}
 
 	return &gen.UserResponse{
-		User: &gen.User{
-			Id:    user.ID,
-			Name:  user.Name,
-			Email: user.Email,
-		},
-		Error: "",
+		User: toProtoUser(user),
 	}, nil
 }
+
+// UpdateUser handles changing a user's name and/or email
+func (h *UserHandler) UpdateUser(ctx context.Context, req *gen.UpdateUserRequest) (*gen.UserResponse, error) {
+	h.logger.Printf("UpdateUser called for ID: %s", req.Id)
+
+	if err := validateUpdateUser(req); err != nil {
+		return nil, err
+	}
+
+	user, err := h.service.UpdateUser(req.Id, Update{Name: req.Name, Email: req.Email})
+	if err != nil {
+		h.logger.Printf("Failed to update user: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.UserResponse{User: toProtoUser(user)}, nil
+}
+
+// DeleteUser handles soft-deleting a user
+func (h *UserHandler) DeleteUser(ctx context.Context, req *gen.DeleteUserRequest) (*gen.UserResponse, error) {
+	h.logger.Printf("DeleteUser called for ID: %s", req.Id)
+
+	if err := validateUserID(req.Id); err != nil {
+		return nil, err
+	}
+
+	user, err := h.service.DeleteUser(req.Id)
+	if err != nil {
+		h.logger.Printf("Failed to delete user: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.UserResponse{User: toProtoUser(user)}, nil
+}
+
+// ListUsers handles paginated user listing
+func (h *UserHandler) ListUsers(ctx context.Context, req *gen.ListUsersRequest) (*gen.ListUsersResponse, error) {
+	h.logger.Printf("ListUsers called, include deleted: %t", req.IncludeDeleted)
+
+	if err := validateListUsers(req); err != nil {
+		return nil, err
+	}
+
+	users, next, err := h.service.ListUsers(ListFilter{
+		IncludeDeleted: req.IncludeDeleted,
+		PageSize:       int(req.PageSize),
+		PageToken:      req.PageToken,
+	})
+	if err != nil {
+		h.logger.Printf("Failed to list users: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	resp := &gen.ListUsersResponse{
+		Users:         make([]*gen.User, 0, len(users)),
+		NextPageToken: next,
+	}
+	for _, user := range users {
+		resp.Users = append(resp.Users, toProtoUser(user))
+	}
+	return resp, nil
+}
+
+// Authenticate handles logging in with an email and password
+func (h *UserHandler) Authenticate(ctx context.Context, req *gen.AuthenticateRequest) (*gen.AuthenticateResponse, error) {
+	if err := validateAuthenticate(req); err != nil {
+		return nil, err
+	}
+	h.logger.Printf("Authenticate called for: %s", req.Email)
+
+	session, err := h.auth.Authenticate(req.Email, req.Password)
+	if err != nil {
+		h.logger.Printf("Failed to authenticate %s: %v", req.Email, err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.AuthenticateResponse{
+		Token:     session.Token,
+		ExpiresAt: session.ExpiresAt.UTC().Format(time.RFC3339),
+		User:      toProtoUser(session.User),
+	}, nil
+}
+
+// VerifySession handles checking a session token
+func (h *UserHandler) VerifySession(ctx context.Context, req *gen.VerifySessionRequest) (*gen.VerifySessionResponse, error) {
+	claims, err := h.auth.VerifySession(req.Token)
+	if err != nil {
+		h.logger.Printf("Rejected session: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+	return &gen.VerifySessionResponse{UserId: claims.Subject}, nil
+}
+
+// ChangePassword handles replacing a password
+func (h *UserHandler) ChangePassword(ctx context.Context, req *gen.ChangePasswordRequest) (*gen.ChangePasswordResponse, error) {
+	h.logger.Printf("ChangePassword called for ID: %s", req.Id)
+
+	if err := validateChangePassword(req); err != nil {
+		return nil, err
+	}
+
+	if err := h.auth.ChangePassword(req.Id, req.CurrentPassword, req.NewPassword); err != nil {
+		h.logger.Printf("Failed to change password: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.ChangePasswordResponse{}, nil
+}
+
+// RequestPasswordReset handles sending a password reset token
+func (h *UserHandler) RequestPasswordReset(ctx context.Context, req *gen.RequestPasswordResetRequest) (*gen.RequestPasswordResetResponse, error) {
+	if err := validateRequestPasswordReset(req); err != nil {
+		return nil, err
+	}
+	h.logger.Printf("RequestPasswordReset called for: %s", req.Email)
+
+	if err := h.auth.RequestPasswordReset(req.Email); err != nil {
+		h.logger.Printf("Failed to request password reset: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.RequestPasswordResetResponse{}, nil
+}
+
+// ResetPassword handles setting a password with a reset token
+func (h *UserHandler) ResetPassword(ctx context.Context, req *gen.ResetPasswordRequest) (*gen.ResetPasswordResponse, error) {
+	h.logger.Printf("ResetPassword called")
+
+	if err := validateResetPassword(req); err != nil {
+		return nil, err
+	}
+
+	if err := h.auth.ResetPassword(req.Token, req.NewPassword); err != nil {
+		h.logger.Printf("Failed to reset password: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.ResetPasswordResponse{}, nil
+}
+
+// VerifyEmail handles verifying an email with a verification token
+func (h *UserHandler) VerifyEmail(ctx context.Context, req *gen.VerifyEmailRequest) (*gen.UserResponse, error) {
+	h.logger.Printf("VerifyEmail called")
+
+	if err := validateVerifyEmail(req); err != nil {
+		return nil, err
+	}
+
+	user, err := h.service.VerifyEmail(req.Token)
+	if err != nil {
+		h.logger.Printf("Failed to verify email: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.UserResponse{User: toProtoUser(user)}, nil
+}
+
+// ResendVerificationEmail handles sending another verification token
+func (h *UserHandler) ResendVerificationEmail(ctx context.Context, req *gen.ResendVerificationEmailRequest) (*gen.ResendVerificationEmailResponse, error) {
+	h.logger.Printf("ResendVerificationEmail called for ID: %s", req.Id)
+
+	if err := validateUserID(req.Id); err != nil {
+		return nil, err
+	}
+
+	if err := h.service.ResendVerification(req.Id); err != nil {
+		h.logger.Printf("Failed to resend verification email: %v", err)
+		return nil, statusErrors.Status(err)
+	}
+
+	return &gen.ResendVerificationEmailResponse{}, nil
+}
+
+func toProtoUser(user User) *gen.User {
+	pb := &gen.User{
+		Id:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt: user.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if user.DeletedAt != nil {
+		pb.DeletedAt = user.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	if user.EmailVerifiedAt != nil {
+		pb.EmailVerifiedAt = user.EmailVerifiedAt.UTC().Format(time.RFC3339)
+	}
+	return pb
+}
@@ -0,0 +1,3 @@
+-- Incremented on every password change; session tokens carry the version
+-- they were issued for and older ones are rejected
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,63 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("hashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("hash = %q, want the argon2id PHC format", hash)
+	}
+
+	again, _ := hashPassword("correct horse battery")
+	if again == hash {
+		t.Error("hashing the same password twice gave the same hash; salts must be random")
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("hashPassword() error = %v", err)
+	}
+	// A hash with cheaper parameters, as stored before they were raised
+	parts := strings.Split(hash, "$")
+	parts[3] = "m=1024,t=1,p=1"
+	cheap := strings.Join(parts, "$")
+
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+		want     bool
+		wantErr  error
+	}{
+		{name: "matching password", password: "correct horse battery", encoded: hash, want: true},
+		{name: "wrong password", password: "Correct horse battery", encoded: hash},
+		{name: "empty password", password: "", encoded: hash},
+		{name: "parameters are read from the hash", password: "correct horse battery", encoded: cheap},
+		{name: "other algorithm", password: "x", encoded: strings.Replace(hash, "argon2id", "argon2i", 1), wantErr: errMalformedHash},
+		{name: "other version", password: "x", encoded: strings.Replace(hash, "v=19", "v=16", 1), wantErr: errMalformedHash},
+		{name: "bad parameters", password: "x", encoded: strings.Replace(hash, "m=65536", "m=lots", 1), wantErr: errMalformedHash},
+		{name: "bad salt", password: "x", encoded: strings.Join(append(parts[:4:4], "!!", parts[5]), "$"), wantErr: errMalformedHash},
+		{name: "truncated", password: "x", encoded: "$argon2id$v=19", wantErr: errMalformedHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyPassword(tt.password, tt.encoded)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verifyPassword() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("verifyPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,54 +2,100 @@ package user
 
 import (
 	"database/sql"
-	"log"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // To support MongoDB or other DBs, implement the Repository interface and add a factory method.
 
 // Repository abstracts DB operations for users
-// Implements basic PostgreSQL connection and migration placeholder
-
 type Repository interface {
 	CreateUser(name, email string) (string, error)
 	GetUser(id string) (User, error)
+	GetUserByEmail(email string) (User, error)
+	UpdateUser(id string, update Update) (User, error)
+	DeleteUser(id string) (User, error)
+	MarkEmailVerified(id, email string) (User, error)
+	ListUsers(filter ListFilter) ([]User, string, error)
 }
 
 type User struct {
-	ID    string
-	Name  string
-	Email string
+	ID        string
+	Name      string
+	Email     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time // nil unless the user was deleted
+	// EmailVerifiedAt is nil until the user verifies their current email
+	EmailVerifiedAt *time.Time
 }
 
-// PostgresRepository implements Repository using PostgreSQL
-type PostgresRepository struct {
-	db *sql.DB
+// Update holds the fields to change on a user; nil fields are left unchanged
+type Update struct {
+	Name  *string
+	Email *string
 }
 
-// NewPostgresRepository creates a new PostgresRepository
-func NewPostgresRepository(connStr string, logger *log.Logger) (*PostgresRepository, error) {
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
+// ListFilter selects and pages users for ListUsers
+type ListFilter struct {
+	IncludeDeleted bool
+	PageSize       int
+	PageToken      string
+}
+
+var (
+	// ErrNotFound is returned when a user does not exist
+	ErrNotFound = errors.New("user not found")
+	// ErrDeleted is returned when changing a user that has been deleted
+	ErrDeleted = errors.New("user has been deleted")
+	// ErrEmailTaken is returned when another user already has the email
+	ErrEmailTaken = errors.New("email is already in use")
+	// ErrNothingToUpdate is returned by an update that changes no field
+	ErrNothingToUpdate = errors.New("nothing to update")
+	// ErrInvalidPageToken is returned when a page token can't be decoded
+	ErrInvalidPageToken = errors.New("invalid page token")
+)
+
+// deletedName replaces the name of a deleted user
+const deletedName = "Deleted user"
+
+const userColumns = "id::text, name, email, created_at, updated_at, deleted_at, email_verified_at"
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (User, error) {
+	var (
+		user                  User
+		deletedAt, verifiedAt sql.NullTime
+	)
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt, &deletedAt, &verifiedAt); err != nil {
+		return User{}, err
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
 	}
-	// Run migrations (placeholder)
-	if err := migrateUsers(db, logger); err != nil {
-		return nil, err
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
 	}
-	return &PostgresRepository{db: db}, nil
+	return user, nil
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
 }
 
-// migrateUsers runs DB migrations for the users table (placeholder)
-func migrateUsers(db *sql.DB, logger *log.Logger) error {
-	logger.Println("Running user table migrations (placeholder)")
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS users (
-		id SERIAL PRIMARY KEY,
-		name TEXT NOT NULL,
-		email TEXT NOT NULL UNIQUE
-	)`)
-	return err
+// NewPostgresRepository creates a new PostgresRepository.
+// The schema is managed by the versioned migrations in Migrations().
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
 }
 
 // CreateUser creates a new user and returns the user ID
@@ -60,6 +106,9 @@ func (r *PostgresRepository) CreateUser(name, email string) (string, error) {
 		name, email,
 	).Scan(&id)
 
+	if isUniqueViolation(err) {
+		return "", ErrEmailTaken
+	}
 	if err != nil {
 		return "", err
 	}
@@ -67,17 +116,206 @@ func (r *PostgresRepository) CreateUser(name, email string) (string, error) {
 	return id, nil
 }
 
-// GetUser retrieves a user by ID
+// GetUser retrieves a user by ID, including deleted users
 func (r *PostgresRepository) GetUser(id string) (User, error) {
-	var user User
-	err := r.db.QueryRow(
-		"SELECT id::text, name, email FROM users WHERE id = $1",
+	user, err := scanUser(r.db.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE id = $1",
 		id,
-	).Scan(&user.ID, &user.Name, &user.Email)
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail retrieves an active user by their normalized email
+func (r *PostgresRepository) GetUserByEmail(email string) (User, error) {
+	user, err := scanUser(r.db.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE email = $1 AND deleted_at IS NULL",
+		email,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// UpdateUser applies update to a user that has not been deleted. Changing the
+// email clears its verification.
+func (r *PostgresRepository) UpdateUser(id string, update Update) (User, error) {
+	user, err := scanUser(r.db.QueryRow(`
+		UPDATE users
+		SET name = COALESCE($2, name), email = COALESCE($3, email), updated_at = now(),
+			email_verified_at = CASE WHEN $3::text <> email THEN NULL ELSE email_verified_at END
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+userColumns,
+		id, update.Name, update.Email,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, r.missing(id)
+	}
+	if isUniqueViolation(err) {
+		return User{}, ErrEmailTaken
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
 
+// DeleteUser soft-deletes a user, replacing their name and email and erasing
+// their credentials so no personal data remains. The row is kept so IDs held
+// by other services stay resolvable and are never reused.
+func (r *PostgresRepository) DeleteUser(id string) (User, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return User{}, err
 	}
+	defer tx.Rollback()
 
+	user, err := scanUser(tx.QueryRow(`
+		UPDATE users
+		SET name = $2, email = 'deleted-' || id || '@invalid', email_verified_at = NULL,
+			deleted_at = now(), updated_at = now()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+userColumns,
+		id, deletedName,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, r.missing(id)
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	for _, table := range []string{"credentials", "password_reset_tokens"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = $1", id); err != nil {
+			return User{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return User{}, err
+	}
 	return user, nil
 }
+
+// MarkEmailVerified records that an active user verified email, which must
+// still be their current address
+func (r *PostgresRepository) MarkEmailVerified(id, email string) (User, error) {
+	user, err := scanUser(r.db.QueryRow(`
+		UPDATE users SET email_verified_at = now(), updated_at = now()
+		WHERE id = $1 AND email = $2 AND deleted_at IS NULL AND email_verified_at IS NULL
+		RETURNING `+userColumns,
+		id, email,
+	))
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return User{}, err
+	}
+
+	// Explain why no row matched
+	if user, err = r.GetUser(id); err != nil {
+		return User{}, err
+	}
+	switch {
+	case user.DeletedAt != nil:
+		return User{}, ErrDeleted
+	case user.Email != email:
+		return User{}, ErrStaleVerification
+	default:
+		return User{}, ErrAlreadyVerified
+	}
+}
+
+// missing explains why a write matched no active user
+func (r *PostgresRepository) missing(id string) error {
+	user, err := r.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if user.DeletedAt != nil {
+		return ErrDeleted
+	}
+	// Deleted and gone between the two queries is the only other case
+	return ErrNotFound
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation,
+// which on users can only come from the email
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// ListUsers pages through users in ID order and returns the token of the next
+// page, which is empty on the last page
+func (r *PostgresRepository) ListUsers(filter ListFilter) ([]User, string, error) {
+	var after int64
+	if filter.PageToken != "" {
+		var err error
+		if after, err = decodePageToken(filter.PageToken); err != nil {
+			return nil, "", err
+		}
+	}
+
+	query := "SELECT " + userColumns + " FROM users WHERE id > $1"
+	if !filter.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	// Fetch one extra row to learn whether another page exists
+	query += " ORDER BY id LIMIT $2"
+
+	rows, err := r.db.Query(query, after, filter.PageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(users) > filter.PageSize {
+		users = users[:filter.PageSize]
+		next = encodePageToken(users[len(users)-1].ID)
+	}
+	return users, next, nil
+}
+
+// encodePageToken builds an opaque cursor pointing after the given user
+func encodePageToken(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodePageToken(token string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidPageToken
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidPageToken
+	}
+	return id, nil
+}
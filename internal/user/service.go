@@ -3,7 +3,9 @@ package user
 import (
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/alex-necsoiu/event-driven/pkg/auth"
 	"github.com/alex-necsoiu/event-driven/pkg/messaging"
 )
 
@@ -11,15 +13,20 @@ import (
 type Service struct {
 	repo      Repository
 	publisher messaging.Publisher
-	logger    *log.Logger
+	// tokens signs email verification tokens valid for verificationTTL
+	tokens          *auth.Signer
+	verificationTTL time.Duration
+	logger          *log.Logger
 }
 
 // NewService creates a new user service
-func NewService(repo Repository, publisher messaging.Publisher, logger *log.Logger) *Service {
+func NewService(repo Repository, publisher messaging.Publisher, tokens *auth.Signer, verificationTTL time.Duration, logger *log.Logger) *Service {
 	return &Service{
-		repo:      repo,
-		publisher: publisher,
-		logger:    logger,
+		repo:            repo,
+		publisher:       publisher,
+		tokens:          tokens,
+		verificationTTL: verificationTTL,
+		logger:          logger,
 	}
 }
 
@@ -41,6 +48,11 @@ func (s *Service) CreateUser(name, email string) (string, error) {
 		// In production, you might want to retry or use outbox pattern
 	}
 
+	// The user can ask for another link if this one is lost
+	if err := s.requestVerification(userID, email); err != nil {
+		s.logger.Printf("Failed to request verification of user %s: %v", userID, err)
+	}
+
 	return userID, nil
 }
 
@@ -52,3 +64,69 @@ func (s *Service) GetUser(id string) (User, error) {
 	}
 	return user, nil
 }
+
+// UpdateUser changes a user's name and/or email and publishes UserUpdated event
+func (s *Service) UpdateUser(id string, update Update) (User, error) {
+	if update.Name == nil && update.Email == nil {
+		return User{}, ErrNothingToUpdate
+	}
+
+	user, err := s.repo.UpdateUser(id, update)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	s.logger.Printf("Updated user: %s", id)
+
+	event := messaging.NewUserUpdatedEvent(user.ID, user.Name, user.Email, user.EmailVerifiedAt != nil)
+	if err := s.publisher.Publish(messaging.EventTypeUserUpdated, event); err != nil {
+		s.logger.Printf("Failed to publish UserUpdated event: %v", err)
+	}
+
+	// A changed email has to be verified again
+	if update.Email != nil && user.EmailVerifiedAt == nil {
+		if err := s.requestVerification(user.ID, user.Email); err != nil {
+			s.logger.Printf("Failed to request verification of user %s: %v", user.ID, err)
+		}
+	}
+
+	return user, nil
+}
+
+// DeleteUser soft-deletes and anonymizes a user and publishes UserDeleted event
+func (s *Service) DeleteUser(id string) (User, error) {
+	user, err := s.repo.DeleteUser(id)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	s.logger.Printf("Deleted user: %s", id)
+
+	event := messaging.NewUserDeletedEvent(user.ID)
+	if err := s.publisher.Publish(messaging.EventTypeUserDeleted, event); err != nil {
+		s.logger.Printf("Failed to publish UserDeleted event: %v", err)
+	}
+
+	return user, nil
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// ListUsers returns a page of users and the token for the next page
+func (s *Service) ListUsers(filter ListFilter) ([]User, string, error) {
+	switch {
+	case filter.PageSize <= 0:
+		filter.PageSize = defaultPageSize
+	case filter.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
+	}
+
+	users, next, err := s.repo.ListUsers(filter)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, next, nil
+}
@@ -0,0 +1,108 @@
+package user
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+	"github.com/alex-necsoiu/event-driven/pkg/validation"
+)
+
+// Limits on user fields, in characters
+const (
+	maxNameLength     = 100
+	minPasswordLength = 8
+	maxPasswordLength = 128
+)
+
+// validateCreateUser checks a CreateUserRequest, trimming its name and
+// normalizing its email in place
+func validateCreateUser(req *gen.CreateUserRequest) error {
+	var v validation.Violations
+	req.Name = strings.TrimSpace(req.Name)
+	if v.Required("name", req.Name) {
+		v.Length("name", req.Name, maxNameLength)
+	}
+	v.Email("email", &req.Email)
+	if req.Password != "" {
+		validatePassword(&v, "password", req.Password)
+	}
+	return v.Err()
+}
+
+// validatePassword checks a new password; passwords are used verbatim, never trimmed
+func validatePassword(v *validation.Violations, field, password string) {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		v.Add(field, "must be at least %d characters", minPasswordLength)
+		return
+	}
+	v.Length(field, password, maxPasswordLength)
+}
+
+// validateUpdateUser checks an UpdateUserRequest like validateCreateUser,
+// skipping unset fields
+func validateUpdateUser(req *gen.UpdateUserRequest) error {
+	var v validation.Violations
+	v.ID("id", req.Id)
+	if req.Name == nil && req.Email == nil {
+		v.Add("name", "name or email is required")
+	}
+	if req.Name != nil {
+		*req.Name = strings.TrimSpace(*req.Name)
+		if v.Required("name", *req.Name) {
+			v.Length("name", *req.Name, maxNameLength)
+		}
+	}
+	if req.Email != nil {
+		v.Email("email", req.Email)
+	}
+	return v.Err()
+}
+
+// validateUserID checks the ID of a single-user request
+func validateUserID(id string) error {
+	var v validation.Violations
+	v.ID("id", id)
+	return v.Err()
+}
+
+func validateListUsers(req *gen.ListUsersRequest) error {
+	var v validation.Violations
+	v.Range("page_size", int64(req.PageSize), 0, maxPageSize)
+	return v.Err()
+}
+
+// validateAuthenticate normalizes the email of an AuthenticateRequest in place
+func validateAuthenticate(req *gen.AuthenticateRequest) error {
+	var v validation.Violations
+	v.Email("email", &req.Email)
+	v.Required("password", req.Password)
+	return v.Err()
+}
+
+func validateChangePassword(req *gen.ChangePasswordRequest) error {
+	var v validation.Violations
+	v.ID("id", req.Id)
+	v.Required("current_password", req.CurrentPassword)
+	validatePassword(&v, "new_password", req.NewPassword)
+	return v.Err()
+}
+
+func validateRequestPasswordReset(req *gen.RequestPasswordResetRequest) error {
+	var v validation.Violations
+	v.Email("email", &req.Email)
+	return v.Err()
+}
+
+func validateResetPassword(req *gen.ResetPasswordRequest) error {
+	var v validation.Violations
+	v.Required("token", req.Token)
+	validatePassword(&v, "new_password", req.NewPassword)
+	return v.Err()
+}
+
+func validateVerifyEmail(req *gen.VerifyEmailRequest) error {
+	var v validation.Violations
+	v.Required("token", req.Token)
+	return v.Err()
+}
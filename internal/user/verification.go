@@ -0,0 +1,76 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alex-necsoiu/event-driven/pkg/auth"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+var (
+	// ErrInvalidVerificationToken is returned for forged or expired verification tokens
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	// ErrStaleVerification is returned for a token issued for an email the user has since changed
+	ErrStaleVerification = errors.New("email verification token is for a previous email")
+	// ErrAlreadyVerified is returned when the user's email is already verified
+	ErrAlreadyVerified = errors.New("email is already verified")
+)
+
+// VerifyEmail marks the email a verification token was issued for as verified
+// and publishes UserEmailVerified. Verifying twice is not an error.
+func (s *Service) VerifyEmail(token string) (User, error) {
+	claims, err := s.tokens.Verify(token, auth.PurposeVerifyEmail)
+	if err != nil {
+		return User{}, fmt.Errorf("%w: %v", ErrInvalidVerificationToken, err)
+	}
+
+	user, err := s.repo.MarkEmailVerified(claims.Subject, claims.Email)
+	if errors.Is(err, ErrAlreadyVerified) {
+		return s.GetUser(claims.Subject)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	s.logger.Printf("Verified email of user: %s", user.ID)
+
+	event := messaging.NewUserEmailVerifiedEvent(user.ID, user.Email, *user.EmailVerifiedAt)
+	if err := s.publisher.Publish(messaging.EventTypeUserEmailVerified, event); err != nil {
+		s.logger.Printf("Failed to publish UserEmailVerified event: %v", err)
+	}
+
+	return user, nil
+}
+
+// ResendVerification issues a new verification token for a user whose email
+// is not verified yet
+func (s *Service) ResendVerification(id string) error {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case user.DeletedAt != nil:
+		return ErrDeleted
+	case user.EmailVerifiedAt != nil:
+		return ErrAlreadyVerified
+	}
+	return s.requestVerification(user.ID, user.Email)
+}
+
+// requestVerification signs a token binding the user to email and publishes
+// it for delivery
+func (s *Service) requestVerification(userID, email string) error {
+	claims := auth.Claims{Subject: userID, Purpose: auth.PurposeVerifyEmail, Email: email}
+	token, expiresAt, err := s.tokens.Issue(claims, s.verificationTTL)
+	if err != nil {
+		return fmt.Errorf("failed to issue verification token: %w", err)
+	}
+
+	event := messaging.NewEmailVerificationRequestedEvent(userID, email, token, expiresAt)
+	if err := s.publisher.Publish(messaging.EventTypeEmailVerificationRequested, event); err != nil {
+		return fmt.Errorf("failed to publish EmailVerificationRequested event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret-0123456789abcdef0123456789"
+
+func TestNewSigner(t *testing.T) {
+	if _, err := NewSigner(strings.Repeat("k", 31)); err == nil {
+		t.Error("expected an error for a secret shorter than 32 bytes")
+	}
+	if _, err := NewSigner(strings.Repeat("k", 32)); err != nil {
+		t.Errorf("NewSigner() error = %v", err)
+	}
+}
+
+func TestSignerVerify(t *testing.T) {
+	now := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+	signer, err := NewSigner(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.now = func() time.Time { return now }
+	other, _ := NewSigner("other-secret-0123456789abcdef012345678")
+	other.now = signer.now
+
+	issue := func(s *Signer, claims Claims, ttl time.Duration) string {
+		token, _, err := s.Issue(claims, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	// signed returns a token with a valid signature over an arbitrary payload
+	signed := func(encoded string) string {
+		return encoded + "." + signer.sign(encoded)
+	}
+	session := Claims{Subject: "42", Purpose: PurposeSession, Version: 3}
+	valid := issue(signer, session, time.Hour)
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		wantErr error
+	}{
+		{name: "valid round trip", token: valid, purpose: PurposeSession},
+		{name: "forged with another secret", token: issue(other, session, time.Hour), purpose: PurposeSession, wantErr: ErrInvalidToken},
+		{
+			name:    "payload swapped under a valid signature",
+			token:   base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1","purpose":"session","exp":9999999999}`)) + "." + signature,
+			purpose: PurposeSession,
+			wantErr: ErrInvalidToken,
+		},
+		{name: "signature tampered", token: payload + "." + strings.ToUpper(signature), purpose: PurposeSession, wantErr: ErrInvalidToken},
+		{name: "wrong purpose", token: valid, purpose: PurposeVerifyEmail, wantErr: ErrInvalidToken},
+		{name: "expired", token: issue(signer, session, -time.Second), purpose: PurposeSession, wantErr: ErrExpiredToken},
+		{name: "expires this second", token: issue(signer, session, 0), purpose: PurposeSession, wantErr: ErrExpiredToken},
+		{name: "empty", token: "", purpose: PurposeSession, wantErr: ErrInvalidToken},
+		{name: "one segment", token: payload, purpose: PurposeSession, wantErr: ErrInvalidToken},
+		{name: "three segments", token: valid + "." + signature, purpose: PurposeSession, wantErr: ErrInvalidToken},
+		{name: "malformed base64", token: signed("not*base64"), purpose: PurposeSession, wantErr: ErrInvalidToken},
+		{name: "not JSON", token: signed(base64.RawURLEncoding.EncodeToString([]byte("sub=42"))), purpose: PurposeSession, wantErr: ErrInvalidToken},
+		{name: "no subject", token: issue(signer, Claims{Purpose: PurposeSession}, time.Hour), purpose: PurposeSession, wantErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := signer.Verify(tt.token, tt.purpose)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := Claims{Subject: "42", Purpose: PurposeSession, Version: 3, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+			if claims != want {
+				t.Errorf("claims = %+v, want %+v", claims, want)
+			}
+		})
+	}
+}
+
+func TestSignerIssueExpiry(t *testing.T) {
+	now := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+	signer, err := NewSigner(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.now = func() time.Time { return now }
+
+	token, expiresAt, err := signer.Issue(Claims{Subject: "42", Purpose: PurposeSession}, 30*time.Minute)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if !expiresAt.Equal(now.Add(30 * time.Minute)) {
+		t.Errorf("expires at %s, want %s", expiresAt, now.Add(30*time.Minute))
+	}
+
+	// Valid until the last second before expiry
+	signer.now = func() time.Time { return expiresAt.Add(-time.Second) }
+	if _, err := signer.Verify(token, PurposeSession); err != nil {
+		t.Errorf("Verify() just before expiry error = %v", err)
+	}
+	signer.now = func() time.Time { return expiresAt }
+	if _, err := signer.Verify(token, PurposeSession); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Verify() at expiry error = %v, want %v", err, ErrExpiredToken)
+	}
+}
@@ -0,0 +1,84 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// AnyVersion appends without checking the stream's version
+	AnyVersion int64 = -1
+	// NoStream expects the stream to have no events yet
+	NoStream int64 = 0
+
+	// End reads a stream backward from its latest event
+	End int64 = math.MaxInt64
+)
+
+// ErrVersionConflict is returned when a stream is not at the expected version,
+// meaning another writer appended to it first
+var ErrVersionConflict = errors.New("stream version conflict")
+
+// Direction is the order ReadStream returns events in
+type Direction int
+
+const (
+	Forward Direction = iota
+	Backward
+)
+
+// EventData is an event to append
+type EventData struct {
+	Type     string
+	Data     json.RawMessage
+	Metadata json.RawMessage // optional, e.g. correlation or actor details
+}
+
+// RecordedEvent is an event as stored
+type RecordedEvent struct {
+	StreamID   string
+	Version    int64 // 1-based position within the stream
+	Position   int64 // global position across all streams, ReadAll's cursor
+	Type       string
+	Data       json.RawMessage
+	Metadata   json.RawMessage
+	RecordedAt time.Time
+}
+
+// Store persists streams of events
+type Store interface {
+	// Append adds events to a stream if it is at expectedVersion (or AnyVersion)
+	// and returns the stream's new version
+	Append(ctx context.Context, streamID string, expectedVersion int64, events ...EventData) (int64, error)
+	// ReadStream returns up to count events of a stream starting at version from;
+	// Backward reads towards the start, from End for the latest. count <= 0 reads all.
+	ReadStream(ctx context.Context, streamID string, from int64, direction Direction, count int) ([]RecordedEvent, error)
+	// ReadAll returns up to count events of every stream in commit order, after
+	// the event at the given position (0 for the start)
+	ReadAll(ctx context.Context, after int64, count int) ([]RecordedEvent, error)
+}
+
+// Checkpoints persists how far a named reader, e.g. a subscription, has got
+type Checkpoints interface {
+	// Load returns the saved position of name, or 0 if it has none
+	Load(ctx context.Context, name string) (int64, error)
+	Save(ctx context.Context, name string, position int64) error
+}
+
+// NewEvent builds EventData with payload encoded as JSON
+func NewEvent(eventType string, payload interface{}) (EventData, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return EventData{}, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	return EventData{Type: eventType, Data: data}, nil
+}
+
+// conflict builds the ErrVersionConflict for a stream found at current
+func conflict(streamID string, current, expected int64) error {
+	return fmt.Errorf("%w: stream %s is at version %d, expected %d", ErrVersionConflict, streamID, current, expected)
+}
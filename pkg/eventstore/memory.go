@@ -0,0 +1,125 @@
+package eventstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements Store in memory, for tests and local experiments
+type MemoryStore struct {
+	mu      sync.RWMutex
+	events  []RecordedEvent  // in global position order
+	streams map[string][]int // indexes into events, in version order
+	now     func() time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		streams: make(map[string][]int),
+		now:     time.Now,
+	}
+}
+
+// Append adds events to a stream if it is at expectedVersion
+func (s *MemoryStore) Append(ctx context.Context, streamID string, expectedVersion int64, events ...EventData) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := int64(len(s.streams[streamID]))
+	if expectedVersion != AnyVersion && current != expectedVersion {
+		return 0, conflict(streamID, current, expectedVersion)
+	}
+
+	for _, e := range events {
+		current++
+		s.events = append(s.events, RecordedEvent{
+			StreamID:   streamID,
+			Version:    current,
+			Position:   int64(len(s.events) + 1),
+			Type:       e.Type,
+			Data:       append([]byte(nil), e.Data...),
+			Metadata:   append([]byte(nil), e.Metadata...),
+			RecordedAt: s.now().UTC(),
+		})
+		s.streams[streamID] = append(s.streams[streamID], len(s.events)-1)
+	}
+	return current, nil
+}
+
+// ReadStream reads a stream forward from version from, or backward down to it
+func (s *MemoryStore) ReadStream(ctx context.Context, streamID string, from int64, direction Direction, count int) ([]RecordedEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	indexes := s.streams[streamID]
+	var events []RecordedEvent
+	if direction == Backward {
+		for i := len(indexes) - 1; i >= 0; i-- {
+			if e := s.events[indexes[i]]; e.Version <= from {
+				events = append(events, e)
+			}
+			if count > 0 && len(events) == count {
+				break
+			}
+		}
+		return events, nil
+	}
+
+	for _, i := range indexes {
+		if e := s.events[i]; e.Version >= from {
+			events = append(events, e)
+		}
+		if count > 0 && len(events) == count {
+			break
+		}
+	}
+	return events, nil
+}
+
+// ReadAll reads every stream in global position order, which is commit order
+// since appends are serialized
+func (s *MemoryStore) ReadAll(ctx context.Context, after int64, count int) ([]RecordedEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if after < 0 {
+		after = 0
+	}
+	if after >= int64(len(s.events)) {
+		return nil, nil
+	}
+
+	events := s.events[after:]
+	if count > 0 && len(events) > count {
+		events = events[:count]
+	}
+	return append([]RecordedEvent(nil), events...), nil
+}
+
+// MemoryCheckpoints implements Checkpoints in memory
+type MemoryCheckpoints struct {
+	mu        sync.Mutex
+	positions map[string]int64
+}
+
+// NewMemoryCheckpoints creates an empty MemoryCheckpoints
+func NewMemoryCheckpoints() *MemoryCheckpoints {
+	return &MemoryCheckpoints{positions: make(map[string]int64)}
+}
+
+// Load returns the saved position of name
+func (c *MemoryCheckpoints) Load(ctx context.Context, name string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.positions[name], nil
+}
+
+// Save stores the position of name
+func (c *MemoryCheckpoints) Save(ctx context.Context, name string, position int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.positions[name] = position
+	return nil
+}
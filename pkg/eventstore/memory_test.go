@@ -0,0 +1,151 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// seed records a1 and a2 in stream a, b1 in stream b, then a3, so global
+// positions interleave the streams
+func seed(t *testing.T) *MemoryStore {
+	t.Helper()
+	ctx := context.Background()
+	s := NewMemoryStore()
+	steps := []struct {
+		stream string
+		types  []string
+	}{
+		{"a", []string{"a1", "a2"}},
+		{"b", []string{"b1"}},
+		{"a", []string{"a3"}},
+	}
+	for _, step := range steps {
+		var events []EventData
+		for _, typ := range step.types {
+			events = append(events, EventData{Type: typ, Data: []byte(`{}`)})
+		}
+		if _, err := s.Append(ctx, step.stream, AnyVersion, events...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// types lists the event types in order
+func types(events []RecordedEvent) []string {
+	out := []string{}
+	for _, e := range events {
+		out = append(out, e.Type)
+	}
+	return out
+}
+
+func TestMemoryStoreAppend(t *testing.T) {
+	tests := []struct {
+		name        string
+		stream      string
+		expected    int64
+		wantVersion int64
+		wantErr     error
+	}{
+		{name: "new stream", stream: "c", expected: NoStream, wantVersion: 1},
+		{name: "stream at the expected version", stream: "a", expected: 3, wantVersion: 4},
+		{name: "any version", stream: "b", expected: AnyVersion, wantVersion: 2},
+		{name: "stream moved on", stream: "a", expected: 2, wantErr: ErrVersionConflict},
+		{name: "stream expected to be new", stream: "b", expected: NoStream, wantErr: ErrVersionConflict},
+		{name: "stream expected to exist", stream: "c", expected: 1, wantErr: ErrVersionConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := seed(t)
+			version, err := s.Append(context.Background(), tt.stream, tt.expected, EventData{Type: "x"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Append() error = %v, want %v", err, tt.wantErr)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("Append() version = %d, want %d", version, tt.wantVersion)
+			}
+
+			all, _ := s.ReadAll(context.Background(), 0, 0)
+			wantEvents := 4
+			if tt.wantErr == nil {
+				wantEvents = 5
+				if last := all[len(all)-1]; last.Position != 5 || last.Version != tt.wantVersion || last.StreamID != tt.stream {
+					t.Errorf("appended event = %+v", last)
+				}
+			}
+			if len(all) != wantEvents {
+				t.Errorf("store has %d events, want %d", len(all), wantEvents)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreReadStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		from      int64
+		direction Direction
+		count     int
+		want      []string
+	}{
+		{name: "whole stream", stream: "a", from: 1, want: []string{"a1", "a2", "a3"}},
+		{name: "forward from a version", stream: "a", from: 2, want: []string{"a2", "a3"}},
+		{name: "forward with a count", stream: "a", from: 1, count: 2, want: []string{"a1", "a2"}},
+		{name: "backward from the end", stream: "a", from: End, direction: Backward, want: []string{"a3", "a2", "a1"}},
+		{name: "latest event", stream: "a", from: End, direction: Backward, count: 1, want: []string{"a3"}},
+		{name: "backward from a version", stream: "a", from: 2, direction: Backward, want: []string{"a2", "a1"}},
+		{name: "past the end", stream: "a", from: 4, want: []string{}},
+		{name: "unknown stream", stream: "c", from: 1, want: []string{}},
+	}
+
+	s := seed(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := s.ReadStream(context.Background(), tt.stream, tt.from, tt.direction, tt.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := types(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadStream() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreReadAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		after int64
+		count int
+		want  []string
+	}{
+		{name: "everything", after: 0, want: []string{"a1", "a2", "b1", "a3"}},
+		{name: "after a position", after: 2, want: []string{"b1", "a3"}},
+		{name: "with a count", after: 1, count: 2, want: []string{"a2", "b1"}},
+		{name: "caught up", after: 4, want: []string{}},
+		{name: "negative position", after: -1, count: 1, want: []string{"a1"}},
+	}
+
+	s := seed(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := s.ReadAll(context.Background(), tt.after, tt.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := types(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadAll() = %v, want %v", got, tt.want)
+			}
+			for i, e := range events {
+				if want := max(tt.after, 0) + int64(i) + 1; e.Position != want {
+					t.Errorf("event %s at position %d, want %d", e.Type, e.Position, want)
+				}
+			}
+		})
+	}
+}
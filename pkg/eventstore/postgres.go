@@ -0,0 +1,174 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the Postgres error code for a duplicate key
+const uniqueViolation = "23505"
+
+// PostgresStore implements Store on one PostgreSQL table. The table is created
+// by the owning service's migrations with these columns:
+//
+//	position BIGSERIAL PRIMARY KEY, stream_id TEXT, version INTEGER,
+//	event_type TEXT, data JSONB, metadata JSONB, recorded_at TIMESTAMPTZ,
+//	transaction_id xid8 DEFAULT pg_current_xact_id(),
+//	UNIQUE (stream_id, version)
+type PostgresStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPostgresStore creates a new PostgresStore on the given table
+func NewPostgresStore(db *sql.DB, table string) *PostgresStore {
+	return &PostgresStore{db: db, table: pq.QuoteIdentifier(table)}
+}
+
+// Append adds events to a stream in its own transaction
+func (s *PostgresStore) Append(ctx context.Context, streamID string, expectedVersion int64, events ...EventData) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	version, err := s.AppendTx(ctx, tx, streamID, expectedVersion, events...)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// AppendTx adds events to a stream within tx, so they commit atomically with
+// the caller's other writes. Appends to different streams run concurrently;
+// two writers of the same stream are told apart by UNIQUE (stream_id, version).
+func (s *PostgresStore) AppendTx(ctx context.Context, tx *sql.Tx, streamID string, expectedVersion int64, events ...EventData) (int64, error) {
+	var current int64
+	if err := tx.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version), 0) FROM "+s.table+" WHERE stream_id = $1",
+		streamID,
+	).Scan(&current); err != nil {
+		return 0, err
+	}
+	if expectedVersion != AnyVersion && current != expectedVersion {
+		return 0, conflict(streamID, current, expectedVersion)
+	}
+
+	for _, e := range events {
+		current++
+		metadata := e.Metadata
+		if len(metadata) == 0 {
+			metadata = []byte("{}")
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO "+s.table+" (stream_id, version, event_type, data, metadata) VALUES ($1, $2, $3, $4, $5)",
+			streamID, current, e.Type, []byte(e.Data), []byte(metadata),
+		)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return 0, conflict(streamID, current, expectedVersion)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return current, nil
+}
+
+// ReadStream reads a stream forward from version from, or backward down to it
+func (s *PostgresStore) ReadStream(ctx context.Context, streamID string, from int64, direction Direction, count int) ([]RecordedEvent, error) {
+	query := "SELECT " + recordedColumns + " FROM " + s.table + " WHERE stream_id = $1 AND version >= $2 ORDER BY version"
+	if direction == Backward {
+		query = "SELECT " + recordedColumns + " FROM " + s.table + " WHERE stream_id = $1 AND version <= $2 ORDER BY version DESC"
+	}
+	return s.query(ctx, query+" LIMIT $3", streamID, from, limit(count))
+}
+
+// ReadAll reads every stream in commit order. Positions are taken when an
+// event is inserted, so a transaction still in flight may hold a lower one
+// than events already committed. Only events of transactions older than every
+// running one are read, ordered by transaction and then position; the cursor
+// after is resolved to the transaction of the event at that position.
+func (s *PostgresStore) ReadAll(ctx context.Context, after int64, count int) ([]RecordedEvent, error) {
+	return s.query(ctx, `
+		SELECT `+recordedColumns+` FROM `+s.table+`
+		WHERE (transaction_id, position) > (
+			COALESCE((SELECT transaction_id FROM `+s.table+` WHERE position = $1), '0'::xid8), $1
+		)
+		AND transaction_id < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY transaction_id, position LIMIT $2`,
+		after, limit(count),
+	)
+}
+
+const recordedColumns = "stream_id, version, position, event_type, data, metadata, recorded_at"
+
+func (s *PostgresStore) query(ctx context.Context, query string, args ...interface{}) ([]RecordedEvent, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []RecordedEvent
+	for rows.Next() {
+		var (
+			e              RecordedEvent
+			data, metadata []byte
+		)
+		if err := rows.Scan(&e.StreamID, &e.Version, &e.Position, &e.Type, &data, &metadata, &e.RecordedAt); err != nil {
+			return nil, err
+		}
+		e.Data, e.Metadata = data, metadata
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// limit maps count to a LIMIT argument, where NULL means no limit
+func limit(count int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(count), Valid: count > 0}
+}
+
+// PostgresCheckpoints implements Checkpoints using PostgreSQL. The
+// eventstore_checkpoints table is created by the owning service's migrations.
+type PostgresCheckpoints struct {
+	db *sql.DB
+}
+
+// NewPostgresCheckpoints creates a new PostgresCheckpoints
+func NewPostgresCheckpoints(db *sql.DB) *PostgresCheckpoints {
+	return &PostgresCheckpoints{db: db}
+}
+
+// Load returns the saved position of name
+func (c *PostgresCheckpoints) Load(ctx context.Context, name string) (int64, error) {
+	var position int64
+	err := c.db.QueryRowContext(ctx,
+		"SELECT position FROM eventstore_checkpoints WHERE name = $1",
+		name,
+	).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return position, err
+}
+
+// Save stores the position of name
+func (c *PostgresCheckpoints) Save(ctx context.Context, name string, position int64) error {
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO eventstore_checkpoints (name, position, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position, updated_at = EXCLUDED.updated_at`,
+		name, position, time.Now().UTC(),
+	)
+	return err
+}
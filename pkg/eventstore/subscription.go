@@ -0,0 +1,109 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// subscriptionBatch bounds how many events one poll forwards
+const subscriptionBatch = 100
+
+// Subscription tails a Store and forwards each event, under its type prefixed
+// with subjectPrefix as the subject, to a messaging.Publisher. Its position is
+// checkpointed under its name, so it resumes where it stopped; delivery is at
+// least once.
+type Subscription struct {
+	name          string
+	store         Store
+	checkpoints   Checkpoints
+	publisher     messaging.Publisher
+	subjectPrefix string
+	logger        *log.Logger
+}
+
+// NewSubscription creates a new Subscription
+func NewSubscription(name string, store Store, checkpoints Checkpoints, publisher messaging.Publisher, subjectPrefix string, logger *log.Logger) *Subscription {
+	return &Subscription{
+		name:          name,
+		store:         store,
+		checkpoints:   checkpoints,
+		publisher:     publisher,
+		subjectPrefix: subjectPrefix,
+		logger:        logger,
+	}
+}
+
+// Poll forwards one batch of events recorded after the checkpoint and returns
+// how many were forwarded. On a publish failure the checkpoint is left at the
+// last forwarded event, so the next poll retries from there.
+func (s *Subscription) Poll(ctx context.Context) (int, error) {
+	position, err := s.checkpoints.Load(ctx, s.name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	events, err := s.store.ReadAll(ctx, position, subscriptionBatch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	forwarded := 0
+	var publishErr error
+	for _, e := range events {
+		if publishErr = s.publisher.Publish(s.subjectPrefix+e.Type, toMessage(e)); publishErr != nil {
+			publishErr = fmt.Errorf("failed to publish %s event at position %d: %w", e.Type, e.Position, publishErr)
+			break
+		}
+		position = e.Position
+		forwarded++
+	}
+
+	if forwarded > 0 {
+		if err := s.checkpoints.Save(ctx, s.name, position); err != nil {
+			return forwarded, fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+	}
+	return forwarded, publishErr
+}
+
+// Run polls every interval until ctx is cancelled; a full batch is followed
+// by another poll straight away so backlogs drain quickly
+func (s *Subscription) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := s.Poll(ctx)
+				if err != nil {
+					s.logger.Printf("Subscription %s failed: %v", s.name, err)
+				}
+				if err != nil || n < subscriptionBatch || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// toMessage converts a recorded event to the bus format
+func toMessage(e RecordedEvent) messaging.Event {
+	var payload interface{}
+	if err := json.Unmarshal(e.Data, &payload); err != nil {
+		payload = string(e.Data)
+	}
+	return messaging.Event{
+		EventType: e.Type,
+		Payload:   payload,
+		Timestamp: e.RecordedAt.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,131 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+	"github.com/alex-necsoiu/event-driven/test/mocks"
+)
+
+func TestSubscriptionPoll(t *testing.T) {
+	tests := []struct {
+		name           string
+		checkpoint     int64
+		failSubject    string // publishing to this subject fails
+		wantForwarded  int
+		wantErr        bool
+		wantSubjects   []string
+		wantCheckpoint int64
+	}{
+		{
+			name:           "forwards every event under its prefixed type",
+			wantForwarded:  4,
+			wantSubjects:   []string{"log.a1", "log.a2", "log.b1", "log.a3"},
+			wantCheckpoint: 4,
+		},
+		{
+			name:           "resumes after the checkpoint",
+			checkpoint:     2,
+			wantForwarded:  2,
+			wantSubjects:   []string{"log.b1", "log.a3"},
+			wantCheckpoint: 4,
+		},
+		{
+			name:           "caught up",
+			checkpoint:     4,
+			wantSubjects:   []string{},
+			wantCheckpoint: 4,
+		},
+		{
+			name:           "publish failure keeps the checkpoint at the last forwarded event",
+			failSubject:    "log.b1",
+			wantForwarded:  2,
+			wantErr:        true,
+			wantSubjects:   []string{"log.a1", "log.a2"},
+			wantCheckpoint: 2,
+		},
+		{
+			name:           "failure on the first event leaves the checkpoint alone",
+			checkpoint:     2,
+			failSubject:    "log.b1",
+			wantErr:        true,
+			wantSubjects:   []string{},
+			wantCheckpoint: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bus := mocks.NewBus()
+			var subjects []string
+			for _, subject := range []string{"log.a1", "log.a2", "log.b1", "log.a3"} {
+				subject := subject
+				bus.Subscribe(subject, func(messaging.Event) { subjects = append(subjects, subject) })
+			}
+			if tt.failSubject != "" {
+				bus.Fail(tt.failSubject, errors.New("broker unavailable"))
+			}
+			checkpoints := NewMemoryCheckpoints()
+			checkpoints.Save(ctx, "relay", tt.checkpoint)
+
+			sub := NewSubscription("relay", seed(t), checkpoints, bus, "log.", log.New(io.Discard, "", 0))
+			forwarded, err := sub.Poll(ctx)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Poll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if forwarded != tt.wantForwarded {
+				t.Errorf("Poll() forwarded %d, want %d", forwarded, tt.wantForwarded)
+			}
+			if subjects == nil {
+				subjects = []string{}
+			}
+			if !reflect.DeepEqual(subjects, tt.wantSubjects) {
+				t.Errorf("published to %v, want %v", subjects, tt.wantSubjects)
+			}
+			if got, _ := checkpoints.Load(ctx, "relay"); got != tt.wantCheckpoint {
+				t.Errorf("checkpoint = %d, want %d", got, tt.wantCheckpoint)
+			}
+
+			// Once the broker recovers the rest is forwarded
+			bus.Fail(tt.failSubject, nil)
+			if _, err := sub.Poll(ctx); err != nil {
+				t.Fatalf("Poll() after recovery error = %v", err)
+			}
+			if got, _ := checkpoints.Load(ctx, "relay"); got != 4 {
+				t.Errorf("checkpoint after recovery = %d, want 4", got)
+			}
+		})
+	}
+}
+
+func TestSubscriptionPayload(t *testing.T) {
+	s := NewMemoryStore()
+	e, _ := NewEvent("OrderCreated", map[string]string{"order_id": "1"})
+	s.Append(context.Background(), "1", NoStream, e, EventData{Type: "Raw", Data: []byte("not json")})
+
+	bus := mocks.NewBus()
+	if _, err := NewSubscription("relay", s, NewMemoryCheckpoints(), bus, "", log.New(io.Discard, "", 0)).Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	published := bus.Published()
+	if len(published) != 2 {
+		t.Fatalf("published %d events, want 2", len(published))
+	}
+	if got := published[0].Payload; !reflect.DeepEqual(got, map[string]interface{}{"order_id": "1"}) {
+		t.Errorf("JSON payload = %#v", got)
+	}
+	if got := published[1].Payload; got != "not json" {
+		t.Errorf("raw payload = %#v, want the data as a string", got)
+	}
+	if published[0].EventType != "OrderCreated" || published[0].Timestamp == "" {
+		t.Errorf("event = %+v", published[0])
+	}
+}
@@ -0,0 +1,98 @@
+package grpcerr
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// retryDelay is the backoff suggested to clients for transient failures
+const retryDelay = time.Second
+
+// Rule maps a domain error, matched with errors.Is, to a gRPC code and the
+// machine-readable reason reported in its ErrorInfo detail
+type Rule struct {
+	Err    error
+	Code   codes.Code
+	Reason string
+}
+
+// Mapper converts the domain errors of one service into gRPC status errors
+type Mapper struct {
+	domain string
+	rules  []Rule
+}
+
+// NewMapper creates a Mapper for the errors of domain, e.g. "user.event-driven"
+func NewMapper(domain string, rules ...Rule) *Mapper {
+	return &Mapper{domain: domain, rules: rules}
+}
+
+// Status converts err to a gRPC status error:
+//   - errors matching a Rule get its code, with an ErrorInfo detail
+//   - errors that already carry a status, such as validation failures or
+//     failed calls to other services, keep it
+//   - context and connection failures become Canceled, DeadlineExceeded or
+//     Unavailable, with a RetryInfo detail when retrying may help
+//   - anything else becomes Internal, without leaking its message
+func (m *Mapper) Status(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	for _, rule := range m.rules {
+		if errors.Is(err, rule.Err) {
+			return m.withDetails(rule.Code, err.Error(), rule.Reason)
+		}
+	}
+
+	if st, ok := status.FromError(err); ok {
+		if st.Code() == codes.Unavailable {
+			return m.withDetails(codes.Unavailable, "upstream is unavailable", "UPSTREAM_UNAVAILABLE")
+		}
+		return st.Err()
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return m.withDetails(codes.DeadlineExceeded, err.Error(), "TIMEOUT")
+	case errors.Is(err, driver.ErrBadConn), errors.As(err, &netErr):
+		return m.withDetails(codes.Unavailable, "storage is unavailable", "STORAGE_UNAVAILABLE")
+	}
+	return m.withDetails(codes.Internal, "internal error", "INTERNAL")
+}
+
+// Retryable reports whether a call that failed with code may succeed if retried
+func Retryable(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.Aborted, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+func (m *Mapper) withDetails(code codes.Code, message, reason string) error {
+	st := status.New(code, message)
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: reason, Domain: m.domain}}
+	if Retryable(code) {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+	}
+
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
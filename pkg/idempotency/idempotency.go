@@ -0,0 +1,214 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// HeaderKey is the HTTP header clients use to make a POST request retry-safe
+	HeaderKey = "Idempotency-Key"
+	// MetadataKey carries the idempotency key from the gateway to gRPC services
+	MetadataKey = "idempotency-key"
+	// ScopeMetadataKey carries who sent the key, e.g. "user:42"; keys of
+	// different callers never share responses
+	ScopeMetadataKey = "idempotency-scope"
+	// ReplayedMetadataKey is set on the gRPC response header when a cached result is returned
+	ReplayedMetadataKey = "idempotency-replayed"
+
+	// MaxKeyLength bounds the size of client-supplied keys
+	MaxKeyLength = 255
+
+	// lockTimeout bounds how long an in-flight request holds its key, so a crashed
+	// replica doesn't block retries for the whole TTL
+	lockTimeout = time.Minute
+)
+
+var (
+	// ErrInProgress is returned when another request with the same key is still running
+	ErrInProgress = errors.New("a request with this idempotency key is already in progress")
+	// ErrKeyReused is returned when a key is replayed with a different request payload
+	ErrKeyReused = errors.New("idempotency key was already used with a different request")
+)
+
+// Record is a stored response for an idempotency key, scoped to its caller
+type Record struct {
+	Key      string
+	Method   string
+	Response []byte
+}
+
+// Store persists idempotency keys and the responses they produced
+type Store interface {
+	// Begin reserves key for method until lockUntil. It returns the stored record
+	// when the key already completed, or nil when the caller should execute the
+	// request. Keys are prefixed with the caller's scope, so callers choosing the
+	// same key don't collide.
+	Begin(ctx context.Context, method, key string, fingerprint []byte, lockUntil time.Time) (*Record, error)
+	// Complete stores the response for key and keeps it until expiresAt
+	Complete(ctx context.Context, method, key string, response []byte, expiresAt time.Time) error
+	// Release drops a pending reservation so the request can be retried
+	Release(ctx context.Context, method, key string) error
+}
+
+// inBandError is implemented by responses that carry an error string instead of a gRPC status
+type inBandError interface {
+	GetError() string
+}
+
+// UnaryServerInterceptor replays cached responses for requests carrying an idempotency key.
+// Only the listed full method names are covered; other calls pass through untouched.
+func UnaryServerInterceptor(store Store, ttl time.Duration, logger *log.Logger, methods ...string) grpc.UnaryServerInterceptor {
+	covered := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		covered[m] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !covered[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		clientKey := KeyFromIncomingContext(ctx)
+		if clientKey == "" {
+			return handler(ctx, req)
+		}
+		if len(clientKey) > MaxKeyLength {
+			return nil, status.Errorf(codes.InvalidArgument, "idempotency key exceeds %d characters", MaxKeyLength)
+		}
+		key := scopeFromIncomingContext(ctx) + "/" + clientKey
+
+		fingerprint, err := fingerprint(req)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to fingerprint request: %v", err)
+		}
+
+		record, err := store.Begin(ctx, info.FullMethod, key, fingerprint, time.Now().Add(lockTimeout))
+		switch {
+		case errors.Is(err, ErrInProgress):
+			return nil, status.Error(codes.Aborted, err.Error())
+		case errors.Is(err, ErrKeyReused):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case err != nil:
+			return nil, status.Errorf(codes.Unavailable, "failed to check idempotency key: %v", err)
+		}
+
+		if record != nil {
+			logger.Printf("Replaying cached response for %s (idempotency key %s)", info.FullMethod, key)
+			return replay(ctx, record)
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil || failedInBand(resp) {
+			// Failed attempts are not cached so the client can retry them
+			if relErr := store.Release(ctx, info.FullMethod, key); relErr != nil {
+				logger.Printf("Failed to release idempotency key %s: %v", key, relErr)
+			}
+			return resp, err
+		}
+
+		if err := complete(ctx, store, info.FullMethod, key, resp, ttl); err != nil {
+			logger.Printf("Failed to store response for idempotency key %s: %v", key, err)
+		}
+		return resp, nil
+	}
+}
+
+// KeyFromIncomingContext returns the idempotency key sent by the caller, if any
+func KeyFromIncomingContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(MetadataKey); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// scopeFromIncomingContext returns the scope the caller sent with its key,
+// or the caller's network address for callers that don't send one
+func scopeFromIncomingContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(ScopeMetadataKey); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "peer:" + host
+	}
+	return "anonymous"
+}
+
+// NewOutgoingContext attaches an idempotency key and the scope of the caller
+// it belongs to, e.g. "user:42", to an outgoing gRPC call
+func NewOutgoingContext(ctx context.Context, key, scope string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, MetadataKey, key, ScopeMetadataKey, scope)
+}
+
+// fingerprint hashes the request so a key can't be reused for a different payload
+func fingerprint(req interface{}) ([]byte, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, errors.New("request is not a protobuf message")
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+func failedInBand(resp interface{}) bool {
+	r, ok := resp.(inBandError)
+	return ok && r.GetError() != ""
+}
+
+func complete(ctx context.Context, store Store, method, key string, resp interface{}, ttl time.Duration) error {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return errors.New("response is not a protobuf message")
+	}
+	wrapped, err := anypb.New(msg)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(wrapped)
+	if err != nil {
+		return err
+	}
+	return store.Complete(ctx, method, key, data, time.Now().Add(ttl))
+}
+
+func replay(ctx context.Context, record *Record) (interface{}, error) {
+	var wrapped anypb.Any
+	if err := proto.Unmarshal(record.Response, &wrapped); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode cached response: %v", err)
+	}
+	resp, err := wrapped.UnmarshalNew()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode cached response: %v", err)
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(ReplayedMetadataKey, "true"))
+	return resp, nil
+}
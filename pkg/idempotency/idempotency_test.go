@@ -0,0 +1,239 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/api/proto/gen"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testMethod = "/proto.UserService/CreateUser"
+
+// memoryStore is an in-memory Store
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]*memoryRecord
+}
+
+type memoryRecord struct {
+	fingerprint []byte
+	completed   bool
+	response    []byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: make(map[string]*memoryRecord)}
+}
+
+func (s *memoryStore) Begin(ctx context.Context, method, key string, fingerprint []byte, lockUntil time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[method+" "+key]
+	if !ok {
+		s.records[method+" "+key] = &memoryRecord{fingerprint: fingerprint}
+		return nil, nil
+	}
+	if !bytes.Equal(r.fingerprint, fingerprint) {
+		return nil, ErrKeyReused
+	}
+	if !r.completed {
+		return nil, ErrInProgress
+	}
+	return &Record{Key: key, Method: method, Response: r.response}, nil
+}
+
+func (s *memoryStore) Complete(ctx context.Context, method, key string, response []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.records[method+" "+key]
+	r.completed = true
+	r.response = response
+	return nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, method, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.records[method+" "+key]; ok && !r.completed {
+		delete(s.records, method+" "+key)
+	}
+	return nil
+}
+
+// call is one request through the interceptor
+type call struct {
+	method  string
+	key     string
+	scope   string
+	req     string
+	handler func(n int) (interface{}, error) // n counts handler executions, from 1
+	code    codes.Code
+	resp    string // expected StringValue response, if any
+	ran     bool   // whether the handler must run
+}
+
+func ok(n int) (interface{}, error) {
+	return wrapperspb.String("response " + strings.Repeat("I", n)), nil
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "uncovered method passes through",
+			calls: []call{
+				{method: "/proto.UserService/GetUser", key: "k", req: "a", handler: ok, resp: "response I", ran: true},
+				{method: "/proto.UserService/GetUser", key: "k", req: "a", handler: ok, resp: "response II", ran: true},
+			},
+		},
+		{
+			name: "requests without a key aren't cached",
+			calls: []call{
+				{req: "a", handler: ok, resp: "response I", ran: true},
+				{req: "a", handler: ok, resp: "response II", ran: true},
+			},
+		},
+		{
+			name: "retry replays the first response",
+			calls: []call{
+				{key: "k", scope: "user:1", req: "a", handler: ok, resp: "response I", ran: true},
+				{key: "k", scope: "user:1", req: "a", handler: ok, resp: "response I"},
+			},
+		},
+		{
+			name: "same key from another caller runs again",
+			calls: []call{
+				{key: "k", scope: "user:1", req: "a", handler: ok, resp: "response I", ran: true},
+				{key: "k", scope: "user:2", req: "a", handler: ok, resp: "response II", ran: true},
+			},
+		},
+		{
+			name: "reused key with another payload is refused",
+			calls: []call{
+				{key: "k", scope: "user:1", req: "a", handler: ok, resp: "response I", ran: true},
+				{key: "k", scope: "user:1", req: "b", handler: ok, code: codes.FailedPrecondition},
+			},
+		},
+		{
+			name: "failed attempts can be retried",
+			calls: []call{
+				{key: "k", scope: "user:1", req: "a", handler: func(int) (interface{}, error) {
+					return nil, status.Error(codes.Unavailable, "down")
+				}, code: codes.Unavailable, ran: true},
+				{key: "k", scope: "user:1", req: "a", handler: ok, resp: "response II", ran: true},
+			},
+		},
+		{
+			name: "in-band errors aren't cached",
+			calls: []call{
+				{key: "k", scope: "user:1", req: "a", handler: func(int) (interface{}, error) {
+					return &gen.StockResponse{Error: "out of stock"}, nil
+				}, ran: true},
+				{key: "k", scope: "user:1", req: "a", handler: ok, resp: "response II", ran: true},
+			},
+		},
+		{
+			name: "overlong key is rejected",
+			calls: []call{
+				{key: strings.Repeat("k", MaxKeyLength+1), req: "a", handler: ok, code: codes.InvalidArgument},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := UnaryServerInterceptor(newMemoryStore(), time.Hour, log.New(io.Discard, "", 0), testMethod)
+
+			executions := 0
+			for i, c := range tt.calls {
+				method := c.method
+				if method == "" {
+					method = testMethod
+				}
+				ctx := context.Background()
+				if c.key != "" {
+					ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(MetadataKey, c.key, ScopeMetadataKey, c.scope))
+				}
+
+				ran := false
+				resp, err := interceptor(ctx, wrapperspb.String(c.req), &grpc.UnaryServerInfo{FullMethod: method},
+					func(ctx context.Context, req interface{}) (interface{}, error) {
+						ran = true
+						executions++
+						return c.handler(executions)
+					})
+
+				if got := status.Code(err); got != c.code {
+					t.Fatalf("call %d: got code %s, want %s (%v)", i, got, c.code, err)
+				}
+				if ran != c.ran {
+					t.Errorf("call %d: handler ran = %v, want %v", i, ran, c.ran)
+				}
+				if c.resp != "" {
+					if got, ok := resp.(*wrapperspb.StringValue); !ok || got.GetValue() != c.resp {
+						t.Errorf("call %d: got response %v, want %q", i, resp, c.resp)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptorInProgress(t *testing.T) {
+	store := newMemoryStore()
+	interceptor := UnaryServerInterceptor(store, time.Hour, log.New(io.Discard, "", 0), testMethod)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "k", ScopeMetadataKey, "user:1"))
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+
+	_, err := interceptor(ctx, wrapperspb.String("a"), info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		// A retry arriving while the first attempt runs
+		_, err := interceptor(ctx, wrapperspb.String("a"), info, func(context.Context, interface{}) (interface{}, error) {
+			return nil, errors.New("must not run")
+		})
+		if status.Code(err) != codes.Aborted {
+			t.Errorf("got %v for a concurrent retry, want Aborted", err)
+		}
+		return wrapperspb.String("done"), nil
+	})
+	if err != nil {
+		t.Fatalf("first attempt failed: %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a, err := fingerprint(wrapperspb.String("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := fingerprint(proto.Clone(wrapperspb.String("a")))
+	b, _ := fingerprint(wrapperspb.String("b"))
+
+	if !bytes.Equal(a, again) {
+		t.Error("equal requests have different fingerprints")
+	}
+	if bytes.Equal(a, b) {
+		t.Error("different requests share a fingerprint")
+	}
+	if _, err := fingerprint("not a message"); err == nil {
+		t.Error("expected an error for a non-protobuf request")
+	}
+}
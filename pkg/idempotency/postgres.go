@@ -0,0 +1,122 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresStore implements Store using PostgreSQL
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a new PostgresStore. The idempotency_keys table
+// is created by the owning service's migrations.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Begin reserves the key, taking over rows whose previous holder expired
+func (s *PostgresStore) Begin(ctx context.Context, method, key string, fingerprint []byte, lockUntil time.Time) (*Record, error) {
+	var claimed string
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (method, key, fingerprint, status, expires_at)
+		VALUES ($1, $2, $3, 'pending', $4)
+		ON CONFLICT (method, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint,
+			status = 'pending',
+			response = NULL,
+			created_at = now(),
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < now()
+		RETURNING key`,
+		method, key, fingerprint, lockUntil,
+	).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// The key is held by a live record: either replay it or report the conflict
+	var (
+		stored   []byte
+		state    string
+		response []byte
+	)
+	err = s.db.QueryRowContext(ctx,
+		"SELECT fingerprint, status, response FROM idempotency_keys WHERE method = $1 AND key = $2",
+		method, key,
+	).Scan(&stored, &state, &response)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between the two statements; the client can simply retry
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(stored, fingerprint) {
+		return nil, ErrKeyReused
+	}
+	if state != "completed" {
+		return nil, ErrInProgress
+	}
+
+	return &Record{Key: key, Method: method, Response: response}, nil
+}
+
+// Complete stores the response and extends the record to its full TTL
+func (s *PostgresStore) Complete(ctx context.Context, method, key string, response []byte, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE idempotency_keys SET status = 'completed', response = $1, expires_at = $2 WHERE method = $3 AND key = $4",
+		response, expiresAt, method, key,
+	)
+	return err
+}
+
+// Release deletes a pending reservation
+func (s *PostgresStore) Release(ctx context.Context, method, key string) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM idempotency_keys WHERE method = $1 AND key = $2 AND status = 'pending'",
+		method, key,
+	)
+	return err
+}
+
+// PurgeExpired deletes records past their expiry and returns how many were removed
+func (s *PostgresStore) PurgeExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < now()")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunPurging removes expired records every interval until ctx is cancelled
+func (s *PostgresStore) RunPurging(ctx context.Context, interval time.Duration, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PurgeExpired(ctx)
+			if err != nil {
+				logger.Printf("Failed to purge idempotency keys: %v", err)
+				continue
+			}
+			if n > 0 {
+				logger.Printf("Purged %d expired idempotency keys", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Manager runs a service's long-lived tasks until a termination signal (or a task failure)
+// and then executes shutdown hooks in registration order within a single deadline.
+//
+// Register hooks in the order resources should be released, e.g.:
+// servers (drain requests) → subscribers → Tasks (background loops) → publisher
+// (flush events) → DB pools.
+type Manager struct {
+	logger  *log.Logger
+	timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	hooks []hook
+
+	tasks sync.WaitGroup
+
+	failed chan error
+}
+
+type hook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// New creates a Manager whose shutdown hooks must finish within timeout
+func New(logger *log.Logger, timeout time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		logger:  logger,
+		timeout: timeout,
+		ctx:     ctx,
+		cancel:  cancel,
+		failed:  make(chan error, 1),
+	}
+}
+
+// Context is cancelled as soon as shutdown begins; background loops started with
+// Go should return once it is done
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Go runs a blocking task such as a server's Serve loop or a background loop. A task
+// returning an error triggers shutdown of the whole service.
+func (m *Manager) Go(name string, fn func() error) {
+	m.tasks.Add(1)
+	go func() {
+		defer m.tasks.Done()
+		if err := fn(); err != nil {
+			select {
+			case m.failed <- fmt.Errorf("%s: %w", name, err):
+			default:
+			}
+		}
+	}()
+}
+
+// OnShutdown registers a hook to run during shutdown, after previously registered hooks
+func (m *Manager) OnShutdown(name string, fn func(context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// Wait blocks until SIGINT/SIGTERM or a task failure, then runs the shutdown hooks.
+// It returns the task failure, if any, joined with hook errors.
+func (m *Manager) Wait() error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	var cause error
+	select {
+	case sig := <-sigChan:
+		m.logger.Printf("Received %s, shutting down", sig)
+	case cause = <-m.failed:
+		m.logger.Printf("Shutting down after failure: %v", cause)
+	}
+
+	return errors.Join(cause, m.Shutdown())
+}
+
+// Shutdown cancels the manager context and runs every hook in order. Hooks share
+// one deadline; a hook that overruns it is expected to abort what it is doing.
+func (m *Manager) Shutdown() error {
+	m.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	m.mu.Lock()
+	hooks := m.hooks
+	m.hooks = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for _, h := range hooks {
+		start := time.Now()
+		if err := h.fn(ctx); err != nil {
+			m.logger.Printf("Shutdown step %q failed: %v", h.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		m.logger.Printf("Shutdown step %q completed in %s", h.name, time.Since(start).Round(time.Millisecond))
+	}
+	return errors.Join(errs...)
+}
+
+// Tasks is a shutdown hook waiting for every task started with Go to return. Register
+// it after the hooks stopping servers and before those closing what the tasks use.
+func (m *Manager) Tasks(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.tasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("tasks still running: %w", ctx.Err())
+	}
+}
+
+// GRPCServer gracefully stops srv, forcing it closed if ctx expires first
+func GRPCServer(srv *grpc.Server) func(context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			srv.Stop()
+			return fmt.Errorf("forced stop: %w", ctx.Err())
+		}
+	}
+}
+
+// HTTPServer drains srv, closing remaining connections if ctx expires first
+func HTTPServer(srv *http.Server) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+			return fmt.Errorf("forced close: %w", err)
+		}
+		return nil
+	}
+}
+
+// Closer adapts an io.Closer to a shutdown hook
+func Closer(c io.Closer) func(context.Context) error {
+	return func(context.Context) error {
+		return c.Close()
+	}
+}
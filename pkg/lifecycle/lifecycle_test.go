@@ -0,0 +1,161 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keeps the order in which shutdown steps and tasks finished
+type recorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recorder) add(step string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+func (r *recorder) hook(step string, err error) func(context.Context) error {
+	return func(context.Context) error {
+		r.add(step)
+		return err
+	}
+}
+
+func newTestManager(timeout time.Duration) *Manager {
+	return New(log.New(io.Discard, "", 0), timeout)
+}
+
+func TestManagerShutdownOrder(t *testing.T) {
+	errClose := errors.New("close failed")
+
+	tests := []struct {
+		name      string
+		setup     func(m *Manager, r *recorder)
+		wantSteps []string
+		wantErr   error
+	}{
+		{
+			name: "hooks run in registration order",
+			setup: func(m *Manager, r *recorder) {
+				m.OnShutdown("server", r.hook("server", nil))
+				m.OnShutdown("publisher", r.hook("publisher", nil))
+				m.OnShutdown("database", r.hook("database", nil))
+			},
+			wantSteps: []string{"server", "publisher", "database"},
+		},
+		{
+			name: "failing hook does not stop later ones",
+			setup: func(m *Manager, r *recorder) {
+				m.OnShutdown("publisher", r.hook("publisher", errClose))
+				m.OnShutdown("database", r.hook("database", nil))
+			},
+			wantSteps: []string{"publisher", "database"},
+			wantErr:   errClose,
+		},
+		{
+			name: "background loops return before resources close",
+			setup: func(m *Manager, r *recorder) {
+				for _, name := range []string{"purge", "retries"} {
+					m.Go(name, func() error {
+						<-m.Context().Done()
+						time.Sleep(20 * time.Millisecond)
+						r.add("loop")
+						return nil
+					})
+				}
+				m.OnShutdown("background tasks", m.Tasks)
+				m.OnShutdown("database", r.hook("database", nil))
+			},
+			wantSteps: []string{"loop", "loop", "database"},
+		},
+		{
+			name: "server task returns once its hook stops it",
+			setup: func(m *Manager, r *recorder) {
+				stopped := make(chan struct{})
+				m.Go("server", func() error {
+					<-stopped
+					r.add("serve returned")
+					return nil
+				})
+				m.OnShutdown("server", func(context.Context) error {
+					r.add("server")
+					close(stopped)
+					return nil
+				})
+				m.OnShutdown("background tasks", m.Tasks)
+				m.OnShutdown("database", r.hook("database", nil))
+			},
+			wantSteps: []string{"server", "serve returned", "database"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(time.Second)
+			r := &recorder{}
+			tt.setup(m, r)
+
+			err := m.Shutdown()
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Shutdown() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(r.steps, tt.wantSteps) {
+				t.Errorf("steps = %v, want %v", r.steps, tt.wantSteps)
+			}
+		})
+	}
+}
+
+func TestManagerTasksDeadline(t *testing.T) {
+	m := newTestManager(50 * time.Millisecond)
+	r := &recorder{}
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	m.Go("stuck loop", func() error {
+		<-stuck
+		return nil
+	})
+	m.OnShutdown("background tasks", m.Tasks)
+	m.OnShutdown("database", r.hook("database", nil))
+
+	err := m.Shutdown()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !reflect.DeepEqual(r.steps, []string{"database"}) {
+		t.Errorf("steps = %v, want the database still closed", r.steps)
+	}
+}
+
+func TestManagerWaitOnTaskFailure(t *testing.T) {
+	errServe := errors.New("listener closed")
+
+	m := newTestManager(time.Second)
+	r := &recorder{}
+	m.OnShutdown("database", r.hook("database", nil))
+	m.Go("grpc server", func() error {
+		return errServe
+	})
+
+	err := m.Wait()
+	if !errors.Is(err, errServe) {
+		t.Fatalf("Wait() error = %v, want %v", err, errServe)
+	}
+	if m.Context().Err() == nil {
+		t.Error("Context() not cancelled after Wait")
+	}
+	if !reflect.DeepEqual(r.steps, []string{"database"}) {
+		t.Errorf("steps = %v, want [database]", r.steps)
+	}
+}
@@ -2,6 +2,8 @@ package messaging
 
 import (
 	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/money"
 )
 
 // EventType constants for all system events
@@ -11,11 +13,40 @@ const (
 	EventTypeUserUpdated = "UserUpdated"
 	EventTypeUserDeleted = "UserDeleted"
 
+	// Email verification events
+	EventTypeEmailVerificationRequested = "EmailVerificationRequested"
+	EventTypeUserEmailVerified          = "UserEmailVerified"
+
+	// Authentication events
+	EventTypeUserLoggedIn           = "UserLoggedIn"
+	EventTypePasswordChanged        = "PasswordChanged"
+	EventTypePasswordResetRequested = "PasswordResetRequested"
+
 	// Order events
 	EventTypeOrderCreated   = "OrderCreated"
 	EventTypeOrderUpdated   = "OrderUpdated"
 	EventTypeOrderCancelled = "OrderCancelled"
 	EventTypeOrderCompleted = "OrderCompleted"
+	EventTypeOrderConfirmed = "OrderConfirmed"
+	EventTypeOrderPaid      = "OrderPaid"
+	EventTypeOrderShipped   = "OrderShipped"
+	EventTypeOrderRefunded  = "OrderRefunded"
+
+	// Order fulfillment saga commands and replies
+	EventTypeStockReservationRequested     = "StockReservationRequested"
+	EventTypeStockReserved                 = "StockReserved"
+	EventTypeStockInsufficient             = "StockInsufficient"
+	EventTypeStockReleaseRequested         = "StockReleaseRequested"
+	EventTypePaymentAuthorizationRequested = "PaymentAuthorizationRequested"
+	EventTypePaymentAuthorized             = "PaymentAuthorized"
+	EventTypePaymentFailed                 = "PaymentFailed"
+	EventTypePaymentVoidRequested          = "PaymentVoidRequested"
+	EventTypeShipmentRequested             = "ShipmentRequested"
+	EventTypeShipmentScheduled             = "ShipmentScheduled"
+	EventTypeShipmentFailed                = "ShipmentFailed"
+
+	// Payment events
+	EventTypeRefundIssued = "RefundIssued"
 
 	// Notification events
 	EventTypeNotificationSent   = "NotificationSent"
@@ -30,34 +61,137 @@ type UserCreatedPayload struct {
 	CreatedAt string `json:"created_at"`
 }
 
+// UserUpdatedPayload reports a changed profile; EmailVerified is false after
+// the email changes until the new address is verified
 type UserUpdatedPayload struct {
+	UserID        string `json:"user_id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+type UserDeletedPayload struct {
+	UserID    string `json:"user_id"`
+	DeletedAt string `json:"deleted_at"`
+}
+
+// EmailVerificationRequestedPayload carries the signed verification token to
+// deliver to the user's email
+type EmailVerificationRequestedPayload struct {
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type UserEmailVerifiedPayload struct {
+	UserID     string `json:"user_id"`
+	Email      string `json:"email"`
+	VerifiedAt string `json:"verified_at"`
+}
+
+type UserLoggedInPayload struct {
+	UserID     string `json:"user_id"`
+	LoggedInAt string `json:"logged_in_at"`
+}
+
+// PasswordChangedPayload reports a new password; Method is "change" when the
+// user knew the old password and "reset" when it was set with a reset token
+type PasswordChangedPayload struct {
+	UserID    string `json:"user_id"`
+	Method    string `json:"method"`
+	ChangedAt string `json:"changed_at"`
+}
+
+// PasswordResetRequestedPayload carries the single-use reset token to deliver
+// to the user's email
+type PasswordResetRequestedPayload struct {
 	UserID    string `json:"user_id"`
-	Name      string `json:"name"`
 	Email     string `json:"email"`
-	UpdatedAt string `json:"updated_at"`
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expires_at"`
 }
 
 type OrderCreatedPayload struct {
-	OrderID   string  `json:"order_id"`
-	UserID    string  `json:"user_id"`
-	Amount    float64 `json:"amount"`
-	Status    string  `json:"status"`
-	CreatedAt string  `json:"created_at"`
+	OrderID   string             `json:"order_id"`
+	UserID    string             `json:"user_id"`
+	Items     []OrderItemPayload `json:"items"`
+	Subtotal  money.Money        `json:"subtotal"`
+	Tax       money.Money        `json:"tax"`
+	Amount    money.Money        `json:"amount"` // grand total including tax
+	Status    string             `json:"status"`
+	CreatedAt string             `json:"created_at"`
+}
+
+// OrderItemPayload is one priced line of an order
+type OrderItemPayload struct {
+	SKU        string      `json:"sku"`
+	Name       string      `json:"name"`
+	Quantity   int64       `json:"quantity"`
+	UnitPrice  money.Money `json:"unit_price"`
+	TaxRateBps int64       `json:"tax_rate_bps"`
+	Tax        money.Money `json:"tax"`
+	Total      money.Money `json:"total"`
 }
 
 type OrderUpdatedPayload struct {
-	OrderID   string  `json:"order_id"`
-	UserID    string  `json:"user_id"`
-	Amount    float64 `json:"amount"`
-	Status    string  `json:"status"`
-	UpdatedAt string  `json:"updated_at"`
+	OrderID   string      `json:"order_id"`
+	UserID    string      `json:"user_id"`
+	Amount    money.Money `json:"amount"`
+	Status    string      `json:"status"`
+	UpdatedAt string      `json:"updated_at"`
+}
+
+// OrderStatusChangedPayload is shared by the per-transition order events
+// (OrderConfirmed, OrderPaid, OrderShipped, OrderCompleted, OrderCancelled, OrderRefunded)
+type OrderStatusChangedPayload struct {
+	OrderID    string `json:"order_id"`
+	UserID     string `json:"user_id"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Actor      string `json:"actor"`
+	Reason     string `json:"reason,omitempty"`
+	ChangedAt  string `json:"changed_at"`
 }
 
+// FulfillmentPayload is shared by the commands and replies of the order fulfillment saga.
+// Replies must echo saga_id; Reference identifies the reservation, authorization or
+// shipment created by the replying service and Reason explains a failure.
+type FulfillmentPayload struct {
+	SagaID    string             `json:"saga_id"`
+	OrderID   string             `json:"order_id"`
+	UserID    string             `json:"user_id,omitempty"`
+	Items     []OrderItemPayload `json:"items,omitempty"`
+	Amount    money.Money        `json:"amount"`
+	Reference string             `json:"reference,omitempty"`
+	Reason    string             `json:"reason,omitempty"`
+}
+
+type RefundIssuedPayload struct {
+	PaymentID     string      `json:"payment_id"`
+	OrderID       string      `json:"order_id"`
+	UserID        string      `json:"user_id"`
+	Amount        money.Money `json:"amount"`
+	Reference     string      `json:"reference"`
+	Reason        string      `json:"reason,omitempty"`
+	FullyRefunded bool        `json:"fully_refunded"`
+	IssuedAt      string      `json:"issued_at"`
+}
+
+// NotificationPayload reports the outcome of delivering a notification over
+// one channel. Message is the subject only: bodies may carry secret links.
 type NotificationPayload struct {
-	UserID  string `json:"user_id"`
-	Type    string `json:"type"`
-	Message string `json:"message"`
-	SentAt  string `json:"sent_at"`
+	DeliveryID  string `json:"delivery_id"`
+	UserID      string `json:"user_id"`
+	Type        string `json:"type"`
+	Channel     string `json:"channel"`
+	Message     string `json:"message"`
+	Attempts    int    `json:"attempts"`
+	ProviderRef string `json:"provider_ref,omitempty"` // e.g. the email's Message-ID
+	Error       string `json:"error,omitempty"`        // why the last attempt failed
+	SentAt      string `json:"sent_at,omitempty"`
+	FailedAt    string `json:"failed_at,omitempty"`
 }
 
 // Helper functions to create events
@@ -74,12 +208,101 @@ func NewUserCreatedEvent(userID, name, email string) Event {
 	}
 }
 
-func NewOrderCreatedEvent(orderID, userID string, amount float64) Event {
+func NewUserUpdatedEvent(userID, name, email string, emailVerified bool) Event {
+	return Event{
+		EventType: EventTypeUserUpdated,
+		Payload: UserUpdatedPayload{
+			UserID:        userID,
+			Name:          name,
+			Email:         email,
+			EmailVerified: emailVerified,
+			UpdatedAt:     time.Now().UTC().Format(time.RFC3339),
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewUserDeletedEvent(userID string) Event {
+	return Event{
+		EventType: EventTypeUserDeleted,
+		Payload: UserDeletedPayload{
+			UserID:    userID,
+			DeletedAt: time.Now().UTC().Format(time.RFC3339),
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewEmailVerificationRequestedEvent(userID, email, token string, expiresAt time.Time) Event {
+	return Event{
+		EventType: EventTypeEmailVerificationRequested,
+		Payload: EmailVerificationRequestedPayload{
+			UserID:    userID,
+			Email:     email,
+			Token:     token,
+			ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewUserEmailVerifiedEvent(userID, email string, verifiedAt time.Time) Event {
+	return Event{
+		EventType: EventTypeUserEmailVerified,
+		Payload: UserEmailVerifiedPayload{
+			UserID:     userID,
+			Email:      email,
+			VerifiedAt: verifiedAt.UTC().Format(time.RFC3339),
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewUserLoggedInEvent(userID string) Event {
+	return Event{
+		EventType: EventTypeUserLoggedIn,
+		Payload: UserLoggedInPayload{
+			UserID:     userID,
+			LoggedInAt: time.Now().UTC().Format(time.RFC3339),
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewPasswordChangedEvent(userID, method string) Event {
+	return Event{
+		EventType: EventTypePasswordChanged,
+		Payload: PasswordChangedPayload{
+			UserID:    userID,
+			Method:    method,
+			ChangedAt: time.Now().UTC().Format(time.RFC3339),
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewPasswordResetRequestedEvent(userID, email, token string, expiresAt time.Time) Event {
+	return Event{
+		EventType: EventTypePasswordResetRequested,
+		Payload: PasswordResetRequestedPayload{
+			UserID:    userID,
+			Email:     email,
+			Token:     token,
+			ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewOrderCreatedEvent(orderID, userID string, items []OrderItemPayload, subtotal, tax, amount money.Money) Event {
 	return Event{
 		EventType: EventTypeOrderCreated,
 		Payload: OrderCreatedPayload{
 			OrderID:   orderID,
 			UserID:    userID,
+			Items:     items,
+			Subtotal:  subtotal,
+			Tax:       tax,
 			Amount:    amount,
 			Status:    "pending",
 			CreatedAt: time.Now().UTC().Format(time.RFC3339),
@@ -88,14 +311,68 @@ func NewOrderCreatedEvent(orderID, userID string, amount float64) Event {
 	}
 }
 
-func NewNotificationEvent(userID, notificationType, message string) Event {
+func NewOrderStatusChangedEvent(eventType, orderID, userID, fromStatus, toStatus, actor, reason string, changedAt time.Time) Event {
+	return Event{
+		EventType: eventType,
+		Payload: OrderStatusChangedPayload{
+			OrderID:    orderID,
+			UserID:     userID,
+			FromStatus: fromStatus,
+			ToStatus:   toStatus,
+			Actor:      actor,
+			Reason:     reason,
+			ChangedAt:  changedAt.UTC().Format(time.RFC3339),
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewFulfillmentEvent(eventType string, payload FulfillmentPayload) Event {
+	return Event{
+		EventType: eventType,
+		Payload:   payload,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewRefundIssuedEvent(payload RefundIssuedPayload) Event {
+	payload.IssuedAt = time.Now().UTC().Format(time.RFC3339)
+	return Event{
+		EventType: EventTypeRefundIssued,
+		Payload:   payload,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewNotificationEvent(deliveryID, userID, notificationType, channel, message string, attempts int, providerRef string) Event {
 	return Event{
 		EventType: EventTypeNotificationSent,
 		Payload: NotificationPayload{
-			UserID:  userID,
-			Type:    notificationType,
-			Message: message,
-			SentAt:  time.Now().UTC().Format(time.RFC3339),
+			DeliveryID:  deliveryID,
+			UserID:      userID,
+			Type:        notificationType,
+			Channel:     channel,
+			Message:     message,
+			Attempts:    attempts,
+			ProviderRef: providerRef,
+			SentAt:      time.Now().UTC().Format(time.RFC3339),
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func NewNotificationFailedEvent(deliveryID, userID, notificationType, channel, message string, attempts int, reason string) Event {
+	return Event{
+		EventType: EventTypeNotificationFailed,
+		Payload: NotificationPayload{
+			DeliveryID: deliveryID,
+			UserID:     userID,
+			Type:       notificationType,
+			Channel:    channel,
+			Message:    message,
+			Attempts:   attempts,
+			Error:      reason,
+			FailedAt:   time.Now().UTC().Format(time.RFC3339),
 		},
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
@@ -1,5 +1,11 @@
 package messaging
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
 // Event represents a standard event envelope (matches event.proto)
 type Event struct {
 	EventType string      `json:"event_type"`
@@ -7,15 +13,33 @@ type Event struct {
 	Timestamp string      `json:"timestamp"`
 }
 
+// DecodePayload converts an event payload, as decoded from the bus, into the given struct
+func DecodePayload(payload interface{}, target interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	return nil
+}
+
 // Publisher publishes events to the event bus
 type Publisher interface {
 	Publish(subject string, event Event) error
+	// Flush blocks until buffered events have been handed to the broker
+	Flush(ctx context.Context) error
 	Close() error
 }
 
 // Subscriber subscribes to events from the event bus
 type Subscriber interface {
 	Subscribe(subject string, handler func(Event)) error
+	// Drain stops receiving new events and waits for in-flight handlers to finish
+	Drain(ctx context.Context) error
 	Close() error
 }
 
@@ -1,6 +1,7 @@
 package messaging
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -49,6 +50,16 @@ func (p *NATSPublisher) Publish(subject string, event Event) error {
 	return nil
 }
 
+func (p *NATSPublisher) Flush(ctx context.Context) error {
+	if p.conn == nil || p.conn.IsClosed() {
+		return nil
+	}
+	if err := p.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to flush events: %w", err)
+	}
+	return nil
+}
+
 func (p *NATSPublisher) Close() error {
 	if p.conn != nil {
 		p.conn.Close()
@@ -107,6 +118,36 @@ func (s *NATSSubscriber) Subscribe(subject string, handler func(Event)) error {
 	return nil
 }
 
+func (s *NATSSubscriber) Drain(ctx context.Context) error {
+	for _, sub := range s.subs {
+		if err := sub.Drain(); err != nil {
+			return fmt.Errorf("failed to drain subscription %s: %w", sub.Subject, err)
+		}
+	}
+
+	// A drained subscription becomes invalid once its pending messages are handled
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		pending := false
+		for _, sub := range s.subs {
+			if sub.IsValid() {
+				pending = true
+				break
+			}
+		}
+		if !pending {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("drain interrupted: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
 func (s *NATSSubscriber) Close() error {
 	for _, sub := range s.subs {
 		sub.Unsubscribe()
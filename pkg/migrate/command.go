@@ -0,0 +1,58 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ErrUsage is returned by RunCommand for malformed arguments
+var ErrUsage = errors.New("usage: migrate [up | down [steps] | status]")
+
+// RunCommand implements the `migrate` subcommand shared by service binaries:
+//
+//	migrate up            apply all pending migrations (default)
+//	migrate down [steps]  revert the latest steps migrations (default 1)
+//	migrate status        list migrations and when they were applied
+func RunCommand(ctx context.Context, m *Migrator, args []string, out io.Writer) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		return m.Up(ctx)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return ErrUsage
+			}
+			steps = n
+		}
+		return m.Down(ctx, steps)
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d  %-40s  %s\n", st.Version, st.Name, applied)
+		}
+		return nil
+
+	default:
+		return ErrUsage
+	}
+}
@@ -0,0 +1,65 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		applied     []int // versions applied beforehand
+		wantErr     error
+		wantApplied []int
+		wantOutput  string
+	}{
+		{name: "up by default", wantApplied: []int{1, 2, 3}},
+		{name: "up", args: []string{"up"}, applied: []int{1}, wantApplied: []int{1, 2, 3}},
+		{name: "down one step by default", args: []string{"down"}, applied: []int{1, 2}, wantApplied: []int{1}},
+		{name: "down several steps", args: []string{"down", "2"}, applied: []int{1, 2}, wantApplied: []int{}},
+		{name: "down with a malformed count", args: []string{"down", "all"}, applied: []int{1, 2}, wantErr: ErrUsage, wantApplied: []int{1, 2}},
+		{name: "down zero steps", args: []string{"down", "0"}, applied: []int{1, 2}, wantErr: ErrUsage, wantApplied: []int{1, 2}},
+		{
+			name:        "status",
+			args:        []string{"status"},
+			applied:     []int{1},
+			wantApplied: []int{1},
+			wantOutput: "0001  create_users                              2025-03-14T15:09:26Z\n" +
+				"0002  add_email                                 pending\n" +
+				"0003  backfill_names                            pending\n",
+		},
+		{name: "unknown action", args: []string{"redo"}, wantErr: ErrUsage, wantApplied: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB()
+			migrations, _ := Load(testMigrations)
+			for _, v := range tt.applied {
+				db.applied[v] = migrations[v-1].Name
+			}
+			m, err := New(db.open(), "user", testMigrations, log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			err = RunCommand(context.Background(), m, tt.args, &out)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RunCommand(%q) error = %v, want %v", tt.args, err, tt.wantErr)
+			}
+			if got := db.versions(); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Errorf("applied = %v, want %v", got, tt.wantApplied)
+			}
+			if out.String() != tt.wantOutput {
+				t.Errorf("output = %q, want %q", out.String(), tt.wantOutput)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeDB is a database that understands just the statements a Migrator
+// issues. Migration scripts are recorded rather than run; a script containing
+// failOn fails, and transactions apply their changes only on commit.
+type fakeDB struct {
+	mu       sync.Mutex
+	applied  map[int]string // version → name
+	at       time.Time
+	scripts  []string // committed scripts, in order
+	failOn   string
+	locks    int // advisory locks held
+	maxLocks int
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{applied: make(map[int]string), at: time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)}
+}
+
+func (db *fakeDB) open() *sql.DB {
+	return sql.OpenDB(db)
+}
+
+// Connect and Driver implement driver.Connector
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+func (db *fakeDB) versions() []int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	versions := []int{}
+	for v := range db.applied {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+type fakeConn struct {
+	db      *fakeDB
+	pending []func() // changes of the open transaction
+	inTx    bool
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.inTx, c.pending = true, nil
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for _, change := range c.pending {
+		change()
+	}
+	c.inTx, c.pending = false, nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.inTx, c.pending = false, nil
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db := c.db
+	var change func()
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_advisory_lock"):
+		change = func() {
+			db.locks++
+			db.maxLocks = max(db.maxLocks, db.locks)
+		}
+	case strings.HasPrefix(query, "SELECT pg_advisory_unlock"):
+		change = func() { db.locks-- }
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		version, name := int(args[1].Value.(int64)), args[2].Value.(string)
+		change = func() { db.applied[version] = name }
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+		version := int(args[1].Value.(int64))
+		change = func() { delete(db.applied, version) }
+	default:
+		if db.failOn != "" && strings.Contains(query, db.failOn) {
+			return nil, errors.New("syntax error")
+		}
+		change = func() { db.scripts = append(db.scripts, query) }
+	}
+
+	if c.inTx {
+		c.pending = append(c.pending, change)
+		return driver.RowsAffected(1), nil
+	}
+	db.mu.Lock()
+	change()
+	db.mu.Unlock()
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.HasPrefix(query, "SELECT version, applied_at FROM schema_migrations") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+	rows := &fakeRows{}
+	for _, v := range c.db.versions() {
+		rows.values = append(rows.values, []driver.Value{int64(v), c.db.at})
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version", "applied_at"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// testMigrations has three migrations; the last one can't be reverted
+var testMigrations = fstest.MapFS{
+	"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users")},
+	"0001_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+	"0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email")},
+	"0002_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email")},
+	"0003_backfill_names.up.sql": {Data: []byte("UPDATE users SET name")},
+	"README.md":                  {Data: []byte("not a migration")},
+	"nested/0009_ignored.up.sql": {Data: []byte("ignored")},
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int
+		wantErr  string
+	}{
+		{name: "ordered by version", fsys: testMigrations, versions: []int{1, 2, 3}},
+		{name: "empty", fsys: fstest.MapFS{}, versions: []int{}},
+		{
+			name:    "malformed file name",
+			fsys:    fstest.MapFS{"create_users.up.sql": {Data: []byte("x")}},
+			wantErr: "invalid migration file name",
+		},
+		{
+			name: "conflicting names",
+			fsys: fstest.MapFS{
+				"0001_create_users.up.sql":    {Data: []byte("x")},
+				"0001_create_people.down.sql": {Data: []byte("x")},
+			},
+			wantErr: "conflicting names",
+		},
+		{
+			name:    "down script only",
+			fsys:    fstest.MapFS{"0001_create_users.down.sql": {Data: []byte("x")}},
+			wantErr: "has no up script",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.fsys)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			versions := []int{}
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			if !reflect.DeepEqual(versions, tt.versions) {
+				t.Errorf("versions = %v, want %v", versions, tt.versions)
+			}
+		})
+	}
+
+	migrations, _ := Load(testMigrations)
+	if want := (Migration{Version: 2, Name: "add_email", Up: "ALTER TABLE users ADD email", Down: "ALTER TABLE users DROP email"}); migrations[1] != want {
+		t.Errorf("migration = %+v, want %+v", migrations[1], want)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	tests := []struct {
+		name string
+		// run applies the steps; a negative number reverts that many migrations
+		run         []int
+		failOn      string
+		wantErr     bool
+		wantApplied []int
+		wantScripts []string
+	}{
+		{
+			name:        "up applies every migration in order",
+			run:         []int{0},
+			wantApplied: []int{1, 2, 3},
+			wantScripts: []string{"CREATE TABLE users", "ALTER TABLE users ADD email", "UPDATE users SET name"},
+		},
+		{
+			name:        "up twice applies nothing new",
+			run:         []int{0, 0},
+			wantApplied: []int{1, 2, 3},
+			wantScripts: []string{"CREATE TABLE users", "ALTER TABLE users ADD email", "UPDATE users SET name"},
+		},
+		{
+			name:        "failed migration stops the run and isn't recorded",
+			run:         []int{0},
+			failOn:      "ADD email",
+			wantErr:     true,
+			wantApplied: []int{1},
+			wantScripts: []string{"CREATE TABLE users"},
+		},
+		{
+			name:        "migration without a down script can't be reverted",
+			run:         []int{0, -1},
+			wantErr:     true,
+			wantApplied: []int{1, 2, 3},
+			wantScripts: []string{"CREATE TABLE users", "ALTER TABLE users ADD email", "UPDATE users SET name"},
+		},
+		{
+			name:        "down reverts the latest applied migrations",
+			run:         []int{0, -1},
+			failOn:      "UPDATE users",
+			wantErr:     true, // the up run fails on 0003
+			wantApplied: []int{1},
+			wantScripts: []string{"CREATE TABLE users", "ALTER TABLE users ADD email", "ALTER TABLE users DROP email"},
+		},
+		{
+			name:        "down with more steps than applied migrations",
+			run:         []int{0, -5},
+			failOn:      "UPDATE users",
+			wantErr:     true,
+			wantApplied: []int{},
+			wantScripts: []string{"CREATE TABLE users", "ALTER TABLE users ADD email", "ALTER TABLE users DROP email", "DROP TABLE users"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB()
+			db.failOn = tt.failOn
+			m, err := New(db.open(), "user", testMigrations, log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var errs []error
+			for _, steps := range tt.run {
+				if steps == 0 {
+					errs = append(errs, m.Up(context.Background()))
+				} else {
+					errs = append(errs, m.Down(context.Background(), -steps))
+				}
+			}
+			if gotErr := errors.Join(errs...) != nil; gotErr != tt.wantErr {
+				t.Errorf("errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+			if got := db.versions(); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Errorf("applied = %v, want %v", got, tt.wantApplied)
+			}
+			if !reflect.DeepEqual(db.scripts, tt.wantScripts) {
+				t.Errorf("scripts = %q, want %q", db.scripts, tt.wantScripts)
+			}
+			if db.locks != 0 || db.maxLocks != 1 {
+				t.Errorf("advisory lock held %d times at the end, at most %d at once", db.locks, db.maxLocks)
+			}
+		})
+	}
+}
+
+func TestMigratorStatus(t *testing.T) {
+	db := newFakeDB()
+	db.applied[1] = "create_users"
+	m, err := New(db.open(), "user", testMigrations, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("got %d statuses, want 3", len(statuses))
+	}
+	for _, st := range statuses {
+		if applied := st.AppliedAt != nil; applied != (st.Version == 1) {
+			t.Errorf("migration %d applied = %v", st.Version, applied)
+		}
+	}
+	if !statuses[0].AppliedAt.Equal(db.at) {
+		t.Errorf("applied at %s, want %s", statuses[0].AppliedAt, db.at)
+	}
+}
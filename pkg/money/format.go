@@ -0,0 +1,112 @@
+package money
+
+import "strings"
+
+// DefaultLocale is used when a locale is empty or unknown
+const DefaultLocale = "en-US"
+
+// localeFormat describes how a locale writes currency amounts
+type localeFormat struct {
+	group       string // thousands separator
+	decimal     string // decimal separator
+	symbolFirst bool   // "$1.00" vs "1,00 €"
+	spaced      bool   // space between symbol and number
+}
+
+// locales covers the languages we send notifications in; regional variants
+// fall back to their language (e.g. "de-AT" → "de")
+var locales = map[string]localeFormat{
+	"en-US": {group: ",", decimal: ".", symbolFirst: true},
+	"en-GB": {group: ",", decimal: ".", symbolFirst: true},
+	"en":    {group: ",", decimal: ".", symbolFirst: true},
+	"de":    {group: ".", decimal: ",", spaced: true},
+	"de-CH": {group: "’", decimal: ".", symbolFirst: true, spaced: true},
+	"es":    {group: ".", decimal: ",", spaced: true},
+	"fr":    {group: " ", decimal: ",", spaced: true},
+	"it":    {group: ".", decimal: ",", spaced: true},
+	"nl":    {group: ".", decimal: ",", symbolFirst: true, spaced: true},
+	"pt":    {group: ".", decimal: ",", spaced: true},
+	"ro":    {group: ".", decimal: ",", spaced: true},
+	"ja":    {group: ",", decimal: ".", symbolFirst: true},
+}
+
+// symbols are the display symbols for common currencies; others use their ISO code
+var symbols = map[string]string{
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"USD": "$",
+}
+
+// Format renders the amount for display in locale, e.g. "$1,234.50" (en-US)
+// or "1.234,50 €" (de-DE)
+func (m Money) Format(locale string) string {
+	f := lookupLocale(locale)
+
+	decimal := m.Decimal()
+	negative := strings.HasPrefix(decimal, "-")
+	decimal = strings.TrimPrefix(decimal, "-")
+
+	whole, frac, hasFrac := strings.Cut(decimal, ".")
+	number := groupThousands(whole, f.group)
+	if hasFrac {
+		number += f.decimal + frac
+	}
+
+	symbol, ok := symbols[m.Currency]
+	spaced := f.spaced
+	if !ok {
+		symbol = m.Currency
+		spaced = true
+	}
+
+	sep := ""
+	if spaced {
+		sep = " "
+	}
+
+	var out string
+	if f.symbolFirst {
+		out = symbol + sep + number
+	} else {
+		out = number + sep + symbol
+	}
+	if negative {
+		out = "-" + out
+	}
+	return out
+}
+
+func lookupLocale(locale string) localeFormat {
+	locale = strings.ReplaceAll(locale, "_", "-")
+	if f, ok := locales[locale]; ok {
+		return f
+	}
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		if f, ok := locales[strings.ToLower(lang)]; ok {
+			return f
+		}
+	}
+	if f, ok := locales[strings.ToLower(locale)]; ok {
+		return f
+	}
+	return locales[DefaultLocale]
+}
+
+func groupThousands(digits, sep string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var b strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		b.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
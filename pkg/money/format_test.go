@@ -0,0 +1,34 @@
+package money
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		money  Money
+		locale string
+		want   string
+	}{
+		{"en-US dollars", Money{Amount: 123450, Currency: "USD"}, "en-US", "$1,234.50"},
+		{"de-DE euros", Money{Amount: 123450, Currency: "EUR"}, "de-DE", "1.234,50\u00a0€"},
+		{"regional locale falls back to its language", Money{Amount: 123450, Currency: "EUR"}, "de_AT", "1.234,50\u00a0€"},
+		{"de-CH has a locale of its own", Money{Amount: 123450, Currency: "CHF"}, "de-CH", "CHF\u00a01’234.50"},
+		{"fr groups with narrow spaces", Money{Amount: 123456789, Currency: "EUR"}, "fr", "1\u202f234\u202f567,89\u00a0€"},
+		{"nl puts the symbol first", Money{Amount: 995, Currency: "EUR"}, "nl", "€\u00a09,95"},
+		{"currency without a decimal part", Money{Amount: 1234, Currency: "JPY"}, "ja", "¥1,234"},
+		{"currency without a symbol", Money{Amount: 1000, Currency: "SEK"}, "en", "SEK\u00a010.00"},
+		{"negative amount", Money{Amount: -500, Currency: "USD"}, "en-US", "-$5.00"},
+		{"small amount", Money{Amount: 5, Currency: "GBP"}, "en-GB", "£0.05"},
+		{"exactly three digits aren't grouped", Money{Amount: 99900, Currency: "USD"}, "en-US", "$999.00"},
+		{"empty locale", Money{Amount: 100000, Currency: "USD"}, "", "$1,000.00"},
+		{"unknown locale", Money{Amount: 100000, Currency: "EUR"}, "xx-YY", "€1,000.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.money.Format(tt.locale); got != tt.want {
+				t.Errorf("%v.Format(%q) = %q, want %q", tt.money, tt.locale, got, tt.want)
+			}
+		})
+	}
+}
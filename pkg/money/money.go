@@ -0,0 +1,163 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnknownCurrency is returned for codes outside the supported ISO 4217 set
+	ErrUnknownCurrency = errors.New("unknown currency")
+	// ErrInvalidAmount is returned for malformed decimal amounts or excess precision
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrCurrencyMismatch is returned when combining amounts in different currencies
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// Money is an exact amount in the minor unit of a currency (e.g. cents for USD).
+// Never use float64 for money: 0.1 + 0.2 != 0.3.
+type Money struct {
+	Amount   int64  `json:"amount"`   // minor units
+	Currency string `json:"currency"` // ISO 4217 code
+}
+
+// exponents is the number of minor-unit digits per supported ISO 4217 currency
+var exponents = map[string]int{
+	"AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "CZK": 2,
+	"DKK": 2, "EUR": 2, "GBP": 2, "HUF": 2, "INR": 2, "JPY": 0, "KRW": 0,
+	"KWD": 3, "MXN": 2, "NOK": 2, "NZD": 2, "PLN": 2, "RON": 2, "SEK": 2,
+	"SGD": 2, "USD": 2, "ZAR": 2,
+}
+
+// New creates an amount of minor units in currency
+func New(amount int64, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	if _, ok := exponents[currency]; !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Parse converts a decimal string such as "1234.50" into Money. It rejects more
+// fractional digits than the currency allows instead of silently rounding.
+func Parse(decimal, currency string) (Money, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s := strings.TrimSpace(decimal)
+	// At most one sign character
+	negative := strings.HasPrefix(s, "-")
+	if negative || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, decimal)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	// Trailing zeros beyond the exponent are harmless (NUMERIC columns may return them)
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > exp {
+		return Money{}, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidAmount, decimal, exp)
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	if !isDigits(whole) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, decimal)
+	}
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, decimal)
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}, nil
+}
+
+// Exponent returns the number of minor-unit digits of currency
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[strings.ToUpper(currency)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return exp, nil
+}
+
+// Decimal renders the amount as a plain decimal string ("1234.50"), suitable for NUMERIC columns
+func (m Money) Decimal() string {
+	exp := exponents[m.Currency]
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.FormatInt(amount, 10)
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// String renders the amount with its currency code, e.g. "1234.50 EUR"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Add returns m + other; both must share a currency
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Mul returns m multiplied by n, e.g. a unit price times a quantity
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// Rate returns basisPoints/10000 of m (e.g. 1900 for 19% VAT), rounded half away from zero
+func (m Money) Rate(basisPoints int64) Money {
+	product := m.Amount * basisPoints
+	q, r := product/10000, product%10000
+	if r >= 5000 {
+		q++
+	} else if r <= -5000 {
+		q--
+	}
+	return Money{Amount: q, Currency: m.Currency}
+}
+
+// Zero returns an empty amount in currency
+func Zero(currency string) Money {
+	return Money{Currency: strings.ToUpper(currency)}
+}
+
+// IsPositive reports whether the amount is greater than zero
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		decimal  string
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{decimal: "1234.50", currency: "EUR", want: Money{Amount: 123450, Currency: "EUR"}},
+		{decimal: "0.1", currency: "usd", want: Money{Amount: 10, Currency: "USD"}},
+		{decimal: ".5", currency: "EUR", want: Money{Amount: 50, Currency: "EUR"}},
+		{decimal: "7.", currency: "EUR", want: Money{Amount: 700, Currency: "EUR"}},
+		{decimal: " 42 ", currency: "EUR", want: Money{Amount: 4200, Currency: "EUR"}},
+		{decimal: "-3.07", currency: "EUR", want: Money{Amount: -307, Currency: "EUR"}},
+		{decimal: "+3.07", currency: "EUR", want: Money{Amount: 307, Currency: "EUR"}},
+		{decimal: "19.9000", currency: "EUR", want: Money{Amount: 1990, Currency: "EUR"}},
+		{decimal: "1500", currency: "JPY", want: Money{Amount: 1500, Currency: "JPY"}},
+		{decimal: "1.5", currency: "JPY", wantErr: ErrInvalidAmount},
+		{decimal: "1.234", currency: "BHD", want: Money{Amount: 1234, Currency: "BHD"}},
+		{decimal: "0.001", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: ".", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "-", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "--1", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "-+5", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "+-5", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "++5", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "+", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "1,50", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "1e3", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "99999999999999999999", currency: "EUR", wantErr: ErrInvalidAmount},
+		{decimal: "1.00", currency: "XYZ", wantErr: ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.decimal+" "+tt.currency, func(t *testing.T) {
+			got, err := Parse(tt.decimal, tt.currency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%q, %q) error = %v, want %v", tt.decimal, tt.currency, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q, %q) = %+v, want %+v", tt.decimal, tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{Amount: 123450, Currency: "EUR"}, "1234.50"},
+		{Money{Amount: 5, Currency: "EUR"}, "0.05"},
+		{Money{Amount: 0, Currency: "USD"}, "0.00"},
+		{Money{Amount: -5, Currency: "EUR"}, "-0.05"},
+		{Money{Amount: -123450, Currency: "EUR"}, "-1234.50"},
+		{Money{Amount: 1500, Currency: "JPY"}, "1500"},
+		{Money{Amount: 1, Currency: "KWD"}, "0.001"},
+	}
+
+	for _, tt := range tests {
+		got := tt.money.Decimal()
+		if got != tt.want {
+			t.Errorf("%+v.Decimal() = %q, want %q", tt.money, got, tt.want)
+		}
+		// Decimal and Parse round-trip
+		if back, err := Parse(got, tt.money.Currency); err != nil || back != tt.money {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", got, back, err, tt.money)
+		}
+	}
+	if got, want := (Money{Amount: 990, Currency: "EUR"}).String(), "9.90 EUR"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	eur := func(amount int64) Money { return Money{Amount: amount, Currency: "EUR"} }
+
+	addTests := []struct {
+		a, b    Money
+		want    Money
+		wantErr error
+	}{
+		{a: eur(150), b: eur(250), want: eur(400)},
+		{a: eur(150), b: eur(-200), want: eur(-50)},
+		{a: eur(150), b: Zero("eur"), want: eur(150)},
+		{a: eur(150), b: Money{Amount: 150, Currency: "USD"}, wantErr: ErrCurrencyMismatch},
+	}
+	for _, tt := range addTests {
+		got, err := tt.a.Add(tt.b)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("%v.Add(%v) = %v, %v, want %v, %v", tt.a, tt.b, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	mulTests := []struct {
+		m    Money
+		n    int64
+		want Money
+	}{
+		{eur(1250), 3, eur(3750)},
+		{eur(1250), 0, eur(0)},
+		{eur(-100), 2, eur(-200)},
+	}
+	for _, tt := range mulTests {
+		if got := tt.m.Mul(tt.n); got != tt.want {
+			t.Errorf("%v.Mul(%d) = %v, want %v", tt.m, tt.n, got, tt.want)
+		}
+	}
+
+	rateTests := []struct {
+		name        string
+		m           Money
+		basisPoints int64
+		want        Money
+	}{
+		{"19% VAT", eur(1000), 1900, eur(190)},
+		{"rounds down below half", eur(2), 1900, eur(0)},
+		{"rounds half away from zero", eur(5), 1000, eur(1)},
+		{"rounds up above half", eur(3), 1900, eur(1)},
+		{"negative rounds half away from zero", eur(-5), 1000, eur(-1)},
+		{"negative rounds towards zero below half", eur(-2), 1900, eur(0)},
+		{"zero rate", eur(1000), 0, eur(0)},
+	}
+	for _, tt := range rateTests {
+		if got := tt.m.Rate(tt.basisPoints); got != tt.want {
+			t.Errorf("%s: %v.Rate(%d) = %v, want %v", tt.name, tt.m, tt.basisPoints, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{100, "eur", Money{Amount: 100, Currency: "EUR"}, nil},
+		{0, "JPY", Money{Currency: "JPY"}, nil},
+		{100, "EURO", Money{}, ErrUnknownCurrency},
+		{100, "", Money{}, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		got, err := New(tt.amount, tt.currency)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("New(%d, %q) = %+v, %v, want %+v, %v", tt.amount, tt.currency, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/alex-necsoiu/event-driven/pkg/eventstore"
+)
+
+// ErrUsage is returned by RunCommand for malformed arguments
+var ErrUsage = errors.New("usage: project [status | rebuild <name | all>]")
+
+// RunCommand implements the `project` subcommand shared by service binaries:
+//
+//	project status                 list projections and their checkpoints (default)
+//	project rebuild <name | all>   empty a projection and replay the store into it
+func RunCommand(ctx context.Context, runners []*Runner, store eventstore.Store, args []string, out io.Writer) error {
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "status":
+		for _, r := range runners {
+			position, err := r.Checkpoint(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%-30s  %d\n", r.projection.Name(), position)
+		}
+		return nil
+
+	case "rebuild":
+		if len(args) != 2 {
+			return ErrUsage
+		}
+		matched := false
+		for _, r := range runners {
+			if args[1] != "all" && args[1] != r.projection.Name() {
+				continue
+			}
+			matched = true
+			n, err := r.Rebuild(ctx, store)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%-30s  replayed %d events\n", r.projection.Name(), n)
+		}
+		if !matched {
+			return fmt.Errorf("unknown projection %q", args[1])
+		}
+		return nil
+
+	default:
+		return ErrUsage
+	}
+}
@@ -0,0 +1,241 @@
+package projection
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-necsoiu/event-driven/pkg/eventstore"
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// batchSize bounds how many store events are applied per transaction
+const batchSize = 100
+
+// Event is the input of a projection, read from an event store or the event bus
+type Event struct {
+	Position   int64 // global position in the store; 0 for events from the bus
+	StreamID   string
+	Type       string
+	Data       json.RawMessage
+	RecordedAt time.Time
+}
+
+// Projection maintains read tables from events
+type Projection interface {
+	// Name identifies the projection's checkpoint
+	Name() string
+	// EventTypes lists the events the projection handles
+	EventTypes() []string
+	// Handle applies one event within tx. Events from the bus may be
+	// redelivered, so handlers must be idempotent.
+	Handle(ctx context.Context, tx *sql.Tx, e Event) error
+	// Reset empties the read tables before a rebuild
+	Reset(ctx context.Context, tx *sql.Tx) error
+}
+
+// Runner feeds a Projection. Events read from a store are applied in the same
+// transaction as the projection's checkpoint, in the projection_checkpoints
+// table, so each is applied exactly once even across restarts and replicas.
+type Runner struct {
+	db         *sql.DB
+	projection Projection
+	handles    map[string]bool
+	logger     *log.Logger
+}
+
+// NewRunner creates a new Runner. The projection_checkpoints table is created
+// by the owning service's migrations.
+func NewRunner(db *sql.DB, projection Projection, logger *log.Logger) *Runner {
+	handles := make(map[string]bool)
+	for _, t := range projection.EventTypes() {
+		handles[t] = true
+	}
+	return &Runner{db: db, projection: projection, handles: handles, logger: logger}
+}
+
+// CatchUp applies the store's events after the checkpoint and returns how many
+// were read; events of other types only advance the checkpoint
+func (r *Runner) CatchUp(ctx context.Context, store eventstore.Store) (int, error) {
+	total := 0
+	for {
+		n, err := r.applyBatch(ctx, store)
+		total += n
+		if err != nil || n < batchSize || ctx.Err() != nil {
+			return total, err
+		}
+	}
+}
+
+// applyBatch applies one batch of store events and its checkpoint in one transaction
+func (r *Runner) applyBatch(ctx context.Context, store eventstore.Store) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locking the checkpoint serializes runners of the same projection
+	position, err := r.lockCheckpoint(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := store.ReadAll(ctx, position, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read events: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	for _, e := range events {
+		if !r.handles[e.Type] {
+			continue
+		}
+		event := Event{Position: e.Position, StreamID: e.StreamID, Type: e.Type, Data: e.Data, RecordedAt: e.RecordedAt}
+		if err := r.projection.Handle(ctx, tx, event); err != nil {
+			return 0, fmt.Errorf("failed to project %s event at position %d: %w", e.Type, e.Position, err)
+		}
+	}
+
+	if err := r.saveCheckpoint(ctx, tx, events[len(events)-1].Position); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// Tail catches up with the store every interval until ctx is cancelled
+func (r *Runner) Tail(ctx context.Context, store eventstore.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.CatchUp(ctx, store); err != nil {
+				r.logger.Printf("Projection %s failed: %v", r.projection.Name(), err)
+			}
+		}
+	}
+}
+
+// Subscribe applies live events from the bus as they arrive. Bus events carry
+// no position, so the checkpoint is not used and the projection can only be
+// rebuilt from a store.
+func (r *Runner) Subscribe(subscriber messaging.Subscriber) error {
+	for _, eventType := range r.projection.EventTypes() {
+		if err := subscriber.Subscribe(eventType, r.handleMessage); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) handleMessage(event messaging.Event) {
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		r.logger.Printf("Failed to encode %s payload for projection %s: %v", event.EventType, r.projection.Name(), err)
+		return
+	}
+
+	recordedAt, err := time.Parse(time.RFC3339, event.Timestamp)
+	if err != nil {
+		recordedAt = time.Now().UTC()
+	}
+
+	e := Event{Type: event.EventType, Data: data, RecordedAt: recordedAt}
+	if err := r.apply(context.Background(), e); err != nil {
+		r.logger.Printf("Projection %s failed on %s event: %v", r.projection.Name(), event.EventType, err)
+	}
+}
+
+func (r *Runner) apply(ctx context.Context, e Event) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := r.projection.Handle(ctx, tx, e); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Rebuild empties the read tables and replays the store from the beginning,
+// returning how many events were read
+func (r *Runner) Rebuild(ctx context.Context, store eventstore.Store) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := r.lockCheckpoint(ctx, tx); err != nil {
+		return 0, err
+	}
+	if err := r.projection.Reset(ctx, tx); err != nil {
+		return 0, fmt.Errorf("failed to reset projection %s: %w", r.projection.Name(), err)
+	}
+	if err := r.saveCheckpoint(ctx, tx, 0); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	r.logger.Printf("Rebuilding projection %s", r.projection.Name())
+	return r.CatchUp(ctx, store)
+}
+
+// Checkpoint returns the store position the projection has applied up to
+func (r *Runner) Checkpoint(ctx context.Context) (int64, error) {
+	var position int64
+	err := r.db.QueryRowContext(ctx,
+		"SELECT position FROM projection_checkpoints WHERE name = $1",
+		r.projection.Name(),
+	).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return position, err
+}
+
+// lockCheckpoint returns the checkpoint, holding its row lock until tx ends
+func (r *Runner) lockCheckpoint(ctx context.Context, tx *sql.Tx) (int64, error) {
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO projection_checkpoints (name, position) VALUES ($1, 0) ON CONFLICT (name) DO NOTHING",
+		r.projection.Name(),
+	); err != nil {
+		return 0, fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+
+	var position int64
+	if err := tx.QueryRowContext(ctx,
+		"SELECT position FROM projection_checkpoints WHERE name = $1 FOR UPDATE",
+		r.projection.Name(),
+	).Scan(&position); err != nil {
+		return 0, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	return position, nil
+}
+
+func (r *Runner) saveCheckpoint(ctx context.Context, tx *sql.Tx, position int64) error {
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE projection_checkpoints SET position = $2, updated_at = now() WHERE name = $1",
+		r.projection.Name(), position,
+	); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
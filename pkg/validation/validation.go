@@ -0,0 +1,154 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxEmailLength is the longest address SMTP can deliver to (RFC 5321)
+const MaxEmailLength = 254
+
+// ErrInvalidEmail is returned by NormalizeEmail for addresses that can't be used
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// Violations collects the field violations of one request
+type Violations struct {
+	fields []*errdetails.BadRequest_FieldViolation
+}
+
+// Add records a violation of field, a dotted path such as "items[2].quantity"
+func (v *Violations) Add(field, format string, args ...interface{}) {
+	v.fields = append(v.fields, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// Required records a violation if value is empty or only whitespace
+func (v *Violations) Required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, "is required")
+		return false
+	}
+	return true
+}
+
+// ID records a violation if value is not a positive integer, the format of
+// the IDs the services allocate
+func (v *Violations) ID(field, value string) bool {
+	if !v.Required(field, value) {
+		return false
+	}
+	if id, err := strconv.ParseInt(value, 10, 64); err != nil || id <= 0 {
+		v.Add(field, "must be a positive integer ID")
+		return false
+	}
+	return true
+}
+
+// Length records a violation if value has more than max characters or
+// contains control characters
+func (v *Violations) Length(field, value string, max int) bool {
+	switch {
+	case utf8.RuneCountInString(value) > max:
+		v.Add(field, "must be at most %d characters", max)
+	case strings.IndexFunc(value, unicode.IsControl) >= 0:
+		v.Add(field, "must not contain control characters")
+	default:
+		return true
+	}
+	return false
+}
+
+// Range records a violation if value is outside [min, max]
+func (v *Violations) Range(field string, value, min, max int64) bool {
+	if value < min || value > max {
+		v.Add(field, "must be between %d and %d, got %d", min, max, value)
+		return false
+	}
+	return true
+}
+
+// Email normalizes *email in place and records a violation if it is not a
+// usable address
+func (v *Violations) Email(field string, email *string) bool {
+	if !v.Required(field, *email) {
+		return false
+	}
+	normalized, err := NormalizeEmail(*email)
+	if err != nil {
+		v.Add(field, "must be a valid email address")
+		return false
+	}
+	*email = normalized
+	return true
+}
+
+// Empty reports whether no violation was recorded
+func (v *Violations) Empty() bool {
+	return len(v.fields) == 0
+}
+
+// Err returns nil without violations, or an InvalidArgument status carrying
+// them as a BadRequest detail
+func (v *Violations) Err() error {
+	if v.Empty() {
+		return nil
+	}
+
+	descriptions := make([]string, 0, len(v.fields))
+	for _, f := range v.fields {
+		descriptions = append(descriptions, f.Field+" "+f.Description)
+	}
+	st := status.New(codes.InvalidArgument, "invalid request: "+strings.Join(descriptions, "; "))
+
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: v.fields})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// FieldViolations returns the BadRequest field violations carried by a gRPC error
+func FieldViolations(err error) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, detail := range status.Convert(err).Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			violations = append(violations, br.FieldViolations...)
+		}
+	}
+	return violations
+}
+
+// NormalizeEmail trims and lower-cases a bare address such as
+// "Jane@Example.com" and checks its syntax. Display names ("Jane <jane@x.io>")
+// and addresses without a dotted domain are rejected.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", fmt.Errorf("%w: is required", ErrInvalidEmail)
+	}
+	if len(email) > MaxEmailLength {
+		return "", fmt.Errorf("%w: must be at most %d characters", ErrInvalidEmail, MaxEmailLength)
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", fmt.Errorf("%w: %q", ErrInvalidEmail, email)
+	}
+
+	_, domain, _ := strings.Cut(email, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fmt.Errorf("%w: %q has no valid domain", ErrInvalidEmail, email)
+	}
+	return email, nil
+}
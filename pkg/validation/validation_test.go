@@ -0,0 +1,131 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "jane@example.com", want: "jane@example.com"},
+		{in: "  Jane@Example.COM ", want: "jane@example.com"},
+		{in: "jane+orders@mail.example.co.uk", want: "jane+orders@mail.example.co.uk"},
+		{in: "", wantErr: true},
+		{in: "   ", wantErr: true},
+		{in: "jane", wantErr: true},
+		{in: "jane@localhost", wantErr: true},
+		{in: "jane@.example.com", wantErr: true},
+		{in: "jane@example.com.", wantErr: true},
+		{in: "Jane <jane@example.com>", wantErr: true},
+		{in: "jane@example.com, joe@example.com", wantErr: true},
+		{in: strings.Repeat("j", MaxEmailLength) + "@example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidEmail) {
+				t.Errorf("NormalizeEmail(%q) = %q, %v, want ErrInvalidEmail", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestViolations(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(v *Violations) bool
+		want  bool
+		field string // violated field, if any
+	}{
+		{name: "required", check: func(v *Violations) bool { return v.Required("name", "Ada") }, want: true},
+		{name: "required blank", check: func(v *Violations) bool { return v.Required("name", " \t") }, field: "name"},
+		{name: "id", check: func(v *Violations) bool { return v.ID("user_id", "42") }, want: true},
+		{name: "id missing", check: func(v *Violations) bool { return v.ID("user_id", "") }, field: "user_id"},
+		{name: "id not a number", check: func(v *Violations) bool { return v.ID("user_id", "abc") }, field: "user_id"},
+		{name: "id zero", check: func(v *Violations) bool { return v.ID("user_id", "0") }, field: "user_id"},
+		{name: "id negative", check: func(v *Violations) bool { return v.ID("user_id", "-3") }, field: "user_id"},
+		{name: "length counts characters", check: func(v *Violations) bool { return v.Length("name", "Zoë", 3) }, want: true},
+		{name: "length too long", check: func(v *Violations) bool { return v.Length("name", "Ada Lovelace", 3) }, field: "name"},
+		{name: "length control characters", check: func(v *Violations) bool { return v.Length("name", "Ada\n", 10) }, field: "name"},
+		{name: "range bounds are inclusive", check: func(v *Violations) bool { return v.Range("quantity", 100, 1, 100) }, want: true},
+		{name: "range below", check: func(v *Violations) bool { return v.Range("quantity", 0, 1, 100) }, field: "quantity"},
+		{name: "range above", check: func(v *Violations) bool { return v.Range("quantity", 101, 1, 100) }, field: "quantity"},
+		{
+			name: "email is normalized in place",
+			check: func(v *Violations) bool {
+				email := " Ada@Example.com"
+				return v.Email("email", &email) && email == "ada@example.com"
+			},
+			want: true,
+		},
+		{
+			name: "invalid email is left alone",
+			check: func(v *Violations) bool {
+				email := "Ada"
+				return v.Email("email", &email) || email != "Ada"
+			},
+			field: "email",
+		},
+		{name: "email missing", check: func(v *Violations) bool { email := ""; return v.Email("email", &email) }, field: "email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Violations
+			if got := tt.check(&v); got != tt.want {
+				t.Errorf("check = %v, want %v", got, tt.want)
+			}
+
+			var fields []string
+			for _, f := range FieldViolations(v.Err()) {
+				fields = append(fields, f.Field)
+			}
+			var want []string
+			if tt.field != "" {
+				want = []string{tt.field}
+			}
+			if !reflect.DeepEqual(fields, want) {
+				t.Errorf("violated fields = %v, want %v", fields, want)
+			}
+		})
+	}
+}
+
+func TestViolationsErr(t *testing.T) {
+	var v Violations
+	if err := v.Err(); err != nil || !v.Empty() {
+		t.Fatalf("Err() without violations = %v", err)
+	}
+
+	v.Add("items[0].quantity", "must be between %d and %d, got %d", 1, 100, 0)
+	v.Required("user_id", "")
+	err := v.Err()
+
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Err() code = %s, want InvalidArgument", status.Code(err))
+	}
+	if msg := status.Convert(err).Message(); msg != "invalid request: items[0].quantity must be between 1 and 100, got 0; user_id is required" {
+		t.Errorf("Err() message = %q", msg)
+	}
+	violations := FieldViolations(err)
+	if len(violations) != 2 || violations[0].Field != "items[0].quantity" || violations[1].Description != "is required" {
+		t.Errorf("FieldViolations() = %v", violations)
+	}
+	if FieldViolations(errors.New("plain")) != nil {
+		t.Error("FieldViolations() of a plain error should be empty")
+	}
+}
@@ -0,0 +1,85 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alex-necsoiu/event-driven/pkg/messaging"
+)
+
+// Bus is an in-memory event bus implementing messaging.Publisher and
+// messaging.Subscriber. Publish records the event and calls every handler of
+// its subject synchronously, so tests see the full chain of reactions by the
+// time Publish returns.
+type Bus struct {
+	mu        sync.Mutex
+	handlers  map[string][]func(messaging.Event)
+	published []messaging.Event
+	failures  map[string]error
+}
+
+// NewBus creates an empty Bus
+func NewBus() *Bus {
+	return &Bus{
+		handlers: make(map[string][]func(messaging.Event)),
+		failures: make(map[string]error),
+	}
+}
+
+// Publish records event and delivers it to the subscribers of subject
+func (b *Bus) Publish(subject string, event messaging.Event) error {
+	b.mu.Lock()
+	if err := b.failures[subject]; err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	b.published = append(b.published, event)
+	handlers := append([]func(messaging.Event){}, b.handlers[subject]...)
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+	return nil
+}
+
+// Subscribe registers handler for subject
+func (b *Bus) Subscribe(subject string, handler func(messaging.Event)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[subject] = append(b.handlers[subject], handler)
+	return nil
+}
+
+// Fail makes publishing to subject return err; a nil err lets it succeed again
+func (b *Bus) Fail(subject string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.failures, subject)
+		return
+	}
+	b.failures[subject] = err
+}
+
+// Published returns the events published so far
+func (b *Bus) Published() []messaging.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]messaging.Event(nil), b.published...)
+}
+
+// PublishedTypes returns the event types published so far, in order
+func (b *Bus) PublishedTypes() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	types := make([]string, len(b.published))
+	for i, event := range b.published {
+		types[i] = event.EventType
+	}
+	return types
+}
+
+func (b *Bus) Flush(ctx context.Context) error { return nil }
+func (b *Bus) Drain(ctx context.Context) error { return nil }
+func (b *Bus) Close() error                    { return nil }
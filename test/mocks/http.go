@@ -0,0 +1,78 @@
+package mocks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// HTTPRequest is one request received by an HTTPRecorder
+type HTTPRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// HTTPRecorder is a local HTTP server standing in for SMS providers and
+// webhook receivers. It records every request and answers with a configurable
+// status and body.
+type HTTPRecorder struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests []HTTPRequest
+	status   int
+	body     string
+}
+
+// NewHTTPRecorder starts a recorder answering 200 with an empty JSON object
+func NewHTTPRecorder() *HTTPRecorder {
+	r := &HTTPRecorder{status: http.StatusOK, body: "{}"}
+	r.server = httptest.NewServer(http.HandlerFunc(r.handle))
+	return r
+}
+
+// URL returns the base URL of the recorder
+func (r *HTTPRecorder) URL() string {
+	return r.server.URL
+}
+
+// Respond sets the status and body of subsequent responses
+func (r *HTTPRecorder) Respond(status int, body string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+	r.body = body
+}
+
+// Requests returns the requests received so far
+func (r *HTTPRecorder) Requests() []HTTPRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]HTTPRequest(nil), r.requests...)
+}
+
+// Close shuts the recorder down
+func (r *HTTPRecorder) Close() {
+	r.server.Close()
+}
+
+func (r *HTTPRecorder) handle(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	r.requests = append(r.requests, HTTPRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Header: req.Header.Clone(),
+		Body:   body,
+	})
+	status, respBody := r.status, r.body
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, respBody)
+}
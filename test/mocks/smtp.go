@@ -0,0 +1,159 @@
+// Package mocks provides local stand-ins for external providers, for tests
+// and local runs that must not reach real services.
+package mocks
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// SMTPMessage is one message accepted by the fake SMTP server
+type SMTPMessage struct {
+	From string
+	To   []string
+	// Data is the raw message with headers, as sent after DATA
+	Data string
+}
+
+// SMTPServer is a minimal SMTP server on a loopback port that accepts every
+// message and records it. It doesn't offer STARTTLS or AUTH.
+type SMTPServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []SMTPMessage
+	// reject, when set, is returned to MAIL FROM instead of accepting the message
+	reject string
+
+	wg sync.WaitGroup
+}
+
+// NewSMTPServer starts a fake SMTP server; point SMTP_HOST and SMTP_PORT at Addr
+func NewSMTPServer() (*SMTPServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SMTPServer{listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on
+func (s *SMTPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Messages returns the messages accepted so far
+func (s *SMTPServer) Messages() []SMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SMTPMessage(nil), s.messages...)
+}
+
+// Reject makes the server refuse new messages with reply, e.g.
+// "421 Service not available"; an empty reply accepts them again
+func (s *SMTPServer) Reject(reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = reply
+}
+
+// Close stops the server and waits for open sessions to end
+func (s *SMTPServer) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *SMTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.session(conn)
+		}()
+	}
+}
+
+// session speaks just enough SMTP for net/smtp clients
+func (s *SMTPServer) session(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(line string) bool {
+		return text.PrintfLine("%s", line) == nil
+	}
+
+	if !reply("220 localhost fake SMTP ready") {
+		return
+	}
+
+	var msg SMTPMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			if !reply("250-localhost") || !reply("250 8BITMIME") {
+				return
+			}
+		case "HELO", "NOOP":
+			reply("250 OK")
+		case "RSET":
+			msg = SMTPMessage{}
+			reply("250 OK")
+		case "MAIL":
+			s.mu.Lock()
+			rejection := s.reject
+			s.mu.Unlock()
+			if rejection != "" {
+				reply(rejection)
+				continue
+			}
+			msg = SMTPMessage{From: addressOf(arg)}
+			reply("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, addressOf(arg))
+			reply("250 OK")
+		case "DATA":
+			if !reply("354 End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = SMTPMessage{}
+			reply("250 OK: queued")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// addressOf extracts the address from "FROM:<a@b>" or "TO:<a@b>"
+func addressOf(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}